@@ -1,21 +1,46 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strings"
 	"syscall"
 
 	"kun-gateway/pkg/controlplane"
+	"kun-gateway/pkg/kunclient"
 
 	"github.com/sirupsen/logrus"
 )
 
 var (
 	port         = flag.Int("port", 9090, "控制面API服务器监听端口")
-	dataplaneURL = flag.String("dataplane-url", "http://localhost:8080", "数据面API地址")
+	grpcPort     = flag.Int("grpc-port", 9091, "配置订阅gRPC服务器监听端口，数据面通过 --controlplane-addr 订阅配置，为0时不启动")
+	grpcTLSCert  = flag.String("grpc-tls-cert", "", "配置订阅gRPC服务的TLS证书文件，与 --grpc-tls-key 一起设置后使用TLS")
+	grpcTLSKey   = flag.String("grpc-tls-key", "", "配置订阅gRPC服务的TLS私钥文件")
+	grpcAuth     = flag.Bool("grpc-auth", true, "是否通过TokenReview校验数据面订阅配置时携带的ServiceAccount令牌")
+	dataplaneURL = flag.String("dataplane-url", "", "数据面API地址，多个用逗号分隔；为空时按 --dataplane-selector 发现数据面Pod并推送到每个Pod")
 	logLevel     = flag.String("log-level", "info", "日志级别")
+	routeStore   = flag.String("route-store", controlplane.RouteStoreFile, "路由存储方式：file、configmap 或 crd")
+	routeFile    = flag.String("route-store-path", "/var/lib/kun-gateway/routes.json", "file存储方式下的路由文件路径")
+	routeCM      = flag.String("route-configmap", "kube-system/kun-gateway-routes", "configmap存储方式下的ConfigMap，格式: namespace/name")
+	routeNS      = flag.String("route-namespace", "kube-system", "crd存储方式下KunRoute、KunCertificate、KunPolicy所在的命名空间")
+	ingressClass = flag.String("ingress-class", controlplane.DefaultIngressClass, "处理的IngressClass名称，为空时不处理Ingress")
+	gatewayAPI   = flag.Bool("gateway-api", true, "是否处理Gateway API资源（GatewayClass、Gateway、HTTPRoute、GRPCRoute）")
+	svcAnnot     = flag.Bool("service-annotations", true, "是否为带有 kun-gateway.io/host 注解的Service生成路由")
+	gatewayHTTP  = flag.Int("gateway-http-port", 80, "数据面HTTP端口，Gateway中HTTP监听器的端口必须与之一致")
+	gatewayHTTPS = flag.Int("gateway-https-port", 443, "数据面HTTPS端口，Gateway中HTTPS监听器的端口必须与之一致")
+	dpNamespace  = flag.String("dataplane-namespace", "kube-system", "数据面Pod所在的命名空间，用于回写Ingress和Gateway状态")
+	dpSelector   = flag.String("dataplane-selector", "app=kun-gateway,component=dataplane", "数据面Pod的标签选择器，用于发现数据面实例、回写Ingress和Gateway状态")
+	dpAPIPort    = flag.Int("dataplane-api-port", controlplane.DefaultDataPlaneAPIPort, "数据面Pod的API端口")
+	cfgHistory   = flag.Int("config-history", controlplane.DefaultConfigHistory, "保留的历史配置版本数，可回滚到其中的任意版本")
+	watchNS      = flag.String("watch-namespaces", "", "服务发现监听的命名空间，多个用逗号分隔，为空时监听所有命名空间")
+	nsSelector   = flag.String("namespace-selector", "", "服务发现的命名空间标签选择器，如 team=a，需要读取namespaces的集群权限")
+	svcSelector  = flag.String("service-selector", "", "服务发现的Service标签选择器，如 kun-gateway.io/expose=true")
+	trusted      = flag.String("trusted-proxies", "", "可信的认证代理网段，逗号分隔，只有来自这些地址的X-Remote-User、X-Forwarded-User和X-Forwarded-For会被采用")
 )
 
 func main() {
@@ -37,7 +62,16 @@ func main() {
 	log.Info("启动K8s流量网关控制面...")
 
 	// 创建K8s服务发现
-	k8sDiscovery, err := controlplane.NewK8sDiscovery(log)
+	scope := controlplane.DiscoveryScope{
+		NamespaceSelector: *nsSelector,
+		ServiceSelector:   *svcSelector,
+	}
+	for _, namespace := range strings.Split(*watchNS, ",") {
+		if namespace = strings.TrimSpace(namespace); namespace != "" {
+			scope.Namespaces = append(scope.Namespaces, namespace)
+		}
+	}
+	k8sDiscovery, err := controlplane.NewK8sDiscovery(scope, log)
 	if err != nil {
 		log.Fatalf("创建K8s服务发现失败: %v", err)
 	}
@@ -47,8 +81,43 @@ func main() {
 		log.Fatalf("启动K8s服务发现失败: %v", err)
 	}
 
-	// 创建数据面客户端
-	dataplaneClient := controlplane.NewDataPlaneClient(*dataplaneURL, log)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// 创建数据面客户端，发现所有数据面实例
+	discovery := controlplane.DataPlaneDiscovery{
+		Namespace: *dpNamespace,
+		Selector:  *dpSelector,
+		APIPort:   *dpAPIPort,
+	}
+	for _, dataplaneURL := range strings.Split(*dataplaneURL, ",") {
+		if dataplaneURL = strings.TrimSpace(dataplaneURL); dataplaneURL != "" {
+			discovery.URLs = append(discovery.URLs, dataplaneURL)
+		}
+	}
+	dataplaneClient := controlplane.NewDataPlaneClient(k8sDiscovery.Client(), discovery, log)
+	dataplaneClient.SetHistoryLimit(*cfgHistory)
+	if err := dataplaneClient.Start(ctx); err != nil {
+		log.Fatalf("启动数据面发现失败: %v", err)
+	}
+
+	// 启动配置订阅gRPC服务器
+	var configServer *controlplane.ConfigServer
+	if *grpcPort > 0 {
+		configServer, err = controlplane.NewConfigServer(dataplaneClient, controlplane.ConfigServerOptions{
+			TLSCertFile:  *grpcTLSCert,
+			TLSKeyFile:   *grpcTLSKey,
+			Authenticate: *grpcAuth,
+		}, log)
+		if err != nil {
+			log.Fatalf("创建配置订阅gRPC服务器失败: %v", err)
+		}
+		go func() {
+			if err := configServer.Start(fmt.Sprintf(":%d", *grpcPort)); err != nil {
+				log.Fatalf("启动配置订阅gRPC服务器失败: %v", err)
+			}
+		}()
+	}
 
 	// 检查数据面连接
 	if err := dataplaneClient.HealthCheck(); err != nil {
@@ -57,8 +126,82 @@ func main() {
 		log.Info("数据面连接正常")
 	}
 
+	// 创建路由存储，回滚状态和历史配置版本保存在路由存储旁边
+	var store controlplane.RouteStore
+	var rollbackStore controlplane.RollbackStore
+	kunClient := kunclient.New(k8sDiscovery.DynamicClient())
+	switch *routeStore {
+	case controlplane.RouteStoreFile:
+		store = controlplane.NewFileRouteStore(*routeFile)
+		rollbackStore = controlplane.NewFileRollbackStore(filepath.Join(filepath.Dir(*routeFile), "rollback.json"))
+	case controlplane.RouteStoreConfigMap:
+		parts := strings.Split(*routeCM, "/")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			log.Fatalf("ConfigMap格式错误，应为 namespace/name: %s", *routeCM)
+		}
+		store = controlplane.NewConfigMapRouteStore(k8sDiscovery.Client(), parts[0], parts[1])
+		rollbackStore = controlplane.NewConfigMapRollbackStore(k8sDiscovery.Client(), parts[0], controlplane.DefaultRollbackConfigMap)
+	case controlplane.RouteStoreCRD:
+		store = controlplane.NewCRDRouteStore(kunClient, *routeNS)
+		rollbackStore = controlplane.NewConfigMapRollbackStore(k8sDiscovery.Client(), *routeNS, controlplane.DefaultRollbackConfigMap)
+	default:
+		log.Fatalf("不支持的路由存储方式: %s", *routeStore)
+	}
+	// 在启动时的推送之前恢复历史版本和回滚，避免推送撤销重启前的回滚
+	if err := dataplaneClient.SetRollbackStore(rollbackStore); err != nil {
+		log.Fatalf("加载回滚状态失败: %v", err)
+	}
+
+	// 加载路由，并将完整的路由推送到数据面
+	routeManager, err := controlplane.NewRouteManager(store, k8sDiscovery, dataplaneClient, log)
+	if err != nil {
+		log.Fatalf("加载路由失败: %v", err)
+	}
+
+	// 启动Ingress控制器
+	if *ingressClass != "" {
+		ingressController := controlplane.NewIngressController(k8sDiscovery.Client(), k8sDiscovery, routeManager, dataplaneClient, controlplane.IngressConfig{
+			ClassName:          *ingressClass,
+			DataPlaneNamespace: *dpNamespace,
+			DataPlaneSelector:  *dpSelector,
+		}, log)
+		ingressController.Start(ctx)
+	}
+
+	// 启动Gateway API控制器
+	if *gatewayAPI {
+		gatewayController := controlplane.NewGatewayController(k8sDiscovery.Client(), k8sDiscovery.DynamicClient(), k8sDiscovery, routeManager, dataplaneClient, controlplane.GatewayConfig{
+			HTTPPort:           int32(*gatewayHTTP),
+			HTTPSPort:          int32(*gatewayHTTPS),
+			DataPlaneNamespace: *dpNamespace,
+			DataPlaneSelector:  *dpSelector,
+		}, log)
+		gatewayController.Start(ctx)
+	}
+
+	// 启动服务注解路由控制器
+	if *svcAnnot {
+		serviceRouteController := controlplane.NewServiceRouteController(k8sDiscovery, routeManager, log)
+		serviceRouteController.Start(ctx)
+	}
+
+	// crd存储方式下启动KunResource控制器，通过API上传的证书也保存为KunCertificate
+	var certStore controlplane.CertificateStore
+	if *routeStore == controlplane.RouteStoreCRD {
+		kunController := controlplane.NewKunResourceController(kunClient, k8sDiscovery.Client(), routeManager, dataplaneClient, *routeNS, log)
+		kunController.Start(ctx)
+		certStore = controlplane.NewCRDCertificateStore(kunClient, k8sDiscovery.Client(), *routeNS)
+	}
+
+	go routeManager.Run(ctx)
+
 	// 创建控制面API服务器
-	apiServer := controlplane.NewControlPlaneAPI(k8sDiscovery, dataplaneClient, log)
+	apiServer := controlplane.NewControlPlaneAPI(k8sDiscovery, dataplaneClient, routeManager, certStore, log)
+	if *trusted != "" {
+		if err := apiServer.SetTrustedProxies(strings.Split(*trusted, ",")); err != nil {
+			log.Fatalf("设置可信代理失败: %v", err)
+		}
+	}
 
 	// 启动控制面API服务器
 	go func() {
@@ -76,6 +219,10 @@ func main() {
 	log.Info("收到中断信号，正在关闭服务...")
 
 	// 优雅关闭
+	cancel()
+	if configServer != nil {
+		configServer.Stop()
+	}
 	k8sDiscovery.Stop()
 
 	log.Info("控制面服务已关闭")
@@ -1,23 +1,45 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 
 	"kun-gateway/pkg/dataplane"
+	"kun-gateway/pkg/proto"
 
 	"github.com/sirupsen/logrus"
 )
 
 var (
-	port     = flag.Int("port", 80, "HTTP代理服务器监听端口")
-	httpsPort = flag.Int("https-port", 443, "HTTPS代理服务器监听端口")
-	apiPort  = flag.Int("api-port", 8080, "API服务器监听端口")
-	logLevel = flag.String("log-level", "info", "日志级别")
-	certDir  = flag.String("cert-dir", "/etc/ssl/certs", "证书文件目录")
+	port           = flag.Int("port", 80, "HTTP代理服务器监听端口")
+	httpsPort      = flag.Int("https-port", 443, "HTTPS代理服务器监听端口")
+	apiPort        = flag.Int("api-port", 8080, "API服务器监听端口")
+	logLevel       = flag.String("log-level", "info", "日志级别")
+	certDir        = flag.String("cert-dir", "/etc/ssl/certs", "证书文件目录")
+	accessLog      = flag.String("access-log", "", "访问日志输出，逗号分隔：stdout、file:///path/access.log、udp://host:port、syslog://host:port，为空时不记录")
+	accessLogFmt   = flag.String("access-log-format", dataplane.DefaultAccessLogFormat, "访问日志格式：json，或 ${field} 形式的模板")
+	accessLogRate  = flag.Float64("access-log-sample-rate", 1, "访问日志全局采样率（0~1）")
+	accessLogSize  = flag.Int("access-log-max-size", 100, "访问日志文件轮转大小（MB）")
+	accessLogFiles = flag.Int("access-log-max-backups", 5, "保留的历史访问日志文件数")
+	seriesWindow   = flag.Duration("metrics-second-window", dataplane.DefaultSecondRetention, "秒级时间序列的保留时长，更早的数据按分钟保留24小时")
+	maxSeries      = flag.Int("metrics-max-series", dataplane.DefaultMaxSeries, "Prometheus请求指标序列上限，超出后合并为other")
+	trustedProxies = flag.String("trusted-proxies", "", "可信来源网段，逗号分隔，来自这些地址的X-Request-Id会被沿用")
+	tracingURL     = flag.String("tracing-endpoint", "", "OTLP/HTTP链路追踪上报地址，如 http://otel-collector:4318，为空时不追踪")
+	tracingService = flag.String("tracing-service-name", dataplane.DefaultTracingServiceName, "链路追踪上报的service.name")
+	tracingRate    = flag.Float64("tracing-sample-rate", 0.1, "链路追踪全局采样率（0~1），携带上游采样决定的请求沿用上游的决定")
+	tracingProps   = flag.String("tracing-propagators", "tracecontext,baggage", "链路上下文传播格式，逗号分隔：tracecontext、baggage、b3")
+	nodeName       = flag.String("node-name", os.Getenv("NODE_NAME"), "数据面所在的节点名，用于拓扑感知路由，默认读取环境变量NODE_NAME")
+	zone           = flag.String("zone", os.Getenv("ZONE"), "数据面所在的可用区，为空时使用控制面下发的节点可用区标签，都没有时按本节点上Pod的可用区推断")
+	controlPlane   = flag.String("controlplane-addr", "", "控制面配置订阅的gRPC地址（host:port），设置后通过长连接订阅配置，为空时由控制面通过API推送")
+	controlPlaneCA = flag.String("controlplane-ca", "", "校验控制面gRPC证书的CA文件，设置后使用TLS订阅配置")
+	tokenFile      = flag.String("token-file", dataplane.DefaultServiceAccountTokenFile, "订阅配置时携带的ServiceAccount令牌文件，控制面用于校验数据面身份")
+	tapRawHeaders  = flag.Bool("tap-raw-headers", false, "是否允许流量抓取通过 raw_headers=true 获取未脱敏的Authorization、Cookie等请求/响应头")
+	podName        = flag.String("pod-name", os.Getenv("POD_NAME"), "订阅配置时上报的实例名称，默认读取环境变量POD_NAME，为空时使用主机名")
 )
 
 func main() {
@@ -43,10 +65,73 @@ func main() {
 
 	// 创建代理服务器
 	proxy := dataplane.NewProxy(router, log)
+	proxy.GetMetrics().SetMaxSeries(*maxSeries)
+	proxy.GetMetrics().SetSecondRetention(*seriesWindow)
+	if *trustedProxies != "" {
+		if err := proxy.SetTrustedProxies(strings.Split(*trustedProxies, ",")); err != nil {
+			log.Fatalf("解析可信来源网段失败: %v", err)
+		}
+	}
+
+	proxy.SetLocality(*nodeName, *zone)
+	proxy.Taps().SetAllowRawHeaders(*tapRawHeaders)
+
+	// 创建访问日志
+	if *accessLog != "" {
+		accessLogger, err := dataplane.NewAccessLogger(dataplane.AccessLogConfig{
+			Format:     *accessLogFmt,
+			Sinks:      strings.Split(*accessLog, ","),
+			SampleRate: *accessLogRate,
+			MaxSizeMB:  *accessLogSize,
+			MaxBackups: *accessLogFiles,
+		}, log)
+		if err != nil {
+			log.Fatalf("创建访问日志失败: %v", err)
+		}
+		proxy.SetAccessLogger(accessLogger)
+	}
+
+	// 创建链路追踪
+	if *tracingURL != "" {
+		tracer, err := dataplane.NewTracer(dataplane.TracingConfig{
+			Endpoint:    *tracingURL,
+			ServiceName: *tracingService,
+			SampleRate:  *tracingRate,
+			Propagators: strings.Split(*tracingProps, ","),
+		}, log)
+		if err != nil {
+			log.Fatalf("创建链路追踪失败: %v", err)
+		}
+		proxy.SetTracer(tracer)
+	}
 
 	// 创建API服务器
 	apiServer := dataplane.NewAPIServer(router, proxy, log)
 
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// 订阅控制面配置
+	if *controlPlane != "" {
+		name := *podName
+		if name == "" {
+			name, _ = os.Hostname()
+		}
+		node := &proto.Node{
+			Id:       name,
+			NodeName: *nodeName,
+			Zone:     *zone,
+			ApiPort:  int32(*apiPort),
+		}
+		options := dataplane.ConfigStreamOptions{CAFile: *controlPlaneCA, TokenFile: *tokenFile}
+		configClient := dataplane.NewConfigStreamClient(*controlPlane, node, options, router, proxy, log)
+		go func() {
+			if err := configClient.Run(ctx); err != nil {
+				log.Fatalf("订阅控制面配置失败: %v", err)
+			}
+		}()
+	}
+
 	// 启动API服务器
 	go func() {
 		apiAddr := fmt.Sprintf(":%d", *apiPort)
@@ -79,6 +164,7 @@ func main() {
 	log.Info("收到中断信号，正在关闭服务...")
 
 	// 优雅关闭
+	cancel()
 	proxy.Stop()
 
 	log.Info("数据面服务已关闭")
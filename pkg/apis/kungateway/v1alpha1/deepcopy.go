@@ -0,0 +1,349 @@
+package v1alpha1
+
+import (
+	"kun-gateway/pkg/dataplane"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// 深拷贝方法，按 deepcopy-gen 的约定手工维护，修改类型时需同步更新
+
+// DeepCopyInto 深拷贝到out
+func (in *KunRoute) DeepCopyInto(out *KunRoute) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy 深拷贝
+func (in *KunRoute) DeepCopy() *KunRoute {
+	if in == nil {
+		return nil
+	}
+	out := new(KunRoute)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject 实现 runtime.Object
+func (in *KunRoute) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto 深拷贝到out
+func (in *KunRouteSpec) DeepCopyInto(out *KunRouteSpec) {
+	*out = *in
+	in.KunUpstreamSource.DeepCopyInto(&out.KunUpstreamSource)
+	out.Headers = copyStringMap(in.Headers)
+	if in.HeaderRoutes != nil {
+		out.HeaderRoutes = make([]KunHeaderRoute, len(in.HeaderRoutes))
+		copy(out.HeaderRoutes, in.HeaderRoutes)
+	}
+	out.RequestHeaders = copyHeaderOperations(in.RequestHeaders)
+	out.ResponseHeaders = copyHeaderOperations(in.ResponseHeaders)
+	if in.AccessLog != nil {
+		accessLog := *in.AccessLog
+		out.AccessLog = &accessLog
+	}
+	if in.Tracing != nil {
+		tracing := *in.Tracing
+		out.Tracing = &tracing
+	}
+	if in.Backends != nil {
+		out.Backends = make([]KunBackend, len(in.Backends))
+		for i := range in.Backends {
+			in.Backends[i].DeepCopyInto(&out.Backends[i])
+		}
+	}
+}
+
+// DeepCopyInto 深拷贝到out
+func (in *KunBackend) DeepCopyInto(out *KunBackend) {
+	*out = *in
+	in.KunUpstreamSource.DeepCopyInto(&out.KunUpstreamSource)
+	out.RequestHeaders = copyHeaderOperations(in.RequestHeaders)
+	out.ResponseHeaders = copyHeaderOperations(in.ResponseHeaders)
+}
+
+// DeepCopyInto 深拷贝到out
+func (in *KunUpstreamSource) DeepCopyInto(out *KunUpstreamSource) {
+	*out = *in
+	if in.Addresses != nil {
+		out.Addresses = make([]string, len(in.Addresses))
+		copy(out.Addresses, in.Addresses)
+	}
+	if in.TLS != nil {
+		tls := *in.TLS
+		out.TLS = &tls
+	}
+	if in.Topology != nil {
+		topology := *in.Topology
+		out.Topology = &topology
+	}
+}
+
+// DeepCopyInto 深拷贝到out
+func (in *KunRouteStatus) DeepCopyInto(out *KunRouteStatus) {
+	*out = *in
+	out.Conditions = copyConditions(in.Conditions)
+}
+
+// DeepCopy 深拷贝
+func (in *KunRouteStatus) DeepCopy() *KunRouteStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(KunRouteStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto 深拷贝到out
+func (in *KunRouteList) DeepCopyInto(out *KunRouteList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		out.Items = make([]KunRoute, len(in.Items))
+		for i := range in.Items {
+			in.Items[i].DeepCopyInto(&out.Items[i])
+		}
+	}
+}
+
+// DeepCopy 深拷贝
+func (in *KunRouteList) DeepCopy() *KunRouteList {
+	if in == nil {
+		return nil
+	}
+	out := new(KunRouteList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject 实现 runtime.Object
+func (in *KunRouteList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto 深拷贝到out
+func (in *KunCertificate) DeepCopyInto(out *KunCertificate) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	if in.Spec.Domains != nil {
+		out.Spec.Domains = make([]string, len(in.Spec.Domains))
+		copy(out.Spec.Domains, in.Spec.Domains)
+	}
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopyInto 深拷贝到out
+func (in *KunCertificateStatus) DeepCopyInto(out *KunCertificateStatus) {
+	*out = *in
+	out.Conditions = copyConditions(in.Conditions)
+	if in.NotAfter != nil {
+		out.NotAfter = in.NotAfter.DeepCopy()
+	}
+}
+
+// DeepCopy 深拷贝
+func (in *KunCertificateStatus) DeepCopy() *KunCertificateStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(KunCertificateStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopy 深拷贝
+func (in *KunCertificate) DeepCopy() *KunCertificate {
+	if in == nil {
+		return nil
+	}
+	out := new(KunCertificate)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject 实现 runtime.Object
+func (in *KunCertificate) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto 深拷贝到out
+func (in *KunCertificateList) DeepCopyInto(out *KunCertificateList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		out.Items = make([]KunCertificate, len(in.Items))
+		for i := range in.Items {
+			in.Items[i].DeepCopyInto(&out.Items[i])
+		}
+	}
+}
+
+// DeepCopy 深拷贝
+func (in *KunCertificateList) DeepCopy() *KunCertificateList {
+	if in == nil {
+		return nil
+	}
+	out := new(KunCertificateList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject 实现 runtime.Object
+func (in *KunCertificateList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto 深拷贝到out
+func (in *KunPolicy) DeepCopyInto(out *KunPolicy) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy 深拷贝
+func (in *KunPolicy) DeepCopy() *KunPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(KunPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject 实现 runtime.Object
+func (in *KunPolicy) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto 深拷贝到out
+func (in *KunPolicySpec) DeepCopyInto(out *KunPolicySpec) {
+	*out = *in
+	if in.TargetRefs != nil {
+		out.TargetRefs = make([]KunPolicyTargetRef, len(in.TargetRefs))
+		copy(out.TargetRefs, in.TargetRefs)
+	}
+	out.RequestHeaders = copyHeaderOperations(in.RequestHeaders)
+	out.ResponseHeaders = copyHeaderOperations(in.ResponseHeaders)
+	if in.AccessLog != nil {
+		accessLog := *in.AccessLog
+		out.AccessLog = &accessLog
+	}
+	if in.Tracing != nil {
+		tracing := *in.Tracing
+		out.Tracing = &tracing
+	}
+}
+
+// DeepCopyInto 深拷贝到out
+func (in *KunPolicyStatus) DeepCopyInto(out *KunPolicyStatus) {
+	*out = *in
+	out.Conditions = copyConditions(in.Conditions)
+}
+
+// DeepCopy 深拷贝
+func (in *KunPolicyStatus) DeepCopy() *KunPolicyStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(KunPolicyStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto 深拷贝到out
+func (in *KunPolicyList) DeepCopyInto(out *KunPolicyList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		out.Items = make([]KunPolicy, len(in.Items))
+		for i := range in.Items {
+			in.Items[i].DeepCopyInto(&out.Items[i])
+		}
+	}
+}
+
+// DeepCopy 深拷贝
+func (in *KunPolicyList) DeepCopy() *KunPolicyList {
+	if in == nil {
+		return nil
+	}
+	out := new(KunPolicyList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject 实现 runtime.Object
+func (in *KunPolicyList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// copyStringMap 拷贝字符串map
+func copyStringMap(in map[string]string) map[string]string {
+	if in == nil {
+		return nil
+	}
+	out := make(map[string]string, len(in))
+	for k, v := range in {
+		out[k] = v
+	}
+	return out
+}
+
+// copyHeaderOperations 拷贝Header操作
+func copyHeaderOperations(in *dataplane.HeaderOperations) *dataplane.HeaderOperations {
+	if in == nil {
+		return nil
+	}
+	out := &dataplane.HeaderOperations{
+		Set: copyStringMap(in.Set),
+		Add: copyStringMap(in.Add),
+	}
+	if in.Remove != nil {
+		out.Remove = make([]string, len(in.Remove))
+		copy(out.Remove, in.Remove)
+	}
+	return out
+}
+
+// copyConditions 拷贝状态条件
+func copyConditions(in []metav1.Condition) []metav1.Condition {
+	if in == nil {
+		return nil
+	}
+	out := make([]metav1.Condition, len(in))
+	for i := range in {
+		in[i].DeepCopyInto(&out[i])
+	}
+	return out
+}
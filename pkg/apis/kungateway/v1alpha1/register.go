@@ -0,0 +1,41 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// GroupName API组名
+const GroupName = "kun-gateway.io"
+
+// SchemeGroupVersion API组版本
+var SchemeGroupVersion = schema.GroupVersion{Group: GroupName, Version: "v1alpha1"}
+
+// 各资源的GroupVersionResource
+var (
+	KunRouteResource       = SchemeGroupVersion.WithResource("kunroutes")
+	KunCertificateResource = SchemeGroupVersion.WithResource("kuncertificates")
+	KunPolicyResource      = SchemeGroupVersion.WithResource("kunpolicies")
+)
+
+var (
+	// SchemeBuilder 注册本组类型
+	SchemeBuilder = runtime.NewSchemeBuilder(addKnownTypes)
+	// AddToScheme 将本组类型加入Scheme
+	AddToScheme = SchemeBuilder.AddToScheme
+)
+
+// addKnownTypes 注册类型
+func addKnownTypes(scheme *runtime.Scheme) error {
+	scheme.AddKnownTypes(SchemeGroupVersion,
+		&KunRoute{},
+		&KunRouteList{},
+		&KunCertificate{},
+		&KunCertificateList{},
+		&KunPolicy{},
+		&KunPolicyList{},
+	)
+	metav1.AddToGroupVersion(scheme, SchemeGroupVersion)
+	return nil
+}
@@ -0,0 +1,198 @@
+package v1alpha1
+
+import (
+	"kun-gateway/pkg/dataplane"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// 状态条件类型
+const (
+	// ConditionAccepted 配置通过校验，没有冲突
+	ConditionAccepted = "Accepted"
+	// ConditionProgrammed 配置已下发到数据面
+	ConditionProgrammed = "Programmed"
+	// ConditionResolvedRefs 引用的Secret、路由等资源存在
+	ConditionResolvedRefs = "ResolvedRefs"
+)
+
+// 注解
+const (
+	// AnnotationCreatedAt 和 AnnotationUpdatedAt 通过控制面API修改时记录的时间，RFC3339格式
+	AnnotationCreatedAt = "kun-gateway.io/created-at"
+	AnnotationUpdatedAt = "kun-gateway.io/updated-at"
+)
+
+// KunRoute 一条路由，控制面将同一命名空间中的KunRoute作为路由的权威来源，对象名称即路由ID
+type KunRoute struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   KunRouteSpec   `json:"spec"`
+	Status KunRouteStatus `json:"status,omitempty"`
+}
+
+// KunRouteSpec 路由配置，与控制面API的路由字段一一对应
+type KunRouteSpec struct {
+	Domain string `json:"domain"`
+	Path   string `json:"path,omitempty"`
+	// PathType 路径匹配方式：exact、prefix，为空时路径精确匹配，未命中时匹配该域名下的任一路由
+	PathType dataplane.PathMatchType `json:"pathType,omitempty"`
+	Headers  map[string]string       `json:"headers,omitempty"`
+	// HeaderRoutes Header子规则，命中时转发到指定服务，否则走默认服务
+	HeaderRoutes []KunHeaderRoute `json:"headerRoutes,omitempty"`
+	// 请求头/响应头操作
+	RequestHeaders  *dataplane.HeaderOperations `json:"requestHeaders,omitempty"`
+	ResponseHeaders *dataplane.HeaderOperations `json:"responseHeaders,omitempty"`
+	// AccessLog 路由级访问日志配置
+	AccessLog *dataplane.RouteAccessLog `json:"accessLog,omitempty"`
+	// Tracing 路由级链路追踪配置
+	Tracing *dataplane.RouteTracing `json:"tracing,omitempty"`
+	// Service 格式: namespace/service，static、dns类型为上游名称
+	Service string `json:"service"`
+	// KunUpstreamSource 上游类型，默认按Service的端点转发
+	KunUpstreamSource `json:",inline"`
+	// Port 和 PortName 按端口号或端口名引用Service端口
+	Port     int    `json:"port,omitempty"`
+	PortName string `json:"portName,omitempty"`
+	Weight   int    `json:"weight,omitempty"`
+	// Backends 额外的后端服务，与 Service 一起按权重分配流量
+	Backends []KunBackend `json:"backends,omitempty"`
+	// Disabled 为true时路由不下发到数据面
+	Disabled bool `json:"disabled,omitempty"`
+}
+
+// KunHeaderRoute Header子规则
+type KunHeaderRoute struct {
+	Header    string                    `json:"header"`
+	Value     string                    `json:"value"`
+	MatchType dataplane.HeaderMatchType `json:"matchType,omitempty"`
+	Service   string                    `json:"service"`
+	Port      int                       `json:"port,omitempty"`
+	PortName  string                    `json:"portName,omitempty"`
+}
+
+// KunBackend 加权后端
+type KunBackend struct {
+	Service           string `json:"service"`
+	KunUpstreamSource `json:",inline"`
+	Port              int                         `json:"port,omitempty"`
+	PortName          string                      `json:"portName,omitempty"`
+	Weight            int                         `json:"weight"`
+	Protocol          dataplane.UpstreamProtocol  `json:"protocol,omitempty"`
+	RequestHeaders    *dataplane.HeaderOperations `json:"requestHeaders,omitempty"`
+	ResponseHeaders   *dataplane.HeaderOperations `json:"responseHeaders,omitempty"`
+}
+
+// KunUpstreamSource 上游类型：为空时按Service的端点转发，static 固定地址，dns 由数据面解析的域名
+type KunUpstreamSource struct {
+	Kind dataplane.UpstreamKind `json:"kind,omitempty"`
+	// Addresses static类型的地址，格式为 IP 或 IP:端口
+	Addresses []string `json:"addresses,omitempty"`
+	// Host dns类型的域名
+	Host string `json:"host,omitempty"`
+	// TLS 使用TLS连接上游
+	TLS *dataplane.UpstreamTLS `json:"tls,omitempty"`
+	// Topology 拓扑感知路由，只用于Service
+	Topology *dataplane.TopologyPolicy `json:"topology,omitempty"`
+}
+
+// KunRouteStatus 路由状态
+type KunRouteStatus struct {
+	ObservedGeneration int64              `json:"observedGeneration,omitempty"`
+	Conditions         []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// KunRouteList KunRoute列表
+type KunRouteList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []KunRoute `json:"items"`
+}
+
+// KunCertificate 将同一命名空间中 kubernetes.io/tls 类型Secret的证书下发到数据面
+type KunCertificate struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   KunCertificateSpec   `json:"spec"`
+	Status KunCertificateStatus `json:"status,omitempty"`
+}
+
+// KunCertificateSpec 证书配置
+type KunCertificateSpec struct {
+	// Domains 使用该证书的域名，支持 *.example.com
+	Domains []string `json:"domains"`
+	// SecretName 保存证书和私钥的Secret
+	SecretName string `json:"secretName"`
+}
+
+// KunCertificateStatus 证书状态
+type KunCertificateStatus struct {
+	ObservedGeneration int64              `json:"observedGeneration,omitempty"`
+	Conditions         []metav1.Condition `json:"conditions,omitempty"`
+	// NotAfter 证书过期时间
+	NotAfter *metav1.Time `json:"notAfter,omitempty"`
+}
+
+// KunCertificateList KunCertificate列表
+type KunCertificateList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []KunCertificate `json:"items"`
+}
+
+// KunPolicy 应用到一组路由的公共配置，路由自身设置的字段优先
+type KunPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   KunPolicySpec   `json:"spec"`
+	Status KunPolicyStatus `json:"status,omitempty"`
+}
+
+// KunPolicySpec 策略配置
+type KunPolicySpec struct {
+	// TargetRefs 应用策略的路由
+	TargetRefs []KunPolicyTargetRef `json:"targetRefs"`
+	// 请求头/响应头操作
+	RequestHeaders  *dataplane.HeaderOperations `json:"requestHeaders,omitempty"`
+	ResponseHeaders *dataplane.HeaderOperations `json:"responseHeaders,omitempty"`
+	// AccessLog 访问日志配置
+	AccessLog *dataplane.RouteAccessLog `json:"accessLog,omitempty"`
+	// Tracing 链路追踪配置
+	Tracing *dataplane.RouteTracing `json:"tracing,omitempty"`
+}
+
+// 策略目标类型
+const (
+	// PolicyTargetKunRoute 按名称选择同一命名空间中的KunRoute
+	PolicyTargetKunRoute = "KunRoute"
+	// PolicyTargetDomain 选择域名下的所有路由，包括Ingress、Gateway API生成的路由
+	PolicyTargetDomain = "Domain"
+)
+
+// KunPolicyTargetRef 策略目标
+type KunPolicyTargetRef struct {
+	// Kind KunRoute 或 Domain
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+}
+
+// KunPolicyStatus 策略状态
+type KunPolicyStatus struct {
+	ObservedGeneration int64              `json:"observedGeneration,omitempty"`
+	Conditions         []metav1.Condition `json:"conditions,omitempty"`
+	// Routes 策略实际应用到的路由数
+	Routes int `json:"routes"`
+}
+
+// KunPolicyList KunPolicy列表
+type KunPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []KunPolicy `json:"items"`
+}
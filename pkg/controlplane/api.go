@@ -1,9 +1,16 @@
 package controlplane
 
 import (
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"io"
+	"mime/multipart"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -17,27 +24,72 @@ import (
 type ControlPlaneAPI struct {
 	k8sDiscovery    *K8sDiscovery
 	dataplaneClient *DataPlaneClient
-	log             *logrus.Logger
+	routeManager    *RouteManager
+	// certStore 为空时证书直接下发到数据面
+	certStore CertificateStore
+	// trustedProxies 可信的认证代理网段，只有来自这些地址的请求才使用其携带的用户头和X-Forwarded-For
+	trustedProxies []*net.IPNet
+	log            *logrus.Logger
 }
 
-// NewControlPlaneAPI 创建控制面API
-func NewControlPlaneAPI(k8sDiscovery *K8sDiscovery, dataplaneClient *DataPlaneClient, log *logrus.Logger) *ControlPlaneAPI {
+// NewControlPlaneAPI 创建控制面API，certStore 可以为空
+func NewControlPlaneAPI(k8sDiscovery *K8sDiscovery, dataplaneClient *DataPlaneClient, routeManager *RouteManager, certStore CertificateStore, log *logrus.Logger) *ControlPlaneAPI {
 	return &ControlPlaneAPI{
 		k8sDiscovery:    k8sDiscovery,
 		dataplaneClient: dataplaneClient,
+		routeManager:    routeManager,
+		certStore:       certStore,
 		log:             log,
 	}
 }
 
+// SetTrustedProxies 设置可信的认证代理网段，需在 Start 前调用
+func (api *ControlPlaneAPI) SetTrustedProxies(cidrs []string) error {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		cidr = strings.TrimSpace(cidr)
+		if cidr == "" {
+			continue
+		}
+		// 兼容单个IP
+		if !strings.Contains(cidr, "/") {
+			if ip := net.ParseIP(cidr); ip != nil && ip.To4() != nil {
+				cidr += "/32"
+			} else {
+				cidr += "/128"
+			}
+		}
+
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return fmt.Errorf("无效的可信网段 %s: %v", cidr, err)
+		}
+		nets = append(nets, ipNet)
+	}
+
+	api.trustedProxies = nets
+	api.log.Infof("可信代理网段已更新，共 %d 个", len(nets))
+	return nil
+}
+
 // Start 启动控制面API服务器
 func (api *ControlPlaneAPI) Start(addr string) error {
 	gin.SetMode(gin.ReleaseMode)
 	r := gin.New()
+	// ClientIP 只采用可信代理设置的X-Forwarded-For
+	proxies := make([]string, 0, len(api.trustedProxies))
+	for _, ipNet := range api.trustedProxies {
+		proxies = append(proxies, ipNet.String())
+	}
+	if err := r.SetTrustedProxies(proxies); err != nil {
+		return fmt.Errorf("设置可信代理失败: %v", err)
+	}
 	r.Use(gin.Recovery())
 	r.Use(gin.Logger())
 
 	// 路由管理
 	r.GET("/api/v1/routes", api.getRoutes)
+	r.GET("/api/v1/routes/:id", api.getRoute)
 	r.POST("/api/v1/routes", api.createRoute)
 	r.PUT("/api/v1/routes/:id", api.updateRoute)
 	r.DELETE("/api/v1/routes/:id", api.deleteRoute)
@@ -54,6 +106,21 @@ func (api *ControlPlaneAPI) Start(addr string) error {
 	// 监控数据
 	r.GET("/api/v1/metrics", api.getMetrics)
 	r.GET("/api/v1/metrics/domains", api.getDomainMetrics)
+	r.GET("/api/v1/metrics/latency", api.getLatency)
+	r.GET("/api/v1/metrics/series", api.getMetricsSeries)
+
+	// 实时流量抓取
+	r.GET("/api/v1/tap", api.tap)
+
+	// 数据面同步状态
+	r.GET("/api/v1/dataplanes", api.getDataPlanes)
+
+	// 配置版本历史与回滚
+	r.GET("/api/v1/config/versions", api.getConfigVersions)
+	r.GET("/api/v1/config/versions/:generation", api.getConfigVersion)
+	r.GET("/api/v1/config/versions/:generation/diff", api.getConfigDiff)
+	r.POST("/api/v1/config/versions/:generation/rollback", api.rollbackConfig)
+	r.POST("/api/v1/config/resume", api.resumeConfig)
 
 	// 健康检查
 	r.GET("/api/v1/health", api.healthCheck)
@@ -64,39 +131,150 @@ func (api *ControlPlaneAPI) Start(addr string) error {
 
 // RouteConfig 路由配置
 type RouteConfig struct {
-	ID        string            `json:"id"`
-	Domain    string            `json:"domain"`
-	Path      string            `json:"path"`
-	Headers   map[string]string `json:"headers,omitempty"`
-	Service   string            `json:"service"` // 格式: namespace/service
-	Port      int               `json:"port"`
-	Weight    int               `json:"weight"`
-	Enabled   bool              `json:"enabled"`
-	CreatedAt time.Time         `json:"created_at"`
-	UpdatedAt time.Time         `json:"updated_at"`
-}
-
-// getRoutes 获取所有路由配置
+	ID     string `json:"id"`
+	Domain string `json:"domain"`
+	Path   string `json:"path"`
+	// PathType 路径匹配方式：exact、prefix，为空时路径精确匹配，未命中时匹配该域名下的任一路由
+	PathType dataplane.PathMatchType `json:"path_type,omitempty"`
+	Headers  map[string]string       `json:"headers,omitempty"`
+	// HeaderRoutes Header子规则，命中时转发到指定服务，否则走默认服务
+	HeaderRoutes []HeaderRouteConfig `json:"header_routes,omitempty"`
+	// 请求头/响应头操作，值中可使用 ${client_ip} ${route} ${upstream_addr} ${request_id} 等变量
+	RequestHeaders  *dataplane.HeaderOperations `json:"request_headers,omitempty"`
+	ResponseHeaders *dataplane.HeaderOperations `json:"response_headers,omitempty"`
+	// AccessLog 路由级访问日志配置（关闭或单独的采样率），未设置时使用数据面的全局配置
+	AccessLog *dataplane.RouteAccessLog `json:"access_log,omitempty"`
+	// Tracing 路由级链路追踪配置，未设置时使用数据面的全局采样率
+	Tracing *dataplane.RouteTracing `json:"tracing,omitempty"`
+	Service string                  `json:"service"` // 格式: namespace/service，static、dns类型为上游名称
+	// UpstreamSource 上游类型，默认按Service的端点转发
+	UpstreamSource
+	// Port 和 PortName 按端口号或端口名引用Service端口，同时设置时以端口名为准；转发时解析为各Pod的targetPort
+	Port     int    `json:"port"`
+	PortName string `json:"port_name,omitempty"`
+	Weight   int    `json:"weight"`
+	// Backends 额外的后端服务，与 Service 一起按权重分配流量
+	Backends []BackendConfig `json:"backends,omitempty"`
+	Enabled  bool            `json:"enabled"`
+	// Source 路由来源，为空表示通过API创建；其他来源（如ingress）的路由只读
+	Source    string    `json:"source,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// BackendConfig 加权后端配置
+type BackendConfig struct {
+	Service string `json:"service"` // 格式: namespace/service，static、dns类型为上游名称
+	UpstreamSource
+	Port     int    `json:"port"`
+	PortName string `json:"port_name,omitempty"`
+	Weight   int    `json:"weight"`
+	// Protocol 转发到后端使用的协议，gRPC服务使用 h2c
+	Protocol dataplane.UpstreamProtocol `json:"protocol,omitempty"`
+	// 转发到该后端时的请求头/响应头操作
+	RequestHeaders  *dataplane.HeaderOperations `json:"request_headers,omitempty"`
+	ResponseHeaders *dataplane.HeaderOperations `json:"response_headers,omitempty"`
+}
+
+// UpstreamSource 上游类型及连接方式。Kind为空时按Service的端点转发，ExternalName类型的Service自动按域名转发
+type UpstreamSource struct {
+	Kind dataplane.UpstreamKind `json:"kind,omitempty"`
+	// Addresses static类型的地址，格式为 IP 或 IP:端口，未指定端口时使用 port
+	Addresses []string `json:"addresses,omitempty"`
+	// Host dns类型的域名，由数据面按TTL重新解析
+	Host string `json:"host,omitempty"`
+	// TLS 使用TLS连接上游，适用于所有类型
+	TLS *dataplane.UpstreamTLS `json:"tls,omitempty"`
+	// Topology 拓扑感知路由，优先转发到数据面所在节点、可用区的Pod，只用于Service；
+	// 未设置时Service带有 service.kubernetes.io/topology-mode: Auto 注解则使用默认阈值
+	Topology *dataplane.TopologyPolicy `json:"topology,omitempty"`
+}
+
+// HeaderRouteConfig Header子规则配置
+type HeaderRouteConfig struct {
+	Header    string                    `json:"header"`
+	Value     string                    `json:"value"`
+	MatchType dataplane.HeaderMatchType `json:"match_type"` // exact/prefix/regex，默认exact
+	Service   string                    `json:"service"`    // 格式: namespace/service
+	Port      int                       `json:"port"`       // 与 PortName 都为空时沿用路由端口
+	PortName  string                    `json:"port_name,omitempty"`
+}
+
+// parseServiceName 解析服务名称格式: namespace/service
+func parseServiceName(service string) (string, string, error) {
+	parts := strings.Split(service, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("服务名称格式错误，应为 namespace/service: %s", service)
+	}
+	return parts[0], parts[1], nil
+}
+
+// RouteStatus 路由配置及其最近一次推送的结果
+type RouteStatus struct {
+	*RouteConfig
+	// State 尚未推送过的路由为空
+	State *RouteState `json:"state,omitempty"`
+}
+
+// routeStatus 附加路由的推送结果
+func (api *ControlPlaneAPI) routeStatus(route *RouteConfig) *RouteStatus {
+	status := &RouteStatus{RouteConfig: route}
+	if state, ok := api.routeManager.State(route.ID); ok {
+		status.State = &state
+	}
+	return status
+}
+
+// getRoutes 获取所有路由配置及推送结果，reason参数按未生效的原因过滤，如 reason=Conflict
 func (api *ControlPlaneAPI) getRoutes(c *gin.Context) {
-	routes, err := api.dataplaneClient.GetRoutes()
+	reason := c.Query("reason")
+	routes := make([]*RouteStatus, 0)
+	conflicts := 0
+	for _, route := range api.routeManager.List() {
+		status := api.routeStatus(route)
+		if status.State != nil && status.State.Reason == RouteStateConflict {
+			conflicts++
+		}
+		if reason != "" && (status.State == nil || !strings.EqualFold(status.State.Reason, reason)) {
+			continue
+		}
+		routes = append(routes, status)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":   true,
+		"routes":    routes,
+		"conflicts": conflicts,
+	})
+}
+
+// getRoute 获取单个路由配置
+func (api *ControlPlaneAPI) getRoute(c *gin.Context) {
+	route, err := api.routeManager.Get(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"success": false,
-			"message": "获取路由失败: " + err.Error(),
-		})
+		api.routeError(c, nil, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
-		"routes":  routes,
+		"route":   api.routeStatus(route),
 	})
 }
 
+// bindRouteConfig 解析路由配置，未指定enabled时默认启用
+func bindRouteConfig(c *gin.Context) (*RouteConfig, error) {
+	config := &RouteConfig{Enabled: true}
+	if err := c.ShouldBindJSON(config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
 // createRoute 创建路由配置
 func (api *ControlPlaneAPI) createRoute(c *gin.Context) {
-	var config RouteConfig
-	if err := c.ShouldBindJSON(&config); err != nil {
+	config, err := bindRouteConfig(c)
+	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
 			"message": "请求参数错误: " + err.Error(),
@@ -104,69 +282,33 @@ func (api *ControlPlaneAPI) createRoute(c *gin.Context) {
 		return
 	}
 
-	// 验证服务是否存在
-	// 解析服务名称格式: namespace/service
-	parts := strings.Split(config.Service, "/")
-	if len(parts) != 2 {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"success": false,
-			"message": "服务名称格式错误，应为 namespace/service",
-		})
-		return
-	}
-
-	namespace, serviceName := parts[0], parts[1]
-	endpoint := api.k8sDiscovery.GetServiceEndpoints(namespace, serviceName)
-	if endpoint == nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"success": false,
-			"message": "指定的服务不存在或没有可用的端点",
-		})
-		return
-	}
-
-	// 构建路由规则
-	rule := &dataplane.RouteRule{
-		Domain:    config.Domain,
-		Path:      config.Path,
-		Headers:   config.Headers,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
-	}
-
-	// 构建上游服务
-	upstream := dataplane.Upstream{
-		Name:      config.Service,
-		Addresses: endpoint.Addresses,
-		Port:      config.Port,
-		Weight:    config.Weight,
-		Healthy:   endpoint.Ready,
-	}
-	rule.Upstreams = append(rule.Upstreams, upstream)
-
-	// 推送到数据面
-	err := api.dataplaneClient.UpdateRoutes([]*dataplane.RouteRule{rule})
+	route, err := api.routeManager.Create(config, api.requestAuthor(c))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"success": false,
-			"message": "更新路由失败: " + err.Error(),
-		})
+		api.routeError(c, route, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "路由创建成功",
-		"route":   config,
+		"route":   route,
 	})
 }
 
+// hasUpstream 判断上游列表中是否已包含指定服务
+func hasUpstream(upstreams []dataplane.Upstream, name string) bool {
+	for _, upstream := range upstreams {
+		if upstream.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
 // updateRoute 更新路由配置
 func (api *ControlPlaneAPI) updateRoute(c *gin.Context) {
-	id := c.Param("id")
-
-	var config RouteConfig
-	if err := c.ShouldBindJSON(&config); err != nil {
+	config, err := bindRouteConfig(c)
+	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
 			"message": "请求参数错误: " + err.Error(),
@@ -174,14 +316,16 @@ func (api *ControlPlaneAPI) updateRoute(c *gin.Context) {
 		return
 	}
 
-	config.ID = id
-	config.UpdatedAt = time.Now()
+	route, err := api.routeManager.Update(c.Param("id"), config, api.requestAuthor(c))
+	if err != nil {
+		api.routeError(c, route, err)
+		return
+	}
 
-	// 这里简化处理，实际应该更新现有的路由规则
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "路由更新成功",
-		"route":   config,
+		"route":   route,
 	})
 }
 
@@ -189,7 +333,11 @@ func (api *ControlPlaneAPI) updateRoute(c *gin.Context) {
 func (api *ControlPlaneAPI) deleteRoute(c *gin.Context) {
 	id := c.Param("id")
 
-	// 这里简化处理，实际应该删除对应的路由规则
+	if err := api.routeManager.Delete(id, api.requestAuthor(c)); err != nil {
+		api.routeError(c, nil, err)
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "路由删除成功",
@@ -197,11 +345,43 @@ func (api *ControlPlaneAPI) deleteRoute(c *gin.Context) {
 	})
 }
 
+// routeError 根据路由操作的错误类型返回对应的状态码。推送失败时修改已经保存，返回202
+func (api *ControlPlaneAPI) routeError(c *gin.Context, route *RouteConfig, err error) {
+	switch {
+	case errors.Is(err, ErrRoutePush):
+		c.JSON(http.StatusAccepted, gin.H{
+			"success": true,
+			"message": err.Error(),
+			"route":   route,
+		})
+	case errors.Is(err, ErrRouteNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+	case errors.Is(err, ErrRouteConflict), errors.Is(err, ErrRouteReadOnly):
+		c.JSON(http.StatusConflict, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+	case errors.Is(err, ErrRouteStore):
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+	}
+}
+
 // CertificateConfig 证书配置
 type CertificateConfig struct {
-	Domain   string    `json:"domain"`
-	CertFile string    `json:"cert_file"`
-	KeyFile  string    `json:"key_file"`
+	Domain    string    `json:"domain"`
+	CertFile  string    `json:"cert_file"`
+	KeyFile   string    `json:"key_file"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
@@ -218,7 +398,7 @@ func (api *ControlPlaneAPI) getCertificates(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"success": true,
+		"success":      true,
 		"certificates": certificates,
 	})
 }
@@ -253,6 +433,46 @@ func (api *ControlPlaneAPI) createCertificate(c *gin.Context) {
 		return
 	}
 
+	// 配置了证书存储时保存为K8s资源，由控制器下发到数据面
+	if api.certStore != nil {
+		certPEM, err := readUploadedFile(certFile)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "读取证书文件失败: " + err.Error(),
+			})
+			return
+		}
+		keyPEM, err := readUploadedFile(keyFile)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "读取私钥文件失败: " + err.Error(),
+			})
+			return
+		}
+		if _, err := tls.X509KeyPair(certPEM, keyPEM); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "证书或私钥无效: " + err.Error(),
+			})
+			return
+		}
+		if err := api.certStore.Save(domain, certPEM, keyPEM); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"message": "保存证书失败: " + err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"message": "证书已保存，稍后下发到数据面",
+			"domain":  domain,
+		})
+		return
+	}
+
 	// 创建临时目录保存证书文件
 	tempDir := fmt.Sprintf("/tmp/certs/%s", domain)
 	if err := os.MkdirAll(tempDir, 0755); err != nil {
@@ -311,6 +531,36 @@ func (api *ControlPlaneAPI) deleteCertificate(c *gin.Context) {
 		return
 	}
 
+	if api.certStore != nil {
+		err := api.certStore.Delete(domain)
+		switch {
+		case errors.Is(err, ErrCertificateNotFound):
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		case errors.Is(err, ErrCertificateReadOnly):
+			c.JSON(http.StatusConflict, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		case err != nil:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"message": "移除证书失败: " + err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"message": "证书已删除，稍后从数据面移除",
+			"domain":  domain,
+		})
+		return
+	}
+
 	// 从数据面移除证书
 	err := api.dataplaneClient.RemoveCertificate(domain)
 	if err != nil {
@@ -328,7 +578,17 @@ func (api *ControlPlaneAPI) deleteCertificate(c *gin.Context) {
 	})
 }
 
-// getServices 获取K8s服务列表
+// readUploadedFile 读取上传文件的内容
+func readUploadedFile(file *multipart.FileHeader) ([]byte, error) {
+	f, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+// getServices 获取服务发现范围内的K8s服务列表
 func (api *ControlPlaneAPI) getServices(c *gin.Context) {
 	services := api.k8sDiscovery.GetServices()
 
@@ -336,6 +596,7 @@ func (api *ControlPlaneAPI) getServices(c *gin.Context) {
 		"success":  true,
 		"services": services,
 		"count":    len(services),
+		"scope":    api.k8sDiscovery.Scope(),
 	})
 }
 
@@ -350,9 +611,9 @@ func (api *ControlPlaneAPI) getEndpoints(c *gin.Context) {
 	})
 }
 
-// getMetrics 获取监控指标
+// getMetrics 获取监控指标，未指定实例时合并所有实例
 func (api *ControlPlaneAPI) getMetrics(c *gin.Context) {
-	metrics, err := api.dataplaneClient.GetMetrics()
+	metrics, err := api.dataplaneClient.GetMetrics(c.Query("instance"))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
@@ -371,7 +632,7 @@ func (api *ControlPlaneAPI) getMetrics(c *gin.Context) {
 func (api *ControlPlaneAPI) getDomainMetrics(c *gin.Context) {
 	domain := c.Query("domain")
 
-	metrics, err := api.dataplaneClient.GetMetrics()
+	metrics, err := api.dataplaneClient.GetMetrics(c.Query("instance"))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
@@ -406,6 +667,259 @@ func (api *ControlPlaneAPI) getDomainMetrics(c *gin.Context) {
 	})
 }
 
+// getLatency 获取延迟分位数，各数据面的直方图合并后再计算
+func (api *ControlPlaneAPI) getLatency(c *gin.Context) {
+	histograms, err := api.dataplaneClient.GetLatencyHistograms()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "获取延迟指标失败: " + err.Error(),
+		})
+		return
+	}
+
+	merged := &dataplane.LatencyHistograms{}
+	merged.Merge(histograms)
+
+	response := gin.H{
+		"success": true,
+		"latency": merged.Report(),
+	}
+	if c.Query("histograms") == "true" {
+		response["histograms"] = merged
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// tap 转发数据面的流量抓取SSE流，参数原样转发到数据面
+func (api *ControlPlaneAPI) tap(c *gin.Context) {
+	instance, query := dataplaneQuery(c)
+	resp, err := api.dataplaneClient.OpenTap(c.Request.Context(), instance, query)
+	if errors.Is(err, ErrInstanceRequired) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	defer resp.Body.Close()
+
+	c.Header("Content-Type", resp.Header.Get("Content-Type"))
+	if resp.StatusCode == http.StatusOK {
+		c.Header("Cache-Control", "no-cache")
+		c.Header("X-Accel-Buffering", "no")
+	}
+	c.Status(resp.StatusCode)
+
+	// 逐块转发并立即刷新，保证事件实时到达
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := resp.Body.Read(buf)
+		if n > 0 {
+			if _, werr := c.Writer.Write(buf[:n]); werr != nil {
+				return
+			}
+			c.Writer.Flush()
+		}
+		if err != nil {
+			if err != io.EOF && c.Request.Context().Err() == nil {
+				api.log.Warnf("转发流量抓取失败: %v", err)
+			}
+			return
+		}
+	}
+}
+
+// getMetricsSeries 查询时间序列，参数原样转发到数据面，未指定实例时合并所有实例
+func (api *ControlPlaneAPI) getMetricsSeries(c *gin.Context) {
+	instance, query := dataplaneQuery(c)
+	series, err := api.dataplaneClient.GetMetricsSeries(instance, query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "查询时间序列失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"series":  series,
+	})
+}
+
+// getDataPlanes 获取所有数据面实例的配置同步状态
+func (api *ControlPlaneAPI) getDataPlanes(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"fleet":   api.dataplaneClient.FleetStatus(),
+	})
+}
+
+// requestAuthor 配置变更的操作者：来自可信代理的请求优先使用认证代理设置的用户头，否则为客户端地址
+func (api *ControlPlaneAPI) requestAuthor(c *gin.Context) string {
+	if api.trustedSource(c.RemoteIP()) {
+		for _, header := range []string{"X-Remote-User", "X-Forwarded-User"} {
+			if user := c.GetHeader(header); user != "" {
+				return user
+			}
+		}
+	}
+	return "api@" + c.ClientIP()
+}
+
+// trustedSource 判断直连地址是否为可信代理
+func (api *ControlPlaneAPI) trustedSource(remoteIP string) bool {
+	ip := net.ParseIP(remoteIP)
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range api.trustedProxies {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseGeneration 解析路径中的配置版本号
+func parseGeneration(c *gin.Context) (int64, bool) {
+	generation, err := strconv.ParseInt(c.Param("generation"), 10, 64)
+	if err != nil || generation <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "无效的配置版本: " + c.Param("generation"),
+		})
+		return 0, false
+	}
+	return generation, true
+}
+
+// getConfigVersions 获取保留的历史配置版本
+func (api *ControlPlaneAPI) getConfigVersions(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success":     true,
+		"versions":    api.dataplaneClient.ConfigVersions(),
+		"rollback_of": api.dataplaneClient.FleetStatus().RollbackOf,
+	})
+}
+
+// getConfigVersion 获取一个历史配置版本及其路由规则
+func (api *ControlPlaneAPI) getConfigVersion(c *gin.Context) {
+	generation, ok := parseGeneration(c)
+	if !ok {
+		return
+	}
+	version, err := api.dataplaneClient.ConfigVersion(generation)
+	if err != nil {
+		api.configError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"version": version,
+	})
+}
+
+// getConfigDiff 比较配置版本与from指定的版本，未指定时与上一个版本比较
+func (api *ControlPlaneAPI) getConfigDiff(c *gin.Context) {
+	generation, ok := parseGeneration(c)
+	if !ok {
+		return
+	}
+	var from int64
+	if value := c.Query("from"); value != "" {
+		var err error
+		if from, err = strconv.ParseInt(value, 10, 64); err != nil || from <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "无效的配置版本: " + value,
+			})
+			return
+		}
+	}
+	diff, err := api.dataplaneClient.ConfigDiff(from, generation)
+	if err != nil {
+		api.configError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"diff":    diff,
+	})
+}
+
+// rollbackConfig 将所有数据面回滚到历史配置版本
+func (api *ControlPlaneAPI) rollbackConfig(c *gin.Context) {
+	generation, ok := parseGeneration(c)
+	if !ok {
+		return
+	}
+	version, err := api.dataplaneClient.Rollback(generation, api.requestAuthor(c))
+	if err != nil && version == nil {
+		api.configError(c, err)
+		return
+	}
+	api.configPushed(c, version, err, fmt.Sprintf("已回滚到第 %d 版，解除回滚前路由变更不会下发", generation))
+}
+
+// resumeConfig 解除回滚，下发最新的路由配置
+func (api *ControlPlaneAPI) resumeConfig(c *gin.Context) {
+	version, err := api.dataplaneClient.Resume(api.requestAuthor(c))
+	if err != nil && version == nil {
+		api.configError(c, err)
+		return
+	}
+	api.configPushed(c, version, err, "已解除回滚，下发最新的路由配置")
+}
+
+// configPushed 返回回滚或解除回滚的结果，部分数据面推送失败时返回202，稍后会自动重试
+func (api *ControlPlaneAPI) configPushed(c *gin.Context, version *ConfigVersionInfo, err error, message string) {
+	if err != nil {
+		c.JSON(http.StatusAccepted, gin.H{
+			"success": true,
+			"message": fmt.Sprintf("%s，但部分数据面推送失败，稍后会自动重试: %v", message, err),
+			"version": version,
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": message,
+		"version": version,
+	})
+}
+
+// configError 根据配置版本操作的错误类型返回对应的状态码
+func (api *ControlPlaneAPI) configError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, ErrConfigVersionNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, ErrConfigNotRolledBack):
+		status = http.StatusConflict
+	}
+	c.JSON(status, gin.H{
+		"success": false,
+		"message": err.Error(),
+	})
+}
+
+// dataplaneQuery 取出查询参数中的数据面实例名称，其余参数原样转发到该实例
+func dataplaneQuery(c *gin.Context) (string, url.Values) {
+	query := c.Request.URL.Query()
+	instance := query.Get("instance")
+	query.Del("instance")
+	return instance, query
+}
+
 // healthCheck 健康检查
 func (api *ControlPlaneAPI) healthCheck(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
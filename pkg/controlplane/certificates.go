@@ -0,0 +1,158 @@
+package controlplane
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// 证书操作的错误类型
+var (
+	ErrCertificateNotFound = errors.New("证书不存在")
+	ErrCertificateReadOnly = errors.New("证书由K8s资源提供，请修改对应的资源")
+)
+
+// CertificateStore 证书的持久化存储，保存后由控制器下发到数据面
+type CertificateStore interface {
+	Save(domain string, certPEM, keyPEM []byte) error
+	Delete(domain string) error
+}
+
+// secretCertificate 从 kubernetes.io/tls Secret 读取的证书
+type secretCertificate struct {
+	source  string // namespace/secret
+	certPEM []byte
+	keyPEM  []byte
+}
+
+// loadTLSSecret 读取Secret中的证书和私钥
+func loadTLSSecret(ctx context.Context, client kubernetes.Interface, namespace, name string) (*secretCertificate, error) {
+	source := fmt.Sprintf("%s/%s", namespace, name)
+	secret, err := client.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	certPEM, keyPEM := secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey]
+	if len(certPEM) == 0 || len(keyPEM) == 0 {
+		return nil, fmt.Errorf("Secret %s 缺少 %s 或 %s", source, corev1.TLSCertKey, corev1.TLSPrivateKeyKey)
+	}
+	return &secretCertificate{source: source, certPEM: certPEM, keyPEM: keyPEM}, nil
+}
+
+// certificateSyncer 将K8s资源引用的证书下发到数据面，只管理自己下发过的域名
+type certificateSyncer struct {
+	client *DataPlaneClient
+	// 已下发到数据面的证书，key: 域名，value: 证书内容摘要
+	certs map[string]string
+	log   *logrus.Logger
+}
+
+// newCertificateSyncer 创建证书同步器
+func newCertificateSyncer(client *DataPlaneClient, log *logrus.Logger) *certificateSyncer {
+	return &certificateSyncer{
+		client: client,
+		certs:  make(map[string]string),
+		log:    log,
+	}
+}
+
+// Sync 内容变化或数据面缺失时重新下发，不再被引用的证书从数据面移除。返回下发失败的域名及原因
+func (s *certificateSyncer) Sync(certs map[string]*secretCertificate) map[string]error {
+	failed := make(map[string]error)
+	present, err := s.client.GetCertificates()
+	if err != nil {
+		s.log.Warnf("获取数据面证书失败，稍后重试: %v", err)
+		for host := range certs {
+			failed[host] = err
+		}
+		return failed
+	}
+	onDataplane := make(map[string]bool, len(present))
+	for _, domain := range present {
+		onDataplane[domain] = true
+	}
+
+	for host, cert := range certs {
+		sum := sha256.Sum256(append(append([]byte{}, cert.certPEM...), cert.keyPEM...))
+		digest := hex.EncodeToString(sum[:])
+		if s.certs[host] == digest && onDataplane[host] {
+			continue
+		}
+
+		if err := s.client.AddCertificatePEM(host, cert.certPEM, cert.keyPEM); err != nil {
+			s.log.Errorf("下发域名 %s 的证书失败: %v", host, err)
+			failed[host] = err
+			continue
+		}
+		s.certs[host] = digest
+		s.log.Infof("已下发域名 %s 的证书（%s）", host, cert.source)
+	}
+
+	for host := range s.certs {
+		if _, ok := certs[host]; ok {
+			continue
+		}
+		if err := s.client.RemoveCertificate(host); err != nil {
+			s.log.Errorf("移除域名 %s 的证书失败: %v", host, err)
+			continue
+		}
+		delete(s.certs, host)
+		s.log.Infof("已移除域名 %s 的证书", host)
+	}
+	return failed
+}
+
+// dataplaneNodeIPs 数据面Pod所在节点的地址，优先使用ExternalIP，结果已排序
+func dataplaneNodeIPs(ctx context.Context, client kubernetes.Interface, namespace, selector string) ([]string, error) {
+	pods, err := client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: selector,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var ips []string
+	for _, pod := range pods.Items {
+		if pod.Spec.NodeName == "" || pod.Status.Phase != corev1.PodRunning || seen[pod.Spec.NodeName] {
+			continue
+		}
+		seen[pod.Spec.NodeName] = true
+
+		node, err := client.CoreV1().Nodes().Get(ctx, pod.Spec.NodeName, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		if ip := nodeAddress(node); ip != "" {
+			ips = append(ips, ip)
+		}
+	}
+
+	sort.Strings(ips)
+	return ips, nil
+}
+
+// nodeAddress 节点对外的地址，没有ExternalIP时使用InternalIP
+func nodeAddress(node *corev1.Node) string {
+	internal := ""
+	for _, address := range node.Status.Addresses {
+		switch address.Type {
+		case corev1.NodeExternalIP:
+			return address.Address
+		case corev1.NodeInternalIP:
+			if internal == "" {
+				internal = address.Address
+			}
+		}
+	}
+	return internal
+}
@@ -2,48 +2,102 @@ package controlplane
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"kun-gateway/pkg/dataplane"
 
 	"github.com/sirupsen/logrus"
+	"k8s.io/client-go/kubernetes"
 )
 
-// DataPlaneClient 数据面客户端
+// DataPlaneClient 数据面客户端。数据面以DaemonSet部署时每个节点一个实例，路由和证书并发推送到所有实例，
+// 并记录每个实例已应用的配置版本；新发现或重启的实例会收到最新的路由和已下发的证书。
+// 通过gRPC订阅配置的实例（见 ConfigServer）不再推送，由订阅连接下发快照
 type DataPlaneClient struct {
-	baseURL string
-	client  *http.Client
-	log     *logrus.Logger
+	discovery DataPlaneDiscovery
+	k8sClient kubernetes.Interface
+	client    *http.Client
+	// 流式请求（如流量抓取）使用的客户端，不设置整体超时
+	streamClient *http.Client
+
+	// instances 数据面实例，key: 实例名称
+	instances map[string]*dataplaneInstance
+	// desired 最新的配置，generation 配置版本的计数
+	desired    *configVersion
+	generation int64
+	// history 最近的配置版本，最多保留historyLimit个；设置了 rollbackStore 时变化后写入存储，historyChanged 通知写入
+	history        []*configVersion
+	historyLimit   int
+	historyChanged chan struct{}
+	// rollback 回滚到的版本，held 回滚期间收到的最新路由，解除回滚后下发
+	rollback *configVersion
+	held     []*dataplane.RouteRule
+	// rollbackStore 持久化回滚状态和历史版本，为空时只保存在内存中；rollbackRestored 回滚由重启前的状态恢复
+	rollbackStore    RollbackStore
+	rollbackRestored bool
+	// rollbackMu 串行化回滚和解除回滚，保证持久化的状态与内存一致
+	rollbackMu sync.Mutex
+	// certs 已下发的证书，新实例加入时重新下发，key: 域名。配置版本引用该集合，变化时复制后替换
+	certs map[string]map[string]string
+	// zones 节点的可用区标签，随路由下发给数据面用于拓扑感知路由，key: 节点名
+	zones map[string]string
+	mu    sync.Mutex
+	log   *logrus.Logger
 }
 
-// NewDataPlaneClient 创建数据面客户端
-func NewDataPlaneClient(baseURL string, log *logrus.Logger) *DataPlaneClient {
-	return &DataPlaneClient{
-		baseURL: baseURL,
+// NewDataPlaneClient 创建数据面客户端，discovery.URLs为空时通过k8sClient按标签选择器发现数据面Pod
+func NewDataPlaneClient(k8sClient kubernetes.Interface, discovery DataPlaneDiscovery, log *logrus.Logger) *DataPlaneClient {
+	if discovery.APIPort == 0 {
+		discovery.APIPort = DefaultDataPlaneAPIPort
+	}
+	c := &DataPlaneClient{
+		discovery: discovery,
+		k8sClient: k8sClient,
 		client: &http.Client{
 			Timeout: 10 * time.Second,
 		},
-		log: log,
-	}
+		streamClient:   &http.Client{},
+		instances:      make(map[string]*dataplaneInstance),
+		certs:          make(map[string]map[string]string),
+		zones:          make(map[string]string),
+		historyLimit:   DefaultConfigHistory,
+		historyChanged: make(chan struct{}, 1),
+		log:            log,
+	}
+	for _, baseURL := range discovery.URLs {
+		c.addInstance(baseURL, "", strings.TrimSuffix(baseURL, "/"), nil)
+	}
+	return c
 }
 
-// UpdateRoutes 更新路由规则
-func (c *DataPlaneClient) UpdateRoutes(rules []*dataplane.RouteRule) error {
-	url := fmt.Sprintf("%s/api/v1/routes", c.baseURL)
-
-	request := dataplane.RouteUpdateRequest{
-		Routes: rules,
+// syncRoutes 将最新的配置版本并发推送到所有数据面实例，已应用该版本的实例跳过，部分实例失败时返回错误，
+// 失败记录在实例状态中。desired 为触发推送的版本，并发推送时各实例下发推送时最新的版本
+func (c *DataPlaneClient) syncRoutes(desired *configVersion) error {
+	if err := c.forEachInstance(c.syncInstance); err != nil {
+		return err
 	}
+	c.log.Infof("路由已推送到全部数据面，配置版本 %s（第 %d 版，%d 条规则）", desired.version, desired.generation, desired.routes)
+	return nil
+}
 
-	jsonData, err := json.Marshal(request)
-	if err != nil {
-		return fmt.Errorf("序列化路由规则失败: %v", err)
+// putRoutes 推送路由规则到一个实例，zone不为空时一并下发实例所在节点的可用区
+func (c *DataPlaneClient) putRoutes(instance *dataplaneInstance, body []byte, zone string) error {
+	var query string
+	if zone != "" {
+		query = "?" + url.Values{"zone": {zone}}.Encode()
 	}
+	url := fmt.Sprintf("%s/api/v1/routes%s", instance.url, query)
 
-	req, err := http.NewRequest("PUT", url, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequest("PUT", url, bytes.NewReader(body))
 	if err != nil {
 		return fmt.Errorf("创建请求失败: %v", err)
 	}
@@ -69,13 +123,17 @@ func (c *DataPlaneClient) UpdateRoutes(rules []*dataplane.RouteRule) error {
 		return fmt.Errorf("更新路由失败: %s", response.Message)
 	}
 
-	c.log.Infof("路由更新成功: %s", response.Message)
+	c.log.Debugf("数据面 %s 路由更新成功: %s", instance.name, response.Message)
 	return nil
 }
 
-// GetRoutes 获取路由规则
-func (c *DataPlaneClient) GetRoutes() ([]*dataplane.RouteRule, error) {
-	url := fmt.Sprintf("%s/api/v1/routes", c.baseURL)
+// GetRoutes 获取数据面实例当前的路由规则，name为空时使用第一个可达的实例
+func (c *DataPlaneClient) GetRoutes(name string) ([]*dataplane.RouteRule, error) {
+	instance, err := c.instanceFor(name)
+	if err != nil {
+		return nil, err
+	}
+	url := fmt.Sprintf("%s/api/v1/routes", instance.url)
 
 	resp, err := c.client.Get(url)
 	if err != nil {
@@ -104,9 +162,52 @@ func (c *DataPlaneClient) GetRoutes() ([]*dataplane.RouteRule, error) {
 	return response.Routes, nil
 }
 
-// GetMetrics 获取监控指标
-func (c *DataPlaneClient) GetMetrics() (map[string]interface{}, error) {
-	url := fmt.Sprintf("%s/api/v1/metrics", c.baseURL)
+// GetMetrics 获取数据面的监控指标，name为空时合并所有实例的计数，延迟摘要由合并后的直方图计算；
+// 部分实例失败时只合并成功的实例
+func (c *DataPlaneClient) GetMetrics(name string) (map[string]interface{}, error) {
+	if name != "" {
+		instance, err := c.instanceFor(name)
+		if err != nil {
+			return nil, err
+		}
+		return c.metrics(instance)
+	}
+
+	var mu sync.Mutex
+	merged := make(map[string]interface{})
+	succeeded := 0
+	err := c.forEachInstance(func(instance *dataplaneInstance) error {
+		metrics, err := c.metrics(instance)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		mergeMetrics(merged, metrics)
+		succeeded++
+		mu.Unlock()
+		return nil
+	})
+	if succeeded == 0 {
+		return nil, err
+	}
+	if err != nil {
+		c.log.Warnf("部分数据面的监控指标获取失败: %v", err)
+	}
+
+	// 各实例的分位数不能相加，改用合并后的直方图计算
+	delete(merged, "latency")
+	if histograms, err := c.GetLatencyHistograms(); err != nil {
+		c.log.Warnf("获取延迟直方图失败: %v", err)
+	} else if histograms.Total != nil && histograms.Total.Count > 0 {
+		merged["latency"] = histograms.Total.Summary()
+	}
+	merged["instances"] = succeeded
+	return merged, nil
+}
+
+// metrics 获取一个实例的监控指标
+func (c *DataPlaneClient) metrics(instance *dataplaneInstance) (map[string]interface{}, error) {
+	url := fmt.Sprintf("%s/api/v1/metrics", instance.url)
 
 	resp, err := c.client.Get(url)
 	if err != nil {
@@ -134,26 +235,305 @@ func (c *DataPlaneClient) GetMetrics() (map[string]interface{}, error) {
 	return response.Metrics, nil
 }
 
-// HealthCheck 健康检查
+// mergeMetrics 把一个实例的指标累加到merged：数值相加，嵌套的维度指标按key逐项相加，时间戳取最新
+func mergeMetrics(merged, metrics map[string]interface{}) {
+	for key, value := range metrics {
+		switch value := value.(type) {
+		case float64:
+			existing, _ := merged[key].(float64)
+			if key == "timestamp" {
+				if value > existing {
+					merged[key] = value
+				}
+				continue
+			}
+			merged[key] = existing + value
+		case map[string]interface{}:
+			existing, ok := merged[key].(map[string]interface{})
+			if !ok {
+				existing = make(map[string]interface{}, len(value))
+				merged[key] = existing
+			}
+			mergeMetrics(existing, value)
+		default:
+			if _, ok := merged[key]; !ok {
+				merged[key] = value
+			}
+		}
+	}
+}
+
+// GetLatencyHistograms 获取所有数据面合并后的延迟直方图，部分实例失败时只合并成功的实例
+func (c *DataPlaneClient) GetLatencyHistograms() (*dataplane.LatencyHistograms, error) {
+	var mu sync.Mutex
+	merged := &dataplane.LatencyHistograms{}
+	succeeded := 0
+	err := c.forEachInstance(func(instance *dataplaneInstance) error {
+		histograms, err := c.latencyHistograms(instance)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		merged.Merge(histograms)
+		succeeded++
+		mu.Unlock()
+		return nil
+	})
+	if succeeded == 0 {
+		return nil, err
+	}
+	if err != nil {
+		c.log.Warnf("部分数据面的延迟直方图获取失败: %v", err)
+	}
+	return merged, nil
+}
+
+// latencyHistograms 获取一个实例的延迟直方图
+func (c *DataPlaneClient) latencyHistograms(instance *dataplaneInstance) (*dataplane.LatencyHistograms, error) {
+	url := fmt.Sprintf("%s/api/v1/metrics/latency?histograms=true", instance.url)
+
+	resp, err := c.client.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("获取延迟直方图失败: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("获取延迟直方图失败，状态码: %d", resp.StatusCode)
+	}
+
+	var response struct {
+		Success    bool                         `json:"success"`
+		Histograms *dataplane.LatencyHistograms `json:"histograms"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("解析响应失败: %v", err)
+	}
+
+	if !response.Success || response.Histograms == nil {
+		return nil, fmt.Errorf("获取延迟直方图失败")
+	}
+
+	return response.Histograms, nil
+}
+
+// GetMetricsSeries 查询数据面的时间序列，query为原样转发的查询参数。name为空时合并所有实例：
+// 计数类指标按时间戳相加，错误率由错误数和请求数计算，平均延迟按请求数加权；部分实例失败时只合并成功的实例
+func (c *DataPlaneClient) GetMetricsSeries(name string, query url.Values) (*dataplane.SeriesResult, error) {
+	if name != "" {
+		instance, err := c.instanceFor(name)
+		if err != nil {
+			return nil, err
+		}
+		return c.metricsSeries(instance, query)
+	}
+
+	metric := query.Get("metric")
+	if metric == "" {
+		metric = dataplane.SeriesQPS
+	}
+	// 比率指标需要分别查询分子和权重
+	parts := []string{metric}
+	switch metric {
+	case dataplane.SeriesErrorRate:
+		parts = []string{dataplane.SeriesErrors, dataplane.SeriesRequests}
+	case dataplane.SeriesLatency:
+		parts = []string{dataplane.SeriesLatency, dataplane.SeriesRequests}
+	}
+
+	var mu sync.Mutex
+	var merged *dataplane.SeriesResult
+	sums := make([]map[int64]float64, len(parts))
+	for i := range sums {
+		sums[i] = make(map[int64]float64)
+	}
+	err := c.forEachInstance(func(instance *dataplaneInstance) error {
+		results := make([]*dataplane.SeriesResult, len(parts))
+		for i, part := range parts {
+			partQuery := url.Values{}
+			for key, values := range query {
+				partQuery[key] = values
+			}
+			partQuery.Set("metric", part)
+			result, err := c.metricsSeries(instance, partQuery)
+			if err != nil {
+				return err
+			}
+			results[i] = result
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if merged == nil {
+			merged = &dataplane.SeriesResult{Metric: metric, Domain: results[0].Domain, Window: results[0].Window, Step: results[0].Step}
+		}
+		if metric == dataplane.SeriesLatency {
+			weights := make(map[int64]float64, len(results[1].Points))
+			for _, point := range results[1].Points {
+				weights[point.Timestamp] = point.Value
+				sums[1][point.Timestamp] += point.Value
+			}
+			for _, point := range results[0].Points {
+				sums[0][point.Timestamp] += point.Value * weights[point.Timestamp]
+			}
+			return nil
+		}
+		for i, result := range results {
+			for _, point := range result.Points {
+				sums[i][point.Timestamp] += point.Value
+			}
+		}
+		return nil
+	})
+	if merged == nil {
+		return nil, err
+	}
+	if err != nil {
+		c.log.Warnf("部分数据面的时间序列查询失败: %v", err)
+	}
+
+	timestamps := make([]int64, 0, len(sums[0]))
+	for ts := range sums[0] {
+		timestamps = append(timestamps, ts)
+	}
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+	merged.Points = make([]dataplane.SeriesValue, 0, len(timestamps))
+	for _, ts := range timestamps {
+		value := sums[0][ts]
+		if len(parts) > 1 {
+			value = 0
+			if sums[1][ts] > 0 {
+				value = sums[0][ts] / sums[1][ts]
+			}
+		}
+		merged.Points = append(merged.Points, dataplane.SeriesValue{Timestamp: ts, Value: value})
+	}
+	return merged, nil
+}
+
+// metricsSeries 查询一个实例的时间序列
+func (c *DataPlaneClient) metricsSeries(instance *dataplaneInstance, query url.Values) (*dataplane.SeriesResult, error) {
+	seriesURL := fmt.Sprintf("%s/api/v1/metrics/series?%s", instance.url, query.Encode())
+
+	resp, err := c.client.Get(seriesURL)
+	if err != nil {
+		return nil, fmt.Errorf("查询时间序列失败: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var response struct {
+		Success bool                    `json:"success"`
+		Message string                  `json:"message"`
+		Series  *dataplane.SeriesResult `json:"series"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("解析响应失败: %v", err)
+	}
+
+	if !response.Success || response.Series == nil {
+		return nil, fmt.Errorf("查询时间序列失败: %s", response.Message)
+	}
+
+	return response.Series, nil
+}
+
+// OpenTap 打开数据面实例的流量抓取SSE流，query为原样转发的查询参数，调用方负责关闭响应体。
+// 抓取只能针对一个实例，有多个实例时必须指定name；ctx取消时连接随之关闭，数据面会结束对应的抓取会话
+func (c *DataPlaneClient) OpenTap(ctx context.Context, name string, query url.Values) (*http.Response, error) {
+	if name == "" && len(c.snapshotInstances()) > 1 {
+		return nil, ErrInstanceRequired
+	}
+	instance, err := c.instanceFor(name)
+	if err != nil {
+		return nil, err
+	}
+	tapURL := fmt.Sprintf("%s/api/v1/tap?%s", instance.url, query.Encode())
+
+	req, err := http.NewRequestWithContext(ctx, "GET", tapURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("创建请求失败: %v", err)
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	resp, err := c.streamClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("打开流量抓取失败: %v", err)
+	}
+
+	return resp, nil
+}
+
+// HealthCheck 检查所有数据面实例的健康状态
 func (c *DataPlaneClient) HealthCheck() error {
-	url := fmt.Sprintf("%s/api/v1/health", c.baseURL)
+	return c.forEachInstance(func(instance *dataplaneInstance) error {
+		_, err := c.instanceVersion(instance)
+		return err
+	})
+}
+
+// instanceVersion 通过健康检查获取实例已应用的配置版本
+func (c *DataPlaneClient) instanceVersion(instance *dataplaneInstance) (string, error) {
+	url := fmt.Sprintf("%s/api/v1/health", instance.url)
 
 	resp, err := c.client.Get(url)
 	if err != nil {
-		return fmt.Errorf("健康检查失败: %v", err)
+		return "", fmt.Errorf("健康检查失败: %v", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("数据面服务不健康，状态码: %d", resp.StatusCode)
+		return "", fmt.Errorf("数据面服务不健康，状态码: %d", resp.StatusCode)
 	}
 
-	return nil
+	var response struct {
+		ConfigVersion string `json:"config_version"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return "", fmt.Errorf("解析响应失败: %v", err)
+	}
+	return response.ConfigVersion, nil
 }
 
-// GetCertificates 获取证书列表
+// GetCertificates 获取证书列表，只返回所有可达的数据面都有的证书，缺少证书的实例会在下次同步时补齐
 func (client *DataPlaneClient) GetCertificates() ([]string, error) {
-	resp, err := client.client.Get(client.baseURL + "/api/v1/certificates")
+	var mu sync.Mutex
+	counts := make(map[string]int)
+	succeeded := 0
+	err := client.forEachInstance(func(instance *dataplaneInstance) error {
+		certificates, err := client.listCertificates(instance)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		for _, domain := range certificates {
+			counts[domain]++
+		}
+		succeeded++
+		return nil
+	})
+	if succeeded == 0 {
+		return nil, err
+	}
+	if err != nil {
+		client.log.Warnf("部分数据面的证书列表获取失败: %v", err)
+	}
+
+	certificates := make([]string, 0, len(counts))
+	for domain, count := range counts {
+		if count == succeeded {
+			certificates = append(certificates, domain)
+		}
+	}
+	sort.Strings(certificates)
+	return certificates, nil
+}
+
+// listCertificates 获取一个实例的证书列表
+func (client *DataPlaneClient) listCertificates(instance *dataplaneInstance) ([]string, error) {
+	resp, err := client.client.Get(instance.url + "/api/v1/certificates")
 	if err != nil {
 		return nil, fmt.Errorf("请求证书列表失败: %v", err)
 	}
@@ -179,20 +559,57 @@ func (client *DataPlaneClient) GetCertificates() ([]string, error) {
 	return result.Certificates, nil
 }
 
-// AddCertificate 添加证书
+// AddCertificate 添加证书，证书文件需在每个数据面所在节点上
 func (client *DataPlaneClient) AddCertificate(domain, certFile, keyFile string) error {
-	data := map[string]string{
+	return client.addCertificate(domain, map[string]string{
 		"domain":    domain,
 		"cert_file": certFile,
 		"key_file":  keyFile,
-	}
+	})
+}
+
+// AddCertificatePEM 以PEM内容添加证书
+func (client *DataPlaneClient) AddCertificatePEM(domain string, certPEM, keyPEM []byte) error {
+	return client.addCertificate(domain, map[string]string{
+		"domain":   domain,
+		"cert_pem": string(certPEM),
+		"key_pem":  string(keyPEM),
+	})
+}
+
+// addCertificate 记录证书并下发到所有数据面，之后加入的实例也会收到。
+// 回滚期间回滚目标不使用该证书时只记录，解除回滚后下发
+func (client *DataPlaneClient) addCertificate(domain string, data map[string]string) error {
+	client.mu.Lock()
+	client.certs = withCertificate(client.certs, domain, data)
+	err := client.refreshLocked(AuthorSystem + "certificate " + domain)
+	apply := reflect.DeepEqual(client.activeCertsLocked()[domain], data)
+	client.mu.Unlock()
+	if err != nil || !apply {
+		return err
+	}
+
+	return client.forEachInstance(func(instance *dataplaneInstance) error {
+		if client.streaming(instance) {
+			return nil
+		}
+		if err := client.postCertificate(instance, data); err != nil {
+			client.recordCertificateFailure(instance, err)
+			return err
+		}
+		// 证书计入配置版本，同步更新实例的版本
+		return client.syncInstance(instance)
+	})
+}
 
+// postCertificate 提交证书到一个实例
+func (client *DataPlaneClient) postCertificate(instance *dataplaneInstance, data map[string]string) error {
 	jsonData, err := json.Marshal(data)
 	if err != nil {
 		return fmt.Errorf("序列化证书数据失败: %v", err)
 	}
 
-	req, err := http.NewRequest("POST", client.baseURL+"/api/v1/certificates", bytes.NewBuffer(jsonData))
+	req, err := http.NewRequest("POST", instance.url+"/api/v1/certificates", bytes.NewBuffer(jsonData))
 	if err != nil {
 		return fmt.Errorf("创建添加证书请求失败: %v", err)
 	}
@@ -225,9 +642,31 @@ func (client *DataPlaneClient) AddCertificate(domain, certFile, keyFile string)
 	return nil
 }
 
-// RemoveCertificate 移除证书
+// RemoveCertificate 从所有数据面移除证书，回滚期间回滚目标仍使用该证书时解除回滚后再移除
 func (client *DataPlaneClient) RemoveCertificate(domain string) error {
-	req, err := http.NewRequest("DELETE", client.baseURL+"/api/v1/certificates/"+domain, nil)
+	client.mu.Lock()
+	client.certs = withCertificate(client.certs, domain, nil)
+	err := client.refreshLocked(AuthorSystem + "certificate " + domain)
+	_, inUse := client.activeCertsLocked()[domain]
+	client.mu.Unlock()
+	if err != nil || inUse {
+		return err
+	}
+
+	return client.forEachInstance(func(instance *dataplaneInstance) error {
+		if client.streaming(instance) {
+			return nil
+		}
+		if err := client.removeCertificate(instance, domain); err != nil {
+			return err
+		}
+		return client.syncInstance(instance)
+	})
+}
+
+// removeCertificate 从一个实例移除证书
+func (client *DataPlaneClient) removeCertificate(instance *dataplaneInstance, domain string) error {
+	req, err := http.NewRequest("DELETE", instance.url+"/api/v1/certificates/"+url.PathEscape(domain), nil)
 	if err != nil {
 		return fmt.Errorf("创建删除请求失败: %v", err)
 	}
@@ -257,3 +696,35 @@ func (client *DataPlaneClient) RemoveCertificate(domain string) error {
 
 	return nil
 }
+
+// pruneCertificates 移除实例上不在keep中的证书
+func (client *DataPlaneClient) pruneCertificates(instance *dataplaneInstance, keep map[string]bool) error {
+	domains, err := client.listCertificates(instance)
+	if err != nil {
+		return err
+	}
+	for _, domain := range domains {
+		if keep[domain] {
+			continue
+		}
+		if err := client.removeCertificate(instance, domain); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// withCertificate 复制证书集合并设置一个域名的证书，data为nil时删除。
+// 配置版本引用生成时的证书集合，证书变化时不能原地修改
+func withCertificate(certs map[string]map[string]string, domain string, data map[string]string) map[string]map[string]string {
+	copied := make(map[string]map[string]string, len(certs)+1)
+	for name, cert := range certs {
+		copied[name] = cert
+	}
+	if data == nil {
+		delete(copied, domain)
+	} else {
+		copied[domain] = data
+	}
+	return copied
+}
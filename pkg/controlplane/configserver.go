@@ -0,0 +1,513 @@
+package controlplane
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"kun-gateway/pkg/dataplane"
+	"kun-gateway/pkg/proto"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// tokenReviewTimeout 校验数据面令牌的超时时间
+	tokenReviewTimeout = 5 * time.Second
+	// podNameExtra 绑定Pod的ServiceAccount令牌在TokenReview结果中携带的Pod名称
+	podNameExtra = "authentication.kubernetes.io/pod-name"
+)
+
+// configResources 一个配置版本通过gRPC下发的资源，key: 资源名称
+type configResources struct {
+	version      string
+	routeOrder   []string
+	routes       map[string]*proto.Resource
+	clusters     map[string]*proto.Resource
+	certificates map[string]*proto.Resource
+}
+
+// ConfigServerOptions 配置订阅服务的安全选项
+type ConfigServerOptions struct {
+	// TLSCertFile、TLSKeyFile 服务端证书和私钥，设置后gRPC使用TLS，下发的证书私钥不再明文传输
+	TLSCertFile string
+	TLSKeyFile  string
+	// Authenticate 是否通过TokenReview校验数据面携带的ServiceAccount令牌，
+	// 令牌的ServiceAccount必须与数据面Pod一致，绑定Pod的令牌还必须属于订阅的实例
+	Authenticate bool
+}
+
+// streamIdentity 订阅连接的令牌校验通过后得到的身份
+type streamIdentity struct {
+	// serviceAccount 格式: namespace/name
+	serviceAccount string
+	// podName 令牌绑定的Pod，旧版本的令牌为空
+	podName string
+}
+
+// configStream 一个数据面的配置订阅连接
+type configStream struct {
+	node *proto.Node
+	// notify 配置变化时通知连接发送新的快照
+	notify chan struct{}
+}
+
+// ConfigServer 实现 DataPlaneService.StreamConfig：数据面订阅后立即收到当前的全量配置，
+// 之后每个版本相对数据面已确认的版本下发增量，数据面回复ACK/NACK，结果记录在数据面同步状态中
+type ConfigServer struct {
+	proto.UnimplementedDataPlaneServiceServer
+
+	client  *DataPlaneClient
+	options ConfigServerOptions
+	server  *grpc.Server
+	log     *logrus.Logger
+}
+
+// NewConfigServer 创建配置订阅服务，证书加载失败时返回错误
+func NewConfigServer(client *DataPlaneClient, options ConfigServerOptions, log *logrus.Logger) (*ConfigServer, error) {
+	s := &ConfigServer{client: client, options: options, log: log}
+	serverOptions := []grpc.ServerOption{
+		// 允许数据面按保活间隔ping，断开的数据面在保活超时后移除
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             dataplane.ConfigStreamKeepalive / 2,
+			PermitWithoutStream: true,
+		}),
+		grpc.KeepaliveParams(keepalive.ServerParameters{
+			Time:    dataplane.ConfigStreamKeepalive,
+			Timeout: 10 * time.Second,
+		}),
+	}
+	if options.TLSCertFile != "" || options.TLSKeyFile != "" {
+		creds, err := credentials.NewServerTLSFromFile(options.TLSCertFile, options.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("加载gRPC服务端证书失败: %v", err)
+		}
+		serverOptions = append(serverOptions, grpc.Creds(creds))
+	} else {
+		log.Warn("配置订阅gRPC服务没有启用TLS，下发的证书私钥以明文传输，端口只应在集群内访问")
+	}
+	if !options.Authenticate {
+		log.Warn("配置订阅gRPC服务没有校验数据面的ServiceAccount令牌")
+	}
+	s.server = grpc.NewServer(serverOptions...)
+	proto.RegisterDataPlaneServiceServer(s.server, s)
+	return s, nil
+}
+
+// Start 启动gRPC服务器
+func (s *ConfigServer) Start(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("监听 %s 失败: %v", addr, err)
+	}
+	s.log.Infof("配置订阅gRPC服务器启动在 %s", addr)
+	return s.server.Serve(listener)
+}
+
+// Stop 关闭gRPC服务器，断开所有订阅
+func (s *ConfigServer) Stop() {
+	s.server.Stop()
+}
+
+// StreamConfig 处理一个数据面的配置订阅。同一时间只有一个快照等待回复，
+// 等待期间的配置变化在收到回复后合并为一个快照下发
+func (s *ConfigServer) StreamConfig(stream proto.DataPlaneService_StreamConfigServer) error {
+	var peerIP string
+	if p, ok := peer.FromContext(stream.Context()); ok {
+		if host, _, err := net.SplitHostPort(p.Addr.String()); err == nil {
+			peerIP = host
+		}
+	}
+	identity, err := s.authenticate(stream.Context())
+	if err != nil {
+		s.log.Warnf("拒绝来自 %s 的配置订阅: %v", peerIP, err)
+		return err
+	}
+
+	req, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	node := req.GetNode()
+	if node.GetId() == "" {
+		return status.Error(codes.InvalidArgument, "订阅的第一条消息需要携带节点信息")
+	}
+	if err := s.client.verifyStream(node.Id, peerIP, identity); err != nil {
+		s.log.Warnf("拒绝来自 %s 的配置订阅（实例 %s）: %v", peerIP, node.Id, err)
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+
+	// 通过订阅加入的实例使用连接的来源地址访问数据面API
+	var url string
+	if peerIP != "" && node.ApiPort > 0 {
+		url = "http://" + net.JoinHostPort(peerIP, strconv.Itoa(int(node.ApiPort)))
+	}
+	cs := &configStream{node: node, notify: make(chan struct{}, 1)}
+	instance := s.client.attachStream(cs, url, req.VersionInfo)
+	defer s.client.detachStream(instance, cs)
+
+	requests := make(chan *proto.ConfigRequest)
+	errs := make(chan error, 1)
+	go func() {
+		for {
+			req, err := stream.Recv()
+			if err != nil {
+				errs <- err
+				return
+			}
+			select {
+			case requests <- req:
+			case <-stream.Context().Done():
+				return
+			}
+		}
+	}()
+
+	var (
+		// acked 数据面已确认的资源，为nil时下发全量
+		acked *configResources
+		// pending 已下发等待回复的版本
+		pending      *configVersion
+		pendingDelta bool
+		nonce        int64
+		// rejected 被拒绝的全量版本，配置变化前不再重复下发
+		rejected string
+	)
+	send := func() error {
+		desired := s.client.currentConfig()
+		if desired == nil || pending != nil || desired.version == rejected {
+			return nil
+		}
+		if acked != nil && acked.version == desired.version {
+			return nil
+		}
+
+		snapshot := desired.resources.snapshot(acked)
+		snapshot.Generation = desired.generation
+		snapshot.Zone = s.client.nodeZone(node.NodeName)
+		nonce++
+		snapshot.Nonce = strconv.FormatInt(nonce, 10)
+		if err := stream.Send(snapshot); err != nil {
+			return err
+		}
+		pending, pendingDelta = desired, snapshot.Delta
+		return nil
+	}
+
+	if err := send(); err != nil {
+		return err
+	}
+	for {
+		select {
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		case err := <-errs:
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		case <-cs.notify:
+		case req := <-requests:
+			if pending == nil || req.ResponseNonce != strconv.FormatInt(nonce, 10) {
+				continue
+			}
+			if req.ErrorDetail == "" {
+				acked, rejected = pending.resources, ""
+				s.client.recordApplied(instance, pending)
+			} else {
+				err := fmt.Errorf("数据面拒绝配置版本 %s: %s", pending.version, req.ErrorDetail)
+				s.log.Warnf("%s: %v", instance.name, err)
+				s.client.recordFailure(instance, err)
+				if pendingDelta {
+					// 增量被拒绝时重新下发全量
+					acked = nil
+				} else {
+					rejected = pending.version
+				}
+			}
+			pending = nil
+		}
+		if err := send(); err != nil {
+			return err
+		}
+	}
+}
+
+// authenticate 通过TokenReview校验连接携带的ServiceAccount令牌（metadata authorization: Bearer <token>），
+// 未开启校验时返回nil
+func (s *ConfigServer) authenticate(ctx context.Context) (*streamIdentity, error) {
+	if !s.options.Authenticate {
+		return nil, nil
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 || !strings.HasPrefix(values[0], "Bearer ") {
+		return nil, status.Error(codes.Unauthenticated, "缺少ServiceAccount令牌")
+	}
+	if s.client.k8sClient == nil {
+		return nil, status.Error(codes.Unavailable, "没有K8s客户端，无法校验令牌")
+	}
+
+	reviewCtx, cancel := context.WithTimeout(ctx, tokenReviewTimeout)
+	defer cancel()
+	review, err := s.client.k8sClient.AuthenticationV1().TokenReviews().Create(reviewCtx, &authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{Token: strings.TrimPrefix(values[0], "Bearer ")},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return nil, status.Errorf(codes.Unavailable, "校验令牌失败: %v", err)
+	}
+	if !review.Status.Authenticated {
+		return nil, status.Errorf(codes.Unauthenticated, "令牌无效: %s", review.Status.Error)
+	}
+
+	// ServiceAccount的用户名格式为 system:serviceaccount:<namespace>:<name>
+	parts := strings.Split(review.Status.User.Username, ":")
+	if len(parts) != 4 || parts[0] != "system" || parts[1] != "serviceaccount" {
+		return nil, status.Errorf(codes.PermissionDenied, "%s 不是ServiceAccount", review.Status.User.Username)
+	}
+	identity := &streamIdentity{serviceAccount: parts[2] + "/" + parts[3]}
+	if names := review.Status.User.Extra[podNameExtra]; len(names) > 0 {
+		identity.podName = names[0]
+	}
+	return identity, nil
+}
+
+// snapshot 生成配置快照，base为nil时为全量，否则为相对base的增量
+func (r *configResources) snapshot(base *configResources) *proto.ConfigSnapshot {
+	snapshot := &proto.ConfigSnapshot{
+		Version:    r.version,
+		RouteOrder: r.routeOrder,
+	}
+	if base == nil {
+		snapshot.Routes = sortedResources(r.routes)
+		snapshot.Clusters = sortedResources(r.clusters)
+		snapshot.Certificates = sortedResources(r.certificates)
+		return snapshot
+	}
+
+	snapshot.Delta = true
+	snapshot.BaseVersion = base.version
+	snapshot.Routes, snapshot.RemovedRoutes = diffResources(base.routes, r.routes)
+	snapshot.Clusters, snapshot.RemovedClusters = diffResources(base.clusters, r.clusters)
+	snapshot.Certificates, snapshot.RemovedCertificates = diffResources(base.certificates, r.certificates)
+	return snapshot
+}
+
+// sortedResources 按名称排序的资源列表
+func sortedResources(resources map[string]*proto.Resource) []*proto.Resource {
+	list := make([]*proto.Resource, 0, len(resources))
+	for _, resource := range resources {
+		list = append(list, resource)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// diffResources 返回相对base新增或变化的资源，以及被删除的资源名称
+func diffResources(base, current map[string]*proto.Resource) ([]*proto.Resource, []string) {
+	var changed []*proto.Resource
+	for name, resource := range current {
+		if old, ok := base[name]; !ok || old.Version != resource.Version {
+			changed = append(changed, resource)
+		}
+	}
+	sort.Slice(changed, func(i, j int) bool { return changed[i].Name < changed[j].Name })
+
+	var removed []string
+	for name := range base {
+		if _, ok := current[name]; !ok {
+			removed = append(removed, name)
+		}
+	}
+	sort.Strings(removed)
+	return changed, removed
+}
+
+// buildConfigResources 把路由规则拆分为路由和集群资源，证书以域名为资源名称
+func buildConfigResources(version string, rules []*dataplane.RouteRule, certs map[string]map[string]string) (*configResources, error) {
+	resources := &configResources{
+		version:      version,
+		routeOrder:   make([]string, 0, len(rules)),
+		routes:       make(map[string]*proto.Resource, len(rules)),
+		clusters:     make(map[string]*proto.Resource),
+		certificates: make(map[string]*proto.Resource, len(certs)),
+	}
+
+	for _, rule := range rules {
+		route := *rule
+		route.Upstreams = nil
+		clusters := make([]string, 0, len(rule.Upstreams))
+		for i := range rule.Upstreams {
+			name := dataplane.ClusterName(rule, rule.Upstreams[i].Name)
+			cluster, err := newResource(name, &rule.Upstreams[i])
+			if err != nil {
+				return nil, err
+			}
+			resources.clusters[name] = cluster
+			clusters = append(clusters, name)
+		}
+
+		resource, err := newResource(rule.Key(), dataplane.RouteResource{RouteRule: &route, Clusters: clusters})
+		if err != nil {
+			return nil, err
+		}
+		resources.routes[resource.Name] = resource
+		resources.routeOrder = append(resources.routeOrder, resource.Name)
+	}
+
+	for domain, cert := range certs {
+		resource, err := newResource(domain, cert)
+		if err != nil {
+			return nil, err
+		}
+		resources.certificates[domain] = resource
+	}
+	return resources, nil
+}
+
+// newResource 以JSON序列化资源，版本为内容的摘要
+func newResource(name string, value interface{}) (*proto.Resource, error) {
+	body, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("序列化资源 %s 失败: %v", name, err)
+	}
+	sum := sha256.Sum256(body)
+	return &proto.Resource{Name: name, Version: hex.EncodeToString(sum[:6]), Body: body}, nil
+}
+
+// currentConfig 返回最新的配置版本，尚未设置路由时为nil
+func (c *DataPlaneClient) currentConfig() *configVersion {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.desired
+}
+
+// notifyStreamsLocked 通知所有订阅连接配置已变化
+func (c *DataPlaneClient) notifyStreamsLocked() {
+	for _, instance := range c.instances {
+		if instance.stream == nil {
+			continue
+		}
+		select {
+		case instance.stream.notify <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// verifyStream 校验订阅连接的身份。按Pod发现数据面时实例名称必须是已发现的Pod，连接的来源地址必须是该Pod的IP；
+// 使用固定地址时来源地址必须是某个数据面地址的主机。identity 不为nil时令牌的ServiceAccount必须与Pod一致，
+// 绑定Pod的令牌必须属于该实例
+func (c *DataPlaneClient) verifyStream(name, peerIP string, identity *streamIdentity) error {
+	if peerIP == "" {
+		return fmt.Errorf("无法获取连接的来源地址")
+	}
+	if identity != nil && identity.podName != "" && identity.podName != name {
+		return fmt.Errorf("令牌属于Pod %s，与实例名称 %s 不一致", identity.podName, name)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.discovery.URLs) > 0 {
+		for _, baseURL := range c.discovery.URLs {
+			if parsed, err := url.Parse(baseURL); err == nil && sameIP(parsed.Hostname(), peerIP) {
+				return nil
+			}
+		}
+		return fmt.Errorf("来源地址 %s 不是任何数据面地址的主机", peerIP)
+	}
+
+	instance, ok := c.instances[name]
+	if !ok || instance.pod == nil {
+		return fmt.Errorf("%s 不是已发现的数据面Pod", name)
+	}
+	matched := false
+	for _, ip := range instance.pod.ips {
+		if sameIP(ip, peerIP) {
+			matched = true
+			break
+		}
+	}
+	if !matched {
+		return fmt.Errorf("来源地址 %s 不是Pod %s 的IP（%s）", peerIP, name, strings.Join(instance.pod.ips, ", "))
+	}
+	if identity != nil && identity.serviceAccount != instance.pod.serviceAccount {
+		return fmt.Errorf("令牌的ServiceAccount %s 与Pod %s 的 %s 不一致", identity.serviceAccount, name, instance.pod.serviceAccount)
+	}
+	return nil
+}
+
+// sameIP 比较两个IP地址，兼容IPv4映射的IPv6地址等不同写法
+func sameIP(a, b string) bool {
+	ipA, ipB := net.ParseIP(a), net.ParseIP(b)
+	return ipA != nil && ipA.Equal(ipB)
+}
+
+// attachStream 登记订阅连接，实例不存在时加入（如未按Pod发现数据面）。同名实例重连时替换之前的连接
+func (c *DataPlaneClient) attachStream(cs *configStream, url, version string) *dataplaneInstance {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	instance, ok := c.instances[cs.node.Id]
+	if !ok {
+		instance = &dataplaneInstance{
+			name:         cs.node.Id,
+			url:          url,
+			streamed:     true,
+			discoveredAt: now,
+		}
+		c.instances[instance.name] = instance
+	}
+	if cs.node.NodeName != "" {
+		instance.node = cs.node.NodeName
+	}
+	instance.stream = cs
+	instance.reachable = true
+	instance.lastSeenAt = now
+	if version != instance.appliedVersion {
+		instance.appliedVersion = version
+		instance.appliedGeneration = 0
+		if c.desired != nil && version == c.desired.version {
+			instance.appliedGeneration = c.desired.generation
+		}
+	}
+	c.log.Infof("数据面 %s 已订阅配置（节点 %s，已应用版本 %q）", instance.name, instance.node, version)
+	return instance
+}
+
+// detachStream 订阅断开。由订阅加入的实例移除，其他实例恢复由控制面推送
+func (c *DataPlaneClient) detachStream(instance *dataplaneInstance, cs *configStream) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if instance.stream != cs {
+		return
+	}
+	instance.stream = nil
+	instance.reachable = false
+	c.log.Infof("数据面 %s 的配置订阅已断开", instance.name)
+	if instance.streamed && c.instances[instance.name] == instance {
+		delete(c.instances, instance.name)
+		c.log.Infof("数据面实例 %s 已移除", instance.name)
+	}
+}
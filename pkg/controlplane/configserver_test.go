@@ -0,0 +1,123 @@
+package controlplane
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/metadata"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func testDataPlanePod(name, ip, serviceAccount string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: name, Labels: map[string]string{"app": "kun-gateway"}},
+		Spec:       corev1.PodSpec{NodeName: "node-" + name, ServiceAccountName: serviceAccount},
+		Status: corev1.PodStatus{
+			Phase:  corev1.PodRunning,
+			PodIP:  ip,
+			PodIPs: []corev1.PodIP{{IP: ip}},
+		},
+	}
+}
+
+// newTestConfigServer 按Pod发现数据面的配置订阅服务，令牌 token-<pod> 属于对应Pod的ServiceAccount
+func newTestConfigServer(t *testing.T, pods ...*corev1.Pod) *ConfigServer {
+	t.Helper()
+	objects := make([]runtime.Object, 0, len(pods))
+	for _, pod := range pods {
+		objects = append(objects, pod)
+	}
+	client := fake.NewSimpleClientset(objects...)
+	client.PrependReactor("create", "tokenreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authenticationv1.TokenReview).DeepCopy()
+		for _, pod := range pods {
+			if review.Spec.Token == "token-"+pod.Name {
+				review.Status.Authenticated = true
+				review.Status.User = authenticationv1.UserInfo{
+					Username: "system:serviceaccount:" + pod.Namespace + ":" + pod.Spec.ServiceAccountName,
+					Extra:    map[string]authenticationv1.ExtraValue{podNameExtra: {pod.Name}},
+				}
+			}
+		}
+		if !review.Status.Authenticated {
+			review.Status.Error = "invalid token"
+		}
+		return true, review, nil
+	})
+
+	log := newTestLogger()
+	dataplaneClient := NewDataPlaneClient(client, DataPlaneDiscovery{Namespace: "kube-system", Selector: "app=kun-gateway"}, log)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	if err := dataplaneClient.Start(ctx); err != nil {
+		t.Fatalf("启动数据面发现失败: %v", err)
+	}
+	server, err := NewConfigServer(dataplaneClient, ConfigServerOptions{Authenticate: true}, log)
+	if err != nil {
+		t.Fatalf("创建配置订阅服务失败: %v", err)
+	}
+	return server
+}
+
+func TestConfigServerAuthenticate(t *testing.T) {
+	server := newTestConfigServer(t,
+		testDataPlanePod("dp-a", "10.0.0.1", "kun-gateway-dataplane"),
+		testDataPlanePod("dp-b", "10.0.0.2", "kun-gateway-dataplane"),
+		testDataPlanePod("other", "10.0.0.3", "default"),
+	)
+	authenticate := func(token string) (*streamIdentity, error) {
+		ctx := context.Background()
+		if token != "" {
+			ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", "Bearer "+token))
+		}
+		return server.authenticate(ctx)
+	}
+
+	if _, err := authenticate(""); err == nil {
+		t.Error("没有令牌的订阅应被拒绝")
+	}
+	if _, err := authenticate("forged"); err == nil {
+		t.Error("无效的令牌应被拒绝")
+	}
+
+	dataplaneAccount := "kube-system/kun-gateway-dataplane"
+	identity, err := authenticate("token-dp-a")
+	if err != nil {
+		t.Fatalf("校验令牌失败: %v", err)
+	}
+	if identity.serviceAccount != dataplaneAccount || identity.podName != "dp-a" {
+		t.Fatalf("令牌的身份错误: %+v", identity)
+	}
+
+	tests := []struct {
+		name     string
+		instance string
+		peerIP   string
+		identity *streamIdentity
+		wantErr  string
+	}{
+		{name: "Pod自己的连接", instance: "dp-a", peerIP: "10.0.0.1", identity: identity},
+		{name: "冒用其他实例的名称", instance: "dp-b", peerIP: "10.0.0.1", identity: identity, wantErr: "令牌属于Pod dp-a"},
+		{name: "来源地址不是Pod的IP", instance: "dp-a", peerIP: "10.0.0.9", identity: identity, wantErr: "不是Pod dp-a 的IP"},
+		{name: "未发现的实例", instance: "unknown", peerIP: "10.0.0.1", wantErr: "不是已发现的数据面Pod"},
+		{name: "ServiceAccount与Pod不一致", instance: "other", peerIP: "10.0.0.3", identity: &streamIdentity{serviceAccount: dataplaneAccount}, wantErr: "与Pod other 的 kube-system/default 不一致"},
+	}
+	for _, tt := range tests {
+		err := server.client.verifyStream(tt.instance, tt.peerIP, tt.identity)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: 应允许订阅: %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: 期望错误包含 %q，实际为 %v", tt.name, tt.wantErr, err)
+		}
+	}
+}
@@ -0,0 +1,674 @@
+package controlplane
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"kun-gateway/pkg/dataplane"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// fleetSyncInterval 检查各数据面已应用的配置版本的间隔，重启或错过推送的实例会重新推送
+	fleetSyncInterval = 10 * time.Second
+	// DefaultDataPlaneAPIPort 数据面API的默认端口
+	DefaultDataPlaneAPIPort = 8080
+)
+
+// 配置下发方式
+const (
+	transportHTTP = "http"
+	transportGRPC = "grpc"
+)
+
+// ErrNoDataPlane 没有发现任何数据面实例
+var ErrNoDataPlane = errors.New("没有发现数据面实例")
+
+// ErrInstanceRequired 有多个数据面实例时，只能针对单个实例的操作需要指定实例
+var ErrInstanceRequired = errors.New("有多个数据面实例，请用 instance 参数指定实例（Pod名称）")
+
+// DataPlaneDiscovery 数据面实例的发现方式：URLs不为空时使用固定地址，否则按标签选择器发现数据面Pod
+type DataPlaneDiscovery struct {
+	URLs      []string
+	Namespace string
+	Selector  string
+	// APIPort 数据面Pod的API端口
+	APIPort int
+}
+
+// podIdentity 按Pod发现的数据面实例的身份，用于校验订阅配置的连接
+type podIdentity struct {
+	ips []string
+	// serviceAccount Pod使用的ServiceAccount，格式: namespace/name
+	serviceAccount string
+}
+
+// dataplaneInstance 一个数据面实例，静态地址的名称为URL，Pod的名称为Pod名
+type dataplaneInstance struct {
+	name string
+	url  string
+	// push 串行化对该实例的推送，保证实例总是收到推送时最新的配置
+	push sync.Mutex
+
+	// 以下字段由 DataPlaneClient.mu 保护
+	node string
+	// pod 按Pod发现时Pod的身份，静态地址和由订阅加入的实例为nil
+	pod *podIdentity
+	// stream 实例通过gRPC订阅配置时的连接，此时配置只通过该连接下发；
+	// streamed 为true表示实例由订阅加入，断开后移除
+	stream            *configStream
+	streamed          bool
+	discoveredAt      time.Time
+	appliedVersion    string
+	appliedGeneration int64
+	appliedAt         time.Time
+	reachable         bool
+	lastSeenAt        time.Time
+	lastAttemptAt     time.Time
+	failures          int
+	totalFailures     int
+	lastError         string
+	// needCerts 新发现或重启的实例需要重新下发全部证书
+	needCerts bool
+	// pruneCerts 回滚或解除回滚后证书集合变化，重新下发时移除实例上不在当前配置中的证书
+	pruneCerts bool
+}
+
+// configVersion 一个版本的配置（路由和证书），版本号为配置内容的摘要，generation在控制面内递增
+type configVersion struct {
+	version    string
+	generation int64
+	author     string
+	// rollbackOf 回滚后生成的版本对应的目标版本
+	rollbackOf int64
+	// changes 相对上一个版本的变化
+	changes ConfigChanges
+	// rules 路由规则，body 推送到数据面REST API的请求体
+	rules     []*dataplane.RouteRule
+	body      []byte
+	routes    int
+	createdAt time.Time
+	// certs 生成该版本的证书，记录后不再修改；从持久化的历史恢复的版本为nil，只有 resources 中的证书摘要
+	certs map[string]map[string]string
+	// resources 通过gRPC下发的资源
+	resources *configResources
+}
+
+// DataPlaneStatus 单个数据面实例的同步状态
+type DataPlaneStatus struct {
+	Name string `json:"name"`
+	Node string `json:"node,omitempty"`
+	// Zone 节点的可用区标签，随配置下发给数据面
+	Zone string `json:"zone,omitempty"`
+	URL  string `json:"url"`
+	// Transport 配置下发方式：http为控制面推送，grpc为数据面订阅
+	Transport         string    `json:"transport"`
+	Reachable         bool      `json:"reachable"`
+	Synced            bool      `json:"synced"`
+	AppliedVersion    string    `json:"applied_version"`
+	AppliedGeneration int64     `json:"applied_generation"`
+	AppliedAt         time.Time `json:"applied_at"`
+	// VersionsBehind 落后最新配置的版本数，已应用的版本不是本控制面推送的时为0
+	VersionsBehind int64 `json:"versions_behind"`
+	// LagSeconds 未同步的时长：从最新配置生成（或实例被发现）开始计算，已同步时为0
+	LagSeconds float64 `json:"lag_seconds"`
+	// Failures 连续失败的次数，TotalFailures 累计失败的次数
+	Failures      int       `json:"failures"`
+	TotalFailures int       `json:"total_failures"`
+	LastError     string    `json:"last_error,omitempty"`
+	LastAttemptAt time.Time `json:"last_attempt_at"`
+	LastSeenAt    time.Time `json:"last_seen_at"`
+	DiscoveredAt  time.Time `json:"discovered_at"`
+}
+
+// FleetStatus 所有数据面实例的同步状态
+type FleetStatus struct {
+	Version     string    `json:"version"`
+	Generation  int64     `json:"generation"`
+	GeneratedAt time.Time `json:"generated_at"`
+	Routes      int       `json:"routes"`
+	Total       int       `json:"total"`
+	Synced      int       `json:"synced"`
+	Unreachable int       `json:"unreachable"`
+	Failing     int       `json:"failing"`
+	// RollbackOf 配置回滚到的版本，解除回滚前为该版本的路由
+	RollbackOf int64 `json:"rollback_of,omitempty"`
+	// RollbackRestored 回滚由控制面重启前保存的状态恢复，RollbackOf 为重启前的编号，不在历史版本中
+	RollbackRestored bool `json:"rollback_restored,omitempty"`
+	// AllSynced 所有实例都已应用最新配置，没有实例时为false
+	AllSynced     bool              `json:"all_synced"`
+	MaxLagSeconds float64           `json:"max_lag_seconds"`
+	Instances     []DataPlaneStatus `json:"instances"`
+}
+
+// Start 开始发现数据面Pod并定期检查各实例的配置版本，需在推送路由前调用；Pod缓存同步后返回
+func (c *DataPlaneClient) Start(ctx context.Context) error {
+	if len(c.discovery.URLs) == 0 {
+		if c.k8sClient == nil {
+			return fmt.Errorf("未指定数据面地址，且没有K8s客户端用于发现数据面Pod")
+		}
+		informer := coreinformers.NewFilteredPodInformer(c.k8sClient, c.discovery.Namespace, informerResyncPeriod, cache.Indexers{}, func(options *metav1.ListOptions) {
+			options.LabelSelector = c.discovery.Selector
+		})
+		if _, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc:    c.onPodUpdate,
+			UpdateFunc: func(_, obj interface{}) { c.onPodUpdate(obj) },
+			DeleteFunc: c.onPodDelete,
+		}); err != nil {
+			return fmt.Errorf("注册数据面Pod事件处理失败: %v", err)
+		}
+		go informer.Run(ctx.Done())
+
+		syncCtx, cancel := context.WithTimeout(ctx, cacheSyncTimeout)
+		defer cancel()
+		if !cache.WaitForCacheSync(syncCtx.Done(), informer.HasSynced) {
+			return fmt.Errorf("等待数据面Pod缓存同步超时")
+		}
+		c.log.Infof("发现 %d 个数据面实例（%s/%s）", len(c.snapshotInstances()), c.discovery.Namespace, c.discovery.Selector)
+	}
+
+	go c.run(ctx)
+	go c.persistHistory(ctx)
+	return nil
+}
+
+// run 定期检查各实例已应用的配置版本
+func (c *DataPlaneClient) run(ctx context.Context) {
+	ticker := time.NewTicker(fleetSyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.reconcile()
+		}
+	}
+}
+
+// reconcile 查询各实例已应用的配置版本，版本不是最新（如实例重启）时重新推送
+func (c *DataPlaneClient) reconcile() {
+	var wg sync.WaitGroup
+	for _, instance := range c.snapshotInstances() {
+		wg.Add(1)
+		go func(instance *dataplaneInstance) {
+			defer wg.Done()
+
+			// 订阅配置的实例由连接保持同步
+			if c.streaming(instance) {
+				return
+			}
+
+			version, err := c.instanceVersion(instance)
+			c.mu.Lock()
+			if err != nil {
+				if instance.reachable {
+					c.log.Warnf("数据面 %s 不可达: %v", instance.name, err)
+				}
+				instance.reachable = false
+				instance.lastError = err.Error()
+				c.mu.Unlock()
+				return
+			}
+			instance.reachable = true
+			instance.lastSeenAt = time.Now()
+			if version != instance.appliedVersion {
+				if version == "" {
+					// 数据面重启后没有任何配置
+					c.log.Infof("数据面 %s 没有配置（可能已重启），重新推送", instance.name)
+					instance.needCerts = true
+				}
+				instance.appliedVersion = version
+				instance.appliedGeneration = 0
+				if c.desired != nil && version == c.desired.version {
+					instance.appliedGeneration = c.desired.generation
+				}
+			}
+			c.mu.Unlock()
+
+			if err := c.syncInstance(instance); err != nil {
+				c.log.Warnf("同步数据面 %s 失败: %v", instance.name, err)
+			}
+		}(instance)
+	}
+	wg.Wait()
+}
+
+// onPodUpdate 运行中且有IP的数据面Pod加入，其他状态的Pod移除
+func (c *DataPlaneClient) onPodUpdate(obj interface{}) {
+	pod, ok := obj.(*corev1.Pod)
+	if !ok {
+		return
+	}
+	if pod.Status.PodIP == "" || pod.Status.Phase != corev1.PodRunning || pod.DeletionTimestamp != nil {
+		c.removeInstance(pod.Name)
+		return
+	}
+
+	url := "http://" + net.JoinHostPort(pod.Status.PodIP, strconv.Itoa(c.discovery.APIPort))
+	identity := &podIdentity{serviceAccount: pod.Namespace + "/" + pod.Spec.ServiceAccountName}
+	for _, ip := range pod.Status.PodIPs {
+		identity.ips = append(identity.ips, ip.IP)
+	}
+	if len(identity.ips) == 0 {
+		identity.ips = []string{pod.Status.PodIP}
+	}
+	if instance := c.addInstance(pod.Name, pod.Spec.NodeName, url, identity); instance != nil {
+		go func() {
+			if err := c.syncInstance(instance); err != nil {
+				c.log.Warnf("向新的数据面 %s 推送配置失败，稍后重试: %v", instance.name, err)
+			}
+		}()
+	}
+}
+
+// onPodDelete 数据面Pod删除
+func (c *DataPlaneClient) onPodDelete(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	if pod, ok := obj.(*corev1.Pod); ok {
+		c.removeInstance(pod.Name)
+	}
+}
+
+// addInstance 添加实例，pod为按Pod发现时Pod的身份。实例已存在且地址不变或正在订阅配置时返回nil
+func (c *DataPlaneClient) addInstance(name, node, url string, pod *podIdentity) *dataplaneInstance {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if existing, ok := c.instances[name]; ok && (existing.url == url || existing.stream != nil) {
+		existing.node = node
+		existing.pod = pod
+		existing.streamed = false
+		return nil
+	}
+	instance := &dataplaneInstance{
+		name:         name,
+		node:         node,
+		url:          url,
+		pod:          pod,
+		discoveredAt: time.Now(),
+		reachable:    true,
+		needCerts:    true,
+	}
+	c.instances[name] = instance
+	c.log.Infof("发现数据面实例 %s（节点 %s，%s）", name, node, url)
+	return instance
+}
+
+// removeInstance 移除实例
+func (c *DataPlaneClient) removeInstance(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	instance, ok := c.instances[name]
+	if !ok {
+		return
+	}
+	if instance.stream != nil {
+		// 订阅仍然连接时保留实例，断开后移除
+		instance.streamed = true
+		return
+	}
+	delete(c.instances, name)
+	c.log.Infof("数据面实例 %s 已移除", name)
+}
+
+// streaming 实例是否通过gRPC订阅配置
+func (c *DataPlaneClient) streaming(instance *dataplaneInstance) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return instance.stream != nil
+}
+
+// snapshotInstances 按名称排序的实例列表
+func (c *DataPlaneClient) snapshotInstances() []*dataplaneInstance {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	instances := make([]*dataplaneInstance, 0, len(c.instances))
+	for _, instance := range c.instances {
+		instances = append(instances, instance)
+	}
+	sort.Slice(instances, func(i, j int) bool { return instances[i].name < instances[j].name })
+	return instances
+}
+
+// instanceFor 返回指定名称的实例，名称为空时返回第一个可达的实例
+func (c *DataPlaneClient) instanceFor(name string) (*dataplaneInstance, error) {
+	instances := c.snapshotInstances()
+	if len(instances) == 0 {
+		return nil, ErrNoDataPlane
+	}
+	if name == "" {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		for _, instance := range instances {
+			if instance.reachable {
+				return instance, nil
+			}
+		}
+		return instances[0], nil
+	}
+	for _, instance := range instances {
+		if instance.name == name {
+			return instance, nil
+		}
+	}
+	return nil, fmt.Errorf("数据面实例不存在: %s", name)
+}
+
+// forEachInstance 并发地对所有实例执行fn，部分实例失败时返回汇总的错误
+func (c *DataPlaneClient) forEachInstance(fn func(instance *dataplaneInstance) error) error {
+	instances := c.snapshotInstances()
+	if len(instances) == 0 {
+		return ErrNoDataPlane
+	}
+
+	errs := make([]error, len(instances))
+	var wg sync.WaitGroup
+	for i, instance := range instances {
+		wg.Add(1)
+		go func(i int, instance *dataplaneInstance) {
+			defer wg.Done()
+			errs[i] = fn(instance)
+		}(i, instance)
+	}
+	wg.Wait()
+
+	var failed []string
+	for i, err := range errs {
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", instances[i].name, err))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%d/%d 个数据面失败: %s", len(failed), len(instances), strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// setDesired 设置最新的路由配置，内容不变时沿用当前版本。配置已回滚时只记录路由，
+// 下发回滚版本的路由（端点使用最新的地址），解除回滚后再下发
+func (c *DataPlaneClient) setDesired(rules []*dataplane.RouteRule, author string) (*configVersion, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.rollback != nil {
+		c.held = rules
+		return c.rebuildLocked(overlayEndpoints(c.rollback.rules, rules), author, c.rollback.generation)
+	}
+	return c.rebuildLocked(rules, author, 0)
+}
+
+// refreshLocked 证书变化后重新生成配置版本，尚未设置路由时只记录证书，避免向数据面推送空的路由表
+func (c *DataPlaneClient) refreshLocked(author string) error {
+	if c.desired == nil {
+		return nil
+	}
+	_, err := c.rebuildLocked(c.desired.rules, author, c.desired.rollbackOf)
+	return err
+}
+
+// rebuildLocked 以路由规则和当前使用的证书（回滚期间为回滚目标的证书）生成配置版本，
+// 内容变化时generation递增、记录到历史并通知订阅配置的实例
+func (c *DataPlaneClient) rebuildLocked(rules []*dataplane.RouteRule, author string, rollbackOf int64) (*configVersion, error) {
+	certs := c.activeCertsLocked()
+	content, err := json.Marshal(struct {
+		Routes       []*dataplane.RouteRule       `json:"routes"`
+		Certificates map[string]map[string]string `json:"certificates"`
+	}{rules, certs})
+	if err != nil {
+		return nil, fmt.Errorf("序列化配置失败: %v", err)
+	}
+	sum := sha256.Sum256(content)
+	version := hex.EncodeToString(sum[:6])
+
+	if c.desired != nil && c.desired.version == version {
+		return c.desired, nil
+	}
+	body, err := json.Marshal(dataplane.RouteUpdateRequest{Routes: rules, Version: version})
+	if err != nil {
+		return nil, fmt.Errorf("序列化路由规则失败: %v", err)
+	}
+	resources, err := buildConfigResources(version, rules, certs)
+	if err != nil {
+		return nil, err
+	}
+	// 重启后的第一个版本与恢复的历史中最新的版本比较
+	var previous *configResources
+	if c.desired != nil {
+		previous = c.desired.resources
+	} else if n := len(c.history); n > 0 {
+		previous = c.history[n-1].resources
+	}
+	c.generation++
+	c.desired = &configVersion{
+		version:    version,
+		generation: c.generation,
+		author:     author,
+		rollbackOf: rollbackOf,
+		changes:    summarizeChanges(previous, resources),
+		rules:      rules,
+		body:       body,
+		routes:     len(rules),
+		createdAt:  time.Now(),
+		certs:      certs,
+		resources:  resources,
+	}
+	c.recordHistoryLocked(c.desired)
+	c.notifyStreamsLocked()
+	return c.desired, nil
+}
+
+// syncInstance 向实例下发缺少的证书和最新的路由配置，已是最新时不推送，返回路由推送的错误。
+// 证书下发失败时仍推送路由，失败记录在实例状态中，证书在下次检查时重新下发
+func (c *DataPlaneClient) syncInstance(instance *dataplaneInstance) error {
+	instance.push.Lock()
+	defer instance.push.Unlock()
+
+	c.mu.Lock()
+	if instance.stream != nil {
+		// 订阅配置的实例由连接推送
+		c.mu.Unlock()
+		return nil
+	}
+	desired := c.desired
+	upToDate := desired == nil || instance.appliedVersion == desired.version
+	var certs []map[string]string
+	var keep map[string]bool
+	if instance.needCerts {
+		active := c.activeCertsLocked()
+		keep = make(map[string]bool, len(active))
+		for domain, cert := range active {
+			certs = append(certs, cert)
+			keep[domain] = true
+		}
+	}
+	needCerts, pruneCerts := instance.needCerts, instance.pruneCerts
+	c.mu.Unlock()
+
+	// 先下发证书，路由生效时HTTPS已可用
+	var certErr error
+	if needCerts {
+		for _, cert := range certs {
+			if certErr = c.postCertificate(instance, cert); certErr != nil {
+				break
+			}
+		}
+		if certErr == nil && pruneCerts {
+			certErr = c.pruneCertificates(instance, keep)
+		}
+		if certErr == nil {
+			c.mu.Lock()
+			instance.needCerts, instance.pruneCerts = false, false
+			c.mu.Unlock()
+		}
+	}
+
+	if !upToDate {
+		if err := c.putRoutes(instance, desired.body, c.nodeZone(instance.node)); err != nil {
+			c.recordFailure(instance, err)
+			return err
+		}
+
+		c.recordApplied(instance, desired)
+	}
+
+	if certErr != nil {
+		c.log.Warnf("向数据面 %s 下发证书失败: %v", instance.name, certErr)
+		c.recordFailure(instance, certErr)
+	}
+	return nil
+}
+
+// nodeZone 返回节点的 topology.kubernetes.io/zone 标签，按节点缓存；节点未知或获取失败时返回空字符串
+func (c *DataPlaneClient) nodeZone(node string) string {
+	if node == "" || c.k8sClient == nil {
+		return ""
+	}
+	c.mu.Lock()
+	zone, ok := c.zones[node]
+	c.mu.Unlock()
+	if ok {
+		return zone
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	object, err := c.k8sClient.CoreV1().Nodes().Get(ctx, node, metav1.GetOptions{})
+	if err != nil {
+		c.log.Warnf("获取节点 %s 的可用区失败: %v", node, err)
+		return ""
+	}
+	zone = object.Labels[corev1.LabelTopologyZone]
+	c.mu.Lock()
+	c.zones[node] = zone
+	c.mu.Unlock()
+	return zone
+}
+
+// recordApplied 记录实例已应用的配置版本
+func (c *DataPlaneClient) recordApplied(instance *dataplaneInstance, desired *configVersion) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	instance.appliedVersion = desired.version
+	instance.appliedGeneration = desired.generation
+	instance.appliedAt = now
+	instance.lastAttemptAt = now
+	instance.lastSeenAt = now
+	instance.reachable = true
+	instance.failures = 0
+	instance.lastError = ""
+}
+
+// recordCertificateFailure 记录证书下发失败，下次检查时重新下发全部证书
+func (c *DataPlaneClient) recordCertificateFailure(instance *dataplaneInstance, err error) {
+	c.mu.Lock()
+	instance.needCerts = true
+	c.mu.Unlock()
+	c.recordFailure(instance, err)
+}
+
+// recordFailure 记录推送失败
+func (c *DataPlaneClient) recordFailure(instance *dataplaneInstance, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	instance.lastAttemptAt = time.Now()
+	instance.failures++
+	instance.totalFailures++
+	instance.lastError = err.Error()
+}
+
+// FleetStatus 返回所有数据面实例的同步状态
+func (c *DataPlaneClient) FleetStatus() FleetStatus {
+	instances := c.snapshotInstances()
+	now := time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	status := FleetStatus{
+		Total:     len(instances),
+		Instances: make([]DataPlaneStatus, 0, len(instances)),
+	}
+	if c.desired != nil {
+		status.Version = c.desired.version
+		status.Generation = c.desired.generation
+		status.GeneratedAt = c.desired.createdAt
+		status.Routes = c.desired.routes
+	}
+	if c.rollback != nil {
+		status.RollbackOf = c.rollback.generation
+		status.RollbackRestored = c.rollbackRestored
+	}
+
+	for _, instance := range instances {
+		item := DataPlaneStatus{
+			Name:              instance.name,
+			Node:              instance.node,
+			Zone:              c.zones[instance.node],
+			URL:               instance.url,
+			Transport:         transportHTTP,
+			Reachable:         instance.reachable,
+			AppliedVersion:    instance.appliedVersion,
+			AppliedGeneration: instance.appliedGeneration,
+			AppliedAt:         instance.appliedAt,
+			Failures:          instance.failures,
+			TotalFailures:     instance.totalFailures,
+			LastError:         instance.lastError,
+			LastAttemptAt:     instance.lastAttemptAt,
+			LastSeenAt:        instance.lastSeenAt,
+			DiscoveredAt:      instance.discoveredAt,
+		}
+		if instance.stream != nil {
+			item.Transport = transportGRPC
+		}
+		item.Synced = c.desired != nil && instance.appliedVersion == c.desired.version
+		if c.desired != nil && !item.Synced {
+			if instance.appliedGeneration > 0 {
+				item.VersionsBehind = c.desired.generation - instance.appliedGeneration
+			}
+			since := c.desired.createdAt
+			if instance.discoveredAt.After(since) {
+				since = instance.discoveredAt
+			}
+			item.LagSeconds = now.Sub(since).Seconds()
+		}
+
+		if item.Synced {
+			status.Synced++
+		}
+		if !item.Reachable {
+			status.Unreachable++
+		}
+		if item.Failures > 0 {
+			status.Failing++
+		}
+		if item.LagSeconds > status.MaxLagSeconds {
+			status.MaxLagSeconds = item.LagSeconds
+		}
+		status.Instances = append(status.Instances, item)
+	}
+	status.AllSynced = status.Total > 0 && status.Synced == status.Total
+	return status
+}
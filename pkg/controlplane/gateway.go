@@ -0,0 +1,1090 @@
+package controlplane
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"kun-gateway/pkg/dataplane"
+
+	"github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// GatewayControllerName GatewayClass中 spec.controllerName 的取值
+	GatewayControllerName = "kun-gateway.io/gateway-controller"
+
+	gatewayGroup = "gateway.networking.k8s.io"
+
+	// gatewayResyncInterval 定期全量同步的间隔，同时用于发现Secret和Service端口的变化
+	gatewayResyncInterval = 30 * time.Second
+	// gatewaySyncDelay 资源变化后等待的时间，合并短时间内的多次变化
+	gatewaySyncDelay = time.Second
+)
+
+// Gateway API 的状态条件
+const (
+	conditionAccepted         = "Accepted"
+	conditionResolvedRefs     = "ResolvedRefs"
+	conditionProgrammed       = "Programmed"
+	conditionPartiallyInvalid = "PartiallyInvalid"
+
+	reasonAccepted                   = "Accepted"
+	reasonResolvedRefs               = "ResolvedRefs"
+	reasonProgrammed                 = "Programmed"
+	reasonInvalid                    = "Invalid"
+	reasonListenersNotValid          = "ListenersNotValid"
+	reasonAddressNotAssigned         = "AddressNotAssigned"
+	reasonPortUnavailable            = "PortUnavailable"
+	reasonUnsupportedProtocol        = "UnsupportedProtocol"
+	reasonUnsupportedValue           = "UnsupportedValue"
+	reasonInvalidCertificateRef      = "InvalidCertificateRef"
+	reasonInvalidRouteKinds          = "InvalidRouteKinds"
+	reasonRefNotPermitted            = "RefNotPermitted"
+	reasonInvalidKind                = "InvalidKind"
+	reasonBackendNotFound            = "BackendNotFound"
+	reasonNotAllowedByListeners      = "NotAllowedByListeners"
+	reasonNoMatchingListenerHostname = "NoMatchingListenerHostname"
+	reasonNoMatchingParent           = "NoMatchingParent"
+)
+
+var (
+	gatewayClassGVR   = schema.GroupVersionResource{Group: gatewayGroup, Version: "v1", Resource: "gatewayclasses"}
+	gatewayGVR        = schema.GroupVersionResource{Group: gatewayGroup, Version: "v1", Resource: "gateways"}
+	httpRouteGVR      = schema.GroupVersionResource{Group: gatewayGroup, Version: "v1", Resource: "httproutes"}
+	grpcRouteGVR      = schema.GroupVersionResource{Group: gatewayGroup, Version: "v1", Resource: "grpcroutes"}
+	referenceGrantGVR = schema.GroupVersionResource{Group: gatewayGroup, Version: "v1beta1", Resource: "referencegrants"}
+)
+
+// GatewayConfig Gateway API控制器配置
+type GatewayConfig struct {
+	// HTTPPort 和 HTTPSPort 数据面对外暴露的端口，监听器端口必须与之一致
+	HTTPPort  int32
+	HTTPSPort int32
+	// DataPlaneNamespace 和 DataPlaneSelector 用于查找数据面Pod，回写Gateway的地址
+	DataPlaneNamespace string
+	DataPlaneSelector  string
+}
+
+// GatewayController 将 gateway.networking.k8s.io 的 Gateway、HTTPRoute、GRPCRoute 转换为数据面路由和证书
+type GatewayController struct {
+	client          kubernetes.Interface
+	dynamicClient   dynamic.Interface
+	k8sDiscovery    *K8sDiscovery
+	routeManager    *RouteManager
+	dataplaneClient *DataPlaneClient
+	config          GatewayConfig
+	certs           *certificateSyncer
+	trigger         chan struct{}
+	// watching 已启动informer的资源，只在Start和run中访问
+	watching map[schema.GroupVersionResource]bool
+	log      *logrus.Logger
+}
+
+// Gateway 中控制器用到的字段
+
+type gatewaySpec struct {
+	GatewayClassName string            `json:"gatewayClassName"`
+	Listeners        []gatewayListener `json:"listeners,omitempty"`
+}
+
+type gatewayListener struct {
+	Name          string         `json:"name"`
+	Hostname      *string        `json:"hostname,omitempty"`
+	Port          int32          `json:"port"`
+	Protocol      string         `json:"protocol"`
+	TLS           *gatewayTLS    `json:"tls,omitempty"`
+	AllowedRoutes *allowedRoutes `json:"allowedRoutes,omitempty"`
+}
+
+type gatewayTLS struct {
+	Mode            *string           `json:"mode,omitempty"`
+	CertificateRefs []objectReference `json:"certificateRefs,omitempty"`
+}
+
+type objectReference struct {
+	Group     *string `json:"group,omitempty"`
+	Kind      *string `json:"kind,omitempty"`
+	Name      string  `json:"name"`
+	Namespace *string `json:"namespace,omitempty"`
+}
+
+type allowedRoutes struct {
+	Namespaces *struct {
+		From     *string               `json:"from,omitempty"`
+		Selector *metav1.LabelSelector `json:"selector,omitempty"`
+	} `json:"namespaces,omitempty"`
+	Kinds []routeGroupKind `json:"kinds,omitempty"`
+}
+
+type routeGroupKind struct {
+	Group *string `json:"group,omitempty"`
+	Kind  string  `json:"kind"`
+}
+
+type referenceGrantSpec struct {
+	From []struct {
+		Group     string `json:"group"`
+		Kind      string `json:"kind"`
+		Namespace string `json:"namespace"`
+	} `json:"from"`
+	To []struct {
+		Group string  `json:"group"`
+		Kind  string  `json:"kind"`
+		Name  *string `json:"name,omitempty"`
+	} `json:"to"`
+}
+
+// 写回的状态
+
+type gatewayStatus struct {
+	Addresses  []gatewayStatusAddress `json:"addresses,omitempty"`
+	Conditions []metav1.Condition     `json:"conditions,omitempty"`
+	Listeners  []listenerStatus       `json:"listeners,omitempty"`
+}
+
+type gatewayStatusAddress struct {
+	Type  *string `json:"type,omitempty"`
+	Value string  `json:"value"`
+}
+
+type listenerStatus struct {
+	Name           string             `json:"name"`
+	SupportedKinds []routeGroupKind   `json:"supportedKinds"`
+	AttachedRoutes int32              `json:"attachedRoutes"`
+	Conditions     []metav1.Condition `json:"conditions"`
+}
+
+type routeStatus struct {
+	Parents []routeParentStatus `json:"parents"`
+}
+
+type routeParentStatus struct {
+	ParentRef      parentReference    `json:"parentRef"`
+	ControllerName string             `json:"controllerName"`
+	Conditions     []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// gatewayState 一次同步中Gateway的计算结果
+type gatewayState struct {
+	object    *unstructured.Unstructured
+	meta      metav1.ObjectMeta
+	listeners []*listenerState
+}
+
+// listenerState 监听器的校验结果和挂载的路由数
+type listenerState struct {
+	gateway        *gatewayState
+	listener       gatewayListener
+	supportedKinds []routeGroupKind
+	cert           *secretCertificate
+	accepted       bool
+	reason         string
+	message        string
+	refsResolved   bool
+	refsReason     string
+	refsMessage    string
+	attachedRoutes int32
+}
+
+// parentState 路由挂载到某个Gateway的结果
+type parentState struct {
+	ref          parentReference
+	accepted     bool
+	reason       string
+	message      string
+	refsResolved bool
+	refsReason   string
+	refsMessage  string
+}
+
+// NewGatewayController 创建Gateway API控制器
+func NewGatewayController(client kubernetes.Interface, dynamicClient dynamic.Interface, k8sDiscovery *K8sDiscovery, routeManager *RouteManager, dataplaneClient *DataPlaneClient, config GatewayConfig, log *logrus.Logger) *GatewayController {
+	if config.HTTPPort == 0 {
+		config.HTTPPort = 80
+	}
+	if config.HTTPSPort == 0 {
+		config.HTTPSPort = 443
+	}
+	return &GatewayController{
+		client:          client,
+		dynamicClient:   dynamicClient,
+		k8sDiscovery:    k8sDiscovery,
+		routeManager:    routeManager,
+		dataplaneClient: dataplaneClient,
+		config:          config,
+		certs:           newCertificateSyncer(dataplaneClient, log),
+		trigger:         make(chan struct{}, 1),
+		watching:        make(map[schema.GroupVersionResource]bool),
+		log:             log,
+	}
+}
+
+// Start 先完成一次全量同步，保证路由管理器首次推送时已包含Gateway路由，然后在后台监听变化直到ctx结束
+func (c *GatewayController) Start(ctx context.Context) {
+	c.log.Infof("启动Gateway API控制器，controllerName: %s", GatewayControllerName)
+
+	c.sync(ctx)
+	c.startInformers(ctx)
+	go c.run(ctx)
+}
+
+// run 在资源变化或定期同步时重新生成路由
+func (c *GatewayController) run(ctx context.Context) {
+	ticker := time.NewTicker(gatewayResyncInterval)
+	defer ticker.Stop()
+
+	var delay <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.trigger:
+			if delay == nil {
+				delay = time.After(gatewaySyncDelay)
+			}
+		case <-delay:
+			delay = nil
+			c.sync(ctx)
+		case <-ticker.C:
+			c.startInformers(ctx)
+			c.sync(ctx)
+		}
+	}
+}
+
+// startInformers 为集群中已安装的Gateway API资源启动informer，任何变化都触发一次全量同步。
+// 没有安装的CRD在定期同步时再检查，安装后开始监听
+func (c *GatewayController) startInformers(ctx context.Context) {
+	for _, gvr := range []schema.GroupVersionResource{gatewayClassGVR, gatewayGVR, httpRouteGVR, grpcRouteGVR, referenceGrantGVR} {
+		if c.watching[gvr] {
+			continue
+		}
+		if _, err := c.dynamicClient.Resource(gvr).List(ctx, metav1.ListOptions{Limit: 1}); err != nil {
+			if apierrors.IsNotFound(err) {
+				c.log.Debugf("集群中没有 %s，稍后重试", gvr.Resource)
+			} else {
+				c.log.Errorf("监听 %s 失败: %v", gvr.Resource, err)
+			}
+			continue
+		}
+
+		informer := dynamicinformer.NewFilteredDynamicInformer(c.dynamicClient, gvr, metav1.NamespaceAll, informerResyncPeriod, cache.Indexers{}, nil).Informer()
+		if err := startTriggerInformer(ctx, informer, c.notify); err != nil {
+			c.log.Errorf("监听 %s 失败: %v", gvr.Resource, err)
+			continue
+		}
+		c.watching[gvr] = true
+	}
+}
+
+// notify 触发一次同步，不阻塞
+func (c *GatewayController) notify() {
+	select {
+	case c.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// sync 全量同步：校验Gateway、生成路由、下发证书、回写状态
+func (c *GatewayController) sync(ctx context.Context) {
+	classes, err := c.syncGatewayClasses(ctx)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			c.log.Debug("集群未安装Gateway API CRD，跳过同步")
+			return
+		}
+		c.log.Errorf("同步Gateway API失败: %v", err)
+		return
+	}
+
+	grants, err := c.listReferenceGrants(ctx)
+	if err != nil {
+		c.log.Warnf("获取ReferenceGrant失败，跨命名空间引用将被拒绝: %v", err)
+	}
+
+	gateways, err := c.listGateways(ctx, classes, grants)
+	if err != nil {
+		c.log.Errorf("同步Gateway失败: %v", err)
+		return
+	}
+
+	routes, err := c.listRoutes(ctx)
+	if err != nil {
+		c.log.Errorf("同步Gateway路由失败: %v", err)
+		return
+	}
+
+	certs := make(map[string]*secretCertificate)
+	namespaceLabels := make(map[string]labels.Set)
+	parents := make(map[*gatewayRoute][]*parentState)
+	var entries []*gatewayEntry
+	routeNotes := make(map[*gatewayRoute][]string)
+	for _, route := range routes {
+		states, hostnames := c.attachRoute(ctx, route, gateways, namespaceLabels, certs)
+		if len(states) == 0 {
+			continue
+		}
+		parents[route] = states
+		if len(hostnames) == 0 {
+			continue
+		}
+
+		routeEntries, reason, message, notes := c.translateRoute(route, hostnames, grants)
+		entries = append(entries, routeEntries...)
+		routeNotes[route] = append(routeNotes[route], notes...)
+		for _, state := range states {
+			if !state.accepted {
+				continue
+			}
+			if reason != "" {
+				state.refsResolved, state.refsReason, state.refsMessage = false, reason, message
+			}
+			if len(routeEntries) == 0 && reason == "" {
+				state.accepted, state.reason = false, reasonUnsupportedValue
+				state.message = strings.Join(notes, "; ")
+			}
+		}
+	}
+
+	generated, notes := mergeGatewayEntries(entries)
+	for route, list := range notes {
+		routeNotes[route] = append(routeNotes[route], list...)
+	}
+
+	c.routeManager.SetSourceRoutes(RouteSourceGateway, generated)
+	c.certs.Sync(certs)
+
+	addresses, err := dataplaneNodeIPs(ctx, c.client, c.config.DataPlaneNamespace, c.config.DataPlaneSelector)
+	if err != nil {
+		c.log.Warnf("获取数据面节点地址失败: %v", err)
+	}
+	for _, gateway := range gateways {
+		c.updateGatewayStatus(ctx, gateway, addresses)
+	}
+	for _, route := range routes {
+		c.updateRouteStatus(ctx, route, parents[route], routeNotes[route])
+	}
+
+	c.log.Debugf("Gateway API同步完成，%d 个Gateway，%d 个路由资源，%d 条路由，%d 个证书", len(gateways), len(routes), len(generated), len(certs))
+}
+
+// syncGatewayClasses 接受由本控制器处理的GatewayClass，返回其名称
+func (c *GatewayController) syncGatewayClasses(ctx context.Context) (map[string]bool, error) {
+	list, err := c.dynamicClient.Resource(gatewayClassGVR).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	owned := make(map[string]bool)
+	for i := range list.Items {
+		class := &list.Items[i]
+		controller, _, _ := unstructured.NestedString(class.Object, "spec", "controllerName")
+		if controller != GatewayControllerName {
+			continue
+		}
+		owned[class.GetName()] = true
+
+		existing, _, _ := unstructured.NestedSlice(class.Object, "status", "conditions")
+		conditions := parseConditions(existing)
+		before := marshalStatus(conditions)
+		setCondition(&conditions, class.GetGeneration(), conditionAccepted, true, reasonAccepted, "")
+		if marshalStatus(conditions) == before {
+			continue
+		}
+
+		updated := class.DeepCopy()
+		if err := setStatusField(updated, conditions, "status", "conditions"); err != nil {
+			c.log.Warnf("更新GatewayClass %s 状态失败: %v", class.GetName(), err)
+			continue
+		}
+		if _, err := c.dynamicClient.Resource(gatewayClassGVR).UpdateStatus(ctx, updated, metav1.UpdateOptions{}); err != nil {
+			c.log.Warnf("更新GatewayClass %s 状态失败: %v", class.GetName(), err)
+			continue
+		}
+		c.log.Infof("已接受GatewayClass %s", class.GetName())
+	}
+	return owned, nil
+}
+
+// listGateways 列出使用本控制器GatewayClass的Gateway并校验监听器，按创建时间排序
+func (c *GatewayController) listGateways(ctx context.Context, classes map[string]bool, grants []referenceGrantSpecWithNamespace) ([]*gatewayState, error) {
+	list, err := c.dynamicClient.Resource(gatewayGVR).Namespace("").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	var gateways []*gatewayState
+	for i := range list.Items {
+		object := &list.Items[i]
+		var spec gatewaySpec
+		if err := fromUnstructuredField(object, &spec, "spec"); err != nil {
+			c.log.Warnf("%v", err)
+			continue
+		}
+		if !classes[spec.GatewayClassName] {
+			continue
+		}
+
+		gateway := &gatewayState{object: object, meta: objectMeta(object)}
+		for _, listener := range spec.Listeners {
+			gateway.listeners = append(gateway.listeners, c.checkListener(ctx, gateway, listener, grants))
+		}
+		gateways = append(gateways, gateway)
+	}
+
+	sort.SliceStable(gateways, func(i, j int) bool {
+		a, b := gateways[i].meta, gateways[j].meta
+		if !a.CreationTimestamp.Equal(&b.CreationTimestamp) {
+			return a.CreationTimestamp.Before(&b.CreationTimestamp)
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Name < b.Name
+	})
+	return gateways, nil
+}
+
+// checkListener 校验监听器的协议、端口、证书和允许的路由类型
+func (c *GatewayController) checkListener(ctx context.Context, gateway *gatewayState, listener gatewayListener, grants []referenceGrantSpecWithNamespace) *listenerState {
+	state := &listenerState{gateway: gateway, listener: listener, accepted: true, refsResolved: true}
+
+	var kinds []string
+	switch listener.Protocol {
+	case "HTTP":
+		kinds = []string{"HTTPRoute"}
+		if listener.Port != c.config.HTTPPort {
+			state.accepted, state.reason = false, reasonPortUnavailable
+			state.message = fmt.Sprintf("HTTP监听器端口必须为 %d", c.config.HTTPPort)
+		}
+	case "HTTPS":
+		// 数据面只在HTTPS监听器上支持h2c上游，GRPCRoute只能挂载到HTTPS监听器
+		kinds = []string{"HTTPRoute", "GRPCRoute"}
+		if listener.Port != c.config.HTTPSPort {
+			state.accepted, state.reason = false, reasonPortUnavailable
+			state.message = fmt.Sprintf("HTTPS监听器端口必须为 %d", c.config.HTTPSPort)
+		}
+		c.resolveListenerCertificate(ctx, state, grants)
+	default:
+		state.accepted, state.reason = false, reasonUnsupportedProtocol
+		state.message = fmt.Sprintf("不支持的协议 %s", listener.Protocol)
+	}
+
+	if listener.AllowedRoutes != nil && len(listener.AllowedRoutes.Kinds) > 0 {
+		var invalid []string
+		for _, kind := range listener.AllowedRoutes.Kinds {
+			if stringValue(kind.Group, gatewayGroup) == gatewayGroup && containsString(kinds, kind.Kind) {
+				state.supportedKinds = append(state.supportedKinds, routeGroupKind{Group: stringPtr(gatewayGroup), Kind: kind.Kind})
+			} else {
+				invalid = append(invalid, kind.Kind)
+			}
+		}
+		if len(invalid) > 0 {
+			state.refsResolved, state.refsReason = false, reasonInvalidRouteKinds
+			state.refsMessage = fmt.Sprintf("不支持的路由类型 %s", strings.Join(invalid, ", "))
+		}
+	} else {
+		for _, kind := range kinds {
+			state.supportedKinds = append(state.supportedKinds, routeGroupKind{Group: stringPtr(gatewayGroup), Kind: kind})
+		}
+	}
+
+	if state.reason == "" {
+		state.reason = reasonAccepted
+	}
+	if state.refsReason == "" {
+		state.refsReason = reasonResolvedRefs
+	}
+	return state
+}
+
+// resolveListenerCertificate 读取HTTPS监听器引用的证书，跨命名空间引用需要ReferenceGrant
+func (c *GatewayController) resolveListenerCertificate(ctx context.Context, state *listenerState, grants []referenceGrantSpecWithNamespace) {
+	tls := state.listener.TLS
+	if tls != nil && stringValue(tls.Mode, "Terminate") != "Terminate" {
+		state.accepted, state.reason = false, reasonUnsupportedValue
+		state.message = fmt.Sprintf("不支持的TLS模式 %s", *tls.Mode)
+		return
+	}
+	if tls == nil || len(tls.CertificateRefs) == 0 {
+		state.refsResolved, state.refsReason = false, reasonInvalidCertificateRef
+		state.refsMessage = "HTTPS监听器必须指定证书"
+		return
+	}
+
+	gateway := state.gateway.meta
+	ref := tls.CertificateRefs[0]
+	namespace := stringValue(ref.Namespace, gateway.Namespace)
+	switch {
+	case stringValue(ref.Group, "") != "" || stringValue(ref.Kind, "Secret") != "Secret":
+		state.refsResolved, state.refsReason = false, reasonInvalidCertificateRef
+		state.refsMessage = fmt.Sprintf("不支持的证书引用类型 %s", stringValue(ref.Kind, ""))
+	case namespace != gateway.Namespace && !referenceAllowed(grants, gatewayGroup, "Gateway", gateway.Namespace, "", "Secret", namespace, ref.Name):
+		state.refsResolved, state.refsReason = false, reasonRefNotPermitted
+		state.refsMessage = fmt.Sprintf("没有ReferenceGrant允许引用Secret %s/%s", namespace, ref.Name)
+	default:
+		cert, err := loadTLSSecret(ctx, c.client, namespace, ref.Name)
+		if err != nil {
+			state.refsResolved, state.refsReason = false, reasonInvalidCertificateRef
+			state.refsMessage = fmt.Sprintf("读取证书 %s/%s 失败: %v", namespace, ref.Name, err)
+			return
+		}
+		state.cert = cert
+	}
+}
+
+// listRoutes 列出HTTPRoute和GRPCRoute，按创建时间排序，冲突时先创建的优先
+func (c *GatewayController) listRoutes(ctx context.Context) ([]*gatewayRoute, error) {
+	var routes []*gatewayRoute
+	for _, item := range []struct {
+		gvr   schema.GroupVersionResource
+		parse func(*unstructured.Unstructured) (*gatewayRoute, error)
+	}{
+		{httpRouteGVR, parseHTTPRoute},
+		{grpcRouteGVR, parseGRPCRoute},
+	} {
+		list, err := c.dynamicClient.Resource(item.gvr).Namespace("").List(ctx, metav1.ListOptions{})
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				// 较旧的Gateway API版本没有GRPCRoute
+				c.log.Debugf("集群中没有 %s", item.gvr.Resource)
+				continue
+			}
+			return nil, err
+		}
+		for i := range list.Items {
+			route, err := item.parse(&list.Items[i])
+			if err != nil {
+				c.log.Warnf("%v", err)
+				continue
+			}
+			routes = append(routes, route)
+		}
+	}
+
+	sortGatewayRoutes(routes)
+	return routes, nil
+}
+
+// attachRoute 将路由挂载到匹配的监听器，返回由本控制器处理的父资源状态，以及路由生效的域名
+func (c *GatewayController) attachRoute(ctx context.Context, route *gatewayRoute, gateways []*gatewayState, namespaceLabels map[string]labels.Set, certs map[string]*secretCertificate) ([]*parentState, []string) {
+	var states []*parentState
+	var hostnames []string
+	seen := make(map[string]bool)
+
+	for _, ref := range route.parentRefs {
+		if stringValue(ref.Group, gatewayGroup) != gatewayGroup || stringValue(ref.Kind, "Gateway") != "Gateway" {
+			continue
+		}
+		namespace := stringValue(ref.Namespace, route.meta.Namespace)
+		var gateway *gatewayState
+		for _, candidate := range gateways {
+			if candidate.meta.Namespace == namespace && candidate.meta.Name == ref.Name {
+				gateway = candidate
+				break
+			}
+		}
+		if gateway == nil {
+			// 不是本控制器处理的Gateway
+			continue
+		}
+
+		state := &parentState{ref: ref, refsResolved: true, refsReason: reasonResolvedRefs}
+		states = append(states, state)
+
+		var matched []*listenerState
+		for _, listener := range gateway.listeners {
+			if ref.SectionName != nil && *ref.SectionName != listener.listener.Name {
+				continue
+			}
+			if ref.Port != nil && *ref.Port != listener.listener.Port {
+				continue
+			}
+			matched = append(matched, listener)
+		}
+		if len(matched) == 0 {
+			state.reason, state.message = reasonNoMatchingParent, "没有匹配的监听器"
+			continue
+		}
+
+		reason, message := reasonNotAllowedByListeners, "监听器不允许挂载该路由"
+		for _, listener := range matched {
+			if !listener.accepted || !c.listenerAllows(ctx, listener, route, namespaceLabels) {
+				continue
+			}
+			accepted := intersectHostnames(listener.listener.Hostname, route.hostnames)
+			if len(accepted) == 0 {
+				reason, message = reasonNoMatchingListenerHostname, "路由域名与监听器域名不匹配"
+				continue
+			}
+
+			state.accepted = true
+			listener.attachedRoutes++
+			for _, hostname := range accepted {
+				if !seen[hostname] {
+					seen[hostname] = true
+					hostnames = append(hostnames, hostname)
+				}
+				if listener.cert != nil && hostname != "" {
+					if _, ok := certs[hostname]; !ok {
+						certs[hostname] = listener.cert
+					}
+				}
+			}
+		}
+		if state.accepted {
+			state.reason, state.message = reasonAccepted, ""
+		} else {
+			state.reason, state.message = reason, message
+		}
+	}
+	return states, hostnames
+}
+
+// listenerAllows 判断监听器是否允许挂载路由：路由类型和所在命名空间
+func (c *GatewayController) listenerAllows(ctx context.Context, listener *listenerState, route *gatewayRoute, namespaceLabels map[string]labels.Set) bool {
+	kindAllowed := false
+	for _, kind := range listener.supportedKinds {
+		if kind.Kind == route.kind {
+			kindAllowed = true
+			break
+		}
+	}
+	if !kindAllowed {
+		return false
+	}
+
+	gatewayNamespace := listener.gateway.meta.Namespace
+	allowed := listener.listener.AllowedRoutes
+	if allowed == nil || allowed.Namespaces == nil {
+		return route.meta.Namespace == gatewayNamespace
+	}
+
+	switch stringValue(allowed.Namespaces.From, "Same") {
+	case "All":
+		return true
+	case "Same":
+		return route.meta.Namespace == gatewayNamespace
+	case "Selector":
+		if allowed.Namespaces.Selector == nil {
+			return false
+		}
+		selector, err := metav1.LabelSelectorAsSelector(allowed.Namespaces.Selector)
+		if err != nil {
+			c.log.Warnf("Gateway %s/%s 监听器 %s 的命名空间选择器无效: %v", gatewayNamespace, listener.gateway.meta.Name, listener.listener.Name, err)
+			return false
+		}
+		set, ok := namespaceLabels[route.meta.Namespace]
+		if !ok {
+			namespace, err := c.client.CoreV1().Namespaces().Get(ctx, route.meta.Namespace, metav1.GetOptions{})
+			if err != nil {
+				c.log.Warnf("获取命名空间 %s 失败: %v", route.meta.Namespace, err)
+				return false
+			}
+			set = labels.Set(namespace.Labels)
+			namespaceLabels[route.meta.Namespace] = set
+		}
+		return selector.Matches(set)
+	}
+	return false
+}
+
+// translateRoute 将路由规则转换为转发规则。返回后端解析失败的原因，以及无法生效的规则说明
+func (c *GatewayController) translateRoute(route *gatewayRoute, hostnames []string, grants []referenceGrantSpecWithNamespace) ([]*gatewayEntry, string, string, []string) {
+	var entries []*gatewayEntry
+	var notes []string
+	var reason, message string
+
+	for i, rule := range route.rules {
+		resolved := c.resolveBackends(route, rule, grants)
+		if resolved.reason != "" && reason == "" {
+			reason, message = resolved.reason, resolved.message
+		}
+		if resolved.message != "" && resolved.reason == "" {
+			notes = append(notes, fmt.Sprintf("规则 %d: %s", i, resolved.message))
+			continue
+		}
+		if len(resolved.backends) == 0 {
+			if resolved.reason == "" {
+				notes = append(notes, fmt.Sprintf("规则 %d: 没有可用的后端", i))
+			}
+			continue
+		}
+
+		for _, match := range rule.matches {
+			if match.unsupported != "" {
+				notes = append(notes, fmt.Sprintf("规则 %d: %s", i, match.unsupported))
+				continue
+			}
+			var header *headerMatch
+			switch len(match.headers) {
+			case 0:
+			case 1:
+				header = &match.headers[0]
+				if len(resolved.backends) != 1 {
+					notes = append(notes, fmt.Sprintf("规则 %d: 带Header条件的规则只支持一个后端", i))
+					continue
+				}
+			default:
+				notes = append(notes, fmt.Sprintf("规则 %d: 不支持同时匹配多个Header", i))
+				continue
+			}
+
+			for _, hostname := range hostnames {
+				entries = append(entries, &gatewayEntry{
+					route:    route,
+					host:     hostname,
+					path:     normalizeGatewayPath(match.path, match.pathType),
+					pathType: match.pathType,
+					header:   header,
+					backends: resolved.backends,
+				})
+			}
+		}
+	}
+	return entries, reason, message, notes
+}
+
+// resolveBackends 解析规则的后端引用：reason 不为空表示引用无法解析，只有 message 表示规则不受支持。
+// 无法解析的引用保留权重，分到的请求由数据面返回500；所有后端权重都为0时整条规则返回500
+func (c *GatewayController) resolveBackends(route *gatewayRoute, rule gatewayRouteRule, grants []referenceGrantSpecWithNamespace) gatewayBackends {
+	var result gatewayBackends
+	for _, ref := range rule.backendRefs {
+		namespace := stringValue(ref.Namespace, route.meta.Namespace)
+		weight := int32(1)
+		if ref.Weight != nil {
+			weight = *ref.Weight
+		}
+
+		var reason, message string
+		switch {
+		case stringValue(ref.Group, "") != "" || stringValue(ref.Kind, "Service") != "Service":
+			reason, message = reasonInvalidKind, fmt.Sprintf("不支持的后端类型 %s", stringValue(ref.Kind, ""))
+		case namespace != route.meta.Namespace && !referenceAllowed(grants, gatewayGroup, route.kind, route.meta.Namespace, "", "Service", namespace, ref.Name):
+			reason, message = reasonRefNotPermitted, fmt.Sprintf("没有ReferenceGrant允许引用Service %s/%s", namespace, ref.Name)
+		case ref.Port == nil:
+			reason, message = reasonBackendNotFound, fmt.Sprintf("Service %s/%s 未指定端口", namespace, ref.Name)
+		default:
+			if _, err := c.k8sDiscovery.ResolveServicePort(namespace, ref.Name, "", *ref.Port); err != nil {
+				reason, message = reasonBackendNotFound, err.Error()
+			}
+		}
+		if reason != "" {
+			result.reason, result.message = reason, message
+			if weight > 0 {
+				result.backends = append(result.backends, invalidGatewayBackend(fmt.Sprintf("%s/%s", namespace, ref.Name), int(weight)))
+			}
+			continue
+		}
+		if weight <= 0 {
+			continue
+		}
+
+		backend := BackendConfig{
+			Service: fmt.Sprintf("%s/%s", namespace, ref.Name),
+			Port:    int(*ref.Port),
+			Weight:  int(weight),
+		}
+		if route.kind == "GRPCRoute" {
+			backend.Protocol = dataplane.UpstreamProtocolH2C
+		}
+		if unsupported := applyFilters(rule.filters, &backend); unsupported != "" {
+			return gatewayBackends{message: fmt.Sprintf("不支持的过滤器 %s", unsupported)}
+		}
+		if unsupported := applyFilters(ref.Filters, &backend); unsupported != "" {
+			return gatewayBackends{message: fmt.Sprintf("不支持的过滤器 %s", unsupported)}
+		}
+		result.backends = append(result.backends, backend)
+	}
+	if len(result.backends) == 0 && len(rule.backendRefs) > 0 {
+		result.backends = append(result.backends, invalidGatewayBackend(route.key(), 1))
+	}
+	return result
+}
+
+// invalidGatewayBackend 无效的后端，名称加上前缀避免与同名的有效后端合并
+func invalidGatewayBackend(name string, weight int) BackendConfig {
+	return BackendConfig{
+		Service:        "invalid:" + name,
+		UpstreamSource: UpstreamSource{Kind: dataplane.UpstreamKindInvalid},
+		Weight:         weight,
+	}
+}
+
+// normalizeGatewayPath 前缀匹配去掉末尾的 /，与Ingress的处理一致
+func normalizeGatewayPath(path string, pathType dataplane.PathMatchType) string {
+	if path == "" {
+		return "/"
+	}
+	if pathType == dataplane.PathMatchPrefix && len(path) > 1 {
+		return strings.TrimSuffix(path, "/")
+	}
+	return path
+}
+
+// updateGatewayStatus 写回Gateway的地址、条件和监听器状态
+func (c *GatewayController) updateGatewayStatus(ctx context.Context, gateway *gatewayState, addresses []string) {
+	var existing gatewayStatus
+	if err := fromUnstructuredField(gateway.object, &existing, "status"); err != nil {
+		c.log.Warnf("%v", err)
+	}
+
+	generation := gateway.meta.Generation
+	status := gatewayStatus{Conditions: existing.Conditions}
+	for _, address := range addresses {
+		status.Addresses = append(status.Addresses, gatewayStatusAddress{Type: stringPtr("IPAddress"), Value: address})
+	}
+
+	acceptedListeners := 0
+	for _, listener := range gateway.listeners {
+		var conditions []metav1.Condition
+		for _, previous := range existing.Listeners {
+			if previous.Name == listener.listener.Name {
+				conditions = previous.Conditions
+			}
+		}
+		programmed := listener.accepted && listener.refsResolved
+		if programmed {
+			acceptedListeners++
+		}
+		setCondition(&conditions, generation, conditionAccepted, listener.accepted, listener.reason, listener.message)
+		setCondition(&conditions, generation, conditionResolvedRefs, listener.refsResolved, listener.refsReason, listener.refsMessage)
+		if programmed {
+			setCondition(&conditions, generation, conditionProgrammed, true, reasonProgrammed, "")
+		} else {
+			setCondition(&conditions, generation, conditionProgrammed, false, reasonInvalid, "监听器配置无效")
+		}
+
+		kinds := listener.supportedKinds
+		if kinds == nil {
+			kinds = []routeGroupKind{}
+		}
+		status.Listeners = append(status.Listeners, listenerStatus{
+			Name:           listener.listener.Name,
+			SupportedKinds: kinds,
+			AttachedRoutes: listener.attachedRoutes,
+			Conditions:     conditions,
+		})
+	}
+
+	accepted := acceptedListeners > 0
+	if accepted {
+		setCondition(&status.Conditions, generation, conditionAccepted, true, reasonAccepted, "")
+	} else {
+		setCondition(&status.Conditions, generation, conditionAccepted, false, reasonListenersNotValid, "没有有效的监听器")
+	}
+	switch {
+	case !accepted:
+		setCondition(&status.Conditions, generation, conditionProgrammed, false, reasonInvalid, "没有有效的监听器")
+	case len(addresses) == 0:
+		setCondition(&status.Conditions, generation, conditionProgrammed, false, reasonAddressNotAssigned, "没有运行中的数据面")
+	default:
+		setCondition(&status.Conditions, generation, conditionProgrammed, true, reasonProgrammed, "")
+	}
+
+	if marshalStatus(status) == marshalStatus(existing) {
+		return
+	}
+	updated := gateway.object.DeepCopy()
+	if err := setStatusField(updated, status, "status"); err != nil {
+		c.log.Warnf("更新Gateway %s/%s 状态失败: %v", gateway.meta.Namespace, gateway.meta.Name, err)
+		return
+	}
+	if _, err := c.dynamicClient.Resource(gatewayGVR).Namespace(gateway.meta.Namespace).UpdateStatus(ctx, updated, metav1.UpdateOptions{}); err != nil {
+		c.log.Warnf("更新Gateway %s/%s 状态失败: %v", gateway.meta.Namespace, gateway.meta.Name, err)
+		return
+	}
+	c.log.Infof("已更新Gateway %s/%s 的状态", gateway.meta.Namespace, gateway.meta.Name)
+}
+
+// updateRouteStatus 写回路由在本控制器处理的各Gateway下的状态，保留其他控制器写入的条目
+func (c *GatewayController) updateRouteStatus(ctx context.Context, route *gatewayRoute, parents []*parentState, notes []string) {
+	var status routeStatus
+	if err := fromUnstructuredField(route.object, &status, "status"); err != nil {
+		c.log.Warnf("%v", err)
+	}
+	existing := status.Parents
+
+	generation := route.meta.Generation
+	var statuses []routeParentStatus
+	for _, previous := range existing {
+		if previous.ControllerName != GatewayControllerName {
+			statuses = append(statuses, previous)
+		}
+	}
+	for _, parent := range parents {
+		var conditions []metav1.Condition
+		for _, previous := range existing {
+			if previous.ControllerName == GatewayControllerName && marshalStatus(previous.ParentRef) == marshalStatus(parent.ref) {
+				conditions = previous.Conditions
+			}
+		}
+		setCondition(&conditions, generation, conditionAccepted, parent.accepted, parent.reason, parent.message)
+		setCondition(&conditions, generation, conditionResolvedRefs, parent.refsResolved, parent.refsReason, parent.refsMessage)
+		if parent.accepted && len(notes) > 0 {
+			setCondition(&conditions, generation, conditionPartiallyInvalid, true, reasonUnsupportedValue, strings.Join(notes, "; "))
+		} else {
+			meta.RemoveStatusCondition(&conditions, conditionPartiallyInvalid)
+		}
+		statuses = append(statuses, routeParentStatus{
+			ParentRef:      parent.ref,
+			ControllerName: GatewayControllerName,
+			Conditions:     conditions,
+		})
+	}
+
+	if marshalStatus(statuses) == marshalStatus(existing) {
+		return
+	}
+	if statuses == nil {
+		statuses = []routeParentStatus{}
+	}
+
+	gvr := httpRouteGVR
+	if route.kind == "GRPCRoute" {
+		gvr = grpcRouteGVR
+	}
+	updated := route.object.DeepCopy()
+	if err := setStatusField(updated, statuses, "status", "parents"); err != nil {
+		c.log.Warnf("更新%s状态失败: %v", route.key(), err)
+		return
+	}
+	if _, err := c.dynamicClient.Resource(gvr).Namespace(route.meta.Namespace).UpdateStatus(ctx, updated, metav1.UpdateOptions{}); err != nil {
+		c.log.Warnf("更新%s状态失败: %v", route.key(), err)
+		return
+	}
+	c.log.Infof("已更新%s的状态", route.key())
+}
+
+// referenceGrantSpecWithNamespace ReferenceGrant及其所在命名空间
+type referenceGrantSpecWithNamespace struct {
+	namespace string
+	spec      referenceGrantSpec
+}
+
+// listReferenceGrants 列出所有ReferenceGrant，集群未安装时返回空
+func (c *GatewayController) listReferenceGrants(ctx context.Context) ([]referenceGrantSpecWithNamespace, error) {
+	list, err := c.dynamicClient.Resource(referenceGrantGVR).Namespace("").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	grants := make([]referenceGrantSpecWithNamespace, 0, len(list.Items))
+	for i := range list.Items {
+		var spec referenceGrantSpec
+		if err := fromUnstructuredField(&list.Items[i], &spec, "spec"); err != nil {
+			c.log.Warnf("%v", err)
+			continue
+		}
+		grants = append(grants, referenceGrantSpecWithNamespace{namespace: list.Items[i].GetNamespace(), spec: spec})
+	}
+	return grants, nil
+}
+
+// referenceAllowed 判断是否有目标命名空间中的ReferenceGrant允许该跨命名空间引用
+func referenceAllowed(grants []referenceGrantSpecWithNamespace, fromGroup, fromKind, fromNamespace, toGroup, toKind, toNamespace, toName string) bool {
+	for _, grant := range grants {
+		if grant.namespace != toNamespace {
+			continue
+		}
+		fromAllowed := false
+		for _, from := range grant.spec.From {
+			if from.Group == fromGroup && from.Kind == fromKind && from.Namespace == fromNamespace {
+				fromAllowed = true
+				break
+			}
+		}
+		if !fromAllowed {
+			continue
+		}
+		for _, to := range grant.spec.To {
+			if to.Group == toGroup && to.Kind == toKind && (to.Name == nil || *to.Name == toName) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// setCondition 设置状态条件，状态未变化时保留原有的 lastTransitionTime
+func setCondition(conditions *[]metav1.Condition, generation int64, conditionType string, ok bool, reason, message string) {
+	status := metav1.ConditionFalse
+	if ok {
+		status = metav1.ConditionTrue
+	}
+	meta.SetStatusCondition(conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		ObservedGeneration: generation,
+		Reason:             reason,
+		Message:            message,
+	})
+}
+
+// parseConditions 解析Unstructured中的条件列表
+func parseConditions(values []interface{}) []metav1.Condition {
+	var conditions []metav1.Condition
+	for _, value := range values {
+		item, ok := value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		var condition metav1.Condition
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(item, &condition); err == nil {
+			conditions = append(conditions, condition)
+		}
+	}
+	return conditions
+}
+
+// setStatusField 将状态写入Unstructured对象的指定字段
+func setStatusField(object *unstructured.Unstructured, value interface{}, fields ...string) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	var converted interface{}
+	if err := json.Unmarshal(data, &converted); err != nil {
+		return err
+	}
+	return unstructured.SetNestedField(object.Object, converted, fields...)
+}
+
+// marshalStatus 序列化状态用于比较是否变化
+func marshalStatus(value interface{}) string {
+	data, _ := json.Marshal(value)
+	return string(data)
+}
+
+// containsString 判断切片中是否包含字符串
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// stringPtr 返回字符串指针
+func stringPtr(value string) *string {
+	return &value
+}
@@ -0,0 +1,282 @@
+package controlplane
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"kun-gateway/pkg/dataplane"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newTestLogger() *logrus.Logger {
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+	return log
+}
+
+// newTestDiscovery 用fake客户端启动服务发现，返回时缓存已同步
+func newTestDiscovery(t *testing.T, objects ...runtime.Object) (*K8sDiscovery, *fake.Clientset) {
+	t.Helper()
+	client := fake.NewSimpleClientset(objects...)
+	discovery := NewK8sDiscoveryWithClients(client, nil, DiscoveryScope{}, newTestLogger())
+	if err := discovery.Start(); err != nil {
+		t.Fatalf("启动服务发现失败: %v", err)
+	}
+	t.Cleanup(discovery.Stop)
+	return discovery, client
+}
+
+func testService(namespace, name string, port int32) *corev1.Service {
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Spec: corev1.ServiceSpec{
+			Type:  corev1.ServiceTypeClusterIP,
+			Ports: []corev1.ServicePort{{Name: "http", Port: port, TargetPort: intstr.FromInt(int(port))}},
+		},
+	}
+}
+
+func newTestGatewayController(t *testing.T, objects ...*unstructured.Unstructured) (*GatewayController, *dynamicfake.FakeDynamicClient) {
+	t.Helper()
+	discovery, client := newTestDiscovery(t,
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "other"}},
+		testService("default", "web", 80),
+		testService("other", "api", 8080),
+	)
+	log := newTestLogger()
+	dataplaneClient := NewDataPlaneClient(client, DataPlaneDiscovery{Namespace: "kun-system", Selector: "app=kun-dataplane"}, log)
+	routeManager, err := NewRouteManager(NewFileRouteStore(filepath.Join(t.TempDir(), "routes.json")), discovery, dataplaneClient, log)
+	if err != nil {
+		t.Fatalf("创建路由管理器失败: %v", err)
+	}
+
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		gatewayClassGVR:   "GatewayClassList",
+		gatewayGVR:        "GatewayList",
+		httpRouteGVR:      "HTTPRouteList",
+		grpcRouteGVR:      "GRPCRouteList",
+		referenceGrantGVR: "ReferenceGrantList",
+	})
+	// Gateway 按默认规则会被猜成 gatewaies，需要按GVR添加
+	resources := map[string]schema.GroupVersionResource{
+		"GatewayClass":   gatewayClassGVR,
+		"Gateway":        gatewayGVR,
+		"HTTPRoute":      httpRouteGVR,
+		"GRPCRoute":      grpcRouteGVR,
+		"ReferenceGrant": referenceGrantGVR,
+	}
+	for _, object := range objects {
+		if err := dynamicClient.Tracker().Create(resources[object.GetKind()], object, object.GetNamespace()); err != nil {
+			t.Fatalf("添加 %s %s 失败: %v", object.GetKind(), object.GetName(), err)
+		}
+	}
+	controller := NewGatewayController(client, dynamicClient, discovery, routeManager, dataplaneClient, GatewayConfig{}, log)
+	return controller, dynamicClient
+}
+
+func gatewayObject(kind, version, namespace, name string, spec map[string]interface{}) *unstructured.Unstructured {
+	object := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": gatewayGroup + "/" + version,
+		"kind":       kind,
+		"metadata":   map[string]interface{}{"name": name},
+		"spec":       spec,
+	}}
+	if namespace != "" {
+		object.SetNamespace(namespace)
+	}
+	return object
+}
+
+func testGatewayClass() *unstructured.Unstructured {
+	return gatewayObject("GatewayClass", "v1", "", "kun", map[string]interface{}{"controllerName": GatewayControllerName})
+}
+
+func testGateway(listeners ...interface{}) *unstructured.Unstructured {
+	return gatewayObject("Gateway", "v1", "default", "gw", map[string]interface{}{
+		"gatewayClassName": "kun",
+		"listeners":        listeners,
+	})
+}
+
+func testListener(name, protocol string, port int64) map[string]interface{} {
+	return map[string]interface{}{"name": name, "protocol": protocol, "port": port}
+}
+
+func backendRefObject(namespace, name string, port, weight int64) map[string]interface{} {
+	ref := map[string]interface{}{"name": name, "port": port, "weight": weight}
+	if namespace != "" {
+		ref["namespace"] = namespace
+	}
+	return ref
+}
+
+func testHTTPRoute(namespace, name string, backendRefs ...interface{}) *unstructured.Unstructured {
+	return gatewayObject("HTTPRoute", "v1", namespace, name, map[string]interface{}{
+		"parentRefs": []interface{}{map[string]interface{}{"name": "gw", "namespace": "default"}},
+		"hostnames":  []interface{}{name + ".example.com"},
+		"rules": []interface{}{map[string]interface{}{
+			"matches":     []interface{}{map[string]interface{}{"path": map[string]interface{}{"type": "PathPrefix", "value": "/"}}},
+			"backendRefs": backendRefs,
+		}},
+	})
+}
+
+func (c *GatewayController) testRoute(t *testing.T, domain string) *RouteConfig {
+	t.Helper()
+	for _, route := range c.routeManager.sources[RouteSourceGateway] {
+		if route.Domain == domain {
+			return route
+		}
+	}
+	return nil
+}
+
+func getGatewayStatus(t *testing.T, client *dynamicfake.FakeDynamicClient) gatewayStatus {
+	t.Helper()
+	object, err := client.Resource(gatewayGVR).Namespace("default").Get(context.Background(), "gw", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("获取Gateway失败: %v", err)
+	}
+	var status gatewayStatus
+	if err := fromUnstructuredField(object, &status, "status"); err != nil {
+		t.Fatal(err)
+	}
+	return status
+}
+
+func getRouteCondition(t *testing.T, client *dynamicfake.FakeDynamicClient, namespace, name, conditionType string) *metav1.Condition {
+	t.Helper()
+	object, err := client.Resource(httpRouteGVR).Namespace(namespace).Get(context.Background(), name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("获取HTTPRoute失败: %v", err)
+	}
+	var status routeStatus
+	if err := fromUnstructuredField(object, &status, "status"); err != nil {
+		t.Fatal(err)
+	}
+	if len(status.Parents) != 1 {
+		t.Fatalf("HTTPRoute %s/%s 的父资源状态数量为 %d", namespace, name, len(status.Parents))
+	}
+	return meta.FindStatusCondition(status.Parents[0].Conditions, conditionType)
+}
+
+func TestGatewayListenerAttach(t *testing.T) {
+	controller, client := newTestGatewayController(t,
+		testGatewayClass(),
+		testGateway(testListener("http", "HTTP", 80), testListener("alt", "HTTP", 8080)),
+		testHTTPRoute("default", "web", backendRefObject("", "web", 80, 1)),
+		testHTTPRoute("other", "api", backendRefObject("", "api", 8080, 1)),
+	)
+	controller.sync(context.Background())
+
+	status := getGatewayStatus(t, client)
+	listeners := make(map[string]listenerStatus)
+	for _, listener := range status.Listeners {
+		listeners[listener.Name] = listener
+	}
+	if got := listeners["http"].AttachedRoutes; got != 1 {
+		t.Errorf("http监听器挂载的路由数为 %d，期望 1", got)
+	}
+	if cond := meta.FindStatusCondition(listeners["http"].Conditions, conditionAccepted); cond == nil || cond.Status != metav1.ConditionTrue {
+		t.Errorf("http监听器应被接受: %+v", cond)
+	}
+	if cond := meta.FindStatusCondition(listeners["alt"].Conditions, conditionAccepted); cond == nil || cond.Reason != reasonPortUnavailable {
+		t.Errorf("端口不一致的监听器应为 %s: %+v", reasonPortUnavailable, cond)
+	}
+
+	if cond := getRouteCondition(t, client, "default", "web", conditionAccepted); cond == nil || cond.Status != metav1.ConditionTrue {
+		t.Errorf("同命名空间的路由应被接受: %+v", cond)
+	}
+	if cond := getRouteCondition(t, client, "other", "api", conditionAccepted); cond == nil || cond.Reason != reasonNotAllowedByListeners {
+		t.Errorf("其他命名空间的路由应为 %s: %+v", reasonNotAllowedByListeners, cond)
+	}
+
+	route := controller.testRoute(t, "web.example.com")
+	if route == nil || len(route.Backends) != 1 || route.Backends[0].Service != "default/web" {
+		t.Fatalf("生成的路由错误: %+v", route)
+	}
+	if controller.testRoute(t, "api.example.com") != nil {
+		t.Error("未挂载的路由不应生成转发规则")
+	}
+}
+
+func TestGatewayReferenceGrant(t *testing.T) {
+	route := testHTTPRoute("default", "cross", backendRefObject("other", "api", 8080, 1))
+
+	controller, client := newTestGatewayController(t, testGatewayClass(), testGateway(testListener("http", "HTTP", 80)), route.DeepCopy())
+	controller.sync(context.Background())
+	if cond := getRouteCondition(t, client, "default", "cross", conditionResolvedRefs); cond == nil || cond.Reason != reasonRefNotPermitted {
+		t.Errorf("没有ReferenceGrant时应为 %s: %+v", reasonRefNotPermitted, cond)
+	}
+	generated := controller.testRoute(t, "cross.example.com")
+	if generated == nil || len(generated.Backends) != 1 || generated.Backends[0].Kind != dataplane.UpstreamKindInvalid {
+		t.Fatalf("不允许引用的后端应返回500: %+v", generated)
+	}
+
+	grant := gatewayObject("ReferenceGrant", "v1beta1", "other", "allow-default", map[string]interface{}{
+		"from": []interface{}{map[string]interface{}{"group": gatewayGroup, "kind": "HTTPRoute", "namespace": "default"}},
+		"to":   []interface{}{map[string]interface{}{"group": "", "kind": "Service"}},
+	})
+	controller, client = newTestGatewayController(t, testGatewayClass(), testGateway(testListener("http", "HTTP", 80)), route.DeepCopy(), grant)
+	controller.sync(context.Background())
+	if cond := getRouteCondition(t, client, "default", "cross", conditionResolvedRefs); cond == nil || cond.Status != metav1.ConditionTrue {
+		t.Errorf("ReferenceGrant允许后引用应已解析: %+v", cond)
+	}
+	generated = controller.testRoute(t, "cross.example.com")
+	if generated == nil || len(generated.Backends) != 1 || generated.Backends[0].Service != "other/api" {
+		t.Fatalf("生成的路由错误: %+v", generated)
+	}
+}
+
+func TestGatewayInvalidBackendKeepsWeight(t *testing.T) {
+	controller, client := newTestGatewayController(t,
+		testGatewayClass(),
+		testGateway(testListener("http", "HTTP", 80)),
+		testHTTPRoute("default", "split", backendRefObject("", "web", 80, 3), backendRefObject("", "missing", 80, 1)),
+		testHTTPRoute("default", "zero", backendRefObject("", "web", 80, 0)),
+	)
+	controller.sync(context.Background())
+
+	if cond := getRouteCondition(t, client, "default", "split", conditionResolvedRefs); cond == nil || cond.Reason != reasonBackendNotFound {
+		t.Errorf("引用不存在的Service应为 %s: %+v", reasonBackendNotFound, cond)
+	}
+	split := controller.testRoute(t, "split.example.com")
+	if split == nil || len(split.Backends) != 2 {
+		t.Fatalf("生成的路由错误: %+v", split)
+	}
+	if backend := split.Backends[0]; backend.Service != "default/web" || backend.Weight != 3 {
+		t.Errorf("有效后端错误: %+v", backend)
+	}
+	if backend := split.Backends[1]; backend.Kind != dataplane.UpstreamKindInvalid || backend.Weight != 1 {
+		t.Errorf("无效后端应保留权重并返回500: %+v", backend)
+	}
+
+	zero := controller.testRoute(t, "zero.example.com")
+	if zero == nil || len(zero.Backends) != 1 || zero.Backends[0].Kind != dataplane.UpstreamKindInvalid {
+		t.Fatalf("后端权重都为0时应返回500: %+v", zero)
+	}
+	if cond := getRouteCondition(t, client, "default", "zero", conditionAccepted); cond == nil || cond.Status != metav1.ConditionTrue {
+		t.Errorf("后端权重都为0的路由仍应被接受: %+v", cond)
+	}
+
+	rule, err := controller.routeManager.buildRule(split, false)
+	if err != nil {
+		t.Fatalf("构建转发规则失败: %v", err)
+	}
+	if len(rule.Upstreams) != 2 || rule.Upstreams[1].Kind != dataplane.UpstreamKindInvalid || rule.Upstreams[1].Weight != 1 {
+		t.Errorf("转发规则的上游错误: %+v", rule.Upstreams)
+	}
+}
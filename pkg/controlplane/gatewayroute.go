@@ -0,0 +1,445 @@
+package controlplane
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"kun-gateway/pkg/dataplane"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// Gateway API 中路由相关的字段，只解析控制器用到的部分
+
+type parentReference struct {
+	Group       *string `json:"group,omitempty"`
+	Kind        *string `json:"kind,omitempty"`
+	Namespace   *string `json:"namespace,omitempty"`
+	Name        string  `json:"name"`
+	SectionName *string `json:"sectionName,omitempty"`
+	Port        *int32  `json:"port,omitempty"`
+}
+
+type httpHeader struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type headerModifier struct {
+	Set    []httpHeader `json:"set,omitempty"`
+	Add    []httpHeader `json:"add,omitempty"`
+	Remove []string     `json:"remove,omitempty"`
+}
+
+type routeFilter struct {
+	Type                   string          `json:"type"`
+	RequestHeaderModifier  *headerModifier `json:"requestHeaderModifier,omitempty"`
+	ResponseHeaderModifier *headerModifier `json:"responseHeaderModifier,omitempty"`
+}
+
+type backendRef struct {
+	Group     *string       `json:"group,omitempty"`
+	Kind      *string       `json:"kind,omitempty"`
+	Name      string        `json:"name"`
+	Namespace *string       `json:"namespace,omitempty"`
+	Port      *int32        `json:"port,omitempty"`
+	Weight    *int32        `json:"weight,omitempty"`
+	Filters   []routeFilter `json:"filters,omitempty"`
+}
+
+type headerMatch struct {
+	Type  *string `json:"type,omitempty"`
+	Name  string  `json:"name"`
+	Value string  `json:"value"`
+}
+
+type httpRouteSpec struct {
+	ParentRefs []parentReference `json:"parentRefs,omitempty"`
+	Hostnames  []string          `json:"hostnames,omitempty"`
+	Rules      []struct {
+		Matches []struct {
+			Path *struct {
+				Type  *string `json:"type,omitempty"`
+				Value *string `json:"value,omitempty"`
+			} `json:"path,omitempty"`
+			Headers     []headerMatch            `json:"headers,omitempty"`
+			QueryParams []map[string]interface{} `json:"queryParams,omitempty"`
+			Method      *string                  `json:"method,omitempty"`
+		} `json:"matches,omitempty"`
+		Filters     []routeFilter `json:"filters,omitempty"`
+		BackendRefs []backendRef  `json:"backendRefs,omitempty"`
+	} `json:"rules,omitempty"`
+}
+
+type grpcRouteSpec struct {
+	ParentRefs []parentReference `json:"parentRefs,omitempty"`
+	Hostnames  []string          `json:"hostnames,omitempty"`
+	Rules      []struct {
+		Matches []struct {
+			Method *struct {
+				Type    *string `json:"type,omitempty"`
+				Service *string `json:"service,omitempty"`
+				Method  *string `json:"method,omitempty"`
+			} `json:"method,omitempty"`
+			Headers []headerMatch `json:"headers,omitempty"`
+		} `json:"matches,omitempty"`
+		Filters     []routeFilter `json:"filters,omitempty"`
+		BackendRefs []backendRef  `json:"backendRefs,omitempty"`
+	} `json:"rules,omitempty"`
+}
+
+// gatewayRoute 统一表示HTTPRoute和GRPCRoute
+type gatewayRoute struct {
+	kind       string
+	object     *unstructured.Unstructured
+	meta       metav1.ObjectMeta
+	parentRefs []parentReference
+	hostnames  []string
+	rules      []gatewayRouteRule
+}
+
+// gatewayRouteRule 路由规则，匹配条件已转换为数据面的路径和Header匹配
+type gatewayRouteRule struct {
+	matches     []gatewayMatch
+	filters     []routeFilter
+	backendRefs []backendRef
+}
+
+// gatewayMatch 一个匹配条件，unsupported 不为空时表示数据面无法表达
+type gatewayMatch struct {
+	path        string
+	pathType    dataplane.PathMatchType
+	headers     []headerMatch
+	unsupported string
+}
+
+// key 路由的显示名称
+func (r *gatewayRoute) key() string {
+	return fmt.Sprintf("%s %s/%s", r.kind, r.meta.Namespace, r.meta.Name)
+}
+
+// parseHTTPRoute 解析HTTPRoute
+func parseHTTPRoute(object *unstructured.Unstructured) (*gatewayRoute, error) {
+	var spec httpRouteSpec
+	if err := fromUnstructuredField(object, &spec, "spec"); err != nil {
+		return nil, err
+	}
+
+	route := &gatewayRoute{
+		kind:       "HTTPRoute",
+		object:     object,
+		meta:       objectMeta(object),
+		parentRefs: spec.ParentRefs,
+		hostnames:  spec.Hostnames,
+	}
+	for _, rule := range spec.Rules {
+		parsed := gatewayRouteRule{filters: rule.Filters, backendRefs: rule.BackendRefs}
+		for _, match := range rule.Matches {
+			m := gatewayMatch{path: "/", pathType: dataplane.PathMatchPrefix, headers: match.Headers}
+			if match.Path != nil {
+				if match.Path.Value != nil {
+					m.path = *match.Path.Value
+				}
+				switch stringValue(match.Path.Type, "PathPrefix") {
+				case "PathPrefix":
+				case "Exact":
+					m.pathType = dataplane.PathMatchExact
+				default:
+					m.unsupported = fmt.Sprintf("不支持的路径匹配方式 %s", *match.Path.Type)
+				}
+			}
+			if match.Method != nil {
+				m.unsupported = "不支持按请求方法匹配"
+			}
+			if len(match.QueryParams) > 0 {
+				m.unsupported = "不支持按查询参数匹配"
+			}
+			parsed.matches = append(parsed.matches, m)
+		}
+		if len(parsed.matches) == 0 {
+			parsed.matches = []gatewayMatch{{path: "/", pathType: dataplane.PathMatchPrefix}}
+		}
+		route.rules = append(route.rules, parsed)
+	}
+	return route, nil
+}
+
+// parseGRPCRoute 解析GRPCRoute，gRPC方法转换为 /service/method 路径
+func parseGRPCRoute(object *unstructured.Unstructured) (*gatewayRoute, error) {
+	var spec grpcRouteSpec
+	if err := fromUnstructuredField(object, &spec, "spec"); err != nil {
+		return nil, err
+	}
+
+	route := &gatewayRoute{
+		kind:       "GRPCRoute",
+		object:     object,
+		meta:       objectMeta(object),
+		parentRefs: spec.ParentRefs,
+		hostnames:  spec.Hostnames,
+	}
+	for _, rule := range spec.Rules {
+		parsed := gatewayRouteRule{filters: rule.Filters, backendRefs: rule.BackendRefs}
+		for _, match := range rule.Matches {
+			m := gatewayMatch{path: "/", pathType: dataplane.PathMatchPrefix, headers: match.Headers}
+			if method := match.Method; method != nil {
+				service, name := stringValue(method.Service, ""), stringValue(method.Method, "")
+				switch {
+				case stringValue(method.Type, "Exact") != "Exact":
+					m.unsupported = fmt.Sprintf("不支持的gRPC方法匹配方式 %s", *method.Type)
+				case service != "" && name != "":
+					m.path, m.pathType = "/"+service+"/"+name, dataplane.PathMatchExact
+				case service != "":
+					m.path = "/" + service
+				case name != "":
+					m.unsupported = "不支持只指定方法名的gRPC匹配"
+				}
+			}
+			parsed.matches = append(parsed.matches, m)
+		}
+		if len(parsed.matches) == 0 {
+			parsed.matches = []gatewayMatch{{path: "/", pathType: dataplane.PathMatchPrefix}}
+		}
+		route.rules = append(route.rules, parsed)
+	}
+	return route, nil
+}
+
+// gatewayEntry 一条匹配条件在某个域名下生成的转发规则
+type gatewayEntry struct {
+	route    *gatewayRoute
+	host     string
+	path     string
+	pathType dataplane.PathMatchType
+	header   *headerMatch
+	backends []BackendConfig
+}
+
+// gatewayBackends 路由规则解析出的后端，以及解析失败的原因
+type gatewayBackends struct {
+	backends []BackendConfig
+	reason   string
+	message  string
+}
+
+// headerOperations 将Header修改过滤器转换为数据面的Header操作
+func headerOperations(modifier *headerModifier, into *dataplane.HeaderOperations) *dataplane.HeaderOperations {
+	if modifier == nil {
+		return into
+	}
+	if into == nil {
+		into = &dataplane.HeaderOperations{}
+	}
+	for _, header := range modifier.Set {
+		if into.Set == nil {
+			into.Set = make(map[string]string)
+		}
+		into.Set[header.Name] = header.Value
+	}
+	for _, header := range modifier.Add {
+		if into.Add == nil {
+			into.Add = make(map[string]string)
+		}
+		into.Add[header.Name] = header.Value
+	}
+	into.Remove = append(into.Remove, modifier.Remove...)
+	return into
+}
+
+// applyFilters 将过滤器应用到后端，返回不支持的过滤器类型
+func applyFilters(filters []routeFilter, backend *BackendConfig) string {
+	for _, filter := range filters {
+		switch filter.Type {
+		case "RequestHeaderModifier":
+			backend.RequestHeaders = headerOperations(filter.RequestHeaderModifier, backend.RequestHeaders)
+		case "ResponseHeaderModifier":
+			backend.ResponseHeaders = headerOperations(filter.ResponseHeaderModifier, backend.ResponseHeaders)
+		default:
+			return filter.Type
+		}
+	}
+	return ""
+}
+
+// mergeGatewayEntries 将转发规则按域名+路径合并为路由：没有Header条件的规则提供按权重分配的后端，
+// 有Header条件的规则转换为Header子规则。返回路由，以及各Gateway路由无法生效的原因
+func mergeGatewayEntries(entries []*gatewayEntry) ([]*RouteConfig, map[*gatewayRoute][]string) {
+	notes := make(map[*gatewayRoute][]string)
+	groups := make(map[string]*RouteConfig)
+	defaults := make(map[string]*gatewayRoute)
+	owned := make(map[*gatewayRoute]int)
+	var order []string
+
+	for _, entry := range entries {
+		key := fmt.Sprintf("%s|%s|%s", entry.host, entry.path, entry.pathType)
+		route, ok := groups[key]
+		if !ok {
+			owner := entry.route
+			route = &RouteConfig{
+				ID:        fmt.Sprintf("%s:%s:%s:%s:%d", RouteSourceGateway, strings.ToLower(owner.kind), owner.meta.Namespace, owner.meta.Name, owned[owner]),
+				Domain:    entry.host,
+				Path:      entry.path,
+				PathType:  entry.pathType,
+				CreatedAt: owner.meta.CreationTimestamp.Time,
+				UpdatedAt: owner.meta.CreationTimestamp.Time,
+			}
+			owned[owner]++
+			groups[key] = route
+			order = append(order, key)
+		}
+
+		if entry.header == nil {
+			if owner, exists := defaults[key]; exists {
+				if owner != entry.route {
+					notes[entry.route] = append(notes[entry.route], fmt.Sprintf("%s%s 已由 %s 处理", entry.host, entry.path, owner.key()))
+				}
+				continue
+			}
+			defaults[key] = entry.route
+			for _, backend := range entry.backends {
+				addGatewayBackend(route, backend)
+			}
+			continue
+		}
+
+		backend := entry.backends[0]
+		weight := backend.Weight
+		backend.Weight = 0
+		addGatewayBackend(route, backend)
+		backend.Weight = weight
+
+		matchType := dataplane.HeaderMatchExact
+		if stringValue(entry.header.Type, "Exact") == "RegularExpression" {
+			matchType = dataplane.HeaderMatchRegex
+		}
+		route.HeaderRoutes = append(route.HeaderRoutes, HeaderRouteConfig{
+			Header:    entry.header.Name,
+			Value:     entry.header.Value,
+			MatchType: matchType,
+			Service:   backend.Service,
+			Port:      backend.Port,
+		})
+	}
+
+	routes := make([]*RouteConfig, 0, len(order))
+	for _, key := range order {
+		route := groups[key]
+		if _, ok := defaults[key]; !ok {
+			// 数据面无法在Header未命中时回落到其他路径，没有默认后端的路径不下发
+			for _, entry := range entries {
+				if fmt.Sprintf("%s|%s|%s", entry.host, entry.path, entry.pathType) == key {
+					notes[entry.route] = append(notes[entry.route], fmt.Sprintf("%s%s 只有带Header条件的规则，缺少默认后端", entry.host, entry.path))
+					break
+				}
+			}
+			continue
+		}
+		routes = append(routes, route)
+	}
+	return routes, notes
+}
+
+// addGatewayBackend 向路由添加后端，同一服务只保留一个上游，权重取较大值
+func addGatewayBackend(route *RouteConfig, backend BackendConfig) {
+	for i := range route.Backends {
+		if route.Backends[i].Service == backend.Service {
+			if backend.Weight > route.Backends[i].Weight {
+				route.Backends[i].Weight = backend.Weight
+			}
+			return
+		}
+	}
+	route.Backends = append(route.Backends, backend)
+}
+
+// sortGatewayRoutes 按创建时间排序，冲突时先创建的路由优先
+func sortGatewayRoutes(routes []*gatewayRoute) {
+	sort.SliceStable(routes, func(i, j int) bool {
+		a, b := routes[i].meta, routes[j].meta
+		if !a.CreationTimestamp.Equal(&b.CreationTimestamp) {
+			return a.CreationTimestamp.Before(&b.CreationTimestamp)
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return routes[i].kind < routes[j].kind
+	})
+}
+
+// intersectHostnames 计算监听器和路由共同接受的域名，监听器和路由都未指定时返回空字符串，表示不限域名
+func intersectHostnames(listener *string, hostnames []string) []string {
+	if listener == nil || *listener == "" {
+		if len(hostnames) == 0 {
+			return []string{""}
+		}
+		return hostnames
+	}
+	if len(hostnames) == 0 {
+		return []string{*listener}
+	}
+
+	var result []string
+	for _, hostname := range hostnames {
+		switch {
+		case hostnameMatches(*listener, hostname):
+			result = append(result, hostname)
+		case hostnameMatches(hostname, *listener):
+			result = append(result, *listener)
+		}
+	}
+	return result
+}
+
+// hostnameMatches 判断域名是否被模式匹配，*.example.com 匹配 example.com 的任意子域名
+func hostnameMatches(pattern, hostname string) bool {
+	if pattern == hostname {
+		return true
+	}
+	if strings.HasPrefix(pattern, "*.") && !strings.HasPrefix(hostname, "*.") {
+		return strings.HasSuffix(hostname, pattern[1:])
+	}
+	if strings.HasPrefix(pattern, "*.") && strings.HasPrefix(hostname, "*.") {
+		return strings.HasSuffix(hostname[1:], pattern[1:])
+	}
+	return false
+}
+
+// fromUnstructuredField 将Unstructured对象的字段转换为结构体
+func fromUnstructuredField(object *unstructured.Unstructured, into interface{}, fields ...string) error {
+	value, found, err := unstructured.NestedMap(object.Object, fields...)
+	if err != nil {
+		return fmt.Errorf("解析 %s %s/%s 失败: %v", object.GetKind(), object.GetNamespace(), object.GetName(), err)
+	}
+	if !found {
+		return nil
+	}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(value, into); err != nil {
+		return fmt.Errorf("解析 %s %s/%s 失败: %v", object.GetKind(), object.GetNamespace(), object.GetName(), err)
+	}
+	return nil
+}
+
+// objectMeta 获取Unstructured对象的元数据
+func objectMeta(object *unstructured.Unstructured) metav1.ObjectMeta {
+	return metav1.ObjectMeta{
+		Name:              object.GetName(),
+		Namespace:         object.GetNamespace(),
+		Generation:        object.GetGeneration(),
+		CreationTimestamp: object.GetCreationTimestamp(),
+		Labels:            object.GetLabels(),
+	}
+}
+
+// stringValue 获取可选字符串的值
+func stringValue(value *string, defaultValue string) string {
+	if value == nil || *value == "" {
+		return defaultValue
+	}
+	return *value
+}
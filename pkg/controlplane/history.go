@@ -0,0 +1,578 @@
+package controlplane
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"kun-gateway/pkg/dataplane"
+	"kun-gateway/pkg/proto"
+)
+
+// DefaultConfigHistory 默认保留的历史配置版本数
+const DefaultConfigHistory = 50
+
+var (
+	ErrConfigVersionNotFound = errors.New("配置版本不存在或已不在历史记录中")
+	ErrConfigNotRolledBack   = errors.New("配置没有处于回滚状态")
+)
+
+// ChangeCount 一类资源相对上一个版本的变化数量
+type ChangeCount struct {
+	Added   int `json:"added"`
+	Removed int `json:"removed"`
+	Changed int `json:"changed"`
+}
+
+// ConfigChanges 配置版本相对上一个版本的变化
+type ConfigChanges struct {
+	Routes       ChangeCount `json:"routes"`
+	Clusters     ChangeCount `json:"clusters"`
+	Certificates ChangeCount `json:"certificates"`
+}
+
+// ConfigVersionInfo 一个历史配置版本
+type ConfigVersionInfo struct {
+	Generation int64     `json:"generation"`
+	Version    string    `json:"version"`
+	Author     string    `json:"author"`
+	CreatedAt  time.Time `json:"created_at"`
+	Routes     int       `json:"routes"`
+	// RollbackOf 该版本由回滚生成时为回滚到的版本
+	RollbackOf int64         `json:"rollback_of,omitempty"`
+	Changes    ConfigChanges `json:"changes"`
+	// Current 是否为当前下发的版本
+	Current bool `json:"current"`
+	// Rules 版本的路由规则，只在查询单个版本时返回
+	Rules []*dataplane.RouteRule `json:"rules,omitempty"`
+}
+
+// ResourceChange 一个变化的资源，Before/After 为变化前后的内容，新增或删除时其中一个为空
+type ResourceChange struct {
+	Name   string          `json:"name"`
+	Before json.RawMessage `json:"before,omitempty"`
+	After  json.RawMessage `json:"after,omitempty"`
+}
+
+// ResourceDiff 一类资源在两个版本之间的差异
+type ResourceDiff struct {
+	Added   []ResourceChange `json:"added"`
+	Removed []ResourceChange `json:"removed"`
+	Changed []ResourceChange `json:"changed"`
+}
+
+// ConfigDiff 两个配置版本之间的差异。证书包含私钥，只返回域名
+type ConfigDiff struct {
+	From         ConfigVersionInfo `json:"from"`
+	To           ConfigVersionInfo `json:"to"`
+	RouteOrder   bool              `json:"route_order_changed"`
+	Routes       ResourceDiff      `json:"routes"`
+	Clusters     ResourceDiff      `json:"clusters"`
+	Certificates ResourceDiff      `json:"certificates"`
+}
+
+// SetHistoryLimit 设置保留的历史配置版本数，小于1时使用默认值
+func (c *DataPlaneClient) SetHistoryLimit(limit int) {
+	if limit < 1 {
+		limit = DefaultConfigHistory
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.historyLimit = limit
+	c.trimHistoryLocked()
+}
+
+// recordHistoryLocked 记录新的配置版本，超过保留数量时丢弃最早的版本
+func (c *DataPlaneClient) recordHistoryLocked(version *configVersion) {
+	c.history = append(c.history, version)
+	c.trimHistoryLocked()
+	select {
+	case c.historyChanged <- struct{}{}:
+	default:
+	}
+}
+
+func (c *DataPlaneClient) trimHistoryLocked() {
+	if n := len(c.history) - c.historyLimit; n > 0 {
+		// 复制到新的切片，丢弃的版本可以被回收
+		c.history = append([]*configVersion(nil), c.history[n:]...)
+	}
+}
+
+// findVersionLocked 在历史记录中查找版本
+func (c *DataPlaneClient) findVersionLocked(generation int64) (int, *configVersion) {
+	for i, version := range c.history {
+		if version.generation == generation {
+			return i, version
+		}
+	}
+	return -1, nil
+}
+
+// versionInfoLocked 配置版本的概要
+func (c *DataPlaneClient) versionInfoLocked(version *configVersion) ConfigVersionInfo {
+	return ConfigVersionInfo{
+		Generation: version.generation,
+		Version:    version.version,
+		Author:     version.author,
+		CreatedAt:  version.createdAt,
+		Routes:     version.routes,
+		RollbackOf: version.rollbackOf,
+		Changes:    version.changes,
+		Current:    version == c.desired,
+	}
+}
+
+// ConfigVersions 返回保留的历史配置版本，最新的在前
+func (c *DataPlaneClient) ConfigVersions() []ConfigVersionInfo {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	versions := make([]ConfigVersionInfo, 0, len(c.history))
+	for i := len(c.history) - 1; i >= 0; i-- {
+		versions = append(versions, c.versionInfoLocked(c.history[i]))
+	}
+	return versions
+}
+
+// ConfigVersion 返回一个历史配置版本及其路由规则
+func (c *DataPlaneClient) ConfigVersion(generation int64) (*ConfigVersionInfo, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, version := c.findVersionLocked(generation)
+	if version == nil {
+		return nil, fmt.Errorf("%w: 第 %d 版", ErrConfigVersionNotFound, generation)
+	}
+	info := c.versionInfoLocked(version)
+	info.Rules = version.rules
+	return &info, nil
+}
+
+// ConfigDiff 比较两个历史配置版本，from为0时与历史记录中的上一个版本比较
+func (c *DataPlaneClient) ConfigDiff(from, to int64) (*ConfigDiff, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	i, target := c.findVersionLocked(to)
+	if target == nil {
+		return nil, fmt.Errorf("%w: 第 %d 版", ErrConfigVersionNotFound, to)
+	}
+	var base *configVersion
+	if from == 0 {
+		if i == 0 {
+			return nil, fmt.Errorf("%w: 第 %d 版之前的版本", ErrConfigVersionNotFound, to)
+		}
+		base = c.history[i-1]
+	} else if _, base = c.findVersionLocked(from); base == nil {
+		return nil, fmt.Errorf("%w: 第 %d 版", ErrConfigVersionNotFound, from)
+	}
+
+	diff := &ConfigDiff{
+		From:         c.versionInfoLocked(base),
+		To:           c.versionInfoLocked(target),
+		RouteOrder:   !equalStrings(base.resources.routeOrder, target.resources.routeOrder),
+		Routes:       resourceDiff(base.resources.routes, target.resources.routes, true),
+		Clusters:     resourceDiff(base.resources.clusters, target.resources.clusters, true),
+		Certificates: resourceDiff(base.resources.certificates, target.resources.certificates, false),
+	}
+	return diff, nil
+}
+
+// SetRollbackStore 设置回滚状态的存储，恢复控制面重启前的历史配置版本和回滚，需在推送路由前调用。
+// 恢复的历史版本只有证书的摘要，回滚到这些版本时按域名使用重新加载的证书
+func (c *DataPlaneClient) SetRollbackStore(store RollbackStore) error {
+	records, err := store.LoadHistory()
+	if err != nil {
+		return err
+	}
+	state, err := store.Load()
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rollbackStore = store
+
+	restored := make([]*configVersion, 0, len(records))
+	for _, record := range records {
+		version, err := restoreVersion(record)
+		if err != nil {
+			return fmt.Errorf("恢复第 %d 版配置失败: %v", record.Generation, err)
+		}
+		restored = append(restored, version)
+	}
+	c.history = append(restored, c.history...)
+	c.trimHistoryLocked()
+	// 新版本的编号接着重启前的编号，避免与历史版本的编号重复
+	if n := len(records); n > 0 && records[n-1].Generation > c.generation {
+		c.generation = records[n-1].Generation
+	}
+	if len(records) > 0 {
+		c.log.Infof("恢复了 %d 个历史配置版本，最新为第 %d 版", len(records), c.generation)
+	}
+	if state == nil {
+		return nil
+	}
+	if state.LastGeneration > c.generation {
+		c.generation = state.LastGeneration
+	}
+	// 回滚目标已不在历史版本中时由回滚状态中保存的路由恢复
+	_, target := c.findVersionLocked(state.Generation)
+	if target == nil {
+		target, err = restoreVersion(&HistoryRecord{
+			Generation:   state.Generation,
+			Version:      state.Version,
+			Rules:        state.Rules,
+			Certificates: state.Certificates,
+			CreatedAt:    state.UpdatedAt,
+		})
+		if err != nil {
+			return fmt.Errorf("恢复回滚目标第 %d 版失败: %v", state.Generation, err)
+		}
+	}
+	c.rollback = target
+	c.rollbackRestored = true
+	c.log.Warnf("恢复了 %s 在重启前执行的回滚：配置锁定在第 %d 版（%s），解除回滚后才会下发最新的路由", state.Author, state.Generation, state.Version)
+	return nil
+}
+
+// Rollback 把所有数据面回滚到历史版本的路由：生成内容与该版本相同的新版本并下发，
+// 数据面以 Router.UpdateRules 整体替换路由表。回滚期间路由变化只记录不下发，
+// 上游端点仍使用最新的地址，避免转发到已不存在的Pod，证书使用目标版本的证书；调用 Resume 后恢复下发最新的路由和证书。
+// 设置了回滚状态存储时先持久化，保存失败时不回滚
+func (c *DataPlaneClient) Rollback(generation int64, author string) (*ConfigVersionInfo, error) {
+	c.rollbackMu.Lock()
+	defer c.rollbackMu.Unlock()
+
+	c.mu.Lock()
+	_, target := c.findVersionLocked(generation)
+	if target == nil {
+		c.mu.Unlock()
+		return nil, fmt.Errorf("%w: 第 %d 版", ErrConfigVersionNotFound, generation)
+	}
+	if c.desired == nil {
+		// 重启后恢复了历史版本，但还没有计算出最新的路由
+		c.mu.Unlock()
+		return nil, fmt.Errorf("尚未生成最新的路由，请稍后重试")
+	}
+	store := c.rollbackStore
+	state := &RollbackState{
+		Generation:     target.generation,
+		Version:        target.version,
+		Author:         author,
+		LastGeneration: c.generation + 1,
+		Rules:          target.rules,
+		Certificates:   certificateRefs(target.resources),
+		UpdatedAt:      time.Now(),
+	}
+	if target.certs == nil {
+		if _, changed := c.versionCertsLocked(target); len(changed) > 0 {
+			c.log.Warnf("第 %d 版由重启前的历史恢复，证书 %s 已变化或已移除，使用当前的证书", target.generation, strings.Join(changed, ", "))
+		}
+	}
+	c.mu.Unlock()
+
+	if store != nil {
+		if err := store.Save(state); err != nil {
+			return nil, fmt.Errorf("保存回滚状态失败: %v", err)
+		}
+	}
+
+	c.mu.Lock()
+	if c.rollback == nil {
+		c.held = c.desired.rules
+	}
+	c.rollback = target
+	c.rollbackRestored = false
+	desired, err := c.rebuildLocked(overlayEndpoints(target.rules, c.held), author, target.generation)
+	if err != nil {
+		c.mu.Unlock()
+		return nil, err
+	}
+	c.resyncCertificatesLocked()
+	info := c.versionInfoLocked(desired)
+	c.mu.Unlock()
+
+	c.log.Infof("%s 将配置回滚到第 %d 版（%s），生成第 %d 版", author, target.generation, target.version, desired.generation)
+	if err := c.forEachInstance(c.syncInstance); err != nil {
+		return &info, err
+	}
+	return &info, nil
+}
+
+// Resume 解除回滚，下发回滚期间记录的最新路由
+func (c *DataPlaneClient) Resume(author string) (*ConfigVersionInfo, error) {
+	c.rollbackMu.Lock()
+	defer c.rollbackMu.Unlock()
+
+	c.mu.Lock()
+	if c.rollback == nil {
+		c.mu.Unlock()
+		return nil, ErrConfigNotRolledBack
+	}
+	if c.held == nil {
+		// 恢复回滚后还没有计算出最新的路由，此时解除会下发空的路由表
+		c.mu.Unlock()
+		return nil, fmt.Errorf("尚未生成最新的路由，请稍后重试")
+	}
+	store := c.rollbackStore
+	c.mu.Unlock()
+
+	if store != nil {
+		if err := store.Save(nil); err != nil {
+			return nil, fmt.Errorf("清除回滚状态失败: %v", err)
+		}
+	}
+
+	c.mu.Lock()
+	rules := c.held
+	c.rollback, c.held = nil, nil
+	c.rollbackRestored = false
+	desired, err := c.rebuildLocked(rules, author, 0)
+	if err != nil {
+		c.mu.Unlock()
+		return nil, err
+	}
+	c.resyncCertificatesLocked()
+	info := c.versionInfoLocked(desired)
+	c.mu.Unlock()
+
+	c.log.Infof("%s 解除了配置回滚，下发第 %d 版（%s）", author, desired.generation, desired.version)
+	if err := c.forEachInstance(c.syncInstance); err != nil {
+		return &info, err
+	}
+	return &info, nil
+}
+
+// activeCertsLocked 生成配置使用的证书：回滚期间为回滚目标的证书，否则为最新记录的证书
+func (c *DataPlaneClient) activeCertsLocked() map[string]map[string]string {
+	if c.rollback == nil {
+		return c.certs
+	}
+	certs, _ := c.versionCertsLocked(c.rollback)
+	return certs
+}
+
+// versionCertsLocked 返回生成配置版本的证书。从持久化的历史恢复的版本只有证书摘要，按域名使用最新记录的证书，
+// changed 为内容与摘要不一致或已移除的域名
+func (c *DataPlaneClient) versionCertsLocked(version *configVersion) (certs map[string]map[string]string, changed []string) {
+	if version.certs != nil {
+		return version.certs, nil
+	}
+	certs = make(map[string]map[string]string)
+	for domain, resource := range version.resources.certificates {
+		cert, ok := c.certs[domain]
+		if !ok {
+			changed = append(changed, domain)
+			continue
+		}
+		certs[domain] = cert
+		if current, err := newResource(domain, cert); err != nil || current.Version != resource.Version {
+			changed = append(changed, domain)
+		}
+	}
+	sort.Strings(changed)
+	return certs, changed
+}
+
+// resyncCertificatesLocked 回滚或解除回滚后证书集合可能变化，通过REST API推送的实例重新下发证书并移除多余的证书
+func (c *DataPlaneClient) resyncCertificatesLocked() {
+	for _, instance := range c.instances {
+		if instance.stream == nil {
+			instance.needCerts, instance.pruneCerts = true, true
+		}
+	}
+}
+
+// persistHistory 历史配置版本变化后写入回滚状态的存储，写入期间的多次变化合并为一次，失败时稍后重试
+func (c *DataPlaneClient) persistHistory(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.historyChanged:
+		}
+		if err := c.saveHistory(); err != nil {
+			c.log.Warnf("保存历史配置版本失败，稍后重试: %v", err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(fleetSyncInterval):
+			}
+			select {
+			case c.historyChanged <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// saveHistory 写入当前的历史配置版本，没有设置存储时跳过
+func (c *DataPlaneClient) saveHistory() error {
+	c.mu.Lock()
+	store := c.rollbackStore
+	records := make([]*HistoryRecord, 0, len(c.history))
+	for _, version := range c.history {
+		records = append(records, &HistoryRecord{
+			Generation:   version.generation,
+			Version:      version.version,
+			Author:       version.author,
+			RollbackOf:   version.rollbackOf,
+			Changes:      version.changes,
+			Rules:        version.rules,
+			Certificates: certificateRefs(version.resources),
+			CreatedAt:    version.createdAt,
+		})
+	}
+	c.mu.Unlock()
+
+	if store == nil {
+		return nil
+	}
+	return store.SaveHistory(records)
+}
+
+// restoreVersion 由持久化的记录恢复配置版本，证书资源只有摘要
+func restoreVersion(record *HistoryRecord) (*configVersion, error) {
+	resources, err := buildConfigResources(record.Version, record.Rules, nil)
+	if err != nil {
+		return nil, err
+	}
+	for domain, digest := range record.Certificates {
+		resources.certificates[domain] = &proto.Resource{Name: domain, Version: digest}
+	}
+	return &configVersion{
+		version:    record.Version,
+		generation: record.Generation,
+		author:     record.Author,
+		rollbackOf: record.RollbackOf,
+		changes:    record.Changes,
+		rules:      record.Rules,
+		routes:     len(record.Rules),
+		createdAt:  record.CreatedAt,
+		resources:  resources,
+	}, nil
+}
+
+// certificateRefs 配置版本的证书引用，key: 域名，value: 证书内容的摘要
+func certificateRefs(resources *configResources) map[string]string {
+	if len(resources.certificates) == 0 {
+		return nil
+	}
+	refs := make(map[string]string, len(resources.certificates))
+	for domain, resource := range resources.certificates {
+		refs[domain] = resource.Version
+	}
+	return refs
+}
+
+// overlayEndpoints 复制回滚目标的路由规则，K8s Service上游（按名称和端口匹配）的端点替换为最新路由中的端点
+func overlayEndpoints(rules, latest []*dataplane.RouteRule) []*dataplane.RouteRule {
+	current := make(map[string]*dataplane.Upstream)
+	for _, rule := range latest {
+		for i := range rule.Upstreams {
+			upstream := &rule.Upstreams[i]
+			if upstream.Kind == "" {
+				current[fmt.Sprintf("%s:%d", upstream.Name, upstream.Port)] = upstream
+			}
+		}
+	}
+
+	overlaid := make([]*dataplane.RouteRule, 0, len(rules))
+	for _, rule := range rules {
+		copied := *rule
+		copied.Upstreams = make([]dataplane.Upstream, len(rule.Upstreams))
+		for i, upstream := range rule.Upstreams {
+			if latest, ok := current[fmt.Sprintf("%s:%d", upstream.Name, upstream.Port)]; ok && upstream.Kind == "" {
+				upstream.Addresses = latest.Addresses
+				upstream.DrainingAddresses = latest.DrainingAddresses
+				upstream.AddressPorts = latest.AddressPorts
+				upstream.Healthy = latest.Healthy
+				upstream.Locality = latest.Locality
+				upstream.UnreadyLocality = latest.UnreadyLocality
+			}
+			copied.Upstreams[i] = upstream
+		}
+		overlaid = append(overlaid, &copied)
+	}
+	return overlaid
+}
+
+// summarizeChanges 统计相对上一个版本的资源变化，没有上一个版本时全部计为新增
+func summarizeChanges(previous, current *configResources) ConfigChanges {
+	if previous == nil {
+		previous = &configResources{}
+	}
+	return ConfigChanges{
+		Routes:       countChanges(previous.routes, current.routes),
+		Clusters:     countChanges(previous.clusters, current.clusters),
+		Certificates: countChanges(previous.certificates, current.certificates),
+	}
+}
+
+func countChanges(base, current map[string]*proto.Resource) ChangeCount {
+	var count ChangeCount
+	for name, resource := range current {
+		if old, ok := base[name]; !ok {
+			count.Added++
+		} else if old.Version != resource.Version {
+			count.Changed++
+		}
+	}
+	for name := range base {
+		if _, ok := current[name]; !ok {
+			count.Removed++
+		}
+	}
+	return count
+}
+
+// resourceDiff 比较两个版本的资源，withBody为false时不返回资源内容
+func resourceDiff(base, current map[string]*proto.Resource, withBody bool) ResourceDiff {
+	diff := ResourceDiff{
+		Added:   []ResourceChange{},
+		Removed: []ResourceChange{},
+		Changed: []ResourceChange{},
+	}
+	body := func(resource *proto.Resource) json.RawMessage {
+		if !withBody {
+			return nil
+		}
+		return resource.Body
+	}
+
+	for name, resource := range current {
+		if old, ok := base[name]; !ok {
+			diff.Added = append(diff.Added, ResourceChange{Name: name, After: body(resource)})
+		} else if old.Version != resource.Version {
+			diff.Changed = append(diff.Changed, ResourceChange{Name: name, Before: body(old), After: body(resource)})
+		}
+	}
+	for name, resource := range base {
+		if _, ok := current[name]; !ok {
+			diff.Removed = append(diff.Removed, ResourceChange{Name: name, Before: body(resource)})
+		}
+	}
+	for _, changes := range [][]ResourceChange{diff.Added, diff.Removed, diff.Changed} {
+		sort.Slice(changes, func(i, j int) bool { return changes[i].Name < changes[j].Name })
+	}
+	return diff
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
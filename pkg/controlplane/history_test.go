@@ -0,0 +1,219 @@
+package controlplane
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"kun-gateway/pkg/dataplane"
+
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func testHistoryRules(paths ...string) []*dataplane.RouteRule {
+	rules := make([]*dataplane.RouteRule, 0, len(paths))
+	for _, path := range paths {
+		rules = append(rules, &dataplane.RouteRule{
+			Domain:   "a.example.com",
+			Path:     path,
+			PathType: dataplane.PathMatchPrefix,
+			Upstreams: []dataplane.Upstream{
+				{Name: "web", Addresses: []string{"10.0.0.1"}, Port: 80, Weight: 100, Healthy: true},
+			},
+		})
+	}
+	return rules
+}
+
+// fakeDataPlane 数据面REST API的路由和证书接口，记录实例上的证书
+type fakeDataPlane struct {
+	mu    sync.Mutex
+	certs map[string]bool
+}
+
+func newFakeDataPlane(t *testing.T) (*fakeDataPlane, string) {
+	instance := &fakeDataPlane{certs: make(map[string]bool)}
+	server := httptest.NewServer(instance)
+	t.Cleanup(server.Close)
+	return instance, server.URL
+}
+
+func (f *fakeDataPlane) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	response := map[string]interface{}{"success": true}
+	switch {
+	case r.Method == http.MethodPut && r.URL.Path == "/api/v1/routes":
+	case r.Method == http.MethodPost && r.URL.Path == "/api/v1/certificates":
+		var cert map[string]string
+		json.NewDecoder(r.Body).Decode(&cert)
+		f.certs[cert["domain"]] = true
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v1/certificates":
+		response["certificates"] = f.domains()
+	case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/api/v1/certificates/"):
+		delete(f.certs, strings.TrimPrefix(r.URL.Path, "/api/v1/certificates/"))
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func (f *fakeDataPlane) domains() []string {
+	domains := make([]string, 0, len(f.certs))
+	for domain := range f.certs {
+		domains = append(domains, domain)
+	}
+	sort.Strings(domains)
+	return domains
+}
+
+func (f *fakeDataPlane) certificates() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.domains()
+}
+
+// desiredCertificates 当前配置版本中的证书域名
+func desiredCertificates(c *DataPlaneClient) []string {
+	domains := make([]string, 0)
+	for domain := range c.currentConfig().resources.certificates {
+		domains = append(domains, domain)
+	}
+	sort.Strings(domains)
+	return domains
+}
+
+func TestConfigHistoryRollbackCertificates(t *testing.T) {
+	store := NewFileRollbackStore(filepath.Join(t.TempDir(), "rollback.json"))
+	instance, url := newFakeDataPlane(t)
+	client := NewDataPlaneClient(nil, DataPlaneDiscovery{URLs: []string{url}}, newTestLogger())
+	if err := client.SetRollbackStore(store); err != nil {
+		t.Fatalf("设置回滚状态存储失败: %v", err)
+	}
+
+	// 第1版只有a的证书，第2版加入b的证书，第3版增加路由
+	if err := client.AddCertificatePEM("a.example.com", []byte("cert-a"), []byte("key-a")); err != nil {
+		t.Fatalf("添加证书失败: %v", err)
+	}
+	if _, err := client.setDesired(testHistoryRules("/"), "alice"); err != nil {
+		t.Fatalf("生成配置失败: %v", err)
+	}
+	if err := client.AddCertificatePEM("b.example.com", []byte("cert-b"), []byte("key-b")); err != nil {
+		t.Fatalf("添加证书失败: %v", err)
+	}
+	if _, err := client.setDesired(testHistoryRules("/", "/api"), "alice"); err != nil {
+		t.Fatalf("生成配置失败: %v", err)
+	}
+
+	if _, err := client.Rollback(1, "bob"); err != nil {
+		t.Fatalf("回滚失败: %v", err)
+	}
+	if got := desiredCertificates(client); !reflect.DeepEqual(got, []string{"a.example.com"}) {
+		t.Errorf("回滚到第1版后的证书为 %v，期望只有第1版的证书", got)
+	}
+	if got := instance.certificates(); !reflect.DeepEqual(got, []string{"a.example.com"}) {
+		t.Errorf("回滚到第1版后数据面的证书为 %v，期望只有第1版的证书", got)
+	}
+	// 回滚期间添加的证书只记录，不进入回滚的配置
+	if err := client.AddCertificatePEM("c.example.com", []byte("cert-c"), []byte("key-c")); err != nil {
+		t.Fatalf("添加证书失败: %v", err)
+	}
+	if got := desiredCertificates(client); !reflect.DeepEqual(got, []string{"a.example.com"}) {
+		t.Errorf("回滚期间添加证书后的证书为 %v", got)
+	}
+	if got := instance.certificates(); !reflect.DeepEqual(got, []string{"a.example.com"}) {
+		t.Errorf("回滚期间添加证书后数据面的证书为 %v", got)
+	}
+	if _, err := client.Resume("bob"); err != nil {
+		t.Fatalf("解除回滚失败: %v", err)
+	}
+	all := []string{"a.example.com", "b.example.com", "c.example.com"}
+	if got := desiredCertificates(client); !reflect.DeepEqual(got, all) {
+		t.Errorf("解除回滚后的证书为 %v", got)
+	}
+	if got := instance.certificates(); !reflect.DeepEqual(got, all) {
+		t.Errorf("解除回滚后数据面的证书为 %v", got)
+	}
+	if err := client.saveHistory(); err != nil {
+		t.Fatalf("保存历史配置版本失败: %v", err)
+	}
+	before := client.ConfigVersions()
+
+	// 模拟控制面重启：历史版本和编号从存储恢复，证书重新加载
+	restarted := NewDataPlaneClient(nil, DataPlaneDiscovery{URLs: []string{url}}, newTestLogger())
+	if err := restarted.SetRollbackStore(store); err != nil {
+		t.Fatalf("恢复历史配置版本失败: %v", err)
+	}
+	after := restarted.ConfigVersions()
+	if len(after) != len(before) || after[0].Generation != before[0].Generation || after[0].Version != before[0].Version {
+		t.Fatalf("恢复的历史版本为 %+v，期望 %+v", after, before)
+	}
+	if err := restarted.AddCertificatePEM("a.example.com", []byte("cert-a"), []byte("key-a")); err != nil {
+		t.Fatalf("添加证书失败: %v", err)
+	}
+	if err := restarted.AddCertificatePEM("b.example.com", []byte("cert-b"), []byte("key-b")); err != nil {
+		t.Fatalf("添加证书失败: %v", err)
+	}
+	desired, err := restarted.setDesired(testHistoryRules("/", "/api"), "system")
+	if err != nil {
+		t.Fatalf("生成配置失败: %v", err)
+	}
+	if desired.generation != before[0].Generation+1 {
+		t.Errorf("重启后新版本的编号为 %d，期望接着重启前的 %d", desired.generation, before[0].Generation)
+	}
+
+	info, err := restarted.Rollback(1, "bob")
+	if err != nil {
+		t.Fatalf("回滚到重启前的版本失败: %v", err)
+	}
+	diff, err := restarted.ConfigDiff(1, info.Generation)
+	if err != nil {
+		t.Fatalf("比较配置版本失败: %v", err)
+	}
+	for name, changes := range map[string]ResourceDiff{"路由": diff.Routes, "证书": diff.Certificates} {
+		if len(changes.Added)+len(changes.Removed)+len(changes.Changed) > 0 {
+			t.Errorf("回滚生成的版本与第1版的%s不同: %+v", name, changes)
+		}
+	}
+}
+
+func TestConfigMapRollbackStore(t *testing.T) {
+	store := NewConfigMapRollbackStore(fake.NewSimpleClientset(), "kube-system", DefaultRollbackConfigMap)
+
+	records := []*HistoryRecord{
+		{Generation: 1, Version: "v1", Rules: testHistoryRules("/"), Certificates: map[string]string{"a.example.com": "digest"}},
+		{Generation: 2, Version: "v2", Rules: testHistoryRules("/", "/api")},
+	}
+	if err := store.SaveHistory(records); err != nil {
+		t.Fatalf("保存历史配置版本失败: %v", err)
+	}
+	if err := store.Save(&RollbackState{Generation: 1, Version: "v1", LastGeneration: 3}); err != nil {
+		t.Fatalf("保存回滚状态失败: %v", err)
+	}
+
+	// 回滚状态和历史版本保存在同一个ConfigMap中，互不覆盖
+	loaded, err := store.LoadHistory()
+	if err != nil {
+		t.Fatalf("读取历史配置版本失败: %v", err)
+	}
+	if len(loaded) != 2 || loaded[0].Certificates["a.example.com"] != "digest" || len(loaded[1].Rules) != 2 {
+		t.Errorf("读取的历史配置版本为 %+v", loaded)
+	}
+	if err := store.Save(nil); err != nil {
+		t.Fatalf("清除回滚状态失败: %v", err)
+	}
+	if state, err := store.Load(); err != nil || state != nil {
+		t.Errorf("清除后的回滚状态为 %+v，错误 %v", state, err)
+	}
+	if loaded, err := store.LoadHistory(); err != nil || len(loaded) != 2 {
+		t.Errorf("清除回滚状态后历史版本为 %d 个，错误 %v", len(loaded), err)
+	}
+}
@@ -0,0 +1,344 @@
+package controlplane
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"kun-gateway/pkg/dataplane"
+
+	"github.com/sirupsen/logrus"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	networkinginformers "k8s.io/client-go/informers/networking/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// IngressControllerName IngressClass中 spec.controller 的取值
+	IngressControllerName = "kun-gateway.io/ingress-controller"
+	// DefaultIngressClass 默认处理的IngressClass名称
+	DefaultIngressClass = "kun-gateway"
+
+	// ingressClassAnnotation 旧版本通过注解指定IngressClass
+	ingressClassAnnotation = "kubernetes.io/ingress.class"
+	// defaultIngressClassAnnotation 标记默认的IngressClass，未指定Class的Ingress由它处理
+	defaultIngressClassAnnotation = "ingressclass.kubernetes.io/is-default-class"
+
+	// ingressResyncInterval 定期全量同步的间隔，同时用于发现Secret和Service端口的变化
+	ingressResyncInterval = 30 * time.Second
+	// ingressSyncDelay Ingress变化后等待的时间，合并短时间内的多次变化
+	ingressSyncDelay = time.Second
+)
+
+// IngressConfig Ingress控制器配置
+type IngressConfig struct {
+	// ClassName 处理的IngressClass名称，同时用于匹配旧版本的 kubernetes.io/ingress.class 注解
+	ClassName string
+	// DataPlaneNamespace 和 DataPlaneSelector 用于查找数据面Pod，回写Ingress的负载均衡地址
+	DataPlaneNamespace string
+	DataPlaneSelector  string
+}
+
+// IngressController 将 networking.k8s.io/v1 Ingress 转换为数据面路由和证书
+type IngressController struct {
+	client          kubernetes.Interface
+	k8sDiscovery    *K8sDiscovery
+	routeManager    *RouteManager
+	dataplaneClient *DataPlaneClient
+	config          IngressConfig
+	certs           *certificateSyncer
+	trigger         chan struct{}
+	log             *logrus.Logger
+}
+
+// NewIngressController 创建Ingress控制器
+func NewIngressController(client kubernetes.Interface, k8sDiscovery *K8sDiscovery, routeManager *RouteManager, dataplaneClient *DataPlaneClient, config IngressConfig, log *logrus.Logger) *IngressController {
+	if config.ClassName == "" {
+		config.ClassName = DefaultIngressClass
+	}
+	return &IngressController{
+		client:          client,
+		k8sDiscovery:    k8sDiscovery,
+		routeManager:    routeManager,
+		dataplaneClient: dataplaneClient,
+		config:          config,
+		certs:           newCertificateSyncer(dataplaneClient, log),
+		trigger:         make(chan struct{}, 1),
+		log:             log,
+	}
+}
+
+// Start 先完成一次全量同步，保证路由管理器首次推送时已包含Ingress路由，然后在后台监听变化直到ctx结束
+func (c *IngressController) Start(ctx context.Context) {
+	c.log.Infof("启动Ingress控制器，IngressClass: %s", c.config.ClassName)
+
+	c.sync(ctx)
+	c.startInformers(ctx)
+	go c.run(ctx)
+}
+
+// run 在Ingress变化或定期同步时重新生成路由
+func (c *IngressController) run(ctx context.Context) {
+	ticker := time.NewTicker(ingressResyncInterval)
+	defer ticker.Stop()
+
+	var delay <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.trigger:
+			if delay == nil {
+				delay = time.After(ingressSyncDelay)
+			}
+		case <-delay:
+			delay = nil
+			c.sync(ctx)
+		case <-ticker.C:
+			c.sync(ctx)
+		}
+	}
+}
+
+// startInformers 监听Ingress和IngressClass，任何变化都触发一次全量同步
+func (c *IngressController) startInformers(ctx context.Context) {
+	informers := map[string]cache.SharedIndexInformer{
+		"Ingress":      networkinginformers.NewIngressInformer(c.client, metav1.NamespaceAll, informerResyncPeriod, cache.Indexers{}),
+		"IngressClass": networkinginformers.NewIngressClassInformer(c.client, informerResyncPeriod, cache.Indexers{}),
+	}
+	for kind, informer := range informers {
+		if err := startTriggerInformer(ctx, informer, c.notify); err != nil {
+			c.log.Errorf("监听%s失败: %v", kind, err)
+		}
+	}
+}
+
+// notify 触发一次同步，不阻塞
+func (c *IngressController) notify() {
+	select {
+	case c.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// sync 全量同步：生成路由、下发证书、回写状态
+func (c *IngressController) sync(ctx context.Context) {
+	ingresses, err := c.listIngresses(ctx)
+	if err != nil {
+		c.log.Errorf("同步Ingress失败: %v", err)
+		return
+	}
+
+	var routes []*RouteConfig
+	certs := make(map[string]*secretCertificate)
+	for _, ingress := range ingresses {
+		routes = append(routes, c.translate(ingress)...)
+		c.collectCertificates(ctx, ingress, certs)
+	}
+
+	c.routeManager.SetSourceRoutes(RouteSourceIngress, routes)
+	c.certs.Sync(certs)
+	c.updateStatus(ctx, ingresses)
+
+	c.log.Debugf("Ingress同步完成，%d 个Ingress，%d 条路由，%d 个证书", len(ingresses), len(routes), len(certs))
+}
+
+// listIngresses 列出由本控制器处理的Ingress，按创建时间排序，域名+路径冲突时先创建的优先
+func (c *IngressController) listIngresses(ctx context.Context) ([]*networkingv1.Ingress, error) {
+	classes, err := c.client.NetworkingV1().IngressClasses().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("获取IngressClass失败: %v", err)
+	}
+
+	owned := map[string]bool{c.config.ClassName: true}
+	isDefault := false
+	for _, class := range classes.Items {
+		if class.Spec.Controller != IngressControllerName {
+			continue
+		}
+		owned[class.Name] = true
+		if class.Annotations[defaultIngressClassAnnotation] == "true" {
+			isDefault = true
+		}
+	}
+
+	list, err := c.client.NetworkingV1().Ingresses("").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("获取Ingress失败: %v", err)
+	}
+
+	ingresses := make([]*networkingv1.Ingress, 0, len(list.Items))
+	for i := range list.Items {
+		ingress := &list.Items[i]
+		switch {
+		case ingress.Spec.IngressClassName != nil:
+			if !owned[*ingress.Spec.IngressClassName] {
+				continue
+			}
+		case ingress.Annotations[ingressClassAnnotation] != "":
+			if !owned[ingress.Annotations[ingressClassAnnotation]] {
+				continue
+			}
+		case !isDefault:
+			continue
+		}
+		ingresses = append(ingresses, ingress)
+	}
+
+	sort.Slice(ingresses, func(i, j int) bool {
+		a, b := ingresses[i], ingresses[j]
+		if !a.CreationTimestamp.Equal(&b.CreationTimestamp) {
+			return a.CreationTimestamp.Before(&b.CreationTimestamp)
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Name < b.Name
+	})
+	return ingresses, nil
+}
+
+// translate 将Ingress的规则和默认后端转换为路由，无法解析后端的路径会被跳过
+func (c *IngressController) translate(ingress *networkingv1.Ingress) []*RouteConfig {
+	key := fmt.Sprintf("%s/%s", ingress.Namespace, ingress.Name)
+	var routes []*RouteConfig
+
+	add := func(host, path string, pathType dataplane.PathMatchType, backend *networkingv1.IngressBackend) {
+		route, err := c.buildRoute(ingress, host, path, pathType, backend)
+		if err != nil {
+			c.log.Warnf("Ingress %s 的路径 %s%s 已跳过: %v", key, host, path, err)
+			return
+		}
+		route.ID = fmt.Sprintf("%s:%s:%s:%d", RouteSourceIngress, ingress.Namespace, ingress.Name, len(routes))
+		routes = append(routes, route)
+	}
+
+	for _, rule := range ingress.Spec.Rules {
+		if rule.HTTP == nil {
+			continue
+		}
+		for _, path := range rule.HTTP.Paths {
+			pathType := dataplane.PathMatchPrefix
+			if path.PathType != nil && *path.PathType == networkingv1.PathTypeExact {
+				pathType = dataplane.PathMatchExact
+			}
+			backend := path.Backend
+			add(rule.Host, path.Path, pathType, &backend)
+		}
+	}
+
+	// 默认后端处理未命中任何规则的请求
+	if ingress.Spec.DefaultBackend != nil {
+		add("", "/", dataplane.PathMatchPrefix, ingress.Spec.DefaultBackend)
+	}
+
+	return routes
+}
+
+// buildRoute 将一条Ingress路径转换为路由配置
+func (c *IngressController) buildRoute(ingress *networkingv1.Ingress, host, path string, pathType dataplane.PathMatchType, backend *networkingv1.IngressBackend) (*RouteConfig, error) {
+	if backend.Service == nil {
+		return nil, fmt.Errorf("只支持Service类型的后端")
+	}
+
+	if path == "" {
+		path = "/"
+	}
+	if !strings.HasPrefix(path, "/") {
+		return nil, fmt.Errorf("路径必须以/开头")
+	}
+	// 前缀按路径段匹配，末尾的/不影响匹配结果
+	if pathType == dataplane.PathMatchPrefix && path != "/" {
+		path = strings.TrimRight(path, "/")
+	}
+
+	// 路由引用Service端口，Pod端口在推送时按EndpointSlice解析
+	servicePort, err := c.k8sDiscovery.ResolveServicePort(ingress.Namespace, backend.Service.Name, backend.Service.Port.Name, backend.Service.Port.Number)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RouteConfig{
+		Domain:    host,
+		Path:      path,
+		PathType:  pathType,
+		Service:   fmt.Sprintf("%s/%s", ingress.Namespace, backend.Service.Name),
+		Port:      int(servicePort.Port),
+		Weight:    100,
+		CreatedAt: ingress.CreationTimestamp.Time,
+		UpdatedAt: ingress.CreationTimestamp.Time,
+	}, nil
+}
+
+// collectCertificates 读取Ingress tls段引用的Secret，同一域名以先处理的Ingress为准
+func (c *IngressController) collectCertificates(ctx context.Context, ingress *networkingv1.Ingress, certs map[string]*secretCertificate) {
+	for _, tls := range ingress.Spec.TLS {
+		if tls.SecretName == "" || len(tls.Hosts) == 0 {
+			continue
+		}
+
+		cert, err := loadTLSSecret(ctx, c.client, ingress.Namespace, tls.SecretName)
+		if err != nil {
+			c.log.Warnf("读取Ingress %s/%s 的证书 %s 失败: %v", ingress.Namespace, ingress.Name, tls.SecretName, err)
+			continue
+		}
+
+		for _, host := range tls.Hosts {
+			if existing, ok := certs[host]; ok {
+				if existing.source != cert.source {
+					c.log.Warnf("域名 %s 的证书已由 %s 提供，忽略 %s", host, existing.source, cert.source)
+				}
+				continue
+			}
+			certs[host] = cert
+		}
+	}
+}
+
+// updateStatus 将数据面所在节点的地址写回Ingress的 status.loadBalancer
+func (c *IngressController) updateStatus(ctx context.Context, ingresses []*networkingv1.Ingress) {
+	ips, err := dataplaneNodeIPs(ctx, c.client, c.config.DataPlaneNamespace, c.config.DataPlaneSelector)
+	if err != nil {
+		c.log.Warnf("获取数据面节点地址失败: %v", err)
+		return
+	}
+	if len(ips) == 0 {
+		return
+	}
+
+	addresses := make([]networkingv1.IngressLoadBalancerIngress, 0, len(ips))
+	for _, ip := range ips {
+		addresses = append(addresses, networkingv1.IngressLoadBalancerIngress{IP: ip})
+	}
+
+	for _, ingress := range ingresses {
+		if equalLoadBalancer(ingress.Status.LoadBalancer.Ingress, addresses) {
+			continue
+		}
+
+		updated := ingress.DeepCopy()
+		updated.Status.LoadBalancer.Ingress = addresses
+		if _, err := c.client.NetworkingV1().Ingresses(ingress.Namespace).UpdateStatus(ctx, updated, metav1.UpdateOptions{}); err != nil {
+			c.log.Warnf("更新Ingress %s/%s 状态失败: %v", ingress.Namespace, ingress.Name, err)
+			continue
+		}
+		c.log.Infof("已更新Ingress %s/%s 的负载均衡地址", ingress.Namespace, ingress.Name)
+	}
+}
+
+// equalLoadBalancer 比较负载均衡地址是否相同
+func equalLoadBalancer(a, b []networkingv1.IngressLoadBalancerIngress) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].IP != b[i].IP || a[i].Hostname != b[i].Hostname {
+			return false
+		}
+	}
+	return true
+}
@@ -3,29 +3,70 @@ package controlplane
 import (
 	"context"
 	"fmt"
+	"reflect"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/sirupsen/logrus"
 	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/dynamic"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	discoveryinformers "k8s.io/client-go/informers/discovery/v1"
 	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	discoverylisters "k8s.io/client-go/listers/discovery/v1"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/clientcmd"
 )
 
-// K8sDiscovery K8s服务发现
+const (
+	// informerResyncPeriod informer定期将缓存重新分发给事件处理函数的间隔，用于修正处理中遗漏的变化
+	informerResyncPeriod = 10 * time.Minute
+	// cacheSyncTimeout 启动时等待Service和EndpointSlice缓存同步的最长时间
+	cacheSyncTimeout = 2 * time.Minute
+)
+
+// DiscoveryScope 服务发现的范围，为空时监听所有命名空间的Service
+type DiscoveryScope struct {
+	// Namespaces 只监听这些命名空间，只有命名空间级别（Role）的权限时必须指定
+	Namespaces []string `json:"namespaces,omitempty"`
+	// NamespaceSelector 命名空间的标签选择器，需要集群范围读取namespaces的权限
+	NamespaceSelector string `json:"namespace_selector,omitempty"`
+	// ServiceSelector Service的标签选择器，在API Server端过滤
+	ServiceSelector string `json:"service_selector,omitempty"`
+}
+
+// K8sDiscovery K8s服务发现，基于shared informer监听Service和EndpointSlice，
+// 断线重连、resourceVersion过期后的重新list都由informer处理
 type K8sDiscovery struct {
-	client         *kubernetes.Clientset
-	log            *logrus.Logger
-	services       map[string]*ServiceInfo
-	endpoints      map[string]*EndpointInfo
+	client        kubernetes.Interface
+	dynamicClient dynamic.Interface
+	scope         DiscoveryScope
+	log           *logrus.Logger
+	services      map[string]*ServiceInfo
+	endpoints     map[string]*EndpointInfo
+	// 由scope解析的选择器，除了在API Server端过滤，处理事件时也再次检查
+	namespaceSelector labels.Selector
+	serviceSelector   labels.Selector
+	// namespaces 设置了命名空间标签选择器时，当前匹配的命名空间
+	namespaces map[string]bool
+	// 每个监听的命名空间一组informer，监听所有命名空间时key为空字符串
+	serviceListers map[string]corelisters.ServiceLister
+	sliceListers   map[string]discoverylisters.EndpointSliceLister
 	mu             sync.RWMutex
 	ctx            context.Context
 	cancel         context.CancelFunc
-	lastServiceRV  string // 记录Service的ResourceVersion
-	lastEndpointRV string // 记录Endpoint的ResourceVersion
+	// 端点变化的回调，参数为 namespace/name
+	endpointHandlers []func(key string)
+	// 服务端口、注解等配置变化的回调，参数为 namespace/name
+	serviceHandlers []func(key string)
 }
 
 // ServiceInfo 服务信息
@@ -33,31 +74,65 @@ type ServiceInfo struct {
 	Name      string
 	Namespace string
 	ClusterIP string
-	Ports     []ServicePort
-	Labels    map[string]string
-	CreatedAt time.Time
+	// Type Service类型，ExternalName类型的服务没有端点，按 ExternalName 域名转发
+	Type         string
+	ExternalName string
+	Ports        []ServicePort
+	Labels       map[string]string
+	// Annotations 用于通过 kun-gateway.io/host 等注解直接暴露服务
+	Annotations map[string]string
+	// PublishNotReadyAddresses 为true时未就绪的Pod也接收流量
+	PublishNotReadyAddresses bool
+	// SessionAffinity 和 AffinityTimeout（秒）对应Service的会话保持配置
+	SessionAffinity string
+	AffinityTimeout int32
+	CreatedAt       time.Time
 }
 
 // ServicePort 服务端口
 type ServicePort struct {
-	Name       string
-	Port       int32
-	TargetPort int32
-	Protocol   string
+	Name string
+	Port int32
+	// TargetPort 为数字时的Pod端口；targetPort为命名端口时为0，名称保存在 TargetPortName，
+	// 实际端口取自EndpointSlice，不同Pod可能不同
+	TargetPort     int32
+	TargetPortName string
+	Protocol       string
 }
 
 // EndpointInfo 端点信息
 type EndpointInfo struct {
 	ServiceName string
 	Namespace   string
-	Addresses   []string // Pod IP列表
-	Ports       []int32
+	Addresses   []string // 就绪的Pod IP列表
+	// DrainingAddresses 正在终止但仍能处理请求的Pod IP，只用于已有会话的流量和没有就绪地址的情况
+	DrainingAddresses []string
+	Ports             []int32
+	// Endpoints 每个地址的状态和所在位置
+	Endpoints []EndpointAddress
+	Ready     bool
+	// 从Service复制的会话保持配置，构建上游时只需读取端点
+	SessionAffinity string
+	AffinityTimeout int32
+	UpdatedAt       time.Time
+}
+
+// EndpointAddress 单个端点的状态，对应EndpointSlice中的一个endpoint
+type EndpointAddress struct {
+	IP string
+	// Ready 可以接收新请求，Serving 能够处理请求（终止中的Pod可能仍为true），Terminating 正在终止
 	Ready       bool
-	UpdatedAt   time.Time
+	Serving     bool
+	Terminating bool
+	PodName     string
+	NodeName    string
+	Zone        string
+	// Ports 该地址的端口，key为Service端口名（只有一个未命名端口时为空字符串），value为Pod端口
+	Ports map[string]int32
 }
 
-// NewK8sDiscovery 创建K8s服务发现
-func NewK8sDiscovery(log *logrus.Logger) (*K8sDiscovery, error) {
+// NewK8sDiscovery 创建K8s服务发现，scope为空时监听所有命名空间
+func NewK8sDiscovery(scope DiscoveryScope, log *logrus.Logger) (*K8sDiscovery, error) {
 	// 尝试从集群内部获取配置
 	config, err := rest.InClusterConfig()
 	if err != nil {
@@ -73,66 +148,172 @@ func NewK8sDiscovery(log *logrus.Logger) (*K8sDiscovery, error) {
 		return nil, fmt.Errorf("创建K8s客户端失败: %v", err)
 	}
 
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("创建K8s动态客户端失败: %v", err)
+	}
+
+	return NewK8sDiscoveryWithClients(client, dynamicClient, scope, log), nil
+}
+
+// NewK8sDiscoveryWithClients 使用指定的客户端创建K8s服务发现，测试时可传入 fake.NewSimpleClientset()
+func NewK8sDiscoveryWithClients(client kubernetes.Interface, dynamicClient dynamic.Interface, scope DiscoveryScope, log *logrus.Logger) *K8sDiscovery {
 	ctx, cancel := context.WithCancel(context.Background())
 
 	return &K8sDiscovery{
-		client:    client,
-		log:       log,
-		services:  make(map[string]*ServiceInfo),
-		endpoints: make(map[string]*EndpointInfo),
-		ctx:       ctx,
-		cancel:    cancel,
-	}, nil
+		client:         client,
+		dynamicClient:  dynamicClient,
+		scope:          scope,
+		log:            log,
+		services:       make(map[string]*ServiceInfo),
+		endpoints:      make(map[string]*EndpointInfo),
+		namespaces:     make(map[string]bool),
+		serviceListers: make(map[string]corelisters.ServiceLister),
+		sliceListers:   make(map[string]discoverylisters.EndpointSliceLister),
+		ctx:            ctx,
+		cancel:         cancel,
+	}
 }
 
-// Start 启动服务发现
+// Start 启动Service和EndpointSlice的informer，等待缓存同步完成后返回，此时范围内的服务和端点已全部加载。
+// 指定了命名空间列表时每个命名空间单独list/watch，只需要这些命名空间的权限
 func (k *K8sDiscovery) Start() error {
 	k.log.Info("启动K8s服务发现...")
 
-	// 先进行初始同步
-	if err := k.initialSync(); err != nil {
-		return fmt.Errorf("初始同步失败: %v", err)
+	serviceSelector, err := labels.Parse(k.scope.ServiceSelector)
+	if err != nil {
+		return fmt.Errorf("Service标签选择器错误: %v", err)
 	}
+	k.serviceSelector = serviceSelector
 
-	// 启动Service监听
-	go k.watchServices()
+	var namespaceInformer cache.SharedIndexInformer
+	if k.scope.NamespaceSelector != "" {
+		namespaceSelector, err := labels.Parse(k.scope.NamespaceSelector)
+		if err != nil {
+			return fmt.Errorf("命名空间标签选择器错误: %v", err)
+		}
+		k.namespaceSelector = namespaceSelector
+		namespaceInformer = coreinformers.NewFilteredNamespaceInformer(k.client, informerResyncPeriod, cache.Indexers{}, func(options *metav1.ListOptions) {
+			options.LabelSelector = namespaceSelector.String()
+		})
+		// 命名空间的标签不再匹配时，informer收到删除事件
+		if _, err := namespaceInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc:    k.onNamespaceUpdate,
+			UpdateFunc: func(_, obj interface{}) { k.onNamespaceUpdate(obj) },
+			DeleteFunc: k.onNamespaceDelete,
+		}); err != nil {
+			return fmt.Errorf("注册Namespace事件处理失败: %v", err)
+		}
+	}
 
-	// 启动Endpoint监听
-	go k.watchEndpoints()
+	namespaces := k.scope.Namespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+	indexers := cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc}
+	var informers []cache.SharedIndexInformer
+	for _, namespace := range namespaces {
+		// Service的标签变化到不再匹配时，informer收到删除事件
+		serviceInformer := coreinformers.NewFilteredServiceInformer(k.client, namespace, informerResyncPeriod, indexers, func(options *metav1.ListOptions) {
+			options.LabelSelector = serviceSelector.String()
+		})
+		sliceInformer := discoveryinformers.NewEndpointSliceInformer(k.client, namespace, informerResyncPeriod, indexers)
+
+		if _, err := serviceInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc:    k.onServiceUpdate,
+			UpdateFunc: func(_, obj interface{}) { k.onServiceUpdate(obj) },
+			DeleteFunc: k.onServiceDelete,
+		}); err != nil {
+			return fmt.Errorf("注册Service事件处理失败: %v", err)
+		}
+		if _, err := sliceInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc:    k.onEndpointSliceChange,
+			UpdateFunc: func(_, obj interface{}) { k.onEndpointSliceChange(obj) },
+			DeleteFunc: k.onEndpointSliceChange,
+		}); err != nil {
+			return fmt.Errorf("注册EndpointSlice事件处理失败: %v", err)
+		}
 
-	return nil
-}
+		k.serviceListers[namespace] = corelisters.NewServiceLister(serviceInformer.GetIndexer())
+		k.sliceListers[namespace] = discoverylisters.NewEndpointSliceLister(sliceInformer.GetIndexer())
+		informers = append(informers, serviceInformer, sliceInformer)
+	}
 
-// initialSync 初始同步现有资源
-func (k *K8sDiscovery) initialSync() error {
-	k.log.Info("开始初始同步...")
+	ctx, cancel := context.WithTimeout(k.ctx, cacheSyncTimeout)
+	defer cancel()
 
-	// 同步Services
-	services, err := k.client.CoreV1().Services("").List(k.ctx, metav1.ListOptions{})
-	if err != nil {
-		return fmt.Errorf("获取Services失败: %v", err)
+	// 先确定范围内的命名空间，处理Service事件时依赖它
+	if namespaceInformer != nil {
+		go namespaceInformer.Run(k.ctx.Done())
+		if !cache.WaitForCacheSync(ctx.Done(), namespaceInformer.HasSynced) {
+			return fmt.Errorf("等待Namespace缓存同步超时")
+		}
 	}
 
-	for _, service := range services.Items {
-		k.updateService(&service)
+	synced := make([]cache.InformerSynced, 0, len(informers))
+	for _, informer := range informers {
+		go informer.Run(k.ctx.Done())
+		synced = append(synced, informer.HasSynced)
 	}
-	k.lastServiceRV = services.ResourceVersion
-	k.log.Infof("同步了 %d 个Service", len(services.Items))
-
-	// 同步Endpoints
-	endpoints, err := k.client.CoreV1().Endpoints("").List(k.ctx, metav1.ListOptions{})
-	if err != nil {
-		return fmt.Errorf("获取Endpoints失败: %v", err)
+	if !cache.WaitForCacheSync(ctx.Done(), synced...) {
+		return fmt.Errorf("等待Service和EndpointSlice缓存同步超时")
 	}
 
-	for _, endpoint := range endpoints.Items {
-		k.updateEndpoint(&endpoint)
+	k.mu.RLock()
+	k.log.Infof("缓存同步完成，%d 个Service，%d 个服务有端点", len(k.services), len(k.endpoints))
+	k.mu.RUnlock()
+	return nil
+}
+
+// Scope 获取服务发现的范围
+func (k *K8sDiscovery) Scope() DiscoveryScope {
+	return k.scope
+}
+
+// Client 获取K8s客户端
+func (k *K8sDiscovery) Client() kubernetes.Interface {
+	return k.client
+}
+
+// DynamicClient 获取K8s动态客户端，用于访问CRD等非内置资源
+func (k *K8sDiscovery) DynamicClient() dynamic.Interface {
+	return k.dynamicClient
+}
+
+// OnEndpointsChange 注册端点变化的回调，只在服务的地址列表变化时调用，回调中不能阻塞
+func (k *K8sDiscovery) OnEndpointsChange(handler func(key string)) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.endpointHandlers = append(k.endpointHandlers, handler)
+}
+
+// OnServiceChange 注册服务变化的回调，只在服务影响路由的配置变化、服务删除时调用，回调中不能阻塞
+func (k *K8sDiscovery) OnServiceChange(handler func(key string)) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.serviceHandlers = append(k.serviceHandlers, handler)
+}
+
+// notifyServiceChange 通知服务变化
+func (k *K8sDiscovery) notifyServiceChange(key string) {
+	k.mu.RLock()
+	handlers := k.serviceHandlers
+	k.mu.RUnlock()
+
+	for _, handler := range handlers {
+		handler(key)
 	}
-	k.lastEndpointRV = endpoints.ResourceVersion
-	k.log.Infof("同步了 %d 个Endpoint", len(endpoints.Items))
+}
 
-	k.log.Info("初始同步完成")
-	return nil
+// notifyEndpointsChange 通知端点变化
+func (k *K8sDiscovery) notifyEndpointsChange(key string) {
+	k.mu.RLock()
+	handlers := k.endpointHandlers
+	k.mu.RUnlock()
+
+	for _, handler := range handlers {
+		handler(key)
+	}
 }
 
 // Stop 停止服务发现
@@ -141,141 +322,183 @@ func (k *K8sDiscovery) Stop() {
 	k.log.Info("K8s服务发现已停止")
 }
 
-// watchServices 监听Service变化
-func (k *K8sDiscovery) watchServices() {
-	for {
-		select {
-		case <-k.ctx.Done():
-			return
-		default:
-			k.watchServicesOnce()
-		}
+// onServiceUpdate 处理Service的新增、修改和定期重放
+func (k *K8sDiscovery) onServiceUpdate(obj interface{}) {
+	service, ok := obj.(*corev1.Service)
+	if !ok {
+		return
+	}
+
+	key := fmt.Sprintf("%s/%s", service.Namespace, service.Name)
+	if !k.namespaceInScope(service.Namespace) || (k.serviceSelector != nil && !k.serviceSelector.Matches(labels.Set(service.Labels))) {
+		k.removeService(service.Namespace, service.Name)
+		return
+	}
+	if k.updateService(service) {
+		k.log.Infof("Service更新: %s, ClusterIP: %s", key, service.Spec.ClusterIP)
+		k.notifyServiceChange(key)
+		// publishNotReadyAddresses和会话保持影响端点的计算
+		k.syncServiceEndpoints(service.Namespace, service.Name)
 	}
 }
 
-// watchServicesOnce 监听Service变化（单次）
-func (k *K8sDiscovery) watchServicesOnce() {
-	options := metav1.ListOptions{}
-	if k.lastServiceRV != "" {
-		options.ResourceVersion = k.lastServiceRV
+// onServiceDelete 处理Service删除，informer重新list时错过的删除以DeletedFinalStateUnknown的形式传入
+func (k *K8sDiscovery) onServiceDelete(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	service, ok := obj.(*corev1.Service)
+	if !ok {
+		return
 	}
 
-	watcher, err := k.client.CoreV1().Services("").Watch(k.ctx, options)
-	if err != nil {
-		k.log.Errorf("监听Service失败: %v", err)
-		time.Sleep(5 * time.Second)
+	k.removeService(service.Namespace, service.Name)
+}
+
+// removeService 删除服务及其端点，用于Service删除或离开服务发现范围
+func (k *K8sDiscovery) removeService(namespace, name string) {
+	key := fmt.Sprintf("%s/%s", namespace, name)
+	if k.deleteService(key) {
+		k.log.Infof("Service删除: %s", key)
+		k.notifyServiceChange(key)
+	}
+	if k.deleteEndpoint(key) {
+		k.log.Infof("Endpoint删除: %s", key)
+		k.notifyEndpointsChange(key)
+	}
+}
+
+// onNamespaceUpdate 命名空间进入范围（新建或标签变化后匹配选择器）时加载其中的服务
+func (k *K8sDiscovery) onNamespaceUpdate(obj interface{}) {
+	namespace, ok := obj.(*corev1.Namespace)
+	if !ok {
+		return
+	}
+	if !k.namespaceSelector.Matches(labels.Set(namespace.Labels)) {
+		k.onNamespaceDelete(namespace)
 		return
 	}
-	defer watcher.Stop()
 
-	for {
-		select {
-		case <-k.ctx.Done():
-			return
-		case event, ok := <-watcher.ResultChan():
-			if !ok {
-				k.log.Warn("Service监听通道已关闭，重新连接...")
-				return
-			}
+	k.mu.Lock()
+	added := !k.namespaces[namespace.Name]
+	k.namespaces[namespace.Name] = true
+	k.mu.Unlock()
 
-			service, ok := event.Object.(*corev1.Service)
-			if !ok {
-				continue
-			}
+	if added {
+		k.log.Infof("命名空间进入服务发现范围: %s", namespace.Name)
+		k.resyncNamespace(namespace.Name)
+	}
+}
 
-			key := fmt.Sprintf("%s/%s", service.Namespace, service.Name)
+// onNamespaceDelete 命名空间离开范围（删除或标签不再匹配选择器）时移除其中的服务
+func (k *K8sDiscovery) onNamespaceDelete(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	namespace, ok := obj.(*corev1.Namespace)
+	if !ok {
+		return
+	}
 
-			// 更新ResourceVersion
-			k.lastServiceRV = service.ResourceVersion
+	k.mu.Lock()
+	removed := k.namespaces[namespace.Name]
+	delete(k.namespaces, namespace.Name)
+	k.mu.Unlock()
+	if !removed {
+		return
+	}
 
-			switch event.Type {
-			case watch.Added, watch.Modified:
-				k.updateService(service)
-				k.log.Infof("Service更新: %s, ClusterIP: %s", key, service.Spec.ClusterIP)
-			case watch.Deleted:
-				k.deleteService(key)
-				k.log.Infof("Service删除: %s", key)
-			}
+	k.log.Infof("命名空间离开服务发现范围: %s", namespace.Name)
+	for _, service := range k.GetServices() {
+		if service.Namespace == namespace.Name {
+			k.removeService(service.Namespace, service.Name)
 		}
 	}
 }
 
-// watchEndpoints 监听Endpoint变化
-func (k *K8sDiscovery) watchEndpoints() {
-	for {
-		select {
-		case <-k.ctx.Done():
-			return
-		default:
-			k.watchEndpointsOnce()
+// resyncNamespace 按命名空间当前是否在范围内重新处理其中的全部Service
+func (k *K8sDiscovery) resyncNamespace(namespace string) {
+	for _, lister := range k.serviceListers {
+		services, err := lister.Services(namespace).List(labels.Everything())
+		if err != nil {
+			k.log.Errorf("获取命名空间 %s 的Service失败: %v", namespace, err)
+			continue
+		}
+		for _, service := range services {
+			k.onServiceUpdate(service)
 		}
 	}
 }
 
-// watchEndpointsOnce 监听Endpoint变化（单次）
-func (k *K8sDiscovery) watchEndpointsOnce() {
-	options := metav1.ListOptions{}
-	if k.lastEndpointRV != "" {
-		options.ResourceVersion = k.lastEndpointRV
+// namespaceInScope 判断命名空间是否在服务发现范围内，命名空间列表已由informer保证
+func (k *K8sDiscovery) namespaceInScope(namespace string) bool {
+	if k.scope.NamespaceSelector == "" {
+		return true
 	}
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.namespaces[namespace]
+}
 
-	watcher, err := k.client.CoreV1().Endpoints("").Watch(k.ctx, options)
-	if err != nil {
-		k.log.Errorf("监听Endpoint失败: %v", err)
-		time.Sleep(5 * time.Second)
+// onEndpointSliceChange 处理EndpointSlice的任何变化：根据该服务当前的全部EndpointSlice重新计算端点
+func (k *K8sDiscovery) onEndpointSliceChange(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	slice, ok := obj.(*discoveryv1.EndpointSlice)
+	if !ok {
+		return
+	}
+	serviceName := slice.Labels[discoveryv1.LabelServiceName]
+	if serviceName == "" {
 		return
 	}
-	defer watcher.Stop()
 
-	for {
-		select {
-		case <-k.ctx.Done():
-			return
-		case event, ok := <-watcher.ResultChan():
-			if !ok {
-				k.log.Warn("Endpoint监听通道已关闭，重新连接...")
-				return
-			}
+	k.syncServiceEndpoints(slice.Namespace, serviceName)
+}
 
-			endpoint, ok := event.Object.(*corev1.Endpoints)
-			if !ok {
-				continue
-			}
+// syncServiceEndpoints 根据服务当前的全部EndpointSlice和Service配置重新计算端点，有变化时通知
+func (k *K8sDiscovery) syncServiceEndpoints(namespace, serviceName string) {
+	lister, ok := k.sliceListers[namespace]
+	if !ok {
+		lister, ok = k.sliceListers[metav1.NamespaceAll]
+	}
+	if !ok {
+		return
+	}
 
-			key := fmt.Sprintf("%s/%s", endpoint.Namespace, endpoint.Name)
-
-			// 更新ResourceVersion
-			k.lastEndpointRV = endpoint.ResourceVersion
-
-			switch event.Type {
-			case watch.Added, watch.Modified:
-				// 检查是否有实际的端点地址
-				hasAddresses := false
-				for _, subset := range endpoint.Subsets {
-					if len(subset.Addresses) > 0 {
-						hasAddresses = true
-						break
-					}
-				}
-
-				// 只在有端点地址或者是有意义的服务时才打印日志
-				if hasAddresses || (endpoint.Name != "docker.io-hostpath" && endpoint.Name != "kubernetes") {
-					k.updateEndpoint(endpoint)
-					k.log.Infof("Endpoint更新: %s, 地址数量: %d", key, len(endpoint.Subsets))
-				} else {
-					// 静默更新没有端点的系统服务
-					k.updateEndpoint(endpoint)
-				}
-			case watch.Deleted:
-				k.deleteEndpoint(key)
-				k.log.Infof("Endpoint删除: %s", key)
-			}
+	key := fmt.Sprintf("%s/%s", namespace, serviceName)
+	slices, err := lister.EndpointSlices(namespace).List(labels.SelectorFromSet(labels.Set{discoveryv1.LabelServiceName: serviceName}))
+	if err != nil {
+		k.log.Errorf("获取服务 %s 的EndpointSlice失败: %v", key, err)
+		return
+	}
+
+	k.mu.RLock()
+	service := k.services[key]
+	k.mu.RUnlock()
+
+	var changed bool
+	// 不在范围内（或已删除）的服务不保留端点
+	if len(slices) == 0 || service == nil {
+		changed = k.deleteEndpoint(key)
+		if changed {
+			k.log.Infof("Endpoint删除: %s", key)
+		}
+	} else {
+		info := buildEndpointInfo(namespace, serviceName, slices, service)
+		changed = k.updateEndpoint(key, info)
+		if changed {
+			k.log.Infof("Endpoint更新: %s, 就绪地址: %d, 终止中: %d", key, len(info.Addresses), len(info.DrainingAddresses))
 		}
 	}
+	if changed {
+		k.notifyEndpointsChange(key)
+	}
 }
 
-// updateService 更新服务信息
-func (k *K8sDiscovery) updateService(service *corev1.Service) {
+// updateService 更新服务信息，返回影响路由的配置（类型、端口、注解、publishNotReadyAddresses、会话保持）是否有变化
+func (k *K8sDiscovery) updateService(service *corev1.Service) bool {
 	k.mu.Lock()
 	defer k.mu.Unlock()
 
@@ -283,67 +506,202 @@ func (k *K8sDiscovery) updateService(service *corev1.Service) {
 
 	ports := make([]ServicePort, 0, len(service.Spec.Ports))
 	for _, port := range service.Spec.Ports {
-		ports = append(ports, ServicePort{
-			Name:       port.Name,
-			Port:       port.Port,
-			TargetPort: port.TargetPort.IntVal,
-			Protocol:   string(port.Protocol),
-		})
+		servicePort := ServicePort{
+			Name:     port.Name,
+			Port:     port.Port,
+			Protocol: string(port.Protocol),
+		}
+		if port.TargetPort.Type == intstr.String {
+			servicePort.TargetPortName = port.TargetPort.StrVal
+		} else {
+			servicePort.TargetPort = port.TargetPort.IntVal
+		}
+		// 未设置targetPort时与port相同
+		if servicePort.TargetPort == 0 && servicePort.TargetPortName == "" {
+			servicePort.TargetPort = port.Port
+		}
+		ports = append(ports, servicePort)
 	}
 
-	k.services[key] = &ServiceInfo{
-		Name:      service.Name,
-		Namespace: service.Namespace,
-		ClusterIP: service.Spec.ClusterIP,
-		Ports:     ports,
-		Labels:    service.Labels,
-		CreatedAt: time.Now(),
+	createdAt := service.CreationTimestamp.Time
+	if createdAt.IsZero() {
+		createdAt = time.Now()
 	}
+
+	info := &ServiceInfo{
+		Name:                     service.Name,
+		Namespace:                service.Namespace,
+		ClusterIP:                service.Spec.ClusterIP,
+		Type:                     string(service.Spec.Type),
+		ExternalName:             service.Spec.ExternalName,
+		Ports:                    ports,
+		Labels:                   service.Labels,
+		Annotations:              service.Annotations,
+		PublishNotReadyAddresses: service.Spec.PublishNotReadyAddresses,
+		SessionAffinity:          string(service.Spec.SessionAffinity),
+		CreatedAt:                createdAt,
+	}
+	if service.Spec.SessionAffinity == corev1.ServiceAffinityClientIP {
+		if config := service.Spec.SessionAffinityConfig; config != nil && config.ClientIP != nil && config.ClientIP.TimeoutSeconds != nil {
+			info.AffinityTimeout = *config.ClientIP.TimeoutSeconds
+		}
+	} else {
+		info.SessionAffinity = ""
+	}
+
+	existing := k.services[key]
+	k.services[key] = info
+	if existing == nil {
+		return true
+	}
+	// ClusterIP、标签等不影响路由的字段变化时不通知
+	return !reflect.DeepEqual(existing.Ports, info.Ports) || !reflect.DeepEqual(existing.Annotations, info.Annotations) ||
+		existing.Type != info.Type || existing.ExternalName != info.ExternalName ||
+		existing.PublishNotReadyAddresses != info.PublishNotReadyAddresses ||
+		existing.SessionAffinity != info.SessionAffinity || existing.AffinityTimeout != info.AffinityTimeout
 }
 
-// deleteService 删除服务信息
-func (k *K8sDiscovery) deleteService(key string) {
+// deleteService 删除服务信息，返回服务是否存在
+func (k *K8sDiscovery) deleteService(key string) bool {
 	k.mu.Lock()
 	defer k.mu.Unlock()
+
+	_, ok := k.services[key]
 	delete(k.services, key)
+	return ok
 }
 
-// updateEndpoint 更新端点信息
-func (k *K8sDiscovery) updateEndpoint(endpoint *corev1.Endpoints) {
-	k.mu.Lock()
-	defer k.mu.Unlock()
-
-	key := fmt.Sprintf("%s/%s", endpoint.Namespace, endpoint.Name)
+// buildEndpointInfo 合并服务的全部EndpointSlice，同一地址可能在切换期间同时出现在多个slice中。
+// 就绪的地址接收新请求；终止中但仍能处理请求的地址进入排空列表；service为空（Service尚未同步）时按默认配置处理
+func buildEndpointInfo(namespace, serviceName string, slices []*discoveryv1.EndpointSlice, service *ServiceInfo) *EndpointInfo {
+	info := &EndpointInfo{
+		ServiceName:       serviceName,
+		Namespace:         namespace,
+		Addresses:         make([]string, 0),
+		DrainingAddresses: make([]string, 0),
+		Ports:             make([]int32, 0),
+		Endpoints:         make([]EndpointAddress, 0),
+		UpdatedAt:         time.Now(),
+	}
+	publishNotReady := false
+	if service != nil {
+		publishNotReady = service.PublishNotReadyAddresses
+		info.SessionAffinity = service.SessionAffinity
+		info.AffinityTimeout = service.AffinityTimeout
+	}
 
-	addresses := make([]string, 0)
-	ports := make([]int32, 0)
+	seenAddresses := make(map[string]bool)
+	seenPorts := make(map[int32]bool)
+	for _, slice := range slices {
+		// FQDN类型的slice由自定义控制器维护，数据面无法直接使用
+		if slice.AddressType != discoveryv1.AddressTypeIPv4 && slice.AddressType != discoveryv1.AddressTypeIPv6 {
+			continue
+		}
 
-	for _, subset := range endpoint.Subsets {
-		// 只选择Ready状态的地址
-		for _, address := range subset.Addresses {
-			addresses = append(addresses, address.IP)
+		// slice中的端口名与Service端口名一致，同一slice中的端点端口相同
+		slicePorts := make(map[string]int32, len(slice.Ports))
+		for _, port := range slice.Ports {
+			if port.Port == nil {
+				continue
+			}
+			name := ""
+			if port.Name != nil {
+				name = *port.Name
+			}
+			slicePorts[name] = *port.Port
+			if !seenPorts[*port.Port] {
+				seenPorts[*port.Port] = true
+				info.Ports = append(info.Ports, *port.Port)
+			}
 		}
 
-		for _, port := range subset.Ports {
-			ports = append(ports, port.Port)
+		for _, endpoint := range slice.Endpoints {
+			// 同一端点的多个地址可以互换，使用第一个
+			if len(endpoint.Addresses) == 0 || seenAddresses[endpoint.Addresses[0]] {
+				continue
+			}
+			seenAddresses[endpoint.Addresses[0]] = true
+
+			address := endpointAddress(endpoint, publishNotReady)
+			address.Ports = slicePorts
+			info.Endpoints = append(info.Endpoints, address)
+			switch {
+			case address.Ready:
+				info.Addresses = append(info.Addresses, address.IP)
+			case address.Terminating && address.Serving:
+				info.DrainingAddresses = append(info.DrainingAddresses, address.IP)
+			}
 		}
 	}
 
-	k.endpoints[key] = &EndpointInfo{
-		ServiceName: endpoint.Name,
-		Namespace:   endpoint.Namespace,
-		Addresses:   addresses,
-		Ports:       ports,
-		Ready:       len(addresses) > 0,
-		UpdatedAt:   time.Now(),
+	// 排序后保存，地址集合相同时不会因为顺序不同而触发推送
+	sort.Strings(info.Addresses)
+	sort.Strings(info.DrainingAddresses)
+	sort.Slice(info.Ports, func(i, j int) bool { return info.Ports[i] < info.Ports[j] })
+	sort.Slice(info.Endpoints, func(i, j int) bool { return info.Endpoints[i].IP < info.Endpoints[j].IP })
+	info.Ready = len(info.Addresses) > 0
+	return info
+}
+
+// endpointAddress 解析端点状态：ready为空时视为就绪，serving为空时与ready相同，terminating为空时视为未终止。
+// publishNotReady为true时未终止的端点都视为就绪，终止中的端点仍然排空
+func endpointAddress(endpoint discoveryv1.Endpoint, publishNotReady bool) EndpointAddress {
+	conditions := endpoint.Conditions
+	address := EndpointAddress{
+		IP:          endpoint.Addresses[0],
+		Ready:       conditions.Ready == nil || *conditions.Ready,
+		Terminating: conditions.Terminating != nil && *conditions.Terminating,
+	}
+	address.Serving = address.Ready
+	if conditions.Serving != nil {
+		address.Serving = *conditions.Serving
+	}
+	if publishNotReady && !address.Terminating {
+		address.Ready = true
+		address.Serving = true
+	}
+	// 终止中的端点不再接收新请求
+	if address.Terminating {
+		address.Ready = false
+	}
+
+	if endpoint.TargetRef != nil && endpoint.TargetRef.Kind == "Pod" {
+		address.PodName = endpoint.TargetRef.Name
+	}
+	if endpoint.NodeName != nil {
+		address.NodeName = *endpoint.NodeName
 	}
+	if endpoint.Zone != nil {
+		address.Zone = *endpoint.Zone
+	}
+	return address
 }
 
-// deleteEndpoint 删除端点信息
-func (k *K8sDiscovery) deleteEndpoint(key string) {
+// updateEndpoint 更新端点信息，返回除更新时间外的内容是否有变化
+func (k *K8sDiscovery) updateEndpoint(key string, info *EndpointInfo) bool {
 	k.mu.Lock()
 	defer k.mu.Unlock()
+
+	previous := k.endpoints[key]
+	if previous != nil {
+		compare := *info
+		compare.UpdatedAt = previous.UpdatedAt
+		if reflect.DeepEqual(*previous, compare) {
+			return false
+		}
+	}
+	k.endpoints[key] = info
+	return true
+}
+
+// deleteEndpoint 删除端点信息，返回端点是否存在
+func (k *K8sDiscovery) deleteEndpoint(key string) bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	_, ok := k.endpoints[key]
 	delete(k.endpoints, key)
+	return ok
 }
 
 // GetServices 获取所有服务
@@ -370,6 +728,15 @@ func (k *K8sDiscovery) GetEndpoints() map[string]*EndpointInfo {
 	return result
 }
 
+// GetService 获取指定的服务，不存在或不在服务发现范围内时返回nil
+func (k *K8sDiscovery) GetService(namespace, serviceName string) *ServiceInfo {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	key := fmt.Sprintf("%s/%s", namespace, serviceName)
+	return k.services[key]
+}
+
 // GetServiceEndpoints 获取指定服务的端点
 func (k *K8sDiscovery) GetServiceEndpoints(namespace, serviceName string) *EndpointInfo {
 	k.mu.RLock()
@@ -378,3 +745,63 @@ func (k *K8sDiscovery) GetServiceEndpoints(namespace, serviceName string) *Endpo
 	key := fmt.Sprintf("%s/%s", namespace, serviceName)
 	return k.endpoints[key]
 }
+
+// ResolveServicePort 按端口名或端口号查找Service端口，portName为空时按端口号查找
+func (k *K8sDiscovery) ResolveServicePort(namespace, serviceName, portName string, port int32) (ServicePort, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	key := fmt.Sprintf("%s/%s", namespace, serviceName)
+	service, ok := k.services[key]
+	if !ok {
+		return ServicePort{}, fmt.Errorf("服务不存在: %s", key)
+	}
+
+	for _, servicePort := range service.Ports {
+		if (portName != "" && servicePort.Name == portName) || (portName == "" && servicePort.Port == port) {
+			return servicePort, nil
+		}
+	}
+	// ExternalName服务通常不声明端口，直接使用端口号
+	if service.Type == string(corev1.ServiceTypeExternalName) && portName == "" && port > 0 {
+		return ServicePort{Port: port, TargetPort: port}, nil
+	}
+	return ServicePort{}, fmt.Errorf("服务 %s 没有端口 %s", key, servicePortName(portName, port))
+}
+
+// servicePortName 端口的显示名称
+func servicePortName(portName string, port int32) string {
+	if portName != "" {
+		return portName
+	}
+	return fmt.Sprintf("%d", port)
+}
+
+// startTriggerInformer 启动只用于触发全量同步的informer：对象增删改时调用notify，
+// 断线重连、resourceVersion过期（410 Gone）后的重新list都由informer处理，ctx结束时停止
+func startTriggerInformer(ctx context.Context, informer cache.SharedIndexInformer, notify func()) error {
+	_, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(interface{}) { notify() },
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			// informer定期resync时对象没有变化，由控制器自身的定期同步处理
+			if resourceVersion(oldObj) != resourceVersion(newObj) {
+				notify()
+			}
+		},
+		DeleteFunc: func(interface{}) { notify() },
+	})
+	if err != nil {
+		return err
+	}
+	go informer.Run(ctx.Done())
+	return nil
+}
+
+// resourceVersion 对象的resourceVersion，无法获取时为空
+func resourceVersion(obj interface{}) string {
+	object, err := meta.Accessor(obj)
+	if err != nil {
+		return ""
+	}
+	return object.GetResourceVersion()
+}
@@ -0,0 +1,223 @@
+package controlplane
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func boolPtr(value bool) *bool {
+	return &value
+}
+
+func int32Ptr(value int32) *int32 {
+	return &value
+}
+
+// testEndpoint 创建端点，ready、serving、terminating 为空时不设置对应的条件
+func testEndpoint(ip string, ready, serving, terminating *bool) discoveryv1.Endpoint {
+	return discoveryv1.Endpoint{
+		Addresses:  []string{ip},
+		Conditions: discoveryv1.EndpointConditions{Ready: ready, Serving: serving, Terminating: terminating},
+		TargetRef:  &corev1.ObjectReference{Kind: "Pod", Name: "pod-" + ip},
+	}
+}
+
+func testEndpointSlice(namespace, name, service string, addressType discoveryv1.AddressType, port int32, endpoints ...discoveryv1.Endpoint) *discoveryv1.EndpointSlice {
+	return &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      name,
+			Labels:    map[string]string{discoveryv1.LabelServiceName: service},
+		},
+		AddressType: addressType,
+		Ports:       []discoveryv1.EndpointPort{{Name: stringPtr("http"), Port: int32Ptr(port)}},
+		Endpoints:   endpoints,
+	}
+}
+
+func TestBuildEndpointInfo(t *testing.T) {
+	slices := []*discoveryv1.EndpointSlice{
+		testEndpointSlice("default", "web-a", "web", discoveryv1.AddressTypeIPv4, 8080,
+			testEndpoint("10.0.0.1", nil, nil, nil),
+			testEndpoint("10.0.0.2", boolPtr(true), boolPtr(true), boolPtr(false)),
+			testEndpoint("10.0.0.3", boolPtr(false), boolPtr(false), boolPtr(false)),
+			testEndpoint("10.0.0.4", boolPtr(false), boolPtr(true), boolPtr(true)),
+			testEndpoint("10.0.0.5", boolPtr(false), boolPtr(false), boolPtr(true)),
+		),
+		// 切换期间同一地址可能同时出现在两个slice中，以先出现的为准
+		testEndpointSlice("default", "web-b", "web", discoveryv1.AddressTypeIPv4, 9090,
+			testEndpoint("10.0.0.1", boolPtr(false), nil, nil),
+			testEndpoint("10.0.0.6", boolPtr(true), nil, nil),
+		),
+		testEndpointSlice("default", "web-fqdn", "web", discoveryv1.AddressTypeFQDN, 8080,
+			testEndpoint("web.example.com", nil, nil, nil),
+		),
+	}
+
+	info := buildEndpointInfo("default", "web", slices, nil)
+	if want := []string{"10.0.0.1", "10.0.0.2", "10.0.0.6"}; !reflect.DeepEqual(info.Addresses, want) {
+		t.Errorf("就绪地址为 %v，期望 %v", info.Addresses, want)
+	}
+	if want := []string{"10.0.0.4"}; !reflect.DeepEqual(info.DrainingAddresses, want) {
+		t.Errorf("排空地址为 %v，期望 %v", info.DrainingAddresses, want)
+	}
+	if want := []int32{8080, 9090}; !reflect.DeepEqual(info.Ports, want) {
+		t.Errorf("端口为 %v，期望 %v", info.Ports, want)
+	}
+	if len(info.Endpoints) != 6 || !info.Ready {
+		t.Fatalf("端点数量为 %d、Ready为 %v，期望 6 和 true", len(info.Endpoints), info.Ready)
+	}
+
+	endpoints := make(map[string]EndpointAddress)
+	for _, endpoint := range info.Endpoints {
+		endpoints[endpoint.IP] = endpoint
+	}
+	if endpoint := endpoints["10.0.0.1"]; !endpoint.Ready || !endpoint.Serving || endpoint.Ports["http"] != 8080 || endpoint.PodName != "pod-10.0.0.1" {
+		t.Errorf("未设置条件的端点应视为就绪并使用第一个slice的端口: %+v", endpoint)
+	}
+	if endpoint := endpoints["10.0.0.4"]; endpoint.Ready || !endpoint.Serving || !endpoint.Terminating {
+		t.Errorf("终止中的端点不应接收新请求: %+v", endpoint)
+	}
+	if endpoint := endpoints["10.0.0.6"]; endpoint.Ports["http"] != 9090 {
+		t.Errorf("端点应使用所在slice的端口: %+v", endpoint)
+	}
+}
+
+func TestBuildEndpointInfoPublishNotReady(t *testing.T) {
+	slices := []*discoveryv1.EndpointSlice{
+		testEndpointSlice("default", "web-a", "web", discoveryv1.AddressTypeIPv4, 8080,
+			testEndpoint("10.0.0.1", boolPtr(false), boolPtr(false), boolPtr(false)),
+			testEndpoint("10.0.0.2", boolPtr(false), boolPtr(true), boolPtr(true)),
+			testEndpoint("10.0.0.3", boolPtr(false), boolPtr(false), boolPtr(true)),
+		),
+	}
+	service := &ServiceInfo{PublishNotReadyAddresses: true, SessionAffinity: "ClientIP", AffinityTimeout: 600}
+
+	info := buildEndpointInfo("default", "web", slices, service)
+	if want := []string{"10.0.0.1"}; !reflect.DeepEqual(info.Addresses, want) {
+		t.Errorf("就绪地址为 %v，期望 %v", info.Addresses, want)
+	}
+	if want := []string{"10.0.0.2"}; !reflect.DeepEqual(info.DrainingAddresses, want) {
+		t.Errorf("终止中的端点仍应排空，排空地址为 %v，期望 %v", info.DrainingAddresses, want)
+	}
+	if info.SessionAffinity != "ClientIP" || info.AffinityTimeout != 600 {
+		t.Errorf("会话保持配置应从Service复制: %s %d", info.SessionAffinity, info.AffinityTimeout)
+	}
+}
+
+func TestK8sDiscoveryEndpointConditions(t *testing.T) {
+	service := testService("default", "web", 80)
+	slice := testEndpointSlice("default", "web-a", "web", discoveryv1.AddressTypeIPv4, 80,
+		testEndpoint("10.0.0.1", boolPtr(true), boolPtr(true), boolPtr(false)),
+		testEndpoint("10.0.0.2", boolPtr(true), boolPtr(true), boolPtr(false)),
+	)
+	discovery, client := newTestDiscovery(t, service, slice)
+
+	endpoints := discovery.GetServiceEndpoints("default", "web")
+	if endpoints == nil || !reflect.DeepEqual(endpoints.Addresses, []string{"10.0.0.1", "10.0.0.2"}) {
+		t.Fatalf("启动后的端点错误: %+v", endpoints)
+	}
+
+	changed := make(chan string, 10)
+	discovery.OnEndpointsChange(func(key string) { changed <- key })
+
+	// 滚动更新：10.0.0.2 开始终止但仍能处理请求
+	slice = slice.DeepCopy()
+	slice.Endpoints[1] = testEndpoint("10.0.0.2", boolPtr(false), boolPtr(true), boolPtr(true))
+	if _, err := client.DiscoveryV1().EndpointSlices("default").Update(context.Background(), slice, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("更新EndpointSlice失败: %v", err)
+	}
+	select {
+	case key := <-changed:
+		if key != "default/web" {
+			t.Fatalf("通知的服务为 %s", key)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("等待端点变化通知超时")
+	}
+
+	endpoints = discovery.GetServiceEndpoints("default", "web")
+	if !reflect.DeepEqual(endpoints.Addresses, []string{"10.0.0.1"}) || !reflect.DeepEqual(endpoints.DrainingAddresses, []string{"10.0.0.2"}) {
+		t.Errorf("终止中的端点应进入排空列表: 就绪 %v，排空 %v", endpoints.Addresses, endpoints.DrainingAddresses)
+	}
+
+	// Service删除后不再保留端点
+	if err := client.CoreV1().Services("default").Delete(context.Background(), "web", metav1.DeleteOptions{}); err != nil {
+		t.Fatalf("删除Service失败: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for discovery.GetServiceEndpoints("default", "web") != nil {
+		if time.Now().After(deadline) {
+			t.Fatal("Service删除后端点仍然存在")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestNamedTargetPort(t *testing.T) {
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"},
+		Spec: corev1.ServiceSpec{
+			Type: corev1.ServiceTypeClusterIP,
+			Ports: []corev1.ServicePort{
+				{Name: "http", Port: 80, TargetPort: intstr.FromString("web")},
+				{Name: "metrics", Port: 9100},
+			},
+		},
+	}
+	// 新旧版本的Pod把命名端口 web 声明在不同的端口上
+	slices := []*discoveryv1.EndpointSlice{
+		testEndpointSlice("default", "web-old", "web", discoveryv1.AddressTypeIPv4, 8080, testEndpoint("10.0.0.1", nil, nil, nil)),
+		testEndpointSlice("default", "web-new", "web", discoveryv1.AddressTypeIPv4, 9090, testEndpoint("10.0.0.2", nil, nil, nil)),
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default",
+				Name:      "web-metrics",
+				Labels:    map[string]string{discoveryv1.LabelServiceName: "web"},
+			},
+			AddressType: discoveryv1.AddressTypeIPv4,
+			Ports:       []discoveryv1.EndpointPort{{Name: stringPtr("metrics"), Port: int32Ptr(9100)}},
+			Endpoints:   []discoveryv1.Endpoint{testEndpoint("10.0.0.3", nil, nil, nil)},
+		},
+	}
+	discovery, client := newTestDiscovery(t, service, slices[0], slices[1], slices[2])
+
+	port, err := discovery.ResolveServicePort("default", "web", "", 80)
+	if err != nil {
+		t.Fatalf("解析端口失败: %v", err)
+	}
+	if port.Name != "http" || port.TargetPort != 0 || port.TargetPortName != "web" {
+		t.Errorf("命名targetPort解析错误: %+v", port)
+	}
+	if port, err := discovery.ResolveServicePort("default", "web", "metrics", 0); err != nil || port.TargetPort != 9100 {
+		t.Errorf("未设置targetPort时应与port相同: %+v %v", port, err)
+	}
+	if _, err := discovery.ResolveServicePort("default", "web", "", 443); err == nil {
+		t.Error("不存在的端口应返回错误")
+	}
+
+	log := newTestLogger()
+	routeManager, err := NewRouteManager(NewFileRouteStore(filepath.Join(t.TempDir(), "routes.json")), discovery,
+		NewDataPlaneClient(client, DataPlaneDiscovery{}, log), log)
+	if err != nil {
+		t.Fatalf("创建路由管理器失败: %v", err)
+	}
+	upstream, err := routeManager.buildUpstream("default/web", UpstreamSource{}, 0, "http", 1, true)
+	if err != nil {
+		t.Fatalf("构建上游失败: %v", err)
+	}
+	if !reflect.DeepEqual(upstream.Addresses, []string{"10.0.0.1", "10.0.0.2"}) {
+		t.Errorf("没有该端口的地址不应转发，上游地址为 %v", upstream.Addresses)
+	}
+	if upstream.Port != 8080 || upstream.PortOf("10.0.0.1") != 8080 || upstream.PortOf("10.0.0.2") != 9090 {
+		t.Errorf("各地址应使用自己的Pod端口: port %d, address_ports %v", upstream.Port, upstream.AddressPorts)
+	}
+}
@@ -0,0 +1,468 @@
+package controlplane
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"kun-gateway/pkg/apis/kungateway/v1alpha1"
+	"kun-gateway/pkg/kunclient"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// kunResyncInterval 定期全量同步的间隔，同时用于发现Secret的变化
+	kunResyncInterval = 30 * time.Second
+	// kunSyncDelay 资源变化或推送完成后等待的时间，合并短时间内的多次变化
+	kunSyncDelay = time.Second
+)
+
+// KunResource状态条件的原因
+const (
+	reasonPending        = "Pending"
+	reasonSecretNotFound = "SecretNotFound"
+	reasonRouteNotFound  = "RouteNotFound"
+)
+
+// KunResourceController 处理 kun-gateway.io 资源：KunRoute被外部修改时重新加载路由，
+// KunCertificate引用的证书下发到数据面，KunPolicy应用到路由，并将处理结果写回各对象的status
+type KunResourceController struct {
+	client       *kunclient.Client
+	k8sClient    kubernetes.Interface
+	routeManager *RouteManager
+	namespace    string
+	certs        *certificateSyncer
+	trigger      chan struct{}
+	log          *logrus.Logger
+}
+
+// NewKunResourceController 创建KunResource控制器，只处理指定命名空间中的资源
+func NewKunResourceController(client *kunclient.Client, k8sClient kubernetes.Interface, routeManager *RouteManager, dataplaneClient *DataPlaneClient, namespace string, log *logrus.Logger) *KunResourceController {
+	return &KunResourceController{
+		client:       client,
+		k8sClient:    k8sClient,
+		routeManager: routeManager,
+		namespace:    namespace,
+		certs:        newCertificateSyncer(dataplaneClient, log),
+		trigger:      make(chan struct{}, 1),
+		log:          log,
+	}
+}
+
+// Start 先完成一次全量同步，然后在后台监听变化直到ctx结束。路由推送完成后重新同步以回写状态
+func (c *KunResourceController) Start(ctx context.Context) {
+	c.log.Infof("启动KunResource控制器，命名空间: %s", c.namespace)
+
+	c.routeManager.OnPush(c.notify)
+	c.sync(ctx)
+
+	// 任何变化都触发一次全量同步
+	for kind, gvr := range map[string]schema.GroupVersionResource{
+		"KunRoute":       v1alpha1.KunRouteResource,
+		"KunCertificate": v1alpha1.KunCertificateResource,
+		"KunPolicy":      v1alpha1.KunPolicyResource,
+	} {
+		if err := startTriggerInformer(ctx, c.client.Informer(gvr, c.namespace, informerResyncPeriod), c.notify); err != nil {
+			c.log.Errorf("监听%s失败: %v", kind, err)
+		}
+	}
+	go c.run(ctx)
+}
+
+// notify 触发一次同步，不阻塞
+func (c *KunResourceController) notify() {
+	select {
+	case c.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// run 在资源变化、路由推送或定期同步时执行全量同步
+func (c *KunResourceController) run(ctx context.Context) {
+	ticker := time.NewTicker(kunResyncInterval)
+	defer ticker.Stop()
+
+	var delay <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.trigger:
+			if delay == nil {
+				delay = time.After(kunSyncDelay)
+			}
+		case <-delay:
+			delay = nil
+			c.sync(ctx)
+		case <-ticker.C:
+			c.sync(ctx)
+		}
+	}
+}
+
+// sync 全量同步：重新加载路由、应用策略、下发证书、回写状态
+func (c *KunResourceController) sync(ctx context.Context) {
+	if err := c.routeManager.Reload(); err != nil {
+		c.log.Errorf("重新加载KunRoute失败: %v", err)
+	}
+	c.syncPolicies(ctx)
+	c.syncCertificates(ctx)
+	c.updateRouteStatuses(ctx)
+}
+
+// updateRouteStatuses 将路由最近一次推送的结果写回KunRoute
+func (c *KunResourceController) updateRouteStatuses(ctx context.Context) {
+	client := c.client.KunRoutes(c.namespace)
+	list, err := client.List(ctx, metav1.ListOptions{})
+	if err != nil {
+		c.log.Errorf("获取KunRoute失败: %v", err)
+		return
+	}
+
+	for i := range list.Items {
+		route := &list.Items[i]
+		status := *route.Status.DeepCopy()
+		status.ObservedGeneration = route.Generation
+
+		state, ok := c.routeManager.State(route.Name)
+		switch {
+		case !ok:
+			setCondition(&status.Conditions, route.Generation, v1alpha1.ConditionAccepted, false, reasonPending, "等待控制面处理")
+			setCondition(&status.Conditions, route.Generation, v1alpha1.ConditionProgrammed, false, reasonPending, "等待控制面处理")
+		case state.Reason == RouteStateInvalid || state.Reason == RouteStateConflict:
+			setCondition(&status.Conditions, route.Generation, v1alpha1.ConditionAccepted, false, state.Reason, state.Message)
+			setCondition(&status.Conditions, route.Generation, v1alpha1.ConditionProgrammed, false, state.Reason, state.Message)
+		case state.Programmed:
+			setCondition(&status.Conditions, route.Generation, v1alpha1.ConditionAccepted, true, reasonAccepted, "")
+			setCondition(&status.Conditions, route.Generation, v1alpha1.ConditionProgrammed, true, reasonProgrammed, "")
+		default:
+			setCondition(&status.Conditions, route.Generation, v1alpha1.ConditionAccepted, true, reasonAccepted, "")
+			setCondition(&status.Conditions, route.Generation, v1alpha1.ConditionProgrammed, false, state.Reason, state.Message)
+		}
+
+		if marshalStatus(status) == marshalStatus(route.Status) {
+			continue
+		}
+		updated := route.DeepCopy()
+		updated.Status = status
+		if _, err := client.UpdateStatus(ctx, updated); err != nil {
+			c.log.Warnf("更新KunRoute %s 状态失败: %v", route.Name, err)
+		}
+	}
+}
+
+// syncPolicies 将KunPolicy转换为路由策略，按创建时间排序，先创建的策略优先
+func (c *KunResourceController) syncPolicies(ctx context.Context) {
+	client := c.client.KunPolicies(c.namespace)
+	list, err := client.List(ctx, metav1.ListOptions{})
+	if err != nil {
+		c.log.Errorf("获取KunPolicy失败: %v", err)
+		return
+	}
+	items := list.Items
+	sort.SliceStable(items, func(i, j int) bool {
+		if !items[i].CreationTimestamp.Equal(&items[j].CreationTimestamp) {
+			return items[i].CreationTimestamp.Before(&items[j].CreationTimestamp)
+		}
+		return items[i].Name < items[j].Name
+	})
+
+	routes := c.routeManager.List()
+	var policies []*RoutePolicy
+	for i := range items {
+		policy := &items[i]
+		status := *policy.Status.DeepCopy()
+		status.ObservedGeneration = policy.Generation
+
+		converted := &RoutePolicy{
+			Name:            policy.Name,
+			RequestHeaders:  policy.Spec.RequestHeaders,
+			ResponseHeaders: policy.Spec.ResponseHeaders,
+			AccessLog:       policy.Spec.AccessLog,
+			Tracing:         policy.Spec.Tracing,
+		}
+		var invalid, missing []string
+		for _, target := range policy.Spec.TargetRefs {
+			switch target.Kind {
+			case v1alpha1.PolicyTargetKunRoute:
+				converted.RouteIDs = append(converted.RouteIDs, target.Name)
+				if !hasRouteID(routes, target.Name) {
+					missing = append(missing, target.Name)
+				}
+			case v1alpha1.PolicyTargetDomain:
+				converted.Domains = append(converted.Domains, target.Name)
+			default:
+				invalid = append(invalid, target.Kind)
+			}
+		}
+
+		status.Routes = 0
+		for _, route := range routes {
+			if containsString(converted.RouteIDs, route.ID) || containsString(converted.Domains, route.Domain) {
+				status.Routes++
+			}
+		}
+
+		if len(invalid) > 0 {
+			setCondition(&status.Conditions, policy.Generation, v1alpha1.ConditionAccepted, false, reasonInvalidKind, fmt.Sprintf("不支持的目标类型 %s，应为 KunRoute 或 Domain", strings.Join(invalid, ", ")))
+		} else {
+			setCondition(&status.Conditions, policy.Generation, v1alpha1.ConditionAccepted, true, reasonAccepted, "")
+			policies = append(policies, converted)
+		}
+		if len(missing) > 0 {
+			setCondition(&status.Conditions, policy.Generation, v1alpha1.ConditionResolvedRefs, false, reasonRouteNotFound, fmt.Sprintf("路由不存在: %s", strings.Join(missing, ", ")))
+		} else {
+			setCondition(&status.Conditions, policy.Generation, v1alpha1.ConditionResolvedRefs, true, reasonResolvedRefs, "")
+		}
+
+		if marshalStatus(status) == marshalStatus(policy.Status) {
+			continue
+		}
+		updated := policy.DeepCopy()
+		updated.Status = status
+		if _, err := client.UpdateStatus(ctx, updated); err != nil {
+			c.log.Warnf("更新KunPolicy %s 状态失败: %v", policy.Name, err)
+		}
+	}
+
+	c.routeManager.SetPolicies(policies)
+}
+
+// syncCertificates 下发KunCertificate引用的证书，同一域名以先创建的KunCertificate为准
+func (c *KunResourceController) syncCertificates(ctx context.Context) {
+	client := c.client.KunCertificates(c.namespace)
+	list, err := client.List(ctx, metav1.ListOptions{})
+	if err != nil {
+		c.log.Errorf("获取KunCertificate失败: %v", err)
+		return
+	}
+	items := list.Items
+	sort.SliceStable(items, func(i, j int) bool {
+		if !items[i].CreationTimestamp.Equal(&items[j].CreationTimestamp) {
+			return items[i].CreationTimestamp.Before(&items[j].CreationTimestamp)
+		}
+		return items[i].Name < items[j].Name
+	})
+
+	type result struct {
+		status   v1alpha1.KunCertificateStatus
+		domains  []string
+		conflict []string
+		err      error
+	}
+	results := make([]*result, len(items))
+	certs := make(map[string]*secretCertificate)
+	owners := make(map[string]string)
+	for i := range items {
+		certificate := &items[i]
+		r := &result{status: *certificate.Status.DeepCopy()}
+		results[i] = r
+
+		if certificate.Spec.SecretName == "" || len(certificate.Spec.Domains) == 0 {
+			r.err = fmt.Errorf("必须指定 domains 和 secretName")
+			continue
+		}
+		cert, err := loadTLSSecret(ctx, c.k8sClient, c.namespace, certificate.Spec.SecretName)
+		if err != nil {
+			r.err = err
+			continue
+		}
+		r.status.NotAfter = certificateNotAfter(cert.certPEM)
+
+		for _, domain := range certificate.Spec.Domains {
+			if owner, ok := owners[domain]; ok {
+				r.conflict = append(r.conflict, fmt.Sprintf("%s 已由 %s 提供", domain, owner))
+				continue
+			}
+			owners[domain] = certificate.Name
+			certs[domain] = cert
+			r.domains = append(r.domains, domain)
+		}
+	}
+
+	failed := c.certs.Sync(certs)
+
+	for i := range items {
+		certificate, r := &items[i], results[i]
+		generation := certificate.Generation
+		r.status.ObservedGeneration = generation
+
+		switch {
+		case r.err != nil && certificate.Spec.SecretName != "" && len(certificate.Spec.Domains) > 0:
+			setCondition(&r.status.Conditions, generation, v1alpha1.ConditionAccepted, true, reasonAccepted, "")
+			setCondition(&r.status.Conditions, generation, v1alpha1.ConditionResolvedRefs, false, reasonSecretNotFound, r.err.Error())
+		case r.err != nil:
+			setCondition(&r.status.Conditions, generation, v1alpha1.ConditionAccepted, false, reasonInvalid, r.err.Error())
+			meta.RemoveStatusCondition(&r.status.Conditions, v1alpha1.ConditionResolvedRefs)
+		case len(r.conflict) > 0:
+			setCondition(&r.status.Conditions, generation, v1alpha1.ConditionAccepted, false, RouteStateConflict, strings.Join(r.conflict, "; "))
+			setCondition(&r.status.Conditions, generation, v1alpha1.ConditionResolvedRefs, true, reasonResolvedRefs, "")
+		default:
+			setCondition(&r.status.Conditions, generation, v1alpha1.ConditionAccepted, true, reasonAccepted, "")
+			setCondition(&r.status.Conditions, generation, v1alpha1.ConditionResolvedRefs, true, reasonResolvedRefs, "")
+		}
+
+		var errs []string
+		for _, domain := range r.domains {
+			if err := failed[domain]; err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %v", domain, err))
+			}
+		}
+		switch {
+		case len(errs) > 0:
+			setCondition(&r.status.Conditions, generation, v1alpha1.ConditionProgrammed, false, RouteStatePushFailed, strings.Join(errs, "; "))
+		case len(r.domains) == 0:
+			setCondition(&r.status.Conditions, generation, v1alpha1.ConditionProgrammed, false, reasonInvalid, "没有下发任何域名的证书")
+		default:
+			setCondition(&r.status.Conditions, generation, v1alpha1.ConditionProgrammed, true, reasonProgrammed, "")
+		}
+
+		if marshalStatus(r.status) == marshalStatus(certificate.Status) {
+			continue
+		}
+		updated := certificate.DeepCopy()
+		updated.Status = r.status
+		if _, err := client.UpdateStatus(ctx, updated); err != nil {
+			c.log.Warnf("更新KunCertificate %s 状态失败: %v", certificate.Name, err)
+		}
+	}
+}
+
+// certificateNotAfter 解析证书链中第一个证书的过期时间
+func certificateNotAfter(certPEM []byte) *metav1.Time {
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		return nil
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil
+	}
+	notAfter := metav1.NewTime(cert.NotAfter)
+	return &notAfter
+}
+
+// hasRouteID 判断路由列表中是否有指定ID的路由
+func hasRouteID(routes []*RouteConfig, id string) bool {
+	for _, route := range routes {
+		if route.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// CRDCertificateStore 通过API上传的证书保存为Secret和KunCertificate，由KunResourceController下发到数据面
+type CRDCertificateStore struct {
+	client    *kunclient.Client
+	k8sClient kubernetes.Interface
+	namespace string
+}
+
+// NewCRDCertificateStore 创建KunCertificate证书存储
+func NewCRDCertificateStore(client *kunclient.Client, k8sClient kubernetes.Interface, namespace string) *CRDCertificateStore {
+	return &CRDCertificateStore{
+		client:    client,
+		k8sClient: k8sClient,
+		namespace: namespace,
+	}
+}
+
+// certificateObjectName 域名对应的Secret和KunCertificate名称，*.example.com 对应 wildcard.example.com
+func certificateObjectName(domain string) string {
+	return "kun-cert-" + strings.Replace(strings.ToLower(domain), "*", "wildcard", 1)
+}
+
+// Save 创建或更新域名的Secret和KunCertificate
+func (s *CRDCertificateStore) Save(domain string, certPEM, keyPEM []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	name := certificateObjectName(domain)
+	labels := map[string]string{
+		"app":       "kun-gateway",
+		"component": "controlplane",
+	}
+
+	secrets := s.k8sClient.CoreV1().Secrets(s.namespace)
+	data := map[string][]byte{corev1.TLSCertKey: certPEM, corev1.TLSPrivateKeyKey: keyPEM}
+	secret, err := secrets.Get(ctx, name, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		_, err = secrets.Create(ctx, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: s.namespace, Labels: labels},
+			Type:       corev1.SecretTypeTLS,
+			Data:       data,
+		}, metav1.CreateOptions{})
+	case err == nil:
+		secret = secret.DeepCopy()
+		secret.Data = data
+		_, err = secrets.Update(ctx, secret, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		return fmt.Errorf("保存Secret %s 失败: %v", name, err)
+	}
+
+	certificates := s.client.KunCertificates(s.namespace)
+	existing, err := certificates.Get(ctx, name)
+	if apierrors.IsNotFound(err) {
+		_, err = certificates.Create(ctx, &v1alpha1.KunCertificate{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: s.namespace, Labels: labels},
+			Spec:       v1alpha1.KunCertificateSpec{Domains: []string{domain}, SecretName: name},
+		})
+		if err != nil {
+			return fmt.Errorf("创建KunCertificate %s 失败: %v", name, err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("读取KunCertificate %s 失败: %v", name, err)
+	}
+
+	updated := existing.DeepCopy()
+	updated.Spec = v1alpha1.KunCertificateSpec{Domains: []string{domain}, SecretName: name}
+	if _, err := certificates.Update(ctx, updated); err != nil {
+		return fmt.Errorf("更新KunCertificate %s 失败: %v", name, err)
+	}
+	return nil
+}
+
+// Delete 删除通过API上传的证书；由其他KunCertificate提供的证书返回ErrCertificateReadOnly
+func (s *CRDCertificateStore) Delete(domain string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	name := certificateObjectName(domain)
+	err := s.client.KunCertificates(s.namespace).Delete(ctx, name)
+	if apierrors.IsNotFound(err) {
+		list, listErr := s.client.KunCertificates(s.namespace).List(ctx, metav1.ListOptions{})
+		if listErr != nil {
+			return fmt.Errorf("获取KunCertificate失败: %v", listErr)
+		}
+		for _, certificate := range list.Items {
+			if containsString(certificate.Spec.Domains, domain) {
+				return fmt.Errorf("%w: KunCertificate %s/%s", ErrCertificateReadOnly, s.namespace, certificate.Name)
+			}
+		}
+		return ErrCertificateNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("删除KunCertificate %s 失败: %v", name, err)
+	}
+
+	if err := s.k8sClient.CoreV1().Secrets(s.namespace).Delete(ctx, name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("删除Secret %s 失败: %v", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,979 @@
+package controlplane
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"kun-gateway/pkg/dataplane"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// 路由操作的错误类型
+var (
+	ErrRouteNotFound = errors.New("路由不存在")
+	ErrRouteConflict = errors.New("路由冲突")
+	ErrRouteStore    = errors.New("保存路由失败")
+	ErrRoutePush     = errors.New("路由已保存，但推送到数据面失败，稍后会自动重试")
+	ErrRouteReadOnly = errors.New("路由由K8s资源生成，请修改对应的资源")
+)
+
+// 路由来源，通过API创建的路由来源为空
+const (
+	RouteSourceIngress = "ingress"
+	RouteSourceGateway = "gateway"
+	RouteSourceService = "service"
+)
+
+// 路由状态的原因，RouteState.Programmed 为false时说明原因
+const (
+	RouteStateDisabled   = "Disabled"
+	RouteStateInvalid    = "Invalid"
+	RouteStateConflict   = "Conflict"
+	RouteStatePushFailed = "PushFailed"
+)
+
+// Service上开启拓扑感知路由的注解，与K8s的拓扑感知路由相同，值为Auto时使用默认的溢出阈值
+const (
+	AnnotationTopologyMode = "service.kubernetes.io/topology-mode"
+	// AnnotationTopologyAwareHints 旧版本K8s使用的注解
+	AnnotationTopologyAwareHints = "service.kubernetes.io/topology-aware-hints"
+)
+
+const (
+	// AuthorSystem 控制面自动推送（启动、重试、端点或生成的路由变化）的配置版本作者前缀
+	AuthorSystem = "system:"
+	// maxAuthorCauses 作者中最多列出的变化原因数
+	maxAuthorCauses = 3
+	// routeResyncInterval 推送失败后重试的间隔
+	routeResyncInterval = 10 * time.Second
+	// changePushDelay 端点或生成的路由变化后等待的时间，滚动更新期间的多次变化合并为一次推送
+	changePushDelay = time.Second
+)
+
+// RouteState 路由最近一次推送的结果
+type RouteState struct {
+	Programmed bool   `json:"programmed"`
+	Reason     string `json:"reason,omitempty"`
+	Message    string `json:"message,omitempty"`
+}
+
+// RoutePolicy 应用到一组路由的公共配置，路由自身设置的字段优先
+type RoutePolicy struct {
+	// Name 策略名称，用于日志
+	Name string
+	// RouteIDs 和 Domains 选择应用策略的路由，Domains 同时匹配生成的路由
+	RouteIDs []string
+	Domains  []string
+
+	RequestHeaders  *dataplane.HeaderOperations
+	ResponseHeaders *dataplane.HeaderOperations
+	AccessLog       *dataplane.RouteAccessLog
+	Tracing         *dataplane.RouteTracing
+}
+
+// RouteManager 控制面持有的权威路由集合，所有修改先持久化，再将完整的期望状态推送到数据面。
+// 由Ingress等K8s资源生成的路由按来源保存在内存中，与API创建的路由一起推送，不持久化
+type RouteManager struct {
+	store        RouteStore
+	k8sDiscovery *K8sDiscovery
+	client       *DataPlaneClient
+	routes       map[string]*RouteConfig
+	// 各来源生成的路由，key: 来源
+	sources map[string][]*RouteConfig
+	// 按顺序应用的策略，先出现的优先
+	policies []*RoutePolicy
+	// 最近一次计算的各路由状态，key: 路由ID
+	states map[string]RouteState
+	// 最近一次推送是否失败，失败时后台定期重试
+	dirty bool
+	// 已生成的配置版本数，推送完成时只有最新的一次推送能清除dirty
+	pushSeq int64
+	// 等待推送的变化原因，作为配置版本的作者
+	causes map[string]bool
+	// 推送完成后的回调，用于回写资源状态
+	pushHandlers []func()
+	// 路由引用的服务端点或生成的路由发生变化
+	changed chan struct{}
+	mu      sync.Mutex
+	log     *logrus.Logger
+}
+
+// NewRouteManager 创建路由管理器并从存储加载路由
+func NewRouteManager(store RouteStore, k8sDiscovery *K8sDiscovery, client *DataPlaneClient, log *logrus.Logger) (*RouteManager, error) {
+	rm := &RouteManager{
+		store:        store,
+		k8sDiscovery: k8sDiscovery,
+		client:       client,
+		routes:       make(map[string]*RouteConfig),
+		sources:      make(map[string][]*RouteConfig),
+		states:       make(map[string]RouteState),
+		causes:       make(map[string]bool),
+		// 缓冲为1，推送前的多次变化只保留一次通知
+		changed: make(chan struct{}, 1),
+		log:     log,
+	}
+	if err := rm.reload(); err != nil {
+		return nil, err
+	}
+	log.Infof("加载了 %d 条路由", len(rm.routes))
+
+	k8sDiscovery.OnEndpointsChange(rm.onServiceChange)
+	// 端口解析和ExternalName依赖Service本身的配置
+	k8sDiscovery.OnServiceChange(rm.onServiceChange)
+	return rm, nil
+}
+
+// reload 从存储重新加载路由，调用方需持有锁或处于初始化阶段
+func (rm *RouteManager) reload() error {
+	routes, err := rm.store.Load()
+	if err != nil {
+		return err
+	}
+
+	rm.routes = make(map[string]*RouteConfig, len(routes))
+	for _, route := range routes {
+		if route.ID == "" {
+			route.ID = newRouteID()
+		}
+		rm.routes[route.ID] = route
+	}
+	return nil
+}
+
+// Reload 从存储重新加载路由，存储被外部修改（如直接编辑KunRoute）时调用，有变化时稍后推送
+func (rm *RouteManager) Reload() error {
+	rm.mu.Lock()
+	before := marshalStatus(rm.routes)
+	err := rm.reload()
+	changed := err == nil && marshalStatus(rm.routes) != before
+	count := len(rm.routes)
+	rm.mu.Unlock()
+
+	if changed {
+		rm.log.Infof("路由存储已被修改，重新加载了 %d 条路由", count)
+		rm.notifyChange("store")
+	}
+	return err
+}
+
+// OnPush 注册推送完成后的回调，回调在持有锁时调用，不能阻塞或调用RouteManager的方法
+func (rm *RouteManager) OnPush(handler func()) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	rm.pushHandlers = append(rm.pushHandlers, handler)
+}
+
+// SetPolicies 替换全部策略，有变化时稍后推送到数据面
+func (rm *RouteManager) SetPolicies(policies []*RoutePolicy) {
+	rm.mu.Lock()
+	unchanged := reflect.DeepEqual(rm.policies, policies)
+	rm.policies = policies
+	rm.mu.Unlock()
+
+	if !unchanged {
+		rm.notifyChange("policies")
+	}
+}
+
+// State 获取路由最近一次推送的结果
+func (rm *RouteManager) State(id string) (RouteState, bool) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	state, ok := rm.states[id]
+	return state, ok
+}
+
+// Run 启动时推送一次完整路由，之后在路由引用的服务端点或生成的路由变化时重新计算并推送，
+// 推送失败时定期重试，直到ctx结束
+func (rm *RouteManager) Run(ctx context.Context) {
+	rm.push(AuthorSystem + "startup")
+
+	ticker := time.NewTicker(routeResyncInterval)
+	defer ticker.Stop()
+
+	// 收到第一次变化后开始计时，到期时推送期间累积的所有变化
+	var delay <-chan time.Time
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-rm.changed:
+			if delay == nil {
+				delay = time.After(changePushDelay)
+			}
+		case <-delay:
+			delay = nil
+			rm.mu.Lock()
+			author := rm.changeAuthorLocked()
+			rm.mu.Unlock()
+			rm.push(author)
+		case <-ticker.C:
+			rm.mu.Lock()
+			dirty := rm.dirty
+			rm.mu.Unlock()
+			if dirty {
+				rm.push(AuthorSystem + "retry")
+			}
+		}
+	}
+}
+
+// onServiceChange 服务的端点或配置变化时，如果有启用的路由引用该服务则通知Run推送
+func (rm *RouteManager) onServiceChange(key string) {
+	rm.mu.Lock()
+	referenced := rm.referencesLocked(key)
+	rm.mu.Unlock()
+
+	if !referenced {
+		return
+	}
+
+	rm.log.Infof("服务 %s 的端点或配置发生变化，将重新推送路由", key)
+	rm.notifyChange("service " + key)
+}
+
+// notifyChange 记录变化原因并通知Run推送，不阻塞
+func (rm *RouteManager) notifyChange(cause string) {
+	rm.mu.Lock()
+	rm.causes[cause] = true
+	rm.mu.Unlock()
+
+	select {
+	case rm.changed <- struct{}{}:
+	default:
+	}
+}
+
+// SetSourceRoutes 替换指定来源生成的全部路由，有变化时稍后推送到数据面
+func (rm *RouteManager) SetSourceRoutes(source string, routes []*RouteConfig) {
+	for _, route := range routes {
+		route.Source = source
+		route.Enabled = true
+	}
+
+	rm.mu.Lock()
+	unchanged := reflect.DeepEqual(rm.sources[source], routes)
+	rm.sources[source] = routes
+	rm.mu.Unlock()
+
+	// 定期全量同步时路由通常没有变化，不需要推送
+	if !unchanged {
+		rm.notifyChange("source " + source)
+	}
+}
+
+// referencesLocked 判断启用的路由（包括Header子规则）是否引用了指定服务
+func (rm *RouteManager) referencesLocked(service string) bool {
+	references := func(route *RouteConfig) bool {
+		if !route.Enabled {
+			return false
+		}
+		if route.Service == service {
+			return true
+		}
+		for _, backend := range route.Backends {
+			if backend.Service == service {
+				return true
+			}
+		}
+		for _, headerRoute := range route.HeaderRoutes {
+			if headerRoute.Service == service {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, route := range rm.routes {
+		if references(route) {
+			return true
+		}
+	}
+	for _, routes := range rm.sources {
+		for _, route := range routes {
+			if references(route) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// findSourceRouteLocked 查找生成的路由
+func (rm *RouteManager) findSourceRouteLocked(id string) *RouteConfig {
+	for _, routes := range rm.sources {
+		for _, route := range routes {
+			if route.ID == id {
+				return route
+			}
+		}
+	}
+	return nil
+}
+
+// List 获取所有路由（包括生成的路由），按创建时间排序
+func (rm *RouteManager) List() []*RouteConfig {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	routes := make([]*RouteConfig, 0, len(rm.routes))
+	for _, route := range rm.routes {
+		routes = append(routes, route)
+	}
+	for _, sourceRoutes := range rm.sources {
+		routes = append(routes, sourceRoutes...)
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		if !routes[i].CreatedAt.Equal(routes[j].CreatedAt) {
+			return routes[i].CreatedAt.Before(routes[j].CreatedAt)
+		}
+		return routes[i].ID < routes[j].ID
+	})
+	return routes
+}
+
+// Get 获取指定路由
+func (rm *RouteManager) Get(id string) (*RouteConfig, error) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	if route, ok := rm.routes[id]; ok {
+		return route, nil
+	}
+	if route := rm.findSourceRouteLocked(id); route != nil {
+		return route, nil
+	}
+	return nil, ErrRouteNotFound
+}
+
+// Create 创建路由，ID由控制面生成，author记录在推送的配置版本中
+func (rm *RouteManager) Create(config *RouteConfig, author string) (*RouteConfig, error) {
+	rm.mu.Lock()
+
+	now := time.Now()
+	route := *config
+	route.ID = newRouteID()
+	route.Source = ""
+	route.CreatedAt = now
+	route.UpdatedAt = now
+
+	if err := rm.applyLocked(route.ID, &route); err != nil {
+		rm.mu.Unlock()
+		return nil, err
+	}
+	rm.mu.Unlock()
+	return &route, rm.push(author)
+}
+
+// Update 以新配置整体替换路由，保留ID和创建时间
+func (rm *RouteManager) Update(id string, config *RouteConfig, author string) (*RouteConfig, error) {
+	rm.mu.Lock()
+	existing, ok := rm.routes[id]
+	if !ok {
+		readOnly := rm.findSourceRouteLocked(id) != nil
+		rm.mu.Unlock()
+		if readOnly {
+			return nil, ErrRouteReadOnly
+		}
+		return nil, ErrRouteNotFound
+	}
+
+	route := *config
+	route.ID = id
+	route.Source = ""
+	route.CreatedAt = existing.CreatedAt
+	route.UpdatedAt = time.Now()
+
+	if err := rm.applyLocked(id, &route); err != nil {
+		rm.mu.Unlock()
+		return nil, err
+	}
+	rm.mu.Unlock()
+	return &route, rm.push(author)
+}
+
+// Delete 删除路由
+func (rm *RouteManager) Delete(id string, author string) error {
+	rm.mu.Lock()
+	if _, ok := rm.routes[id]; !ok {
+		readOnly := rm.findSourceRouteLocked(id) != nil
+		rm.mu.Unlock()
+		if readOnly {
+			return ErrRouteReadOnly
+		}
+		return ErrRouteNotFound
+	}
+	if err := rm.applyLocked(id, nil); err != nil {
+		rm.mu.Unlock()
+		return err
+	}
+	rm.mu.Unlock()
+	return rm.push(author)
+}
+
+// routeKey 路由在数据面路由表中的key，key相同的路由冲突
+func routeKey(route *RouteConfig) string {
+	rule := dataplane.RouteRule{Domain: route.Domain, Path: route.Path, PathType: route.PathType}
+	return rule.Key()
+}
+
+// applyLocked 校验并持久化修改，route为nil表示删除；持久化成功后才修改内存中的集合
+func (rm *RouteManager) applyLocked(id string, route *RouteConfig) error {
+	if route != nil {
+		if _, err := rm.buildRule(route, true); err != nil {
+			return err
+		}
+		if route.Enabled {
+			for _, other := range rm.routes {
+				if other.ID != id && other.Enabled && routeKey(other) == routeKey(route) {
+					return fmt.Errorf("%w: %s 已被路由 %s 使用", ErrRouteConflict, routeKey(route), other.ID)
+				}
+			}
+		}
+	}
+
+	next := make([]*RouteConfig, 0, len(rm.routes)+1)
+	for _, existing := range rm.routes {
+		if existing.ID != id {
+			next = append(next, existing)
+		}
+	}
+	if route != nil {
+		next = append(next, route)
+	}
+
+	if err := rm.store.Save(next); err != nil {
+		// 存储可能已被其他副本修改，重新加载以便下次操作基于最新状态
+		if reloadErr := rm.reload(); reloadErr != nil {
+			rm.log.Errorf("重新加载路由失败: %v", reloadErr)
+		}
+		return fmt.Errorf("%w: %v", ErrRouteStore, err)
+	}
+
+	if route != nil {
+		rm.routes[id] = route
+	} else {
+		delete(rm.routes, id)
+	}
+	return nil
+}
+
+// push 将所有启用的路由作为完整的期望状态推送到数据面，author为配置版本的作者，调用时不能持有rm.mu。
+// 期望状态和配置版本在锁内按顺序生成，各实例的推送在解锁后进行，不阻塞路由的查询和修改。
+// 部分实例推送失败只记录在实例状态中（FleetStatus）并稍后重试，不修改路由状态
+func (rm *RouteManager) push(author string) error {
+	rm.mu.Lock()
+	rules := rm.desiredRulesLocked()
+	desired, err := rm.client.setDesired(rules, author)
+	if err != nil {
+		// 没有生成配置版本，所有数据面都不会应用这些路由
+		rm.dirty = true
+		rm.log.Errorf("生成配置版本失败: %v", err)
+		for id, state := range rm.states {
+			if state.Programmed {
+				rm.states[id] = RouteState{Reason: RouteStatePushFailed, Message: err.Error()}
+			}
+		}
+		rm.notifyPushLocked()
+		rm.mu.Unlock()
+		return fmt.Errorf("%w: %v", ErrRoutePush, err)
+	}
+	rm.pushSeq++
+	seq := rm.pushSeq
+	rm.mu.Unlock()
+
+	err = rm.client.syncRoutes(desired)
+
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	if err != nil {
+		rm.dirty = true
+		rm.log.Errorf("推送路由到数据面失败: %v", err)
+	} else {
+		// 推送期间又生成了新版本时由之后的推送决定是否需要重试
+		if seq == rm.pushSeq {
+			rm.dirty = false
+		}
+		rm.log.Infof("已推送 %d 条路由到数据面", len(rules))
+	}
+	rm.notifyPushLocked()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrRoutePush, err)
+	}
+	return nil
+}
+
+// notifyPushLocked 调用推送完成后的回调
+func (rm *RouteManager) notifyPushLocked() {
+	for _, handler := range rm.pushHandlers {
+		handler()
+	}
+}
+
+// changeAuthorLocked 以等待推送的变化原因作为作者，如 system:service default/web，并清空原因
+func (rm *RouteManager) changeAuthorLocked() string {
+	causes := make([]string, 0, len(rm.causes))
+	for cause := range rm.causes {
+		causes = append(causes, cause)
+	}
+	rm.causes = make(map[string]bool)
+	if len(causes) == 0 {
+		return AuthorSystem + "resync"
+	}
+
+	sort.Strings(causes)
+	if len(causes) > maxAuthorCauses {
+		return AuthorSystem + strings.Join(causes[:maxAuthorCauses], ", ") + fmt.Sprintf(" 等 %d 项", len(causes))
+	}
+	return AuthorSystem + strings.Join(causes, ", ")
+}
+
+// desiredRulesLocked 根据路由集合生成数据面路由规则，构建失败的路由会被跳过。
+// 域名+路径相同时，API创建的路由优先，其次按来源名称、来源内的顺序，服务注解生成的路由最后
+func (rm *RouteManager) desiredRulesLocked() []*dataplane.RouteRule {
+	states := make(map[string]RouteState, len(rm.routes))
+	ids := make([]string, 0, len(rm.routes))
+	for id, route := range rm.routes {
+		if route.Enabled {
+			ids = append(ids, id)
+		} else {
+			states[id] = RouteState{Reason: RouteStateDisabled}
+		}
+	}
+	sort.Strings(ids)
+
+	ordered := make([]*RouteConfig, 0, len(ids))
+	for _, id := range ids {
+		ordered = append(ordered, rm.routes[id])
+	}
+
+	sources := make([]string, 0, len(rm.sources))
+	for source := range rm.sources {
+		sources = append(sources, source)
+	}
+	sort.Slice(sources, func(i, j int) bool {
+		if (sources[i] == RouteSourceService) != (sources[j] == RouteSourceService) {
+			return sources[j] == RouteSourceService
+		}
+		return sources[i] < sources[j]
+	})
+	for _, source := range sources {
+		ordered = append(ordered, rm.sources[source]...)
+	}
+
+	rules := make([]*dataplane.RouteRule, 0, len(ordered))
+	owners := make(map[string]string, len(ordered))
+	for _, route := range ordered {
+		rule, err := rm.buildRule(route, false)
+		if err != nil {
+			rm.log.Warnf("跳过路由 %s: %v", route.ID, err)
+			states[route.ID] = RouteState{Reason: RouteStateInvalid, Message: err.Error()}
+			continue
+		}
+		if owner, exists := owners[rule.Key()]; exists {
+			rm.log.Warnf("跳过路由 %s: %s 已被路由 %s 使用", route.ID, rule.Key(), owner)
+			states[route.ID] = RouteState{Reason: RouteStateConflict, Message: fmt.Sprintf("%s 已被路由 %s 使用", rule.Key(), owner)}
+			continue
+		}
+		owners[rule.Key()] = route.ID
+		rm.applyPoliciesLocked(route, rule)
+		states[route.ID] = RouteState{Programmed: true}
+		rules = append(rules, rule)
+	}
+	rm.states = states
+	return rules
+}
+
+// applyPoliciesLocked 将选中该路由的策略应用到规则，只填充路由自身未设置的字段，先出现的策略优先
+func (rm *RouteManager) applyPoliciesLocked(route *RouteConfig, rule *dataplane.RouteRule) {
+	for _, policy := range rm.policies {
+		if !containsString(policy.RouteIDs, route.ID) && !containsString(policy.Domains, route.Domain) {
+			continue
+		}
+		if rule.RequestHeaders == nil {
+			rule.RequestHeaders = policy.RequestHeaders
+		}
+		if rule.ResponseHeaders == nil {
+			rule.ResponseHeaders = policy.ResponseHeaders
+		}
+		if rule.AccessLog == nil {
+			rule.AccessLog = policy.AccessLog
+		}
+		if rule.Tracing == nil {
+			rule.Tracing = policy.Tracing
+		}
+	}
+}
+
+// buildRule 将路由配置转换为数据面规则。strict为true时要求服务存在且有端点，用于校验用户提交的配置；
+// 推送已保存的路由时服务可能暂时不存在，此时生成没有地址的上游，数据面返回503
+func (rm *RouteManager) buildRule(config *RouteConfig, strict bool) (*dataplane.RouteRule, error) {
+	// 生成的路由允许不限域名（如Ingress的默认后端）
+	if config.Domain == "" && config.Source == "" {
+		return nil, fmt.Errorf("域名不能为空")
+	}
+	switch config.PathType {
+	case "", dataplane.PathMatchExact, dataplane.PathMatchPrefix:
+	default:
+		return nil, fmt.Errorf("不支持的路径匹配方式: %s", config.PathType)
+	}
+	if config.Path == "" {
+		config.Path = "/"
+	}
+
+	// 生成的路由可以只使用 Backends
+	if config.Service == "" && config.Source != "" && len(config.Backends) == 0 {
+		return nil, fmt.Errorf("没有可用的后端服务")
+	}
+
+	var upstreams []dataplane.Upstream
+	if config.Service != "" || config.Source == "" {
+		upstream, err := rm.buildUpstream(config.Service, config.UpstreamSource, config.Port, config.PortName, config.Weight, strict)
+		if err != nil {
+			return nil, err
+		}
+		upstreams = append(upstreams, upstream)
+	}
+
+	for _, backend := range config.Backends {
+		if hasUpstream(upstreams, backend.Service) {
+			return nil, fmt.Errorf("后端服务重复: %s", backend.Service)
+		}
+		upstream, err := rm.buildUpstream(backend.Service, backend.UpstreamSource, backend.Port, backend.PortName, backend.Weight, strict)
+		if err != nil {
+			return nil, err
+		}
+		switch backend.Protocol {
+		case "", dataplane.UpstreamProtocolH2C:
+		default:
+			return nil, fmt.Errorf("不支持的后端协议: %s", backend.Protocol)
+		}
+		upstream.Protocol = backend.Protocol
+		upstream.RequestHeaders = backend.RequestHeaders
+		upstream.ResponseHeaders = backend.ResponseHeaders
+		upstreams = append(upstreams, upstream)
+	}
+
+	rule := &dataplane.RouteRule{
+		Domain:          config.Domain,
+		Path:            config.Path,
+		PathType:        config.PathType,
+		Headers:         config.Headers,
+		RequestHeaders:  config.RequestHeaders,
+		ResponseHeaders: config.ResponseHeaders,
+		AccessLog:       config.AccessLog,
+		Tracing:         config.Tracing,
+		Upstreams:       upstreams,
+		CreatedAt:       config.CreatedAt,
+		UpdatedAt:       config.UpdatedAt,
+	}
+
+	// 构建Header子规则，子规则的目标服务以权重0加入上游列表，不参与默认流量分配
+	for _, headerConfig := range config.HeaderRoutes {
+		headerRoute := &dataplane.HeaderRoute{
+			Header:    headerConfig.Header,
+			Value:     headerConfig.Value,
+			MatchType: headerConfig.MatchType,
+			Upstream:  headerConfig.Service,
+		}
+		if err := headerRoute.Compile(); err != nil {
+			return nil, fmt.Errorf("Header子规则错误: %v", err)
+		}
+
+		if !hasUpstream(rule.Upstreams, headerConfig.Service) {
+			port, portName := headerConfig.Port, headerConfig.PortName
+			if port == 0 && portName == "" {
+				port, portName = config.Port, config.PortName
+			}
+			upstream, err := rm.buildUpstream(headerConfig.Service, UpstreamSource{Topology: config.Topology}, port, portName, 0, strict)
+			if err != nil {
+				return nil, fmt.Errorf("Header子规则: %v", err)
+			}
+			rule.Upstreams = append(rule.Upstreams, upstream)
+		}
+
+		rule.HeaderRoutes = append(rule.HeaderRoutes, headerRoute)
+	}
+
+	return rule, nil
+}
+
+// buildUpstream 构建上游：static、dns类型直接使用配置的地址或域名；Service按当前端点构建，
+// port和portName引用Service端口，按EndpointSlice解析为各Pod的端口；ExternalName类型的Service按域名转发
+func (rm *RouteManager) buildUpstream(service string, source UpstreamSource, port int, portName string, weight int, strict bool) (dataplane.Upstream, error) {
+	upstream := dataplane.Upstream{
+		Name:   service,
+		Port:   port,
+		Weight: weight,
+		TLS:    source.TLS,
+	}
+	if err := validateUpstreamTLS(source.TLS); err != nil {
+		return upstream, fmt.Errorf("上游 %s: %v", service, err)
+	}
+	if err := validateTopology(source.Topology); err != nil {
+		return upstream, fmt.Errorf("上游 %s: %v", service, err)
+	}
+
+	switch source.Kind {
+	case "":
+	case dataplane.UpstreamKindStatic, dataplane.UpstreamKindDNS:
+		return buildExternalUpstream(upstream, source, portName)
+	case dataplane.UpstreamKindInvalid:
+		// 数据面对分到该上游的请求返回500
+		upstream.Kind = dataplane.UpstreamKindInvalid
+		return upstream, nil
+	default:
+		return upstream, fmt.Errorf("不支持的上游类型: %s", source.Kind)
+	}
+
+	namespace, serviceName, err := parseServiceName(service)
+	if err != nil {
+		return upstream, err
+	}
+	if portName == "" && (port <= 0 || port > 65535) {
+		return upstream, fmt.Errorf("服务 %s 的端口无效: %d", service, port)
+	}
+
+	info := rm.k8sDiscovery.GetService(namespace, serviceName)
+	if info != nil && info.Type == string(corev1.ServiceTypeExternalName) {
+		servicePort, err := rm.k8sDiscovery.ResolveServicePort(namespace, serviceName, portName, int32(port))
+		if err != nil {
+			return upstream, err
+		}
+		upstream.Kind = dataplane.UpstreamKindDNS
+		upstream.Host = info.ExternalName
+		upstream.Port = int(servicePort.Port)
+		upstream.Healthy = true
+		return upstream, nil
+	}
+
+	endpoint := rm.k8sDiscovery.GetServiceEndpoints(namespace, serviceName)
+	if endpoint == nil {
+		if strict {
+			return upstream, fmt.Errorf("指定的服务不存在或没有可用的端点: %s", service)
+		}
+		return upstream, nil
+	}
+	upstream.SessionAffinity = dataplane.SessionAffinity(endpoint.SessionAffinity)
+	upstream.AffinityTimeout = int(endpoint.AffinityTimeout)
+
+	// 同一Service端口在不同Pod上可能是不同的端口（命名targetPort），没有该端口的地址不转发
+	ports := make(map[string]int, len(endpoint.Endpoints))
+	servicePort, err := rm.k8sDiscovery.ResolveServicePort(namespace, serviceName, portName, int32(port))
+	switch {
+	case err == nil:
+		upstream.Port = int(servicePort.TargetPort)
+		for _, address := range endpoint.Endpoints {
+			if podPort, ok := address.Ports[servicePort.Name]; ok {
+				ports[address.IP] = int(podPort)
+			}
+		}
+	case portName == "" && containsPort(endpoint.Ports, int32(port)):
+		// 兼容旧版本保存的路由：端口为Pod端口时直接使用
+		for _, address := range endpoint.Endpoints {
+			for _, podPort := range address.Ports {
+				if int(podPort) == port {
+					ports[address.IP] = port
+				}
+			}
+		}
+	default:
+		return upstream, err
+	}
+
+	upstream.Addresses = addressesWithPort(endpoint.Addresses, ports)
+	upstream.DrainingAddresses = addressesWithPort(endpoint.DrainingAddresses, ports)
+	upstream.Healthy = len(upstream.Addresses) > 0
+
+	upstream.Topology = source.Topology
+	if upstream.Topology == nil && info != nil && topologyAuto(info.Annotations) {
+		upstream.Topology = &dataplane.TopologyPolicy{}
+	}
+	if upstream.Topology != nil {
+		setLocality(&upstream, endpoint.Endpoints, ports)
+	}
+
+	// 以第一个地址的端口为上游端口，其他端口不同的地址单独记录
+	if all := append(append([]string{}, upstream.Addresses...), upstream.DrainingAddresses...); len(all) > 0 {
+		upstream.Port = ports[all[0]]
+		for _, address := range all {
+			if ports[address] != upstream.Port {
+				if upstream.AddressPorts == nil {
+					upstream.AddressPorts = make(map[string]int)
+				}
+				upstream.AddressPorts[address] = ports[address]
+			}
+		}
+	}
+	return upstream, nil
+}
+
+// buildExternalUpstream 构建static、dns类型的上游，地址不经过服务发现
+func buildExternalUpstream(upstream dataplane.Upstream, source UpstreamSource, portName string) (dataplane.Upstream, error) {
+	if upstream.Name == "" {
+		return upstream, fmt.Errorf("%s类型的上游需要名称", source.Kind)
+	}
+	if portName != "" {
+		return upstream, fmt.Errorf("上游 %s: 端口名只能用于Service", upstream.Name)
+	}
+	if source.Topology != nil {
+		return upstream, fmt.Errorf("上游 %s: 拓扑感知路由只能用于Service", upstream.Name)
+	}
+	if upstream.Port < 0 || upstream.Port > 65535 {
+		return upstream, fmt.Errorf("上游 %s 的端口无效: %d", upstream.Name, upstream.Port)
+	}
+	upstream.Kind = source.Kind
+	upstream.Healthy = true
+
+	if source.Kind == dataplane.UpstreamKindDNS {
+		host := strings.TrimSuffix(source.Host, ".")
+		if host == "" || net.ParseIP(host) != nil || strings.ContainsAny(host, ":/ ") {
+			return upstream, fmt.Errorf("上游 %s 的域名无效: %s", upstream.Name, source.Host)
+		}
+		if upstream.Port == 0 {
+			return upstream, fmt.Errorf("上游 %s 需要指定端口", upstream.Name)
+		}
+		upstream.Host = host
+		return upstream, nil
+	}
+
+	if len(source.Addresses) == 0 {
+		return upstream, fmt.Errorf("上游 %s 没有地址", upstream.Name)
+	}
+	ports := make(map[string]int, len(source.Addresses))
+	for _, address := range source.Addresses {
+		ip, port := address, upstream.Port
+		if host, portText, err := net.SplitHostPort(address); err == nil {
+			ip = host
+			if port, err = strconv.Atoi(portText); err != nil || port <= 0 || port > 65535 {
+				return upstream, fmt.Errorf("上游 %s 的地址端口无效: %s", upstream.Name, address)
+			}
+		}
+		if net.ParseIP(ip) == nil {
+			return upstream, fmt.Errorf("上游 %s 的地址必须是IP: %s", upstream.Name, address)
+		}
+		if port == 0 {
+			return upstream, fmt.Errorf("上游 %s 的地址 %s 没有端口", upstream.Name, address)
+		}
+		if _, exists := ports[ip]; exists {
+			return upstream, fmt.Errorf("上游 %s 的地址重复: %s", upstream.Name, ip)
+		}
+		ports[ip] = port
+		upstream.Addresses = append(upstream.Addresses, ip)
+	}
+
+	if upstream.Port == 0 {
+		upstream.Port = ports[upstream.Addresses[0]]
+	}
+	for _, address := range upstream.Addresses {
+		if ports[address] != upstream.Port {
+			if upstream.AddressPorts == nil {
+				upstream.AddressPorts = make(map[string]int)
+			}
+			upstream.AddressPorts[address] = ports[address]
+		}
+	}
+	return upstream, nil
+}
+
+// validateUpstreamTLS 校验上游的TLS配置
+func validateUpstreamTLS(config *dataplane.UpstreamTLS) error {
+	if config == nil || config.CA == "" {
+		return nil
+	}
+	if !x509.NewCertPool().AppendCertsFromPEM([]byte(config.CA)) {
+		return fmt.Errorf("TLS的CA证书无效")
+	}
+	return nil
+}
+
+// validateTopology 校验拓扑感知路由的溢出阈值
+func validateTopology(policy *dataplane.TopologyPolicy) error {
+	if policy == nil {
+		return nil
+	}
+	if policy.MinEndpoints < 0 || policy.MaxInflight < 0 {
+		return fmt.Errorf("拓扑感知路由的阈值不能为负数")
+	}
+	if policy.MinHealthyPercent < 0 || policy.MinHealthyPercent > 100 {
+		return fmt.Errorf("拓扑感知路由的就绪比例应在0~100之间: %d", policy.MinHealthyPercent)
+	}
+	return nil
+}
+
+// topologyAuto 判断Service是否通过注解开启了拓扑感知路由，与kube-proxy使用相同的注解
+func topologyAuto(annotations map[string]string) bool {
+	if mode, ok := annotations[AnnotationTopologyMode]; ok {
+		return strings.EqualFold(mode, "auto")
+	}
+	return strings.EqualFold(annotations[AnnotationTopologyAwareHints], "auto")
+}
+
+// setLocality 记录上游地址所在的节点和可用区，未就绪且未终止的Pod单独记录，用于数据面计算本地Pod的就绪比例
+func setLocality(upstream *dataplane.Upstream, endpoints []EndpointAddress, ports map[string]int) {
+	upstream.Locality = make(map[string]dataplane.Locality, len(upstream.Addresses)+len(upstream.DrainingAddresses))
+	for _, address := range upstream.Addresses {
+		upstream.Locality[address] = dataplane.Locality{}
+	}
+	for _, address := range upstream.DrainingAddresses {
+		upstream.Locality[address] = dataplane.Locality{}
+	}
+	for _, address := range endpoints {
+		if _, ok := ports[address.IP]; !ok {
+			continue
+		}
+		locality := dataplane.Locality{Node: address.NodeName, Zone: address.Zone}
+		_, published := upstream.Locality[address.IP]
+		switch {
+		case published:
+			upstream.Locality[address.IP] = locality
+		case !address.Terminating:
+			upstream.UnreadyLocality = append(upstream.UnreadyLocality, locality)
+		}
+	}
+}
+
+// addressesWithPort 过滤出有端口的地址
+func addressesWithPort(addresses []string, ports map[string]int) []string {
+	result := make([]string, 0, len(addresses))
+	for _, address := range addresses {
+		if _, ok := ports[address]; ok {
+			result = append(result, address)
+		}
+	}
+	return result
+}
+
+// containsPort 判断端口列表中是否包含指定端口
+func containsPort(ports []int32, port int32) bool {
+	for _, p := range ports {
+		if p == port {
+			return true
+		}
+	}
+	return false
+}
+
+// newRouteID 生成路由ID
+func newRouteID() string {
+	var buf [8]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(buf[:])
+}
@@ -0,0 +1,187 @@
+package controlplane
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"kun-gateway/pkg/dataplane"
+
+	"github.com/sirupsen/logrus"
+)
+
+// 通过注解暴露服务
+const (
+	// AnnotationHost 访问服务的域名，多个域名用逗号分隔
+	AnnotationHost = "kun-gateway.io/host"
+	// AnnotationPath 路径前缀，默认 /
+	AnnotationPath = "kun-gateway.io/path"
+	// AnnotationPort 服务端口名或端口号，服务只有一个端口时可以省略
+	AnnotationPort = "kun-gateway.io/port"
+)
+
+const (
+	// serviceRouteResyncInterval 定期全量同步的间隔，用于修正遗漏的变化
+	serviceRouteResyncInterval = 30 * time.Second
+	// serviceRouteSyncDelay 服务变化后等待的时间，合并短时间内的多次变化
+	serviceRouteSyncDelay = time.Second
+)
+
+// ServiceRouteController 为带有 kun-gateway.io/host 注解的服务生成路由。
+// 域名+路径冲突时，手动创建的路由、Ingress和Gateway API生成的路由优先，注解之间先创建的服务优先
+type ServiceRouteController struct {
+	k8sDiscovery *K8sDiscovery
+	routeManager *RouteManager
+	trigger      chan struct{}
+	log          *logrus.Logger
+}
+
+// NewServiceRouteController 创建服务注解路由控制器
+func NewServiceRouteController(k8sDiscovery *K8sDiscovery, routeManager *RouteManager, log *logrus.Logger) *ServiceRouteController {
+	return &ServiceRouteController{
+		k8sDiscovery: k8sDiscovery,
+		routeManager: routeManager,
+		trigger:      make(chan struct{}, 1),
+		log:          log,
+	}
+}
+
+// Start 先完成一次全量同步，然后在服务变化时重新生成路由，直到ctx结束
+func (c *ServiceRouteController) Start(ctx context.Context) {
+	c.log.Info("启动服务注解路由控制器")
+
+	c.sync()
+	c.k8sDiscovery.OnServiceChange(func(string) { c.notify() })
+	go c.run(ctx)
+}
+
+// notify 触发一次同步，不阻塞
+func (c *ServiceRouteController) notify() {
+	select {
+	case c.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// run 在服务变化或定期同步时重新生成路由
+func (c *ServiceRouteController) run(ctx context.Context) {
+	ticker := time.NewTicker(serviceRouteResyncInterval)
+	defer ticker.Stop()
+
+	var delay <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.trigger:
+			if delay == nil {
+				delay = time.After(serviceRouteSyncDelay)
+			}
+		case <-delay:
+			delay = nil
+			c.sync()
+		case <-ticker.C:
+			c.sync()
+		}
+	}
+}
+
+// sync 为所有带注解的服务生成路由，按服务创建时间排序
+func (c *ServiceRouteController) sync() {
+	var services []*ServiceInfo
+	for _, service := range c.k8sDiscovery.GetServices() {
+		if strings.TrimSpace(service.Annotations[AnnotationHost]) != "" {
+			services = append(services, service)
+		}
+	}
+	sort.Slice(services, func(i, j int) bool {
+		a, b := services[i], services[j]
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.Before(b.CreatedAt)
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Name < b.Name
+	})
+
+	var routes []*RouteConfig
+	for _, service := range services {
+		serviceRoutes, err := c.translate(service)
+		if err != nil {
+			c.log.Warnf("服务 %s/%s 的注解已跳过: %v", service.Namespace, service.Name, err)
+			continue
+		}
+		routes = append(routes, serviceRoutes...)
+	}
+
+	c.routeManager.SetSourceRoutes(RouteSourceService, routes)
+	c.log.Debugf("服务注解同步完成，%d 个服务，%d 条路由", len(services), len(routes))
+}
+
+// translate 根据注解为服务生成路由，每个域名一条
+func (c *ServiceRouteController) translate(service *ServiceInfo) ([]*RouteConfig, error) {
+	path := strings.TrimSpace(service.Annotations[AnnotationPath])
+	if path == "" {
+		path = "/"
+	}
+	if !strings.HasPrefix(path, "/") {
+		return nil, fmt.Errorf("%s 必须以/开头: %s", AnnotationPath, path)
+	}
+	// 前缀按路径段匹配，末尾的/不影响匹配结果
+	if path != "/" {
+		path = strings.TrimRight(path, "/")
+	}
+
+	port, err := c.resolvePort(service, strings.TrimSpace(service.Annotations[AnnotationPort]))
+	if err != nil {
+		return nil, err
+	}
+
+	var routes []*RouteConfig
+	for _, host := range strings.Split(service.Annotations[AnnotationHost], ",") {
+		host = strings.TrimSpace(host)
+		if host == "" {
+			continue
+		}
+		routes = append(routes, &RouteConfig{
+			ID:        fmt.Sprintf("%s:%s:%s:%d", RouteSourceService, service.Namespace, service.Name, len(routes)),
+			Domain:    host,
+			Path:      path,
+			PathType:  dataplane.PathMatchPrefix,
+			Service:   fmt.Sprintf("%s/%s", service.Namespace, service.Name),
+			Port:      port,
+			Weight:    100,
+			CreatedAt: service.CreatedAt,
+			UpdatedAt: service.CreatedAt,
+		})
+	}
+	return routes, nil
+}
+
+// resolvePort 将注解中的端口名或端口号解析为Service端口号，未指定时服务必须只有一个端口
+func (c *ServiceRouteController) resolvePort(service *ServiceInfo, value string) (int, error) {
+	var portName string
+	var portNumber int32
+	switch {
+	case value == "":
+		if len(service.Ports) != 1 {
+			return 0, fmt.Errorf("服务有 %d 个端口，需要通过 %s 指定", len(service.Ports), AnnotationPort)
+		}
+		portName, portNumber = service.Ports[0].Name, service.Ports[0].Port
+	default:
+		if number, err := strconv.ParseInt(value, 10, 32); err == nil {
+			portNumber = int32(number)
+		} else {
+			portName = value
+		}
+	}
+	servicePort, err := c.k8sDiscovery.ResolveServicePort(service.Namespace, service.Name, portName, portNumber)
+	if err != nil {
+		return 0, err
+	}
+	return int(servicePort.Port), nil
+}
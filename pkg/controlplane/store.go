@@ -0,0 +1,715 @@
+package controlplane
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"kun-gateway/pkg/apis/kungateway/v1alpha1"
+	"kun-gateway/pkg/dataplane"
+	"kun-gateway/pkg/kunclient"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// 路由存储类型
+const (
+	RouteStoreFile      = "file"
+	RouteStoreConfigMap = "configmap"
+	RouteStoreCRD       = "crd"
+)
+
+// routeStoreKey ConfigMap中保存路由的key
+const routeStoreKey = "routes.json"
+
+const (
+	// rollbackStoreKey、historyStoreKey ConfigMap中保存回滚状态和历史配置版本的key
+	rollbackStoreKey = "rollback.json"
+	historyStoreKey  = "history.json"
+	// DefaultRollbackConfigMap configmap和crd存储方式下保存回滚状态和历史配置版本的ConfigMap名称，与路由在同一命名空间
+	DefaultRollbackConfigMap = "kun-gateway-rollback"
+	// maxHistoryConfigMapSize 历史配置版本在ConfigMap中的最大长度，ConfigMap的上限为1MiB
+	maxHistoryConfigMapSize = 900 * 1024
+)
+
+// RouteStore 路由配置的持久化存储，每次读写完整的路由集合
+type RouteStore interface {
+	Load() ([]*RouteConfig, error)
+	Save(routes []*RouteConfig) error
+}
+
+// routeDocument 持久化的路由集合
+type routeDocument struct {
+	Routes    []*RouteConfig `json:"routes"`
+	UpdatedAt time.Time      `json:"updated_at"`
+}
+
+// encodeRoutes 按ID排序后序列化，保证相同的路由集合得到相同的内容
+func encodeRoutes(routes []*RouteConfig) ([]byte, error) {
+	sorted := append([]*RouteConfig(nil), routes...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ID < sorted[j].ID })
+
+	data, err := json.MarshalIndent(&routeDocument{Routes: sorted, UpdatedAt: time.Now()}, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("序列化路由失败: %v", err)
+	}
+	return data, nil
+}
+
+// decodeRoutes 反序列化路由集合
+func decodeRoutes(data []byte) ([]*RouteConfig, error) {
+	var doc routeDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("解析路由失败: %v", err)
+	}
+	return doc.Routes, nil
+}
+
+// FileRouteStore 保存在本地文件中的路由存储
+type FileRouteStore struct {
+	path string
+}
+
+// NewFileRouteStore 创建文件路由存储
+func NewFileRouteStore(path string) *FileRouteStore {
+	return &FileRouteStore{path: path}
+}
+
+// Load 读取路由，文件不存在时返回空集合
+func (s *FileRouteStore) Load() ([]*RouteConfig, error) {
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取路由文件失败: %v", err)
+	}
+	return decodeRoutes(data)
+}
+
+// Save 先写临时文件再重命名，避免写到一半时留下损坏的文件
+func (s *FileRouteStore) Save(routes []*RouteConfig) error {
+	data, err := encodeRoutes(routes)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("创建路由目录失败: %v", err)
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("写入路由文件失败: %v", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("写入路由文件失败: %v", err)
+	}
+	return nil
+}
+
+// ConfigMapRouteStore 保存在K8s ConfigMap中的路由存储，控制面重建或迁移节点后路由不丢失
+type ConfigMapRouteStore struct {
+	client    kubernetes.Interface
+	namespace string
+	name      string
+	// 最近一次读写的ResourceVersion，用于检测其他副本的并发修改
+	resourceVersion string
+	exists          bool
+}
+
+// NewConfigMapRouteStore 创建ConfigMap路由存储
+func NewConfigMapRouteStore(client kubernetes.Interface, namespace, name string) *ConfigMapRouteStore {
+	return &ConfigMapRouteStore{
+		client:    client,
+		namespace: namespace,
+		name:      name,
+	}
+}
+
+// Load 读取路由，ConfigMap不存在时返回空集合
+func (s *ConfigMapRouteStore) Load() ([]*RouteConfig, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	configMap, err := s.client.CoreV1().ConfigMaps(s.namespace).Get(ctx, s.name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		s.resourceVersion = ""
+		s.exists = false
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取路由ConfigMap失败: %v", err)
+	}
+
+	s.resourceVersion = configMap.ResourceVersion
+	s.exists = true
+	data, ok := configMap.Data[routeStoreKey]
+	if !ok || data == "" {
+		return nil, nil
+	}
+	return decodeRoutes([]byte(data))
+}
+
+// Save 写入路由，ConfigMap被其他副本修改过时返回冲突错误
+func (s *ConfigMapRouteStore) Save(routes []*RouteConfig) error {
+	data, err := encodeRoutes(routes)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            s.name,
+			Namespace:       s.namespace,
+			ResourceVersion: s.resourceVersion,
+			Labels: map[string]string{
+				"app":       "kun-gateway",
+				"component": "controlplane",
+			},
+		},
+		Data: map[string]string{routeStoreKey: string(data)},
+	}
+
+	var saved *corev1.ConfigMap
+	if !s.exists {
+		saved, err = s.client.CoreV1().ConfigMaps(s.namespace).Create(ctx, configMap, metav1.CreateOptions{})
+	} else {
+		saved, err = s.client.CoreV1().ConfigMaps(s.namespace).Update(ctx, configMap, metav1.UpdateOptions{})
+	}
+	if apierrors.IsConflict(err) || apierrors.IsAlreadyExists(err) {
+		return fmt.Errorf("路由ConfigMap已被其他副本修改，请刷新后重试: %v", err)
+	}
+	if err != nil {
+		return fmt.Errorf("写入路由ConfigMap失败: %v", err)
+	}
+
+	s.resourceVersion = saved.ResourceVersion
+	s.exists = true
+	return nil
+}
+
+// CRDRouteStore 以KunRoute保存路由，每条路由对应一个对象，对象名称即路由ID，
+// 可以直接通过kubectl或GitOps管理，外部修改由KunResourceController触发重新加载
+type CRDRouteStore struct {
+	client    *kunclient.Client
+	namespace string
+	// 最近一次读写的对象，key: 名称，用于只写入变化的路由并检测并发修改
+	objects map[string]*v1alpha1.KunRoute
+}
+
+// NewCRDRouteStore 创建KunRoute路由存储
+func NewCRDRouteStore(client *kunclient.Client, namespace string) *CRDRouteStore {
+	return &CRDRouteStore{
+		client:    client,
+		namespace: namespace,
+		objects:   make(map[string]*v1alpha1.KunRoute),
+	}
+}
+
+// Load 读取命名空间中的所有KunRoute
+func (s *CRDRouteStore) Load() ([]*RouteConfig, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	list, err := s.client.KunRoutes(s.namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("读取KunRoute失败: %v", err)
+	}
+
+	s.objects = make(map[string]*v1alpha1.KunRoute, len(list.Items))
+	routes := make([]*RouteConfig, 0, len(list.Items))
+	for i := range list.Items {
+		object := &list.Items[i]
+		s.objects[object.Name] = object
+		routes = append(routes, routeFromKunRoute(object))
+	}
+	return routes, nil
+}
+
+// Save 只写入变化的路由：新路由创建对象，修改的路由更新对象，移除的路由删除对象。
+// 对象被其他副本或kubectl修改过时返回冲突错误
+func (s *CRDRouteStore) Save(routes []*RouteConfig) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client := s.client.KunRoutes(s.namespace)
+	desired := make(map[string]bool, len(routes))
+	for _, route := range routes {
+		desired[route.ID] = true
+		spec := kunRouteSpec(route)
+		createdAt := route.CreatedAt.Format(time.RFC3339Nano)
+		updatedAt := route.UpdatedAt.Format(time.RFC3339Nano)
+
+		existing, ok := s.objects[route.ID]
+		if !ok {
+			object := &v1alpha1.KunRoute{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      route.ID,
+					Namespace: s.namespace,
+					Labels: map[string]string{
+						"app":       "kun-gateway",
+						"component": "controlplane",
+					},
+					Annotations: map[string]string{
+						v1alpha1.AnnotationCreatedAt: createdAt,
+						v1alpha1.AnnotationUpdatedAt: updatedAt,
+					},
+				},
+				Spec: spec,
+			}
+			created, err := client.Create(ctx, object)
+			if apierrors.IsAlreadyExists(err) {
+				return fmt.Errorf("KunRoute %s 已存在，请刷新后重试: %v", route.ID, err)
+			}
+			if err != nil {
+				return fmt.Errorf("创建KunRoute %s 失败: %v", route.ID, err)
+			}
+			s.objects[route.ID] = created
+			continue
+		}
+
+		if reflect.DeepEqual(existing.Spec, spec) && existing.Annotations[v1alpha1.AnnotationUpdatedAt] == updatedAt {
+			continue
+		}
+		object := existing.DeepCopy()
+		object.Spec = spec
+		if object.Annotations == nil {
+			object.Annotations = make(map[string]string)
+		}
+		object.Annotations[v1alpha1.AnnotationCreatedAt] = createdAt
+		object.Annotations[v1alpha1.AnnotationUpdatedAt] = updatedAt
+		updated, err := client.Update(ctx, object)
+		if apierrors.IsConflict(err) || apierrors.IsNotFound(err) {
+			return fmt.Errorf("KunRoute %s 已被修改，请刷新后重试: %v", route.ID, err)
+		}
+		if err != nil {
+			return fmt.Errorf("更新KunRoute %s 失败: %v", route.ID, err)
+		}
+		s.objects[route.ID] = updated
+	}
+
+	for name := range s.objects {
+		if desired[name] {
+			continue
+		}
+		if err := client.Delete(ctx, name); err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("删除KunRoute %s 失败: %v", name, err)
+		}
+		delete(s.objects, name)
+	}
+	return nil
+}
+
+// routeFromKunRoute 将KunRoute转换为路由配置，未通过API修改过的对象使用创建时间
+func routeFromKunRoute(object *v1alpha1.KunRoute) *RouteConfig {
+	spec := object.Spec
+	route := &RouteConfig{
+		ID:              object.Name,
+		Domain:          spec.Domain,
+		Path:            spec.Path,
+		PathType:        spec.PathType,
+		Headers:         spec.Headers,
+		RequestHeaders:  spec.RequestHeaders,
+		ResponseHeaders: spec.ResponseHeaders,
+		AccessLog:       spec.AccessLog,
+		Tracing:         spec.Tracing,
+		Service:         spec.Service,
+		UpstreamSource:  upstreamSourceFromKun(spec.KunUpstreamSource),
+		Port:            spec.Port,
+		PortName:        spec.PortName,
+		Weight:          spec.Weight,
+		Enabled:         !spec.Disabled,
+		CreatedAt:       object.CreationTimestamp.Time,
+	}
+	for _, headerRoute := range spec.HeaderRoutes {
+		route.HeaderRoutes = append(route.HeaderRoutes, HeaderRouteConfig{
+			Header:    headerRoute.Header,
+			Value:     headerRoute.Value,
+			MatchType: headerRoute.MatchType,
+			Service:   headerRoute.Service,
+			Port:      headerRoute.Port,
+			PortName:  headerRoute.PortName,
+		})
+	}
+	for _, backend := range spec.Backends {
+		route.Backends = append(route.Backends, BackendConfig{
+			Service:         backend.Service,
+			UpstreamSource:  upstreamSourceFromKun(backend.KunUpstreamSource),
+			Port:            backend.Port,
+			PortName:        backend.PortName,
+			Weight:          backend.Weight,
+			Protocol:        backend.Protocol,
+			RequestHeaders:  backend.RequestHeaders,
+			ResponseHeaders: backend.ResponseHeaders,
+		})
+	}
+
+	if createdAt, err := time.Parse(time.RFC3339Nano, object.Annotations[v1alpha1.AnnotationCreatedAt]); err == nil {
+		route.CreatedAt = createdAt
+	}
+	route.UpdatedAt = route.CreatedAt
+	if updatedAt, err := time.Parse(time.RFC3339Nano, object.Annotations[v1alpha1.AnnotationUpdatedAt]); err == nil {
+		route.UpdatedAt = updatedAt
+	}
+	return route
+}
+
+// upstreamSourceFromKun 转换KunRoute中的上游类型
+func upstreamSourceFromKun(source v1alpha1.KunUpstreamSource) UpstreamSource {
+	return UpstreamSource{
+		Kind:      source.Kind,
+		Addresses: source.Addresses,
+		Host:      source.Host,
+		TLS:       source.TLS,
+		Topology:  source.Topology,
+	}
+}
+
+// kunUpstreamSource 将上游类型转换为KunRoute中的格式
+func kunUpstreamSource(source UpstreamSource) v1alpha1.KunUpstreamSource {
+	return v1alpha1.KunUpstreamSource{
+		Kind:      source.Kind,
+		Addresses: source.Addresses,
+		Host:      source.Host,
+		TLS:       source.TLS,
+		Topology:  source.Topology,
+	}
+}
+
+// kunRouteSpec 将路由配置转换为KunRoute的spec
+func kunRouteSpec(route *RouteConfig) v1alpha1.KunRouteSpec {
+	spec := v1alpha1.KunRouteSpec{
+		Domain:            route.Domain,
+		Path:              route.Path,
+		PathType:          route.PathType,
+		Headers:           route.Headers,
+		RequestHeaders:    route.RequestHeaders,
+		ResponseHeaders:   route.ResponseHeaders,
+		AccessLog:         route.AccessLog,
+		Tracing:           route.Tracing,
+		Service:           route.Service,
+		KunUpstreamSource: kunUpstreamSource(route.UpstreamSource),
+		Port:              route.Port,
+		PortName:          route.PortName,
+		Weight:            route.Weight,
+		Disabled:          !route.Enabled,
+	}
+	for _, headerRoute := range route.HeaderRoutes {
+		spec.HeaderRoutes = append(spec.HeaderRoutes, v1alpha1.KunHeaderRoute{
+			Header:    headerRoute.Header,
+			Value:     headerRoute.Value,
+			MatchType: headerRoute.MatchType,
+			Service:   headerRoute.Service,
+			Port:      headerRoute.Port,
+			PortName:  headerRoute.PortName,
+		})
+	}
+	for _, backend := range route.Backends {
+		spec.Backends = append(spec.Backends, v1alpha1.KunBackend{
+			Service:           backend.Service,
+			KunUpstreamSource: kunUpstreamSource(backend.UpstreamSource),
+			Port:              backend.Port,
+			PortName:          backend.PortName,
+			Weight:            backend.Weight,
+			Protocol:          backend.Protocol,
+			RequestHeaders:    backend.RequestHeaders,
+			ResponseHeaders:   backend.ResponseHeaders,
+		})
+	}
+	return spec
+}
+
+// RollbackState 持久化的配置回滚状态。回滚目标的路由单独保存，回滚目标已不在历史版本中时也能恢复，
+// 控制面重启后恢复回滚，启动时的推送不会撤销回滚
+type RollbackState struct {
+	// Generation、Version 回滚到的版本，Generation 为重启前的编号
+	Generation int64  `json:"generation"`
+	Version    string `json:"version"`
+	Author     string `json:"author"`
+	// LastGeneration 保存时最新的版本编号，重启后新版本的编号从这里继续
+	LastGeneration int64                  `json:"last_generation"`
+	Rules          []*dataplane.RouteRule `json:"rules"`
+	// Certificates 回滚目标的证书引用，key: 域名，value: 证书内容的摘要
+	Certificates map[string]string `json:"certificates,omitempty"`
+	UpdatedAt    time.Time         `json:"updated_at"`
+}
+
+// HistoryRecord 持久化的历史配置版本。证书包含私钥，只保存域名和内容的摘要，
+// 重启后回滚到该版本时按域名使用控制面重新加载的证书
+type HistoryRecord struct {
+	Generation   int64                  `json:"generation"`
+	Version      string                 `json:"version"`
+	Author       string                 `json:"author"`
+	RollbackOf   int64                  `json:"rollback_of,omitempty"`
+	Changes      ConfigChanges          `json:"changes"`
+	Rules        []*dataplane.RouteRule `json:"rules"`
+	Certificates map[string]string      `json:"certificates,omitempty"`
+	CreatedAt    time.Time              `json:"created_at"`
+}
+
+// RollbackStore 回滚状态和历史配置版本的持久化存储，Save(nil) 清除回滚状态。
+// 历史版本按从旧到新的顺序保存
+type RollbackStore interface {
+	Load() (*RollbackState, error)
+	Save(state *RollbackState) error
+	LoadHistory() ([]*HistoryRecord, error)
+	SaveHistory(records []*HistoryRecord) error
+}
+
+// encodeRollback 序列化回滚状态，nil 序列化为空内容
+func encodeRollback(state *RollbackState) ([]byte, error) {
+	if state == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return nil, fmt.Errorf("序列化回滚状态失败: %v", err)
+	}
+	return data, nil
+}
+
+// decodeRollback 反序列化回滚状态，空内容表示没有回滚
+func decodeRollback(data []byte) (*RollbackState, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	var state RollbackState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("解析回滚状态失败: %v", err)
+	}
+	return &state, nil
+}
+
+// encodeHistory 序列化历史配置版本，超过maxSize（大于0时）时丢弃最早的版本
+func encodeHistory(records []*HistoryRecord, maxSize int) ([]byte, error) {
+	for {
+		data, err := json.Marshal(records)
+		if err != nil {
+			return nil, fmt.Errorf("序列化历史配置版本失败: %v", err)
+		}
+		if maxSize <= 0 || len(data) <= maxSize || len(records) <= 1 {
+			return data, nil
+		}
+		records = records[1:]
+	}
+}
+
+// decodeHistory 反序列化历史配置版本，空内容表示没有历史版本
+func decodeHistory(data []byte) ([]*HistoryRecord, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	var records []*HistoryRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("解析历史配置版本失败: %v", err)
+	}
+	return records, nil
+}
+
+// writeFileAtomic 先写临时文件再重命名，避免写到一半时留下损坏的文件
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("创建目录失败: %v", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// FileRollbackStore 保存在本地文件中的回滚状态，历史配置版本保存在同一目录的 history.json
+type FileRollbackStore struct {
+	path        string
+	historyPath string
+}
+
+// NewFileRollbackStore 创建文件回滚状态存储
+func NewFileRollbackStore(path string) *FileRollbackStore {
+	return &FileRollbackStore{path: path, historyPath: filepath.Join(filepath.Dir(path), "history.json")}
+}
+
+// Load 读取回滚状态，文件不存在时没有回滚
+func (s *FileRollbackStore) Load() (*RollbackState, error) {
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取回滚状态文件失败: %v", err)
+	}
+	return decodeRollback(data)
+}
+
+// Save 写入回滚状态，state为nil时删除文件
+func (s *FileRollbackStore) Save(state *RollbackState) error {
+	if state == nil {
+		if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("删除回滚状态文件失败: %v", err)
+		}
+		return nil
+	}
+	data, err := encodeRollback(state)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(s.path, data); err != nil {
+		return fmt.Errorf("写入回滚状态文件失败: %v", err)
+	}
+	return nil
+}
+
+// LoadHistory 读取历史配置版本，文件不存在时没有历史版本
+func (s *FileRollbackStore) LoadHistory() ([]*HistoryRecord, error) {
+	data, err := os.ReadFile(s.historyPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取历史配置版本文件失败: %v", err)
+	}
+	return decodeHistory(data)
+}
+
+// SaveHistory 写入历史配置版本
+func (s *FileRollbackStore) SaveHistory(records []*HistoryRecord) error {
+	data, err := encodeHistory(records, 0)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(s.historyPath, data); err != nil {
+		return fmt.Errorf("写入历史配置版本文件失败: %v", err)
+	}
+	return nil
+}
+
+// ConfigMapRollbackStore 保存在K8s ConfigMap中的回滚状态，回滚状态和历史配置版本分别保存在两个key中
+type ConfigMapRollbackStore struct {
+	client    kubernetes.Interface
+	namespace string
+	name      string
+	// mu 串行化对ConfigMap的读改写，回滚状态和历史版本的保存互不覆盖
+	mu sync.Mutex
+}
+
+// NewConfigMapRollbackStore 创建ConfigMap回滚状态存储
+func NewConfigMapRollbackStore(client kubernetes.Interface, namespace, name string) *ConfigMapRollbackStore {
+	return &ConfigMapRollbackStore{
+		client:    client,
+		namespace: namespace,
+		name:      name,
+	}
+}
+
+// Load 读取回滚状态，ConfigMap不存在或内容为空时没有回滚
+func (s *ConfigMapRollbackStore) Load() (*RollbackState, error) {
+	data, err := s.get(rollbackStoreKey)
+	if err != nil {
+		return nil, err
+	}
+	return decodeRollback(data)
+}
+
+// Save 写入回滚状态，state为nil时清空内容
+func (s *ConfigMapRollbackStore) Save(state *RollbackState) error {
+	data, err := encodeRollback(state)
+	if err != nil {
+		return err
+	}
+	return s.put(rollbackStoreKey, data)
+}
+
+// LoadHistory 读取历史配置版本
+func (s *ConfigMapRollbackStore) LoadHistory() ([]*HistoryRecord, error) {
+	data, err := s.get(historyStoreKey)
+	if err != nil {
+		return nil, err
+	}
+	return decodeHistory(data)
+}
+
+// SaveHistory 写入历史配置版本，超过ConfigMap的大小限制时丢弃最早的版本
+func (s *ConfigMapRollbackStore) SaveHistory(records []*HistoryRecord) error {
+	data, err := encodeHistory(records, maxHistoryConfigMapSize)
+	if err != nil {
+		return err
+	}
+	return s.put(historyStoreKey, data)
+}
+
+// get 读取ConfigMap中一个key的内容，ConfigMap不存在时为空
+func (s *ConfigMapRollbackStore) get(key string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	configMap, err := s.client.CoreV1().ConfigMaps(s.namespace).Get(ctx, s.name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取回滚状态ConfigMap失败: %v", err)
+	}
+	return []byte(configMap.Data[key]), nil
+}
+
+// put 写入ConfigMap中一个key的内容，其他key保持不变
+func (s *ConfigMapRollbackStore) put(key string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	configMaps := s.client.CoreV1().ConfigMaps(s.namespace)
+	configMap, err := configMaps.Get(ctx, s.name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		if len(data) == 0 {
+			return nil
+		}
+		configMap = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      s.name,
+				Namespace: s.namespace,
+				Labels: map[string]string{
+					"app":       "kun-gateway",
+					"component": "controlplane",
+				},
+			},
+			Data: map[string]string{key: string(data)},
+		}
+		if _, err := configMaps.Create(ctx, configMap, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("写入回滚状态ConfigMap失败: %v", err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("读取回滚状态ConfigMap失败: %v", err)
+	}
+
+	if configMap.Data == nil {
+		configMap.Data = make(map[string]string)
+	}
+	configMap.Data[key] = string(data)
+	if _, err := configMaps.Update(ctx, configMap, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("写入回滚状态ConfigMap失败: %v", err)
+	}
+	return nil
+}
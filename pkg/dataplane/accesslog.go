@@ -0,0 +1,560 @@
+package dataplane
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// 响应标记，用于说明请求未正常完成的原因
+const (
+	FlagNoRoute           = "NR" // 未匹配到路由
+	FlagNoHealthyUpstream = "UH" // 没有可用的上游服务
+	FlagInvalidUpstream   = "IU" // 上游引用无效
+	FlagUpstreamFailure   = "UF" // 上游请求失败
+	FlagInternalError     = "IE" // 网关内部错误
+	FlagDownstreamAbort   = "DC" // 向客户端写响应失败
+)
+
+// DefaultAccessLogFormat 默认的访问日志格式
+const DefaultAccessLogFormat = "json"
+
+// DefaultAccessLogTemplate 默认的文本访问日志模板
+const DefaultAccessLogTemplate = `${timestamp} ${client_ip} "${method} ${host}${path}" ${status} ${bytes_in} ${bytes_out} ${upstream_addr} ${upstream_latency_ms} ${latency_ms} ${route} ${flags} ${request_id}`
+
+// AccessLogEntry 访问日志记录
+type AccessLogEntry struct {
+	Timestamp       time.Time     `json:"timestamp"`
+	RequestID       string        `json:"request_id"`
+	Protocol        string        `json:"protocol"`
+	ClientIP        string        `json:"client_ip"`
+	Method          string        `json:"method"`
+	Host            string        `json:"host"`
+	Path            string        `json:"path"`
+	Status          int           `json:"status"`
+	BytesIn         int64         `json:"bytes_in"`
+	BytesOut        int64         `json:"bytes_out"`
+	Route           string        `json:"route"`
+	Upstream        string        `json:"upstream"`
+	UpstreamAddr    string        `json:"upstream_addr"`
+	UpstreamLatency time.Duration `json:"-"`
+	Latency         time.Duration `json:"-"`
+	Flags           []string      `json:"-"`
+	TraceID         string        `json:"trace_id,omitempty"`
+
+	// 采样率，由路由配置决定，0表示使用全局采样率
+	sampleRate float64
+	// 服务端Span，未开启链路追踪时为nil
+	span *Span
+}
+
+// AddFlag 添加响应标记
+func (e *AccessLogEntry) AddFlag(flag string) {
+	e.Flags = append(e.Flags, flag)
+}
+
+// flagString 响应标记的文本形式，无标记时为"-"
+func (e *AccessLogEntry) flagString() string {
+	if len(e.Flags) == 0 {
+		return "-"
+	}
+	return strings.Join(e.Flags, ",")
+}
+
+// MarshalJSON 延迟字段以毫秒输出
+func (e *AccessLogEntry) MarshalJSON() ([]byte, error) {
+	type alias AccessLogEntry
+	return json.Marshal(&struct {
+		*alias
+		UpstreamLatencyMs float64 `json:"upstream_latency_ms"`
+		LatencyMs         float64 `json:"latency_ms"`
+		Flags             string  `json:"flags"`
+	}{
+		alias:             (*alias)(e),
+		UpstreamLatencyMs: durationMs(e.UpstreamLatency),
+		LatencyMs:         durationMs(e.Latency),
+		Flags:             e.flagString(),
+	})
+}
+
+// field 按名称获取字段的文本值，用于模板格式
+func (e *AccessLogEntry) field(name string) string {
+	switch name {
+	case "timestamp":
+		return e.Timestamp.Format(time.RFC3339Nano)
+	case "request_id":
+		return e.RequestID
+	case "protocol":
+		return e.Protocol
+	case "client_ip":
+		return e.ClientIP
+	case "method":
+		return e.Method
+	case "host":
+		return e.Host
+	case "path":
+		return e.Path
+	case "status":
+		return strconv.Itoa(e.Status)
+	case "bytes_in":
+		return strconv.FormatInt(e.BytesIn, 10)
+	case "bytes_out":
+		return strconv.FormatInt(e.BytesOut, 10)
+	case "route":
+		return orDash(e.Route)
+	case "upstream":
+		return orDash(e.Upstream)
+	case "upstream_addr":
+		return orDash(e.UpstreamAddr)
+	case "upstream_latency_ms":
+		return strconv.FormatFloat(durationMs(e.UpstreamLatency), 'f', 3, 64)
+	case "latency_ms":
+		return strconv.FormatFloat(durationMs(e.Latency), 'f', 3, 64)
+	case "flags":
+		return e.flagString()
+	case "trace_id":
+		return orDash(e.TraceID)
+	default:
+		return "${" + name + "}"
+	}
+}
+
+// durationMs 将时长转换为毫秒
+func durationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// orDash 空值以"-"输出
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+// RouteAccessLog 路由级访问日志配置
+type RouteAccessLog struct {
+	Disabled   bool    `json:"disabled,omitempty"`
+	SampleRate float64 `json:"sample_rate,omitempty"` // 0~1，0表示使用全局采样率
+}
+
+// AccessLogConfig 访问日志配置
+type AccessLogConfig struct {
+	// Format 为"json"时输出JSON，否则作为 ${field} 形式的模板
+	Format string
+	// Sinks 输出目标：stdout、file:///path/to/access.log、udp://host:port、syslog://host:port
+	Sinks []string
+	// SampleRate 全局采样率，0~1
+	SampleRate float64
+	// BufferSize 异步队列长度，队列满时丢弃日志
+	BufferSize int
+	// MaxSizeMB 日志文件轮转大小
+	MaxSizeMB int
+	// MaxBackups 保留的历史日志文件数
+	MaxBackups int
+}
+
+// AccessLogger 异步访问日志记录器
+type AccessLogger struct {
+	config  AccessLogConfig
+	sinks   []accessLogSink
+	entries chan AccessLogEntry
+	dropped int64
+	done    chan struct{}
+	once    sync.Once
+	log     *logrus.Logger
+}
+
+// NewAccessLogger 创建访问日志记录器
+func NewAccessLogger(config AccessLogConfig, log *logrus.Logger) (*AccessLogger, error) {
+	if config.Format == "" {
+		config.Format = DefaultAccessLogFormat
+	}
+	if config.SampleRate <= 0 || config.SampleRate > 1 {
+		config.SampleRate = 1
+	}
+	if config.BufferSize <= 0 {
+		config.BufferSize = 8192
+	}
+	if config.MaxSizeMB <= 0 {
+		config.MaxSizeMB = 100
+	}
+	if config.MaxBackups <= 0 {
+		config.MaxBackups = 5
+	}
+
+	sinks := make([]accessLogSink, 0, len(config.Sinks))
+	for _, target := range config.Sinks {
+		sink, err := newAccessLogSink(strings.TrimSpace(target), config)
+		if err != nil {
+			for _, opened := range sinks {
+				opened.Close()
+			}
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+
+	al := &AccessLogger{
+		config:  config,
+		sinks:   sinks,
+		entries: make(chan AccessLogEntry, config.BufferSize),
+		done:    make(chan struct{}),
+		log:     log,
+	}
+	go al.run()
+
+	return al, nil
+}
+
+// Log 提交一条访问日志，不阻塞请求处理
+func (al *AccessLogger) Log(entry *AccessLogEntry) {
+	if al == nil {
+		return
+	}
+
+	rate := al.config.SampleRate
+	if entry.sampleRate > 0 {
+		rate = entry.sampleRate
+	}
+	if rate < 1 && rand.Float64() >= rate {
+		return
+	}
+
+	select {
+	case al.entries <- *entry:
+	default:
+		atomic.AddInt64(&al.dropped, 1)
+	}
+}
+
+// Dropped 因队列已满丢弃的日志数
+func (al *AccessLogger) Dropped() int64 {
+	return atomic.LoadInt64(&al.dropped)
+}
+
+// Close 写完队列中剩余的日志并关闭输出
+func (al *AccessLogger) Close() {
+	al.once.Do(func() {
+		close(al.entries)
+		<-al.done
+	})
+}
+
+// run 后台写日志，队列空闲或每秒刷新一次缓冲
+func (al *AccessLogger) run() {
+	defer close(al.done)
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	var line []byte
+	for {
+		select {
+		case entry, ok := <-al.entries:
+			if !ok {
+				al.flush()
+				for _, sink := range al.sinks {
+					sink.Close()
+				}
+				return
+			}
+
+			line = al.format(line[:0], &entry)
+			for _, sink := range al.sinks {
+				if err := sink.Write(line); err != nil {
+					al.log.Debugf("写访问日志失败: %v", err)
+				}
+			}
+
+			if len(al.entries) == 0 {
+				al.flush()
+			}
+		case <-ticker.C:
+			al.flush()
+		}
+	}
+}
+
+// flush 刷新所有输出的缓冲
+func (al *AccessLogger) flush() {
+	for _, sink := range al.sinks {
+		if err := sink.Flush(); err != nil {
+			al.log.Debugf("刷新访问日志失败: %v", err)
+		}
+	}
+}
+
+// format 按配置格式化一条日志，结果不含换行
+func (al *AccessLogger) format(buf []byte, entry *AccessLogEntry) []byte {
+	if al.config.Format == DefaultAccessLogFormat {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return append(buf, err.Error()...)
+		}
+		return append(buf, data...)
+	}
+	return append(buf, os.Expand(al.config.Format, entry.field)...)
+}
+
+// responseRecorder 记录写给客户端的状态码和字节数
+type responseRecorder struct {
+	http.ResponseWriter
+	status  int
+	bytes   int64
+	capture *limitedBuffer // 流量抓取时保留响应体开头部分，为nil时不保留
+}
+
+func (rr *responseRecorder) WriteHeader(statusCode int) {
+	rr.status = statusCode
+	rr.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (rr *responseRecorder) Write(p []byte) (int, error) {
+	n, err := rr.ResponseWriter.Write(p)
+	rr.bytes += int64(n)
+	if rr.capture != nil {
+		rr.capture.Write(p[:n])
+	}
+	return n, err
+}
+
+// Flush 支持流式响应
+func (rr *responseRecorder) Flush() {
+	if flusher, ok := rr.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// countingReader 统计读取的请求体字节数
+type countingReader struct {
+	io.ReadCloser
+	n       int64
+	capture *limitedBuffer // 流量抓取时保留请求体开头部分，为nil时不保留
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.ReadCloser.Read(p)
+	cr.n += int64(n)
+	if cr.capture != nil {
+		cr.capture.Write(p[:n])
+	}
+	return n, err
+}
+
+// accessLogSink 访问日志输出目标
+type accessLogSink interface {
+	Write(line []byte) error
+	Flush() error
+	Close() error
+}
+
+// newAccessLogSink 根据目标地址创建输出
+func newAccessLogSink(target string, config AccessLogConfig) (accessLogSink, error) {
+	switch {
+	case target == "stdout":
+		return &writerSink{w: bufio.NewWriterSize(os.Stdout, 64*1024)}, nil
+	case target == "stderr":
+		return &writerSink{w: bufio.NewWriterSize(os.Stderr, 64*1024)}, nil
+	case strings.HasPrefix(target, "file://"):
+		return newRotatingFileSink(strings.TrimPrefix(target, "file://"), config.MaxSizeMB, config.MaxBackups)
+	case strings.HasPrefix(target, "udp://"):
+		return newUDPSink(strings.TrimPrefix(target, "udp://"), false)
+	case strings.HasPrefix(target, "syslog://"):
+		return newUDPSink(strings.TrimPrefix(target, "syslog://"), true)
+	default:
+		return nil, fmt.Errorf("不支持的访问日志输出: %s", target)
+	}
+}
+
+// writerSink 带缓冲的标准输出
+type writerSink struct {
+	w *bufio.Writer
+}
+
+func (s *writerSink) Write(line []byte) error {
+	if _, err := s.w.Write(line); err != nil {
+		return err
+	}
+	return s.w.WriteByte('\n')
+}
+
+func (s *writerSink) Flush() error {
+	return s.w.Flush()
+}
+
+func (s *writerSink) Close() error {
+	return s.w.Flush()
+}
+
+// rotatingFileSink 按大小轮转的日志文件：access.log -> access.log.1 -> ... -> access.log.N
+type rotatingFileSink struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	w          *bufio.Writer
+	size       int64
+	// rotateAt 文件达到该大小时轮转，轮转失败后推迟到再写入maxSize字节
+	rotateAt int64
+}
+
+// newRotatingFileSink 创建轮转日志文件
+func newRotatingFileSink(path string, maxSizeMB, maxBackups int) (*rotatingFileSink, error) {
+	if path == "" {
+		return nil, fmt.Errorf("访问日志文件路径不能为空")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("创建访问日志目录失败: %v", err)
+	}
+
+	s := &rotatingFileSink{
+		path:       path,
+		maxSize:    int64(maxSizeMB) * 1024 * 1024,
+		maxBackups: maxBackups,
+	}
+	s.rotateAt = s.maxSize
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// open 以追加方式打开日志文件
+func (s *rotatingFileSink) open() error {
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("打开访问日志文件失败: %v", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("读取访问日志文件信息失败: %v", err)
+	}
+
+	s.file = file
+	s.size = info.Size()
+	s.w = bufio.NewWriterSize(file, 64*1024)
+	return nil
+}
+
+// rotate 轮转日志文件。关闭或重命名失败时重新打开原文件继续追加，由 Write 推迟下一次轮转
+func (s *rotatingFileSink) rotate() error {
+	if err := s.Close(); err != nil {
+		if openErr := s.open(); openErr != nil {
+			return fmt.Errorf("关闭访问日志文件失败: %v，重新打开失败: %v", err, openErr)
+		}
+		return err
+	}
+
+	os.Remove(fmt.Sprintf("%s.%d", s.path, s.maxBackups))
+	for i := s.maxBackups - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", s.path, i), fmt.Sprintf("%s.%d", s.path, i+1))
+	}
+	var renameErr error
+	if err := os.Rename(s.path, s.path+".1"); err != nil && !os.IsNotExist(err) {
+		renameErr = fmt.Errorf("轮转访问日志文件失败: %v", err)
+	}
+
+	if err := s.open(); err != nil {
+		return err
+	}
+	if renameErr == nil {
+		s.rotateAt = s.maxSize
+	}
+	return renameErr
+}
+
+// Write 写入一行，轮转失败时仍写入当前文件并返回轮转的错误
+func (s *rotatingFileSink) Write(line []byte) error {
+	var rotateErr error
+	if s.size+int64(len(line))+1 > s.rotateAt {
+		if rotateErr = s.rotate(); rotateErr != nil {
+			// 每行都重试会反复关闭、打开文件，再写入maxSize字节后才重试
+			s.rotateAt = s.size + s.maxSize
+		}
+	}
+
+	n, err := s.w.Write(line)
+	s.size += int64(n)
+	if err != nil {
+		return err
+	}
+	s.size++
+	if err := s.w.WriteByte('\n'); err != nil {
+		return err
+	}
+	return rotateErr
+}
+
+func (s *rotatingFileSink) Flush() error {
+	return s.w.Flush()
+}
+
+func (s *rotatingFileSink) Close() error {
+	if err := s.w.Flush(); err != nil {
+		s.file.Close()
+		return err
+	}
+	return s.file.Close()
+}
+
+// udpSink UDP输出，每条日志一个数据报；syslog模式下按RFC 5424添加头部
+type udpSink struct {
+	conn     io.WriteCloser
+	syslog   bool
+	hostname string
+	buf      []byte
+}
+
+// newUDPSink 创建UDP输出
+func newUDPSink(addr string, syslog bool) (*udpSink, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("连接访问日志UDP地址失败: %v", err)
+	}
+
+	hostname, _ := os.Hostname()
+	if hostname == "" {
+		hostname = "-"
+	}
+	return &udpSink{conn: conn, syslog: syslog, hostname: hostname}, nil
+}
+
+func (s *udpSink) Write(line []byte) error {
+	if !s.syslog {
+		_, err := s.conn.Write(line)
+		return err
+	}
+
+	// facility=local0(16) severity=info(6)
+	s.buf = append(s.buf[:0], "<134>1 "...)
+	s.buf = time.Now().AppendFormat(s.buf, time.RFC3339Nano)
+	s.buf = append(s.buf, ' ')
+	s.buf = append(s.buf, s.hostname...)
+	s.buf = append(s.buf, " kun-gateway - access - "...)
+	s.buf = append(s.buf, line...)
+	_, err := s.conn.Write(s.buf)
+	return err
+}
+
+func (s *udpSink) Flush() error {
+	return nil
+}
+
+func (s *udpSink) Close() error {
+	return s.conn.Close()
+}
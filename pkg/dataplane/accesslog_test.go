@@ -0,0 +1,73 @@
+package dataplane
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func readLines(t *testing.T, path string) []string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("读取 %s 失败: %v", path, err)
+	}
+	return strings.Fields(string(data))
+}
+
+func TestRotatingFileSinkRotate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	sink, err := newRotatingFileSink(path, 1, 2)
+	if err != nil {
+		t.Fatalf("创建日志文件失败: %v", err)
+	}
+	sink.maxSize, sink.rotateAt = 10, 10
+
+	for _, line := range []string{"aaaa", "bbbb", "cccc", "dddd", "eeee"} {
+		if err := sink.Write([]byte(line)); err != nil {
+			t.Fatalf("写入 %s 失败: %v", line, err)
+		}
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatalf("关闭日志文件失败: %v", err)
+	}
+
+	for file, want := range map[string]string{path: "eeee", path + ".1": "cccc dddd", path + ".2": "aaaa bbbb"} {
+		if got := strings.Join(readLines(t, file), " "); got != want {
+			t.Errorf("%s 的内容为 %q，期望 %q", file, got, want)
+		}
+	}
+}
+
+func TestRotatingFileSinkRotateFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	// access.log.1 是非空目录，删除和重命名都会失败
+	if err := os.MkdirAll(filepath.Join(path+".1", "keep"), 0755); err != nil {
+		t.Fatalf("创建目录失败: %v", err)
+	}
+	sink, err := newRotatingFileSink(path, 1, 1)
+	if err != nil {
+		t.Fatalf("创建日志文件失败: %v", err)
+	}
+	sink.maxSize, sink.rotateAt = 10, 10
+
+	var rotateErrors int
+	lines := []string{"aaaa", "bbbb", "cccc", "dddd", "eeee", "ffff"}
+	for _, line := range lines {
+		if err := sink.Write([]byte(line)); err != nil {
+			rotateErrors++
+		}
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatalf("关闭日志文件失败: %v", err)
+	}
+
+	if got := readLines(t, path); strings.Join(got, " ") != strings.Join(lines, " ") {
+		t.Errorf("轮转失败后日志应继续写入原文件，内容为 %v", got)
+	}
+	// 第3行触发轮转失败，之后推迟到再写入10字节（第5行）才重试
+	if rotateErrors != 2 {
+		t.Errorf("轮转失败 %d 次，期望 2 次", rotateErrors)
+	}
+}
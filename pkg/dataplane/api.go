@@ -1,7 +1,10 @@
 package dataplane
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -42,8 +45,14 @@ func (api *APIServer) Start(addr string) error {
 
 	// 监控指标API
 	r.GET("/api/v1/metrics", api.getMetrics)
+	r.GET("/api/v1/metrics/latency", api.getLatency)
+	r.GET("/api/v1/metrics/series", api.getMetricsSeries)
+	r.GET("/metrics", api.getPrometheusMetrics)
 	r.GET("/api/v1/health", api.healthCheck)
 
+	// 实时流量抓取API
+	r.GET("/api/v1/tap", api.tap)
+
 	api.log.Infof("数据面API服务器启动，监听地址: %s", addr)
 	return r.Run(addr)
 }
@@ -51,6 +60,8 @@ func (api *APIServer) Start(addr string) error {
 // RouteUpdateRequest 路由更新请求
 type RouteUpdateRequest struct {
 	Routes []*RouteRule `json:"routes"`
+	// Version 控制面生成的配置版本，通过健康检查和路由查询返回，用于确认各数据面已应用的配置
+	Version string `json:"version,omitempty"`
 }
 
 // RouteUpdateResponse 路由更新响应
@@ -58,6 +69,7 @@ type RouteUpdateResponse struct {
 	Success bool   `json:"success"`
 	Message string `json:"message"`
 	Count   int    `json:"count"`
+	Version string `json:"version,omitempty"`
 }
 
 // updateRoutes 更新路由规则
@@ -73,29 +85,30 @@ func (api *APIServer) updateRoutes(c *gin.Context) {
 
 	api.log.Infof("收到路由更新请求，规则数量: %d", len(req.Routes))
 
+	// 控制面按节点标签解析的可用区，用于拓扑感知路由
+	api.proxy.SetNodeZone(c.Query("zone"))
+
 	// 原子更新路由规则
-	api.router.UpdateRules(req.Routes)
+	api.router.UpdateRulesWithVersion(req.Routes, req.Version)
 
 	c.JSON(http.StatusOK, RouteUpdateResponse{
 		Success: true,
 		Message: "路由规则更新成功",
 		Count:   len(req.Routes),
+		Version: req.Version,
 	})
 }
 
 // getRoutes 获取当前路由规则
 func (api *APIServer) getRoutes(c *gin.Context) {
-	table := api.router.rules.Load().(*RouteTable)
-
-	rules := make([]*RouteRule, 0, len(table.Rules))
-	for _, rule := range table.Rules {
-		rules = append(rules, rule)
-	}
+	rules := api.router.Rules()
+	version, _ := api.router.Version()
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"routes":  rules,
 		"count":   len(rules),
+		"version": version,
 	})
 }
 
@@ -114,20 +127,191 @@ func (api *APIServer) getMetrics(c *gin.Context) {
 	})
 }
 
+// getLatency 获取各维度的延迟分位数，histograms=true时附带原始直方图以便跨节点合并
+func (api *APIServer) getLatency(c *gin.Context) {
+	histograms := api.proxy.GetMetrics().LatencyHistograms()
+
+	response := gin.H{
+		"success": true,
+		"latency": histograms.Report(),
+	}
+	if c.Query("histograms") == "true" {
+		response["histograms"] = histograms
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// getMetricsSeries 查询时间序列，参数: metric(默认qps)、domain(为空时为全部请求)、window(默认1h)
+func (api *APIServer) getMetricsSeries(c *gin.Context) {
+	window, err := time.ParseDuration(c.DefaultQuery("window", "1h"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "时间窗口格式错误: " + err.Error(),
+		})
+		return
+	}
+
+	result, err := api.proxy.GetMetrics().QueryTimeSeries(c.DefaultQuery("metric", SeriesQPS), c.Query("domain"), window)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"series":  result,
+	})
+}
+
+// tapKeepalive SSE保活间隔，避免中间代理断开空闲连接
+const tapKeepalive = 15 * time.Second
+
+// tap 以SSE推送匹配的请求摘要，到达duration（默认1m，最长10m）或客户端断开时结束。
+// 参数: host、path_prefix、status(如502或5xx)、client_ip、sample_rate、headers、raw_headers、body_bytes、duration
+func (api *APIServer) tap(c *gin.Context) {
+	filter, duration, err := parseTapQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	taps := api.proxy.Taps()
+	session, err := taps.Subscribe(filter, duration)
+	if err != nil {
+		status := http.StatusTooManyRequests
+		if errors.Is(err, ErrTapRawHeadersDisabled) {
+			status = http.StatusForbidden
+		}
+		c.JSON(status, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	defer taps.Unsubscribe(session)
+
+	api.log.Infof("开始流量抓取 #%d，过滤条件: %+v，截止: %s", session.ID, filter, session.ExpiresAt.Format(time.RFC3339))
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	c.SSEvent("start", gin.H{
+		"id":         session.ID,
+		"filter":     session.Filter,
+		"expires_at": session.ExpiresAt,
+	})
+	c.Writer.Flush()
+
+	expired := time.NewTimer(time.Until(session.ExpiresAt))
+	defer expired.Stop()
+	keepalive := time.NewTicker(tapKeepalive)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case event := <-session.Events:
+			c.SSEvent("request", event)
+			c.Writer.Flush()
+		case <-keepalive.C:
+			c.Writer.WriteString(": keepalive\n\n")
+			c.Writer.Flush()
+		case <-expired.C:
+			c.SSEvent("end", gin.H{
+				"reason":  "expired",
+				"dropped": session.Dropped(),
+			})
+			c.Writer.Flush()
+			api.log.Infof("流量抓取 #%d 已到期结束，丢弃事件: %d", session.ID, session.Dropped())
+			return
+		case <-c.Request.Context().Done():
+			api.log.Infof("流量抓取 #%d 客户端已断开，丢弃事件: %d", session.ID, session.Dropped())
+			return
+		}
+	}
+}
+
+// parseTapQuery 解析流量抓取的查询参数
+func parseTapQuery(c *gin.Context) (TapFilter, time.Duration, error) {
+	filter := TapFilter{
+		Host:       c.Query("host"),
+		PathPrefix: c.Query("path_prefix"),
+		Status:     c.Query("status"),
+		ClientIP:   c.Query("client_ip"),
+	}
+
+	var err error
+	if value := c.Query("sample_rate"); value != "" {
+		if filter.SampleRate, err = strconv.ParseFloat(value, 64); err != nil {
+			return filter, 0, fmt.Errorf("采样率格式错误: %v", err)
+		}
+	}
+	if value := c.Query("headers"); value != "" {
+		if filter.Headers, err = strconv.ParseBool(value); err != nil {
+			return filter, 0, fmt.Errorf("headers参数格式错误: %v", err)
+		}
+	}
+	if value := c.Query("raw_headers"); value != "" {
+		if filter.RawHeaders, err = strconv.ParseBool(value); err != nil {
+			return filter, 0, fmt.Errorf("raw_headers参数格式错误: %v", err)
+		}
+	}
+	if value := c.Query("body_bytes"); value != "" {
+		if filter.BodyBytes, err = strconv.Atoi(value); err != nil {
+			return filter, 0, fmt.Errorf("body_bytes参数格式错误: %v", err)
+		}
+	}
+
+	duration := DefaultTapDuration
+	if value := c.Query("duration"); value != "" {
+		if duration, err = time.ParseDuration(value); err != nil {
+			return filter, 0, fmt.Errorf("抓取时长格式错误: %v", err)
+		}
+	}
+
+	return filter, duration, filter.Validate()
+}
+
+// getPrometheusMetrics 以Prometheus文本格式输出监控指标
+func (api *APIServer) getPrometheusMetrics(c *gin.Context) {
+	c.Header("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	c.Status(http.StatusOK)
+
+	if err := api.proxy.WritePrometheus(c.Writer); err != nil {
+		api.log.Errorf("输出Prometheus指标失败: %v", err)
+	}
+}
+
 // healthCheck 健康检查
 func (api *APIServer) healthCheck(c *gin.Context) {
+	version, updatedAt := api.router.Version()
 	c.JSON(http.StatusOK, gin.H{
 		"status":    "healthy",
 		"timestamp": time.Now().Unix(),
 		"service":   "dataplane",
+		// config_version 已应用的配置版本，控制面据此判断数据面是否需要重新推送（如重启后）
+		"config_version":    version,
+		"config_updated_at": updatedAt,
 	})
 }
 
 // CertificateRequest 证书请求
+// 证书可以通过本机文件路径或PEM内容提供
 type CertificateRequest struct {
 	Domain   string `json:"domain" binding:"required"`
-	CertFile string `json:"cert_file" binding:"required"`
-	KeyFile  string `json:"key_file" binding:"required"`
+	CertFile string `json:"cert_file"`
+	KeyFile  string `json:"key_file"`
+	CertPEM  string `json:"cert_pem"`
+	KeyPEM   string `json:"key_pem"`
 }
 
 // addCertificate 添加HTTPS证书
@@ -144,7 +328,19 @@ func (api *APIServer) addCertificate(c *gin.Context) {
 	api.log.Infof("添加HTTPS证书，域名: %s", req.Domain)
 
 	// 添加证书到代理服务器
-	err := api.proxy.AddCertificate(req.Domain, req.CertFile, req.KeyFile)
+	var err error
+	switch {
+	case req.CertPEM != "" && req.KeyPEM != "":
+		err = api.proxy.AddCertificatePEM(req.Domain, []byte(req.CertPEM), []byte(req.KeyPEM))
+	case req.CertFile != "" && req.KeyFile != "":
+		err = api.proxy.AddCertificate(req.Domain, req.CertFile, req.KeyFile)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "请求参数错误: 需要提供 cert_file/key_file 或 cert_pem/key_pem",
+		})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
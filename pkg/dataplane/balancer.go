@@ -0,0 +1,173 @@
+package dataplane
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// defaultAffinityTimeout 未指定会话保持时长时使用的默认值，与K8s Service一致（3小时）
+	defaultAffinityTimeout = 3 * time.Hour
+	// affinitySweepInterval 清理过期会话的间隔
+	affinitySweepInterval = time.Minute
+)
+
+// Balancer 为请求选择上游地址：新请求在就绪地址间轮询；ClientIP会话保持的请求沿用之前的地址，
+// 即使该地址已进入终止流程，直到它从上游中移除；没有就绪地址时使用正在终止但仍能处理请求的地址。
+// 上游配置了拓扑感知路由时，优先在数据面所在节点、可用区的地址间轮询
+type Balancer struct {
+	// counters 各上游的轮询计数，key: 上游名称:端口，拓扑感知的上游每一级单独计数
+	counters sync.Map
+	// inflight 各地址处理中的请求数，key: 地址。归零时删除，Pod更替后不会一直累积
+	inflight   map[string]int64
+	inflightMu sync.Mutex
+	// picks 拓扑感知的上游在各级选择的次数
+	picks sync.Map
+	// node、zone 数据面所在的节点和可用区（启动参数）
+	node string
+	zone string
+	// nodeZone 控制面按节点标签下发的可用区（string），zone为空时使用
+	nodeZone atomic.Value
+	// sessions 会话保持的记录
+	sessions  map[affinityKey]affinityEntry
+	lastSweep time.Time
+	mu        sync.Mutex
+}
+
+type affinityKey struct {
+	upstream string
+	clientIP string
+}
+
+type affinityEntry struct {
+	address string
+	expires time.Time
+}
+
+// NewBalancer 创建负载均衡器
+func NewBalancer() *Balancer {
+	return &Balancer{
+		inflight:  make(map[string]int64),
+		sessions:  make(map[affinityKey]affinityEntry),
+		lastSweep: time.Now(),
+	}
+}
+
+// SetLocality 设置数据面所在的节点和可用区，需在处理请求前调用；zone为空时使用控制面下发的可用区，
+// 控制面也没有下发时按本节点上Pod的可用区推断
+func (b *Balancer) SetLocality(node, zone string) {
+	b.node = node
+	b.zone = zone
+}
+
+// SetNodeZone 设置控制面按节点标签解析的可用区，返回是否有变化
+func (b *Balancer) SetNodeZone(zone string) bool {
+	previous, _ := b.nodeZone.Swap(zone).(string)
+	return previous != zone
+}
+
+// Pick 选择转发的地址，没有可用地址时返回false；选择成功后请求结束时需要调用Done
+func (b *Balancer) Pick(upstream *Upstream, clientIP string) (string, bool) {
+	address, ok := b.pick(upstream, clientIP)
+	if ok {
+		b.inflightMu.Lock()
+		b.inflight[address]++
+		b.inflightMu.Unlock()
+	}
+	return address, ok
+}
+
+// Done 请求结束，减少地址处理中的请求数
+func (b *Balancer) Done(address string) {
+	b.inflightMu.Lock()
+	defer b.inflightMu.Unlock()
+	if n := b.inflight[address] - 1; n > 0 {
+		b.inflight[address] = n
+	} else {
+		delete(b.inflight, address)
+	}
+}
+
+// counter 增加计数并返回新值
+func (b *Balancer) counter(counters *sync.Map, key interface{}, delta int64) int64 {
+	value, ok := counters.Load(key)
+	if !ok {
+		value, _ = counters.LoadOrStore(key, new(int64))
+	}
+	return atomic.AddInt64(value.(*int64), delta)
+}
+
+// pick 选择转发的地址
+func (b *Balancer) pick(upstream *Upstream, clientIP string) (string, bool) {
+	if len(upstream.Addresses) == 0 && len(upstream.DrainingAddresses) == 0 {
+		return "", false
+	}
+	key := fmt.Sprintf("%s:%d", upstream.Name, upstream.Port)
+	if upstream.SessionAffinity != SessionAffinityClientIP || clientIP == "" {
+		return b.next(key, upstream), true
+	}
+
+	timeout := defaultAffinityTimeout
+	if upstream.AffinityTimeout > 0 {
+		timeout = time.Duration(upstream.AffinityTimeout) * time.Second
+	}
+
+	now := time.Now()
+	session := affinityKey{upstream: key, clientIP: clientIP}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if entry, ok := b.sessions[session]; ok && now.Before(entry.expires) &&
+		(containsAddress(upstream.Addresses, entry.address) || containsAddress(upstream.DrainingAddresses, entry.address)) {
+		entry.expires = now.Add(timeout)
+		b.sessions[session] = entry
+		return entry.address, true
+	}
+
+	address := b.next(key, upstream)
+	b.sessions[session] = affinityEntry{address: address, expires: now.Add(timeout)}
+	if now.Sub(b.lastSweep) >= affinitySweepInterval {
+		b.sweepLocked(now)
+	}
+	return address, true
+}
+
+// next 轮询选择就绪地址，没有就绪地址时轮询正在终止的地址
+func (b *Balancer) next(key string, upstream *Upstream) string {
+	addresses := upstream.Addresses
+	if len(addresses) == 0 {
+		addresses = upstream.DrainingAddresses
+	} else if upstream.Topology != nil {
+		var level string
+		addresses, level = b.preferLocal(upstream)
+		b.counter(&b.picks, topologyPick{upstream: upstream.Name, level: level}, 1)
+		key += "/" + level
+	}
+
+	value, _ := b.counters.LoadOrStore(key, new(uint64))
+	n := atomic.AddUint64(value.(*uint64), 1)
+	return addresses[(n-1)%uint64(len(addresses))]
+}
+
+// sweepLocked 清理过期的会话
+func (b *Balancer) sweepLocked(now time.Time) {
+	for session, entry := range b.sessions {
+		if !now.Before(entry.expires) {
+			delete(b.sessions, session)
+		}
+	}
+	b.lastSweep = now
+}
+
+// containsAddress 判断地址列表中是否包含指定地址
+func containsAddress(addresses []string, address string) bool {
+	for _, a := range addresses {
+		if a == address {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,282 @@
+package dataplane
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"kun-gateway/pkg/proto"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// configStreamMinBackoff、configStreamMaxBackoff 订阅断开后重连的退避时间
+	configStreamMinBackoff = time.Second
+	configStreamMaxBackoff = 30 * time.Second
+	// ConfigStreamKeepalive 订阅连接的保活间隔，控制面需允许该频率的ping
+	ConfigStreamKeepalive = 30 * time.Second
+	// DefaultServiceAccountTokenFile Pod中挂载的ServiceAccount令牌，订阅时携带给控制面校验
+	DefaultServiceAccountTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+)
+
+// ConfigStreamOptions 订阅连接的安全选项
+type ConfigStreamOptions struct {
+	// CAFile 校验控制面证书的CA，设置后使用TLS连接控制面
+	CAFile string
+	// TokenFile ServiceAccount令牌文件，每次订阅时重新读取以使用轮换后的令牌，为空或不存在时不携带
+	TokenFile string
+}
+
+// RouteResource 通过gRPC下发的路由资源。上游作为独立的集群资源下发，
+// 端点变化时只需下发集群；Clusters 为路由按顺序引用的集群名称
+type RouteResource struct {
+	*RouteRule
+	Clusters []string `json:"clusters"`
+}
+
+// ClusterName 路由中上游对应的集群资源名称
+func ClusterName(rule *RouteRule, upstream string) string {
+	return rule.Key() + "#" + upstream
+}
+
+// ConfigStreamClient 通过gRPC长连接从控制面订阅配置（DataPlaneService.StreamConfig），
+// 应用收到的全量或增量快照并回复ACK/NACK，断开后自动重连
+type ConfigStreamClient struct {
+	addr    string
+	node    *proto.Node
+	options ConfigStreamOptions
+	router  *Router
+	proxy   *Proxy
+	log     *logrus.Logger
+
+	// 已应用的配置，只在订阅协程中访问
+	version      string
+	routes       map[string]*proto.Resource
+	clusters     map[string]*proto.Resource
+	certificates map[string]*proto.Resource
+}
+
+// NewConfigStreamClient 创建配置订阅客户端，addr为控制面gRPC地址（host:port）
+func NewConfigStreamClient(addr string, node *proto.Node, options ConfigStreamOptions, router *Router, proxy *Proxy, log *logrus.Logger) *ConfigStreamClient {
+	return &ConfigStreamClient{
+		addr:         addr,
+		node:         node,
+		options:      options,
+		router:       router,
+		proxy:        proxy,
+		log:          log,
+		routes:       make(map[string]*proto.Resource),
+		clusters:     make(map[string]*proto.Resource),
+		certificates: make(map[string]*proto.Resource),
+	}
+}
+
+// Run 订阅配置直到ctx取消，连接断开后按指数退避重连，重连后控制面会立即下发当前配置
+func (c *ConfigStreamClient) Run(ctx context.Context) error {
+	creds := insecure.NewCredentials()
+	if c.options.CAFile != "" {
+		var err error
+		if creds, err = credentials.NewClientTLSFromFile(c.options.CAFile, ""); err != nil {
+			return fmt.Errorf("加载控制面CA证书失败: %v", err)
+		}
+	} else {
+		c.log.Warn("没有设置控制面CA证书，配置订阅不加密")
+	}
+	conn, err := grpc.DialContext(ctx, c.addr,
+		grpc.WithTransportCredentials(creds),
+		grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                ConfigStreamKeepalive,
+			Timeout:             10 * time.Second,
+			PermitWithoutStream: true,
+		}),
+	)
+	if err != nil {
+		return fmt.Errorf("连接控制面 %s 失败: %v", c.addr, err)
+	}
+	defer conn.Close()
+
+	client := proto.NewDataPlaneServiceClient(conn)
+	backoff := configStreamMinBackoff
+	for {
+		started := time.Now()
+		err := c.subscribe(ctx, client)
+		if ctx.Err() != nil {
+			return nil
+		}
+		// 连接保持过一段时间后断开的，从最小退避重新开始
+		if time.Since(started) > configStreamMaxBackoff {
+			backoff = configStreamMinBackoff
+		}
+		c.log.Warnf("配置订阅断开，%v 后重连: %v", backoff, err)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > configStreamMaxBackoff {
+			backoff = configStreamMaxBackoff
+		}
+	}
+}
+
+// subscribe 建立一次订阅，应用收到的每个快照并回复，连接断开时返回
+func (c *ConfigStreamClient) subscribe(ctx context.Context, client proto.DataPlaneServiceClient) error {
+	if c.options.TokenFile != "" {
+		token, err := os.ReadFile(c.options.TokenFile)
+		if err == nil {
+			ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+strings.TrimSpace(string(token)))
+		} else if !os.IsNotExist(err) {
+			c.log.Warnf("读取ServiceAccount令牌失败: %v", err)
+		}
+	}
+	stream, err := client.StreamConfig(ctx, grpc.WaitForReady(true))
+	if err != nil {
+		return err
+	}
+	if err := stream.Send(&proto.ConfigRequest{Node: c.node, VersionInfo: c.version}); err != nil {
+		return err
+	}
+	c.log.Infof("已向控制面 %s 订阅配置，当前版本 %q", c.addr, c.version)
+
+	for {
+		snapshot, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+
+		reply := &proto.ConfigRequest{ResponseNonce: snapshot.Nonce}
+		if err := c.apply(snapshot); err != nil {
+			c.log.Errorf("拒绝配置版本 %s: %v", snapshot.Version, err)
+			reply.ErrorDetail = err.Error()
+		}
+		reply.VersionInfo = c.version
+		if err := stream.Send(reply); err != nil {
+			return err
+		}
+	}
+}
+
+// apply 应用配置快照。所有资源解析成功后才更新路由表，失败时保留之前的配置
+func (c *ConfigStreamClient) apply(snapshot *proto.ConfigSnapshot) error {
+	if snapshot.Delta && snapshot.BaseVersion != c.version {
+		return fmt.Errorf("增量配置的基础版本 %s 与当前版本 %s 不一致", snapshot.BaseVersion, c.version)
+	}
+
+	routes := mergeResources(c.routes, snapshot.Routes, snapshot.RemovedRoutes, snapshot.Delta)
+	clusters := mergeResources(c.clusters, snapshot.Clusters, snapshot.RemovedClusters, snapshot.Delta)
+	certificates := mergeResources(c.certificates, snapshot.Certificates, snapshot.RemovedCertificates, snapshot.Delta)
+
+	rules, err := assembleRules(snapshot.RouteOrder, routes, clusters)
+	if err != nil {
+		return err
+	}
+
+	// 先加载新增或变化的证书，路由生效时HTTPS已可用
+	for name, resource := range certificates {
+		if applied, ok := c.certificates[name]; ok && applied.Version == resource.Version {
+			continue
+		}
+		if err := c.addCertificate(resource); err != nil {
+			return fmt.Errorf("加载证书 %s 失败: %v", name, err)
+		}
+	}
+
+	c.proxy.SetNodeZone(snapshot.Zone)
+	c.router.UpdateRulesWithVersion(rules, snapshot.Version)
+
+	for name := range c.certificates {
+		if _, ok := certificates[name]; !ok {
+			c.proxy.RemoveCertificate(name)
+		}
+	}
+
+	c.version = snapshot.Version
+	c.routes, c.clusters, c.certificates = routes, clusters, certificates
+	if snapshot.Delta {
+		c.log.Infof("已应用增量配置 %s（第 %d 版）：%d 个路由、%d 个集群、%d 个证书变化，删除 %d 个资源",
+			snapshot.Version, snapshot.Generation, len(snapshot.Routes), len(snapshot.Clusters), len(snapshot.Certificates),
+			len(snapshot.RemovedRoutes)+len(snapshot.RemovedClusters)+len(snapshot.RemovedCertificates))
+	} else {
+		c.log.Infof("已应用全量配置 %s（第 %d 版）：%d 个路由、%d 个集群、%d 个证书",
+			snapshot.Version, snapshot.Generation, len(routes), len(clusters), len(certificates))
+	}
+	return nil
+}
+
+// addCertificate 加载证书资源，资源内容与REST API的证书请求相同
+func (c *ConfigStreamClient) addCertificate(resource *proto.Resource) error {
+	var req CertificateRequest
+	if err := json.Unmarshal(resource.Body, &req); err != nil {
+		return fmt.Errorf("解析证书失败: %v", err)
+	}
+	switch {
+	case req.CertPEM != "" && req.KeyPEM != "":
+		return c.proxy.AddCertificatePEM(resource.Name, []byte(req.CertPEM), []byte(req.KeyPEM))
+	case req.CertFile != "" && req.KeyFile != "":
+		return c.proxy.AddCertificate(resource.Name, req.CertFile, req.KeyFile)
+	default:
+		return fmt.Errorf("需要提供 cert_file/key_file 或 cert_pem/key_pem")
+	}
+}
+
+// mergeResources 返回应用快照后的资源集合：全量快照直接替换，增量快照在当前资源上更新和删除
+func mergeResources(current map[string]*proto.Resource, updated []*proto.Resource, removed []string, delta bool) map[string]*proto.Resource {
+	merged := make(map[string]*proto.Resource, len(current)+len(updated))
+	if delta {
+		for name, resource := range current {
+			merged[name] = resource
+		}
+		for _, name := range removed {
+			delete(merged, name)
+		}
+	}
+	for _, resource := range updated {
+		merged[resource.Name] = resource
+	}
+	return merged
+}
+
+// assembleRules 按顺序把路由资源和引用的集群组装为路由规则，引用的集群不存在时返回错误
+func assembleRules(order []string, routes, clusters map[string]*proto.Resource) ([]*RouteRule, error) {
+	if len(order) != len(routes) {
+		return nil, fmt.Errorf("路由顺序包含 %d 个路由，实际有 %d 个", len(order), len(routes))
+	}
+
+	rules := make([]*RouteRule, 0, len(order))
+	for _, name := range order {
+		resource, ok := routes[name]
+		if !ok {
+			return nil, fmt.Errorf("路由 %s 不存在", name)
+		}
+		route := RouteResource{RouteRule: &RouteRule{}}
+		if err := json.Unmarshal(resource.Body, &route); err != nil {
+			return nil, fmt.Errorf("解析路由 %s 失败: %v", name, err)
+		}
+
+		route.Upstreams = make([]Upstream, 0, len(route.Clusters))
+		for _, clusterName := range route.Clusters {
+			cluster, ok := clusters[clusterName]
+			if !ok {
+				return nil, fmt.Errorf("路由 %s 引用的集群 %s 不存在", name, clusterName)
+			}
+			var upstream Upstream
+			if err := json.Unmarshal(cluster.Body, &upstream); err != nil {
+				return nil, fmt.Errorf("解析集群 %s 失败: %v", clusterName, err)
+			}
+			route.Upstreams = append(route.Upstreams, upstream)
+		}
+		rules = append(rules, route.RouteRule)
+	}
+
+	return rules, nil
+}
@@ -0,0 +1,125 @@
+package dataplane
+
+import (
+	"strings"
+)
+
+// HeaderOperations Header操作，按 删除 -> 设置 -> 追加 的顺序执行
+type HeaderOperations struct {
+	Set    map[string]string `json:"set,omitempty"`    // 覆盖设置
+	Add    map[string]string `json:"add,omitempty"`    // 追加，不覆盖已有值
+	Remove []string          `json:"remove,omitempty"` // 删除
+}
+
+// headerWriter 请求/响应头的写接口，同时适配 http.Header 与 fasthttp 的Header
+type headerWriter interface {
+	Set(key, value string)
+	Add(key, value string)
+	Del(key string)
+}
+
+// HeaderVars Header模板变量，值中可以使用 ${client_ip} ${route} ${upstream} ${upstream_addr} ${request_id} ${host}
+type HeaderVars struct {
+	ClientIP     string
+	Route        string
+	Upstream     string
+	UpstreamAddr string
+	RequestID    string
+	Host         string
+}
+
+// Expand 展开值中的模板变量，支持 ${name} 和 $name 两种写法；未知变量和单独的 $ 保持原样
+func (v *HeaderVars) Expand(value string) string {
+	if !strings.Contains(value, "$") {
+		return value
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(value); {
+		if value[i] != '$' {
+			b.WriteByte(value[i])
+			i++
+			continue
+		}
+
+		// ${name}
+		if i+1 < len(value) && value[i+1] == '{' {
+			if end := strings.IndexByte(value[i+2:], '}'); end >= 0 {
+				if expanded, ok := v.lookup(value[i+2 : i+2+end]); ok {
+					b.WriteString(expanded)
+					i += end + 3
+					continue
+				}
+			}
+			b.WriteByte('$')
+			i++
+			continue
+		}
+
+		// $name
+		end := i + 1
+		for end < len(value) && isVarByte(value[end]) {
+			end++
+		}
+		if expanded, ok := v.lookup(value[i+1 : end]); ok {
+			b.WriteString(expanded)
+		} else {
+			b.WriteString(value[i:end])
+		}
+		i = end
+	}
+	return b.String()
+}
+
+// lookup 返回变量的值，未知变量返回false
+func (v *HeaderVars) lookup(name string) (string, bool) {
+	switch name {
+	case "client_ip":
+		return v.ClientIP, true
+	case "route":
+		return v.Route, true
+	case "upstream":
+		return v.Upstream, true
+	case "upstream_addr":
+		return v.UpstreamAddr, true
+	case "request_id":
+		return v.RequestID, true
+	case "host":
+		return v.Host, true
+	default:
+		return "", false
+	}
+}
+
+func isVarByte(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// Apply 对Header执行操作
+func (ops *HeaderOperations) Apply(header headerWriter, vars *HeaderVars) {
+	if ops == nil {
+		return
+	}
+
+	for _, key := range ops.Remove {
+		header.Del(key)
+	}
+	for key, value := range ops.Set {
+		header.Set(key, vars.Expand(value))
+	}
+	for key, value := range ops.Add {
+		header.Add(key, vars.Expand(value))
+	}
+}
+
+// applyRequestHeaders 依次执行路由级和上游级的请求头操作
+func applyRequestHeaders(header headerWriter, rule *RouteRule, upstream *Upstream, vars *HeaderVars) {
+	rule.RequestHeaders.Apply(header, vars)
+	upstream.RequestHeaders.Apply(header, vars)
+}
+
+// applyResponseHeaders 依次执行路由级和上游级的响应头操作
+func applyResponseHeaders(header headerWriter, rule *RouteRule, upstream *Upstream, vars *HeaderVars) {
+	rule.ResponseHeaders.Apply(header, vars)
+	upstream.ResponseHeaders.Apply(header, vars)
+}
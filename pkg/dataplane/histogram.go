@@ -0,0 +1,269 @@
+package dataplane
+
+import (
+	"math"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// 直方图分桶：以1µs为起点，每个2倍区间再细分为histogramSubBuckets个对数桶，
+// 相对误差约4.4%，覆盖到约2^histogramOctaves微秒（约19分钟）。
+// 所有节点使用相同的分桶布局，因此直方图可以直接按桶相加合并。
+const (
+	histogramSubBuckets = 16
+	histogramOctaves    = 30
+	histogramBuckets    = histogramSubBuckets*histogramOctaves + 1 // 最后一个桶收纳超出范围的值
+)
+
+// bucketIndex 计算延迟所在的桶
+func bucketIndex(d time.Duration) int {
+	us := float64(d) / float64(time.Microsecond)
+	if us <= 1 {
+		return 0
+	}
+	index := int(math.Log2(us) * histogramSubBuckets)
+	if index >= histogramBuckets {
+		return histogramBuckets - 1
+	}
+	return index
+}
+
+// bucketUpperBound 桶的上界
+func bucketUpperBound(index int) time.Duration {
+	us := math.Exp2(float64(index+1) / histogramSubBuckets)
+	return time.Duration(us * float64(time.Microsecond))
+}
+
+// LatencyHistogram 并发安全的延迟直方图
+type LatencyHistogram struct {
+	counts [histogramBuckets]uint64
+	count  uint64
+	sum    int64 // 纳秒
+	min    int64 // 纳秒，count为0时无意义
+	max    int64 // 纳秒
+}
+
+// NewLatencyHistogram 创建延迟直方图
+func NewLatencyHistogram() *LatencyHistogram {
+	return &LatencyHistogram{min: math.MaxInt64}
+}
+
+// Record 记录一次延迟
+func (h *LatencyHistogram) Record(d time.Duration) {
+	ns := d.Nanoseconds()
+	if ns < 0 {
+		ns = 0
+	}
+
+	atomic.AddUint64(&h.counts[bucketIndex(d)], 1)
+	atomic.AddInt64(&h.sum, ns)
+	atomic.AddUint64(&h.count, 1)
+
+	for {
+		old := atomic.LoadInt64(&h.min)
+		if ns >= old || atomic.CompareAndSwapInt64(&h.min, old, ns) {
+			break
+		}
+	}
+	for {
+		old := atomic.LoadInt64(&h.max)
+		if ns <= old || atomic.CompareAndSwapInt64(&h.max, old, ns) {
+			break
+		}
+	}
+}
+
+// reset 清空直方图
+func (h *LatencyHistogram) reset() {
+	for i := range h.counts {
+		atomic.StoreUint64(&h.counts[i], 0)
+	}
+	atomic.StoreUint64(&h.count, 0)
+	atomic.StoreInt64(&h.sum, 0)
+	atomic.StoreInt64(&h.min, math.MaxInt64)
+	atomic.StoreInt64(&h.max, 0)
+}
+
+// Snapshot 获取直方图快照
+func (h *LatencyHistogram) Snapshot() *HistogramSnapshot {
+	snap := &HistogramSnapshot{
+		Count:   atomic.LoadUint64(&h.count),
+		SumNs:   atomic.LoadInt64(&h.sum),
+		MinNs:   atomic.LoadInt64(&h.min),
+		MaxNs:   atomic.LoadInt64(&h.max),
+		Buckets: make(map[int]uint64),
+	}
+	for i := range h.counts {
+		if n := atomic.LoadUint64(&h.counts[i]); n > 0 {
+			snap.Buckets[i] = n
+		}
+	}
+	if snap.Count == 0 {
+		snap.MinNs = 0
+	}
+	return snap
+}
+
+// HistogramSnapshot 直方图快照，稀疏存储非零桶，可序列化后在控制面合并
+type HistogramSnapshot struct {
+	Count   uint64         `json:"count"`
+	SumNs   int64          `json:"sum_ns"`
+	MinNs   int64          `json:"min_ns"`
+	MaxNs   int64          `json:"max_ns"`
+	Buckets map[int]uint64 `json:"buckets"`
+}
+
+// Merge 合并另一个快照（例如来自其他数据面节点）
+func (s *HistogramSnapshot) Merge(other *HistogramSnapshot) {
+	if other == nil || other.Count == 0 {
+		return
+	}
+	if s.Buckets == nil {
+		s.Buckets = make(map[int]uint64)
+	}
+
+	if s.Count == 0 || other.MinNs < s.MinNs {
+		s.MinNs = other.MinNs
+	}
+	if other.MaxNs > s.MaxNs {
+		s.MaxNs = other.MaxNs
+	}
+	s.Count += other.Count
+	s.SumNs += other.SumNs
+	for index, n := range other.Buckets {
+		s.Buckets[index] += n
+	}
+}
+
+// Quantile 估算分位数，结果限制在[min, max]之间
+func (s *HistogramSnapshot) Quantile(q float64) time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+
+	indexes := make([]int, 0, len(s.Buckets))
+	for index := range s.Buckets {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+
+	rank := uint64(math.Ceil(q * float64(s.Count)))
+	if rank == 0 {
+		rank = 1
+	}
+
+	var cumulative uint64
+	for _, index := range indexes {
+		cumulative += s.Buckets[index]
+		if cumulative >= rank {
+			value := bucketUpperBound(index).Nanoseconds()
+			if value > s.MaxNs {
+				value = s.MaxNs
+			}
+			if value < s.MinNs {
+				value = s.MinNs
+			}
+			return time.Duration(value)
+		}
+	}
+	return time.Duration(s.MaxNs)
+}
+
+// Summary 输出以毫秒为单位的统计摘要
+func (s *HistogramSnapshot) Summary() *LatencySummary {
+	summary := &LatencySummary{Count: s.Count}
+	if s.Count == 0 {
+		return summary
+	}
+
+	summary.AvgMs = float64(s.SumNs) / float64(s.Count) / 1e6
+	summary.MinMs = float64(s.MinNs) / 1e6
+	summary.MaxMs = float64(s.MaxNs) / 1e6
+	summary.P50Ms = durationMs(s.Quantile(0.5))
+	summary.P90Ms = durationMs(s.Quantile(0.9))
+	summary.P95Ms = durationMs(s.Quantile(0.95))
+	summary.P99Ms = durationMs(s.Quantile(0.99))
+	summary.P999Ms = durationMs(s.Quantile(0.999))
+	return summary
+}
+
+// LatencySummary 延迟统计摘要
+type LatencySummary struct {
+	Count  uint64  `json:"count"`
+	AvgMs  float64 `json:"avg_ms"`
+	MinMs  float64 `json:"min_ms"`
+	MaxMs  float64 `json:"max_ms"`
+	P50Ms  float64 `json:"p50_ms"`
+	P90Ms  float64 `json:"p90_ms"`
+	P95Ms  float64 `json:"p95_ms"`
+	P99Ms  float64 `json:"p99_ms"`
+	P999Ms float64 `json:"p999_ms"`
+}
+
+// LatencyHistograms 各维度的延迟直方图快照
+type LatencyHistograms struct {
+	Total     *HistogramSnapshot            `json:"total"`
+	Domains   map[string]*HistogramSnapshot `json:"domains"`
+	Routes    map[string]*HistogramSnapshot `json:"routes"`
+	Upstreams map[string]*HistogramSnapshot `json:"upstreams"`
+}
+
+// Merge 合并另一个节点的直方图
+func (h *LatencyHistograms) Merge(other *LatencyHistograms) {
+	if other == nil {
+		return
+	}
+	if h.Total == nil {
+		h.Total = &HistogramSnapshot{}
+	}
+	h.Total.Merge(other.Total)
+	h.Domains = mergeHistograms(h.Domains, other.Domains)
+	h.Routes = mergeHistograms(h.Routes, other.Routes)
+	h.Upstreams = mergeHistograms(h.Upstreams, other.Upstreams)
+}
+
+// mergeHistograms 按key合并直方图
+func mergeHistograms(dst, src map[string]*HistogramSnapshot) map[string]*HistogramSnapshot {
+	if dst == nil {
+		dst = make(map[string]*HistogramSnapshot, len(src))
+	}
+	for key, snap := range src {
+		if dst[key] == nil {
+			dst[key] = &HistogramSnapshot{}
+		}
+		dst[key].Merge(snap)
+	}
+	return dst
+}
+
+// Report 计算各维度的延迟统计摘要
+func (h *LatencyHistograms) Report() *LatencyReport {
+	report := &LatencyReport{
+		Total:     (&HistogramSnapshot{}).Summary(),
+		Domains:   summarizeHistograms(h.Domains),
+		Routes:    summarizeHistograms(h.Routes),
+		Upstreams: summarizeHistograms(h.Upstreams),
+	}
+	if h.Total != nil {
+		report.Total = h.Total.Summary()
+	}
+	return report
+}
+
+// summarizeHistograms 批量计算统计摘要
+func summarizeHistograms(histograms map[string]*HistogramSnapshot) map[string]*LatencySummary {
+	result := make(map[string]*LatencySummary, len(histograms))
+	for key, snap := range histograms {
+		result[key] = snap.Summary()
+	}
+	return result
+}
+
+// LatencyReport 各维度的延迟统计摘要
+type LatencyReport struct {
+	Total     *LatencySummary            `json:"total"`
+	Domains   map[string]*LatencySummary `json:"domains"`
+	Routes    map[string]*LatencySummary `json:"routes"`
+	Upstreams map[string]*LatencySummary `json:"upstreams"`
+}
@@ -0,0 +1,109 @@
+package dataplane
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// histogramOf 记录一组延迟的直方图快照
+func histogramOf(latencies ...time.Duration) *HistogramSnapshot {
+	h := NewLatencyHistogram()
+	for _, d := range latencies {
+		h.Record(d)
+	}
+	return h.Snapshot()
+}
+
+func TestHistogramQuantile(t *testing.T) {
+	latencies := make([]time.Duration, 0, 100)
+	for i := 1; i <= 100; i++ {
+		latencies = append(latencies, time.Duration(i)*time.Millisecond)
+	}
+	snap := histogramOf(latencies...)
+
+	tests := []struct {
+		q    float64
+		want time.Duration
+	}{
+		{q: 0, want: time.Millisecond},
+		{q: 0.5, want: 50 * time.Millisecond},
+		{q: 0.9, want: 90 * time.Millisecond},
+		{q: 0.99, want: 99 * time.Millisecond},
+		{q: 1, want: 100 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		got := snap.Quantile(tt.q)
+		// 分桶的相对误差约4.4%
+		if math.Abs(float64(got-tt.want)) > 0.045*float64(tt.want) {
+			t.Errorf("p%v = %v，期望约 %v", tt.q*100, got, tt.want)
+		}
+		if got < time.Millisecond || got > 100*time.Millisecond {
+			t.Errorf("p%v = %v 超出了 [min, max]", tt.q*100, got)
+		}
+	}
+
+	if got := (&HistogramSnapshot{}).Quantile(0.5); got != 0 {
+		t.Errorf("空直方图的分位数为 %v", got)
+	}
+}
+
+func TestHistogramMerge(t *testing.T) {
+	fast := []time.Duration{time.Millisecond, 2 * time.Millisecond, 3 * time.Millisecond}
+	slow := []time.Duration{200 * time.Millisecond, 400 * time.Millisecond}
+
+	tests := []struct {
+		name  string
+		parts [][]time.Duration
+	}{
+		{name: "两个节点", parts: [][]time.Duration{fast, slow}},
+		{name: "合并顺序无关", parts: [][]time.Duration{slow, fast}},
+		{name: "包含没有请求的节点", parts: [][]time.Duration{nil, fast, nil, slow}},
+	}
+	want := histogramOf(append(append([]time.Duration{}, fast...), slow...)...)
+	for _, tt := range tests {
+		merged := &HistogramSnapshot{}
+		for _, part := range tt.parts {
+			merged.Merge(histogramOf(part...))
+		}
+		if !reflect.DeepEqual(merged, want) {
+			t.Errorf("%s: 合并结果为 %+v，期望与在同一节点记录相同 %+v", tt.name, merged, want)
+		}
+	}
+
+	summary := want.Summary()
+	if summary.Count != 5 || summary.MinMs != 1 || summary.MaxMs != 400 || summary.AvgMs != 121.2 {
+		t.Errorf("统计摘要错误: %+v", summary)
+	}
+	if summary.P50Ms < 3 || summary.P50Ms > 3*1.045 || summary.P99Ms != 400 {
+		t.Errorf("分位数错误: p50=%v p99=%v", summary.P50Ms, summary.P99Ms)
+	}
+}
+
+func TestLatencyHistogramsMerge(t *testing.T) {
+	merged := &LatencyHistograms{}
+	merged.Merge(&LatencyHistograms{
+		Total:   histogramOf(time.Millisecond, 3*time.Millisecond),
+		Domains: map[string]*HistogramSnapshot{"a.example.com": histogramOf(time.Millisecond, 3*time.Millisecond)},
+	})
+	merged.Merge(&LatencyHistograms{
+		Total: histogramOf(5 * time.Millisecond),
+		Domains: map[string]*HistogramSnapshot{
+			"a.example.com": histogramOf(5 * time.Millisecond),
+			"b.example.com": histogramOf(7 * time.Millisecond),
+		},
+	})
+	merged.Merge(nil)
+
+	report := merged.Report()
+	if report.Total.Count != 3 || report.Total.AvgMs != 3 {
+		t.Errorf("合并后的总计为 %+v", report.Total)
+	}
+	if a := report.Domains["a.example.com"]; a == nil || a.Count != 3 || a.MaxMs != 5 {
+		t.Errorf("合并后 a.example.com 为 %+v", a)
+	}
+	if b := report.Domains["b.example.com"]; b == nil || b.Count != 1 || b.MinMs != 7 {
+		t.Errorf("合并后 b.example.com 为 %+v", b)
+	}
+}
@@ -17,18 +17,34 @@ type Metrics struct {
 	statusCodes map[int]int64
 
 	// 延迟统计
-	latencySum   int64 // 纳秒
-	latencyCount int64
-	latencyMin   int64
-	latencyMax   int64
+	latency *LatencyHistogram
 
-	// 域名维度指标
-	domainMetrics map[string]*DomainMetrics
+	// 按域名/路由/上游分组的延迟直方图
+	domainLatency   map[string]*LatencyHistogram
+	routeLatency    map[string]*LatencyHistogram
+	upstreamLatency map[string]*LatencyHistogram
+
+	// 域名/路由/上游维度指标
+	domainMetrics   map[string]*DomainMetrics
+	routeMetrics    map[string]*DomainMetrics
+	upstreamMetrics map[string]*DomainMetrics
+
+	// 按域名/路由/上游/地址/状态码分类的请求序列
+	series *seriesStore
+
+	// 最近一段时间的秒级/分钟级时间序列
+	timeSeries *TimeSeriesStore
+
+	// 连接与TLS握手
+	httpConns          int64
+	httpsConns         int64
+	tlsHandshakes      int64
+	tlsHandshakeErrors int64
 
 	mu sync.RWMutex
 }
 
-// DomainMetrics 域名维度指标
+// DomainMetrics 域名维度指标，路由和上游维度使用相同的结构
 type DomainMetrics struct {
 	Requests     int64
 	BytesIn      int64
@@ -42,8 +58,73 @@ type DomainMetrics struct {
 // NewMetrics 创建监控指标
 func NewMetrics() *Metrics {
 	return &Metrics{
-		statusCodes:   make(map[int]int64),
-		domainMetrics: make(map[string]*DomainMetrics),
+		statusCodes:     make(map[int]int64),
+		domainMetrics:   make(map[string]*DomainMetrics),
+		routeMetrics:    make(map[string]*DomainMetrics),
+		upstreamMetrics: make(map[string]*DomainMetrics),
+		latency:         NewLatencyHistogram(),
+		domainLatency:   make(map[string]*LatencyHistogram),
+		routeLatency:    make(map[string]*LatencyHistogram),
+		upstreamLatency: make(map[string]*LatencyHistogram),
+		series:          newSeriesStore(DefaultMaxSeries),
+		timeSeries:      NewTimeSeriesStore(DefaultSecondRetention),
+	}
+}
+
+// SetSecondRetention 设置秒级时间序列的保留时长，需在处理请求前调用
+func (m *Metrics) SetSecondRetention(retention time.Duration) {
+	m.timeSeries = NewTimeSeriesStore(retention)
+}
+
+// RecordTimeSeries 记录请求到时间序列，domain为空时只计入全部请求
+func (m *Metrics) RecordTimeSeries(domain string, isError bool, bytesIn, bytesOut int64, latency time.Duration) {
+	m.timeSeries.Record(time.Now(), domain, isError, bytesIn, bytesOut, latency)
+}
+
+// QueryTimeSeries 查询最近window时长内的指标序列
+func (m *Metrics) QueryTimeSeries(metric, domain string, window time.Duration) (*SeriesResult, error) {
+	return m.timeSeries.Query(metric, domain, window, time.Now())
+}
+
+// SetMaxSeries 设置请求指标序列上限
+func (m *Metrics) SetMaxSeries(maxSeries int) {
+	if maxSeries <= 0 {
+		return
+	}
+	m.series.mu.Lock()
+	defer m.series.mu.Unlock()
+	m.series.maxSeries = maxSeries
+}
+
+// RecordRequest 记录一次请求的序列指标
+func (m *Metrics) RecordRequest(labels SeriesLabels, bytesIn, bytesOut int64, latency, upstreamLatency time.Duration) {
+	m.series.record(labels, bytesIn, bytesOut, latency.Seconds(), upstreamLatency.Seconds())
+}
+
+// ConnOpened 记录监听器上新建的连接
+func (m *Metrics) ConnOpened(listener string) {
+	atomic.AddInt64(m.connGauge(listener), 1)
+}
+
+// ConnClosed 记录监听器上关闭的连接
+func (m *Metrics) ConnClosed(listener string) {
+	atomic.AddInt64(m.connGauge(listener), -1)
+}
+
+// connGauge 监听器对应的连接数
+func (m *Metrics) connGauge(listener string) *int64 {
+	if listener == "https" {
+		return &m.httpsConns
+	}
+	return &m.httpConns
+}
+
+// IncTLSHandshake 记录TLS握手结果
+func (m *Metrics) IncTLSHandshake(success bool) {
+	if success {
+		atomic.AddInt64(&m.tlsHandshakes, 1)
+	} else {
+		atomic.AddInt64(&m.tlsHandshakeErrors, 1)
 	}
 }
 
@@ -68,32 +149,60 @@ func (m *Metrics) IncStatusCodes(code int) {
 
 // RecordLatency 记录延迟
 func (m *Metrics) RecordLatency(duration time.Duration) {
-	ns := duration.Nanoseconds()
+	m.latency.Record(duration)
+}
 
-	atomic.AddInt64(&m.latencySum, ns)
-	atomic.AddInt64(&m.latencyCount, 1)
+// RecordDimensionLatency 按域名/路由/上游记录延迟，空值的维度不记录
+func (m *Metrics) RecordDimensionLatency(domain, route, upstream string, duration time.Duration) {
+	if domain != "" {
+		m.dimensionHistogram(m.domainLatency, domain).Record(duration)
+	}
+	if route != "" {
+		m.dimensionHistogram(m.routeLatency, route).Record(duration)
+	}
+	if upstream != "" {
+		m.dimensionHistogram(m.upstreamLatency, upstream).Record(duration)
+	}
+}
 
-	// 更新最小延迟
-	for {
-		old := atomic.LoadInt64(&m.latencyMin)
-		if old != 0 && ns >= old {
-			break
-		}
-		if atomic.CompareAndSwapInt64(&m.latencyMin, old, ns) {
-			break
-		}
+// dimensionHistogram 获取或创建维度对应的直方图
+func (m *Metrics) dimensionHistogram(histograms map[string]*LatencyHistogram, key string) *LatencyHistogram {
+	m.mu.RLock()
+	h, exists := histograms[key]
+	m.mu.RUnlock()
+	if exists {
+		return h
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if h, exists = histograms[key]; !exists {
+		h = NewLatencyHistogram()
+		histograms[key] = h
+	}
+	return h
+}
+
+// LatencyHistograms 获取延迟直方图快照，可在控制面跨节点合并
+func (m *Metrics) LatencyHistograms() *LatencyHistograms {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return &LatencyHistograms{
+		Total:     m.latency.Snapshot(),
+		Domains:   snapshotHistograms(m.domainLatency),
+		Routes:    snapshotHistograms(m.routeLatency),
+		Upstreams: snapshotHistograms(m.upstreamLatency),
 	}
+}
 
-	// 更新最大延迟
-	for {
-		old := atomic.LoadInt64(&m.latencyMax)
-		if ns <= old {
-			break
-		}
-		if atomic.CompareAndSwapInt64(&m.latencyMax, old, ns) {
-			break
-		}
+// snapshotHistograms 批量获取直方图快照
+func snapshotHistograms(histograms map[string]*LatencyHistogram) map[string]*HistogramSnapshot {
+	result := make(map[string]*HistogramSnapshot, len(histograms))
+	for key, h := range histograms {
+		result[key] = h.Snapshot()
 	}
+	return result
 }
 
 // RecordDomainMetrics 记录域名维度指标
@@ -101,10 +210,31 @@ func (m *Metrics) RecordDomainMetrics(domain string, success bool, latency time.
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	dm, exists := m.domainMetrics[domain]
+	recordTraffic(m.domainMetrics, domain, success, latency, bytesIn, bytesOut)
+}
+
+// RecordTraffic 记录域名/路由/上游维度指标，空值的维度不记录
+func (m *Metrics) RecordTraffic(domain, route, upstream string, success bool, latency time.Duration, bytesIn, bytesOut int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if domain != "" {
+		recordTraffic(m.domainMetrics, domain, success, latency, bytesIn, bytesOut)
+	}
+	if route != "" {
+		recordTraffic(m.routeMetrics, route, success, latency, bytesIn, bytesOut)
+	}
+	if upstream != "" {
+		recordTraffic(m.upstreamMetrics, upstream, success, latency, bytesIn, bytesOut)
+	}
+}
+
+// recordTraffic 累加一次请求，调用方需持有写锁
+func recordTraffic(metrics map[string]*DomainMetrics, key string, success bool, latency time.Duration, bytesIn, bytesOut int64) {
+	dm, exists := metrics[key]
 	if !exists {
 		dm = &DomainMetrics{}
-		m.domainMetrics[domain] = dm
+		metrics[key] = dm
 	}
 
 	dm.Requests++
@@ -120,6 +250,15 @@ func (m *Metrics) RecordDomainMetrics(domain string, success bool, latency time.
 	}
 }
 
+// copyTraffic 复制维度指标，调用方需持有读锁
+func copyTraffic(metrics map[string]*DomainMetrics) map[string]DomainMetrics {
+	result := make(map[string]DomainMetrics, len(metrics))
+	for key, dm := range metrics {
+		result[key] = *dm
+	}
+	return result
+}
+
 // GetStats 获取统计信息
 func (m *Metrics) GetStats() map[string]interface{} {
 	m.mu.RLock()
@@ -133,25 +272,21 @@ func (m *Metrics) GetStats() map[string]interface{} {
 	stats["active_requests"] = atomic.LoadInt64(&m.activeRequests)
 
 	// 延迟统计
-	latencyCount := atomic.LoadInt64(&m.latencyCount)
-	if latencyCount > 0 {
-		latencySum := atomic.LoadInt64(&m.latencySum)
-		latencyMin := atomic.LoadInt64(&m.latencyMin)
-		latencyMax := atomic.LoadInt64(&m.latencyMax)
-
-		stats["latency"] = map[string]interface{}{
-			"avg_ms": float64(latencySum) / float64(latencyCount) / 1e6,
-			"min_ms": float64(latencyMin) / 1e6,
-			"max_ms": float64(latencyMax) / 1e6,
-			"count":  latencyCount,
-		}
+	if latency := m.latency.Snapshot(); latency.Count > 0 {
+		stats["latency"] = latency.Summary()
 	}
 
-	// 状态码统计
-	stats["status_codes"] = m.statusCodes
+	// 状态码统计，复制后返回，避免序列化时在锁外读取
+	statusCodes := make(map[int]int64, len(m.statusCodes))
+	for code, count := range m.statusCodes {
+		statusCodes[code] = count
+	}
+	stats["status_codes"] = statusCodes
 
-	// 域名维度统计
-	stats["domains"] = m.domainMetrics
+	// 域名/路由/上游维度统计
+	stats["domains"] = copyTraffic(m.domainMetrics)
+	stats["routes"] = copyTraffic(m.routeMetrics)
+	stats["upstreams"] = copyTraffic(m.upstreamMetrics)
 
 	return stats
 }
@@ -164,11 +299,22 @@ func (m *Metrics) Reset() {
 	atomic.StoreInt64(&m.totalRequests, 0)
 	atomic.StoreInt64(&m.totalResponses, 0)
 	atomic.StoreInt64(&m.activeRequests, 0)
-	atomic.StoreInt64(&m.latencySum, 0)
-	atomic.StoreInt64(&m.latencyCount, 0)
-	atomic.StoreInt64(&m.latencyMin, 0)
-	atomic.StoreInt64(&m.latencyMax, 0)
+	m.latency.reset()
 
-	m.statusCodes = make(map[int]int64)
-	m.domainMetrics = make(map[string]*DomainMetrics)
+	// 原地清空，避免与持有旧引用的记录方竞争
+	clearMap(m.domainLatency)
+	clearMap(m.routeLatency)
+	clearMap(m.upstreamLatency)
+	clearMap(m.statusCodes)
+	clearMap(m.domainMetrics)
+	clearMap(m.routeMetrics)
+	clearMap(m.upstreamMetrics)
+	m.series.reset()
+}
+
+// clearMap 清空map
+func clearMap[K comparable, V any](values map[K]V) {
+	for key := range values {
+		delete(values, key)
+	}
 }
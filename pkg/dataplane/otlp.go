@@ -0,0 +1,285 @@
+package dataplane
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// otlpTracesPath OTLP/HTTP的默认上报路径
+const otlpTracesPath = "/v1/traces"
+
+// otlpExporter 以OTLP/HTTP JSON格式异步批量上报Span
+type otlpExporter struct {
+	endpoint    string
+	headers     map[string]string
+	serviceName string
+	batchSize   int
+	interval    time.Duration
+	client      *http.Client
+	spans       chan *Span
+	done        chan struct{}
+	once        sync.Once
+	log         *logrus.Logger
+
+	exported int64
+	dropped  int64
+	failed   int64
+}
+
+// newOTLPExporter 创建OTLP上报器
+func newOTLPExporter(config TracingConfig, log *logrus.Logger) (*otlpExporter, error) {
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		return nil, fmt.Errorf("OTLP上报地址格式错误: %s", config.Endpoint)
+	}
+	if endpoint.Path == "" || endpoint.Path == "/" {
+		endpoint.Path = otlpTracesPath
+	}
+
+	if config.BatchSize <= 0 {
+		config.BatchSize = 512
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = 8192
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = 5 * time.Second
+	}
+
+	exporter := &otlpExporter{
+		endpoint:    endpoint.String(),
+		headers:     config.Headers,
+		serviceName: config.ServiceName,
+		batchSize:   config.BatchSize,
+		interval:    config.FlushInterval,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		spans:       make(chan *Span, config.QueueSize),
+		done:        make(chan struct{}),
+		log:         log,
+	}
+	go exporter.run()
+
+	return exporter, nil
+}
+
+// Export 提交Span，不阻塞请求处理，队列满时丢弃
+func (e *otlpExporter) Export(span *Span) {
+	select {
+	case e.spans <- span:
+	default:
+		atomic.AddInt64(&e.dropped, 1)
+	}
+}
+
+// Close 上报队列中剩余的Span
+func (e *otlpExporter) Close() {
+	e.once.Do(func() {
+		close(e.spans)
+		<-e.done
+	})
+}
+
+// run 后台批量上报，攒够一批或到达上报间隔时发送
+func (e *otlpExporter) run() {
+	defer close(e.done)
+
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	batch := make([]*Span, 0, e.batchSize)
+	for {
+		select {
+		case span, ok := <-e.spans:
+			if !ok {
+				e.send(batch)
+				return
+			}
+			batch = append(batch, span)
+			if len(batch) >= e.batchSize {
+				e.send(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			e.send(batch)
+			batch = batch[:0]
+		}
+	}
+}
+
+// send 发送一批Span，失败时丢弃并计数
+func (e *otlpExporter) send(batch []*Span) {
+	if len(batch) == 0 {
+		return
+	}
+
+	data, err := json.Marshal(e.encode(batch))
+	if err != nil {
+		atomic.AddInt64(&e.failed, int64(len(batch)))
+		e.log.Errorf("序列化Span失败: %v", err)
+		return
+	}
+
+	req, err := http.NewRequest("POST", e.endpoint, bytes.NewReader(data))
+	if err != nil {
+		atomic.AddInt64(&e.failed, int64(len(batch)))
+		e.log.Errorf("创建OTLP请求失败: %v", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range e.headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		atomic.AddInt64(&e.failed, int64(len(batch)))
+		e.log.Warnf("上报Span失败: %v", err)
+		return
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode/100 != 2 {
+		atomic.AddInt64(&e.failed, int64(len(batch)))
+		e.log.Warnf("上报Span失败，状态码: %d", resp.StatusCode)
+		return
+	}
+	atomic.AddInt64(&e.exported, int64(len(batch)))
+}
+
+// OTLP JSON编码的结构，字段名与 opentelemetry-proto 的JSON映射一致
+
+type otlpTracesRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	TraceState        string         `json:"traceState,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"` // int64以字符串编码
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+}
+
+// encode 将一批Span编码为OTLP请求
+func (e *otlpExporter) encode(batch []*Span) *otlpTracesRequest {
+	spans := make([]otlpSpan, 0, len(batch))
+	for _, span := range batch {
+		encoded := otlpSpan{
+			TraceID:           span.TraceID.String(),
+			SpanID:            span.SpanID.String(),
+			TraceState:        span.traceState,
+			Name:              span.Name,
+			Kind:              span.Kind,
+			StartTimeUnixNano: strconv.FormatInt(span.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(span.End.UnixNano(), 10),
+			Attributes:        encodeAttributes(span.Attributes),
+			Status:            otlpStatus{Code: span.Status, Message: span.StatusMsg},
+		}
+		if span.ParentSpanID.IsValid() {
+			encoded.ParentSpanID = span.ParentSpanID.String()
+		}
+		spans = append(spans, encoded)
+	}
+
+	return &otlpTracesRequest{
+		ResourceSpans: []otlpResourceSpans{{
+			Resource: otlpResource{
+				Attributes: encodeAttributes([]SpanAttribute{{Key: "service.name", Value: e.serviceName}}),
+			},
+			ScopeSpans: []otlpScopeSpans{{
+				Scope: otlpScope{Name: DefaultTracingServiceName},
+				Spans: spans,
+			}},
+		}},
+	}
+}
+
+// encodeAttributes 编码属性，不支持的类型按字符串输出
+func encodeAttributes(attributes []SpanAttribute) []otlpKeyValue {
+	result := make([]otlpKeyValue, 0, len(attributes))
+	for _, attr := range attributes {
+		var value otlpAnyValue
+		switch v := attr.Value.(type) {
+		case string:
+			value.StringValue = &v
+		case int64:
+			s := strconv.FormatInt(v, 10)
+			value.IntValue = &s
+		case float64:
+			value.DoubleValue = &v
+		case bool:
+			value.BoolValue = &v
+		default:
+			s := fmt.Sprint(v)
+			value.StringValue = &s
+		}
+		result = append(result, otlpKeyValue{Key: attr.Key, Value: value})
+	}
+	return result
+}
+
+// writePrometheus 输出Span上报统计
+func (t *Tracer) writePrometheus(w io.Writer) error {
+	if t == nil {
+		return nil
+	}
+
+	pw := &promWriter{w: bufio.NewWriter(w)}
+	pw.header("kun_gateway_tracing_spans_total", "Spans handed to the OTLP exporter by result.", "counter")
+	pw.sample("kun_gateway_tracing_spans_total", float64(atomic.LoadInt64(&t.exporter.exported)), "result", "exported")
+	pw.sample("kun_gateway_tracing_spans_total", float64(atomic.LoadInt64(&t.exporter.dropped)), "result", "dropped")
+	pw.sample("kun_gateway_tracing_spans_total", float64(atomic.LoadInt64(&t.exporter.failed)), "result", "failed")
+	return pw.w.Flush()
+}
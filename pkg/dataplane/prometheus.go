@@ -0,0 +1,319 @@
+package dataplane
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultMaxSeries 默认的指标序列上限，超出后新序列合并到 "other"
+const DefaultMaxSeries = 5000
+
+// unmatchedLabel 未匹配到路由的请求使用的域名标签，避免任意Host头产生新序列
+const unmatchedLabel = "unmatched"
+
+// overflowLabel 超出序列上限后使用的标签值
+const overflowLabel = "other"
+
+// latencyBuckets Prometheus直方图的桶上界（秒）
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// SeriesLabels 请求维度的指标标签
+type SeriesLabels struct {
+	Domain      string
+	Route       string
+	Upstream    string
+	Address     string
+	StatusClass string
+}
+
+// statusClass 状态码分类，如 2xx
+func statusClass(code int) string {
+	if code < 100 || code > 599 {
+		return "unknown"
+	}
+	return strconv.Itoa(code/100) + "xx"
+}
+
+// promHistogram 固定桶的直方图
+type promHistogram struct {
+	counts []uint64 // 与latencyBuckets一一对应，最后一个为+Inf
+	sum    float64
+	count  uint64
+}
+
+func newPromHistogram() promHistogram {
+	return promHistogram{counts: make([]uint64, len(latencyBuckets)+1)}
+}
+
+// observe 记录一个观测值（秒）
+func (h *promHistogram) observe(seconds float64) {
+	i := sort.SearchFloat64s(latencyBuckets, seconds)
+	h.counts[i]++
+	h.sum += seconds
+	h.count++
+}
+
+// requestSeries 单个标签组合的请求指标
+type requestSeries struct {
+	requests        uint64
+	bytesIn         uint64
+	bytesOut        uint64
+	latency         promHistogram
+	upstreamLatency promHistogram
+}
+
+// seriesStore 带上限的请求指标序列
+type seriesStore struct {
+	series    map[SeriesLabels]*requestSeries
+	maxSeries int
+	overflow  uint64 // 因超出上限被合并的请求数
+	mu        sync.Mutex
+}
+
+func newSeriesStore(maxSeries int) *seriesStore {
+	return &seriesStore{
+		series:    make(map[SeriesLabels]*requestSeries),
+		maxSeries: maxSeries,
+	}
+}
+
+// record 记录一次请求
+func (s *seriesStore) record(labels SeriesLabels, bytesIn, bytesOut int64, latency, upstreamLatency float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	series, exists := s.series[labels]
+	if !exists {
+		if len(s.series) >= s.maxSeries {
+			s.overflow++
+			labels = SeriesLabels{
+				Domain:      overflowLabel,
+				Route:       overflowLabel,
+				Upstream:    overflowLabel,
+				Address:     overflowLabel,
+				StatusClass: labels.StatusClass,
+			}
+			series = s.series[labels]
+		}
+		if series == nil {
+			series = &requestSeries{
+				latency:         newPromHistogram(),
+				upstreamLatency: newPromHistogram(),
+			}
+			s.series[labels] = series
+		}
+	}
+
+	series.requests++
+	series.bytesIn += uint64(bytesIn)
+	series.bytesOut += uint64(bytesOut)
+	series.latency.observe(latency)
+	if upstreamLatency > 0 {
+		series.upstreamLatency.observe(upstreamLatency)
+	}
+}
+
+// reset 清空所有序列
+func (s *seriesStore) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.series = make(map[SeriesLabels]*requestSeries)
+	s.overflow = 0
+}
+
+// seriesSnapshot 序列快照
+type seriesSnapshot struct {
+	labels SeriesLabels
+	requestSeries
+}
+
+// snapshot 复制当前所有序列，按标签排序
+func (s *seriesStore) snapshot() ([]seriesSnapshot, uint64) {
+	s.mu.Lock()
+	result := make([]seriesSnapshot, 0, len(s.series))
+	for labels, series := range s.series {
+		snap := seriesSnapshot{labels: labels, requestSeries: *series}
+		snap.latency.counts = append([]uint64(nil), series.latency.counts...)
+		snap.upstreamLatency.counts = append([]uint64(nil), series.upstreamLatency.counts...)
+		result = append(result, snap)
+	}
+	overflow := s.overflow
+	s.mu.Unlock()
+
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i].labels, result[j].labels
+		if a.Domain != b.Domain {
+			return a.Domain < b.Domain
+		}
+		if a.Route != b.Route {
+			return a.Route < b.Route
+		}
+		if a.Upstream != b.Upstream {
+			return a.Upstream < b.Upstream
+		}
+		if a.Address != b.Address {
+			return a.Address < b.Address
+		}
+		return a.StatusClass < b.StatusClass
+	})
+	return result, overflow
+}
+
+// promWriter Prometheus文本格式输出
+type promWriter struct {
+	w *bufio.Writer
+}
+
+// header 输出指标的HELP和TYPE
+func (pw *promWriter) header(name, help, metricType string) {
+	fmt.Fprintf(pw.w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType)
+}
+
+// sample 输出一个样本，labels为 name,value 交替
+func (pw *promWriter) sample(name string, value float64, labels ...string) {
+	pw.w.WriteString(name)
+	if len(labels) > 0 {
+		pw.w.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				pw.w.WriteByte(',')
+			}
+			pw.w.WriteString(labels[i])
+			pw.w.WriteString(`="`)
+			pw.w.WriteString(escapeLabelValue(labels[i+1]))
+			pw.w.WriteByte('"')
+		}
+		pw.w.WriteByte('}')
+	}
+	pw.w.WriteByte(' ')
+	pw.w.WriteString(strconv.FormatFloat(value, 'g', -1, 64))
+	pw.w.WriteByte('\n')
+}
+
+// histogram 输出直方图的bucket/sum/count
+func (pw *promWriter) histogram(name string, h *promHistogram, labels ...string) {
+	var cumulative uint64
+	for i, bound := range latencyBuckets {
+		cumulative += h.counts[i]
+		pw.sample(name+"_bucket", float64(cumulative), append(labels, "le", strconv.FormatFloat(bound, 'g', -1, 64))...)
+	}
+	cumulative += h.counts[len(latencyBuckets)]
+	pw.sample(name+"_bucket", float64(cumulative), append(labels, "le", "+Inf")...)
+	pw.sample(name+"_sum", h.sum, labels...)
+	pw.sample(name+"_count", float64(h.count), labels...)
+}
+
+// labelEscaper 标签值转义
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+// WritePrometheus 以Prometheus文本格式输出请求维度的指标
+func (m *Metrics) WritePrometheus(w io.Writer) error {
+	pw := &promWriter{w: bufio.NewWriter(w)}
+	series, overflow := m.series.snapshot()
+
+	pw.header("kun_gateway_requests_total", "Total number of proxied requests.", "counter")
+	for i := range series {
+		s := &series[i]
+		pw.sample("kun_gateway_requests_total", float64(s.requests), s.labels.pairs()...)
+	}
+
+	pw.header("kun_gateway_request_bytes_total", "Total bytes received from clients.", "counter")
+	for i := range series {
+		s := &series[i]
+		pw.sample("kun_gateway_request_bytes_total", float64(s.bytesIn), s.labels.pairs()...)
+	}
+
+	pw.header("kun_gateway_response_bytes_total", "Total bytes sent to clients.", "counter")
+	for i := range series {
+		s := &series[i]
+		pw.sample("kun_gateway_response_bytes_total", float64(s.bytesOut), s.labels.pairs()...)
+	}
+
+	pw.header("kun_gateway_request_duration_seconds", "Total request latency seen by the gateway.", "histogram")
+	for i := range series {
+		s := &series[i]
+		pw.histogram("kun_gateway_request_duration_seconds", &s.latency, s.labels.pairs()...)
+	}
+
+	pw.header("kun_gateway_upstream_duration_seconds", "Latency of upstream requests.", "histogram")
+	for i := range series {
+		s := &series[i]
+		if s.upstreamLatency.count > 0 {
+			pw.histogram("kun_gateway_upstream_duration_seconds", &s.upstreamLatency, s.labels.pairs()...)
+		}
+	}
+
+	pw.header("kun_gateway_series_overflow_total", "Requests folded into the \"other\" series after the series limit was reached.", "counter")
+	pw.sample("kun_gateway_series_overflow_total", float64(overflow))
+
+	pw.header("kun_gateway_active_requests", "Requests currently being processed.", "gauge")
+	pw.sample("kun_gateway_active_requests", float64(atomic.LoadInt64(&m.activeRequests)))
+
+	pw.header("kun_gateway_connections", "Open client connections per listener.", "gauge")
+	pw.sample("kun_gateway_connections", float64(atomic.LoadInt64(&m.httpConns)), "listener", "http")
+	pw.sample("kun_gateway_connections", float64(atomic.LoadInt64(&m.httpsConns)), "listener", "https")
+
+	pw.header("kun_gateway_tls_handshakes_total", "TLS handshakes by result.", "counter")
+	pw.sample("kun_gateway_tls_handshakes_total", float64(atomic.LoadInt64(&m.tlsHandshakes)), "result", "success")
+	pw.sample("kun_gateway_tls_handshakes_total", float64(atomic.LoadInt64(&m.tlsHandshakeErrors)), "result", "failure")
+
+	return pw.w.Flush()
+}
+
+// pairs 标签的 name,value 序列
+func (l *SeriesLabels) pairs() []string {
+	return []string{
+		"domain", l.Domain,
+		"route", l.Route,
+		"upstream", l.Upstream,
+		"address", l.Address,
+		"code_class", l.StatusClass,
+	}
+}
+
+// writeUpstreamHealth 输出上游服务健康状态
+func writeUpstreamHealth(w io.Writer, rules []*RouteRule) error {
+	pw := &promWriter{w: bufio.NewWriter(w)}
+
+	sort.Slice(rules, func(i, j int) bool { return rules[i].Key() < rules[j].Key() })
+
+	pw.header("kun_gateway_upstream_healthy", "Whether the upstream is marked healthy (1) or not (0).", "gauge")
+	for _, rule := range rules {
+		for _, upstream := range rule.Upstreams {
+			healthy := 0.0
+			if upstream.Healthy {
+				healthy = 1
+			}
+			pw.sample("kun_gateway_upstream_healthy", healthy, "domain", rule.Domain, "route", rule.Key(), "upstream", upstream.Name)
+		}
+	}
+
+	pw.header("kun_gateway_upstream_endpoints", "Number of endpoint addresses per upstream.", "gauge")
+	for _, rule := range rules {
+		for _, upstream := range rule.Upstreams {
+			pw.sample("kun_gateway_upstream_endpoints", float64(len(upstream.Addresses)), "domain", rule.Domain, "route", rule.Key(), "upstream", upstream.Name)
+		}
+	}
+
+	pw.header("kun_gateway_upstream_draining_endpoints", "Number of terminating but still serving endpoint addresses per upstream.", "gauge")
+	for _, rule := range rules {
+		for _, upstream := range rule.Upstreams {
+			pw.sample("kun_gateway_upstream_draining_endpoints", float64(len(upstream.DrainingAddresses)), "domain", rule.Domain, "route", rule.Key(), "upstream", upstream.Name)
+		}
+	}
+
+	pw.header("kun_gateway_routes", "Number of routes in the active route table.", "gauge")
+	pw.sample("kun_gateway_routes", float64(len(rules)))
+
+	return pw.w.Flush()
+}
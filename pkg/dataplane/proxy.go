@@ -5,30 +5,56 @@ import (
 	"crypto/tls"
 	"fmt"
 	"io"
+	stdlog "log"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/valyala/fasthttp"
+	"golang.org/x/net/http2"
 )
 
 // Proxy 代理服务器
 type Proxy struct {
-	router    *Router
-	log       *logrus.Logger
-	metrics   *Metrics
-	client    *fasthttp.Client
+	router  *Router
+	log     *logrus.Logger
+	metrics *Metrics
+	client  *fasthttp.Client
+	// balancer 选择上游地址
+	balancer *Balancer
+	// resolver 解析dns类型上游的域名
+	resolver *DNSResolver
+	// upstreamClients 配置了TLS的上游使用的客户端
+	upstreamClients *upstreamClients
+	// plainClient HTTPS监听器以明文HTTP/1.1转发到上游
+	plainClient *http.Client
+	// h2cClient 以明文HTTP/2转发到gRPC上游
+	h2cClient *http.Client
 	ctx       context.Context
 	cancel    context.CancelFunc
 	connCount int64
-	// HTTPS相关配置
-	tlsConfig   *tls.Config
+	// 可信来源网段（[]*net.IPNet），来自这些地址的X-Request-Id会被沿用
+	trustedProxies atomic.Value
+	// 访问日志
+	accessLog *AccessLogger
+	// 实时流量抓取
+	taps *TapManager
+	// 链路追踪，为nil时不追踪
+	tracer *Tracer
+	// HTTPS证书
 	certManager *CertManager
-	// HTTP服务器
-	httpServer  *http.Server
+	// HTTP服务器，在 NewProxy 中创建，Start/StartTLS 只负责监听
+	httpServer  *fasthttp.Server
 	httpsServer *http.Server
+	// serveMu 保护 stopped 和 listeners：Stop 之后不再启动监听，并关闭尚未进入Serve的监听
+	serveMu   sync.Mutex
+	stopped   bool
+	listeners []net.Listener
 }
 
 // CertManager 证书管理器
@@ -57,11 +83,31 @@ func (cm *CertManager) AddCertificate(domain, certFile, keyFile string) error {
 	return nil
 }
 
-// GetCertificate 获取证书
+// AddCertificatePEM 使用PEM内容添加证书，用于控制面下发K8s Secret中的证书
+func (cm *CertManager) AddCertificatePEM(domain string, certPEM, keyPEM []byte) error {
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return fmt.Errorf("加载证书失败: %v", err)
+	}
+
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.certs[domain] = &cert
+	return nil
+}
+
+// GetCertificate 获取证书，没有该域名的证书时使用通配符证书
 func (cm *CertManager) GetCertificate(domain string) *tls.Certificate {
 	cm.mu.RLock()
 	defer cm.mu.RUnlock()
-	return cm.certs[domain]
+
+	if cert, ok := cm.certs[domain]; ok {
+		return cert
+	}
+	if i := strings.IndexByte(domain, '.'); i > 0 {
+		return cm.certs["*"+domain[i:]]
+	}
+	return nil
 }
 
 // RemoveCertificate 移除证书
@@ -94,31 +140,45 @@ func NewProxy(router *Router, log *logrus.Logger) *Proxy {
 		MaxIdleConnDuration: 10 * time.Second,
 	}
 
-	return &Proxy{
-		router:      router,
-		log:         log,
-		metrics:     NewMetrics(),
-		client:      client,
-		ctx:         ctx,
-		cancel:      cancel,
-		certManager: NewCertManager(),
+	proxy := &Proxy{
+		router:          router,
+		log:             log,
+		metrics:         NewMetrics(),
+		client:          client,
+		balancer:        NewBalancer(),
+		resolver:        NewDNSResolver(log),
+		upstreamClients: newUpstreamClients(),
+		plainClient:     &http.Client{CheckRedirect: noRedirect},
+		h2cClient:       newH2CClient(),
+		ctx:             ctx,
+		cancel:          cancel,
+		certManager:     NewCertManager(),
+		taps:            NewTapManager(),
 	}
+	proxy.httpServer = proxy.newHTTPServer()
+	proxy.httpsServer = proxy.newHTTPSServer()
+	return proxy
 }
 
-// Start 启动HTTP代理服务器
-func (proxy *Proxy) Start(addr string) error {
-	proxy.log.Infof("启动HTTP代理服务器，监听地址: %s", addr)
-
-	// 使用fasthttp启动HTTP服务器
-	return fasthttp.ListenAndServe(addr, proxy.handleRequest)
+// newHTTPServer 创建HTTP代理服务器
+func (proxy *Proxy) newHTTPServer() *fasthttp.Server {
+	return &fasthttp.Server{
+		Handler: proxy.handleRequest,
+		ConnState: func(conn net.Conn, state fasthttp.ConnState) {
+			switch state {
+			case fasthttp.StateNew:
+				proxy.metrics.ConnOpened("http")
+			case fasthttp.StateClosed, fasthttp.StateHijacked:
+				proxy.metrics.ConnClosed("http")
+			}
+		},
+	}
 }
 
-// StartTLS 启动HTTPS代理服务器
-func (proxy *Proxy) StartTLS(addr string) error {
-	proxy.log.Infof("启动HTTPS代理服务器，监听地址: %s", addr)
-
+// newHTTPSServer 创建HTTPS代理服务器
+func (proxy *Proxy) newHTTPSServer() *http.Server {
 	// 创建TLS配置，支持SNI
-	proxy.tlsConfig = &tls.Config{
+	tlsConfig := &tls.Config{
 		GetCertificate: func(info *tls.ClientHelloInfo) (*tls.Certificate, error) {
 			domain := info.ServerName
 			if domain == "" {
@@ -146,18 +206,77 @@ func (proxy *Proxy) StartTLS(addr string) error {
 			proxy.log.Debugf("为域名 %s 选择证书", domain)
 			return cert, nil
 		},
+		// 握手成功后调用，用于统计握手次数
+		VerifyConnection: func(tls.ConnectionState) error {
+			proxy.metrics.IncTLSHandshake(true)
+			return nil
+		},
 		MinVersion: tls.VersionTLS12,
 	}
 
-	// 创建HTTP服务器
-	proxy.httpsServer = &http.Server{
-		Addr:      addr,
+	return &http.Server{
 		Handler:   http.HandlerFunc(proxy.handleHTTPRequest),
-		TLSConfig: proxy.tlsConfig,
+		TLSConfig: tlsConfig,
+		ConnState: func(conn net.Conn, state http.ConnState) {
+			switch state {
+			case http.StateNew:
+				proxy.metrics.ConnOpened("https")
+			case http.StateClosed, http.StateHijacked:
+				proxy.metrics.ConnClosed("https")
+			}
+		},
+		ErrorLog: stdlog.New(&serverErrorLog{proxy: proxy}, "", 0),
+	}
+}
+
+// listen 监听地址并登记，Stop 之后返回nil
+func (proxy *Proxy) listen(addr string) (net.Listener, error) {
+	proxy.serveMu.Lock()
+	defer proxy.serveMu.Unlock()
+
+	if proxy.stopped {
+		return nil, nil
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	proxy.listeners = append(proxy.listeners, ln)
+	return ln, nil
+}
+
+// serveError Stop 之后Serve返回的错误（监听已关闭）不作为错误
+func (proxy *Proxy) serveError(err error) error {
+	proxy.serveMu.Lock()
+	defer proxy.serveMu.Unlock()
+
+	if proxy.stopped || err == http.ErrServerClosed {
+		return nil
 	}
+	return err
+}
+
+// Start 启动HTTP代理服务器，阻塞直到 Stop
+func (proxy *Proxy) Start(addr string) error {
+	proxy.log.Infof("启动HTTP代理服务器，监听地址: %s", addr)
+
+	ln, err := proxy.listen(addr)
+	if err != nil || ln == nil {
+		return err
+	}
+	return proxy.serveError(proxy.httpServer.Serve(ln))
+}
+
+// StartTLS 启动HTTPS代理服务器，阻塞直到 Stop
+func (proxy *Proxy) StartTLS(addr string) error {
+	proxy.log.Infof("启动HTTPS代理服务器，监听地址: %s", addr)
 
-	// 启动HTTPS服务器
-	return proxy.httpsServer.ListenAndServeTLS("", "")
+	ln, err := proxy.listen(addr)
+	if err != nil || ln == nil {
+		return err
+	}
+	// 证书由TLSConfig.GetCertificate按SNI选择
+	return proxy.serveError(proxy.httpsServer.ServeTLS(ln, "", ""))
 }
 
 // handleHTTPRequest 处理HTTP请求（用于HTTPS）
@@ -175,14 +294,64 @@ func (proxy *Proxy) handleHTTPRequest(w http.ResponseWriter, r *http.Request) {
 		domain = r.TLS.ServerName
 	}
 
-	proxy.log.Debugf("处理HTTPS请求: %s %s", domain, r.URL.Path)
+	// 确定请求ID
+	clientIP, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		clientIP = r.RemoteAddr
+	}
+	requestID := proxy.resolveRequestID(net.ParseIP(clientIP), r.Header.Get(RequestIDHeader))
+	w.Header().Set(RequestIDHeader, requestID)
+	log := proxy.log.WithField("request_id", requestID)
+
+	// 提取上游链路上下文，开始服务端Span
+	span := proxy.tracer.StartServerSpan(r.Header.Get, start)
+
+	// 请求结束时记录访问日志
+	entry := &AccessLogEntry{
+		Timestamp: start,
+		RequestID: requestID,
+		Protocol:  "https",
+		ClientIP:  clientIP,
+		Method:    r.Method,
+		Host:      domain,
+		Path:      r.URL.Path,
+		span:      span,
+	}
+	if span != nil {
+		entry.TraceID = span.TraceID.String()
+	}
+	recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+	w = recorder
+	body := &countingReader{ReadCloser: r.Body}
+	if bodyBytes := proxy.taps.BodyBytes(); bodyBytes > 0 {
+		body.capture = &limitedBuffer{limit: bodyBytes}
+		recorder.capture = &limitedBuffer{limit: bodyBytes}
+	}
+	var rule *RouteRule
+	defer func() {
+		entry.Status = recorder.status
+		entry.BytesIn = body.n
+		if entry.BytesIn == 0 && r.ContentLength > 0 {
+			entry.BytesIn = r.ContentLength
+		}
+		entry.BytesOut = recorder.bytes
+		entry.Latency = time.Since(start)
+		var capture *TapCapture
+		if proxy.taps.Active() {
+			capture = httpTapCapture(r, recorder.Header(), body.capture, recorder.capture)
+		}
+		proxy.finishRequest(entry, rule, capture)
+	}()
+
+	log.Debugf("处理HTTPS请求: %s %s", domain, r.URL.Path)
 
 	// 查找路由规则
-	rule := proxy.findRouteForDomain(domain, r.URL.Path)
+	rule = proxy.findRouteForDomain(domain, r.URL.Path)
+	proxy.tracer.Sample(span, rule)
 	if rule == nil {
-		proxy.log.Warnf("未找到匹配的路由规则: %s%s", domain, r.URL.Path)
-		http.Error(w, "404 Not Found", http.StatusNotFound)
-		proxy.metrics.IncStatusCodes(404)
+		entry.AddFlag(FlagNoRoute)
+		log.Warnf("未找到匹配的路由规则: %s%s", domain, r.URL.Path)
+		http.Error(w, errorBody(http.StatusNotFound, requestID), http.StatusNotFound)
 		return
 	}
 
@@ -196,31 +365,55 @@ func (proxy *Proxy) handleHTTPRequest(w http.ResponseWriter, r *http.Request) {
 
 	// 选择上游服务
 	upstream := proxy.router.GetUpstream(rule, headers)
-	if upstream == nil || len(upstream.Addresses) == 0 {
-		proxy.log.Errorf("没有可用的上游服务: %s", rule.Domain)
-		http.Error(w, "503 Service Unavailable", http.StatusServiceUnavailable)
-		proxy.metrics.IncStatusCodes(503)
+	if upstream != nil && upstream.Kind == UpstreamKindInvalid {
+		entry.AddFlag(FlagInvalidUpstream)
+		entry.Upstream = upstream.Name
+		log.Errorf("上游服务引用无效: %s", upstream.Name)
+		http.Error(w, errorBody(http.StatusInternalServerError, requestID), http.StatusInternalServerError)
 		return
 	}
+	backendAddr := proxy.pickAddress(upstream, clientIP)
+	if backendAddr == "" {
+		entry.AddFlag(FlagNoHealthyUpstream)
+		log.Errorf("没有可用的上游服务: %s", rule.Domain)
+		http.Error(w, errorBody(http.StatusServiceUnavailable, requestID), http.StatusServiceUnavailable)
+		return
+	}
+	defer proxy.balancer.Done(backendAddr)
 
-	// 选择后端地址（简单的轮询）
-	backendAddr := upstream.Addresses[0] // 简化处理，实际应该使用负载均衡算法
+	backendPort := upstream.PortOf(backendAddr)
+	entry.Upstream = upstream.Name
+	entry.UpstreamAddr = net.JoinHostPort(backendAddr, strconv.Itoa(backendPort))
+
+	client, scheme, err := proxy.httpClient(upstream)
+	if err != nil {
+		entry.AddFlag(FlagUpstreamFailure)
+		log.Errorf("转发请求失败: %v", err)
+		http.Error(w, errorBody(http.StatusBadGateway, requestID), http.StatusBadGateway)
+		return
+	}
 
 	// 构建目标URL
-	targetURL := fmt.Sprintf("http://%s:%d%s", backendAddr, upstream.Port, r.URL.Path)
+	targetURL := fmt.Sprintf("%s://%s%s", scheme, entry.UpstreamAddr, r.URL.Path)
 	if r.URL.RawQuery != "" {
 		targetURL += "?" + r.URL.RawQuery
 	}
 
 	// 创建转发请求
-	req, err := http.NewRequest(r.Method, targetURL, r.Body)
+	req, err := http.NewRequest(r.Method, targetURL, body)
 	if err != nil {
-		proxy.log.Errorf("创建转发请求失败: %v", err)
-		http.Error(w, "500 Internal Server Error", http.StatusInternalServerError)
-		proxy.metrics.IncStatusCodes(500)
+		entry.AddFlag(FlagInternalError)
+		log.Errorf("创建转发请求失败: %v", err)
+		http.Error(w, errorBody(http.StatusInternalServerError, requestID), http.StatusInternalServerError)
 		return
 	}
 
+	req.ContentLength = r.ContentLength
+	// dns类型的上游按域名提供服务，Host与SNI一致使用上游域名
+	if upstream.Kind == UpstreamKindDNS {
+		req.Host = upstream.Host
+	}
+
 	// 复制请求头
 	for key, values := range r.Header {
 		for _, value := range values {
@@ -228,12 +421,36 @@ func (proxy *Proxy) handleHTTPRequest(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	req.Header.Set(RequestIDHeader, requestID)
+
+	// 传播链路上下文
+	attempt := span.StartChild(upstreamSpanName(r.Method, upstream))
+	attempt.Inject(req.Header)
+
+	// 执行请求头操作
+	vars := &HeaderVars{
+		ClientIP:     clientIP,
+		Route:        rule.Key(),
+		Upstream:     upstream.Name,
+		UpstreamAddr: entry.UpstreamAddr,
+		RequestID:    requestID,
+		Host:         domain,
+	}
+	applyRequestHeaders(req.Header, rule, upstream, vars)
+
 	// 转发请求
-	resp, err := http.DefaultClient.Do(req)
+	upstreamStart := time.Now()
+	resp, err := client.Do(req)
+	entry.UpstreamLatency = time.Since(upstreamStart)
+	upstreamStatus := 0
+	if resp != nil {
+		upstreamStatus = resp.StatusCode
+	}
+	finishUpstreamSpan(attempt, r.Method, targetURL, backendAddr, backendPort, 0, upstreamStatus, err)
 	if err != nil {
-		proxy.log.Errorf("转发请求失败: %v", err)
-		http.Error(w, "502 Bad Gateway", http.StatusBadGateway)
-		proxy.metrics.IncStatusCodes(502)
+		entry.AddFlag(FlagUpstreamFailure)
+		log.Errorf("转发请求失败: %v", err)
+		http.Error(w, errorBody(http.StatusBadGateway, requestID), http.StatusBadGateway)
 		return
 	}
 	defer resp.Body.Close()
@@ -245,20 +462,66 @@ func (proxy *Proxy) handleHTTPRequest(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// 执行响应头操作，请求ID始终以网关为准
+	w.Header().Set(RequestIDHeader, requestID)
+	applyResponseHeaders(w.Header(), rule, upstream, vars)
+
 	// 设置状态码
 	w.WriteHeader(resp.StatusCode)
 
-	// 复制响应体
-	if _, err := io.Copy(w, resp.Body); err != nil {
-		proxy.log.Errorf("复制响应体失败: %v", err)
+	// 复制响应体，HTTP/2上游（gRPC流）每次读取后立即发送
+	var dst io.Writer = w
+	if upstream.Protocol == UpstreamProtocolH2C {
+		if flusher, ok := w.(http.Flusher); ok {
+			dst = &flushWriter{w: w, flusher: flusher}
+		}
+	}
+	if _, err := io.Copy(dst, resp.Body); err != nil {
+		entry.AddFlag(FlagDownstreamAbort)
+		log.Errorf("复制响应体失败: %v", err)
+	}
+
+	// 复制响应尾部（gRPC通过trailer返回grpc-status）
+	for key, values := range resp.Trailer {
+		for _, value := range values {
+			w.Header().Add(http.TrailerPrefix+key, value)
+		}
 	}
 
-	// 记录指标
 	duration := time.Since(start)
-	proxy.metrics.RecordLatency(duration)
-	proxy.metrics.IncStatusCodes(resp.StatusCode)
 
-	proxy.log.Debugf("HTTPS请求处理完成: %s -> %s, 耗时: %v", domain, targetURL, duration)
+	log.Debugf("HTTPS请求处理完成: %s -> %s, 耗时: %v", domain, targetURL, duration)
+}
+
+// newH2CClient 创建明文HTTP/2客户端
+func newH2CClient() *http.Client {
+	return &http.Client{
+		CheckRedirect: noRedirect,
+		Transport: &http2.Transport{
+			AllowHTTP: true,
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, network, addr)
+			},
+		},
+	}
+}
+
+// noRedirect 上游的重定向原样返回给客户端，由客户端决定是否跟随
+func noRedirect(*http.Request, []*http.Request) error {
+	return http.ErrUseLastResponse
+}
+
+// flushWriter 每次写入后立即发送给客户端
+type flushWriter struct {
+	w       io.Writer
+	flusher http.Flusher
+}
+
+func (fw *flushWriter) Write(p []byte) (int, error) {
+	n, err := fw.w.Write(p)
+	fw.flusher.Flush()
+	return n, err
 }
 
 // findRouteForDomain 根据域名和路径查找路由规则
@@ -271,6 +534,11 @@ func (proxy *Proxy) AddCertificate(domain, certFile, keyFile string) error {
 	return proxy.certManager.AddCertificate(domain, certFile, keyFile)
 }
 
+// AddCertificatePEM 使用PEM内容添加HTTPS证书
+func (proxy *Proxy) AddCertificatePEM(domain string, certPEM, keyPEM []byte) error {
+	return proxy.certManager.AddCertificatePEM(domain, certPEM, keyPEM)
+}
+
 // RemoveCertificate 移除HTTPS证书
 func (proxy *Proxy) RemoveCertificate(domain string) {
 	proxy.certManager.RemoveCertificate(domain)
@@ -281,9 +549,23 @@ func (proxy *Proxy) Stop() {
 	proxy.cancel()
 	proxy.client.CloseIdleConnections()
 
-	// 优雅关闭HTTPS服务器
-	if proxy.httpsServer != nil {
-		proxy.httpsServer.Shutdown(context.Background())
+	proxy.serveMu.Lock()
+	proxy.stopped = true
+	listeners := proxy.listeners
+	proxy.serveMu.Unlock()
+
+	// 优雅关闭HTTP/HTTPS服务器，再关闭尚未进入Serve的监听
+	proxy.httpServer.Shutdown()
+	proxy.httpsServer.Shutdown(context.Background())
+	for _, ln := range listeners {
+		ln.Close()
+	}
+
+	// 上报剩余的Span，写完剩余的访问日志
+	proxy.tracer.Close()
+
+	if proxy.accessLog != nil {
+		proxy.accessLog.Close()
 	}
 
 	proxy.log.Info("数据面代理服务器已停止")
@@ -298,13 +580,52 @@ func (proxy *Proxy) handleRequest(ctx *fasthttp.RequestCtx) {
 	// 记录请求开始
 	proxy.metrics.IncRequests()
 
+	// 确定请求ID
+	requestID := proxy.resolveRequestID(ctx.RemoteIP(), string(ctx.Request.Header.Peek(RequestIDHeader)))
+	ctx.Request.Header.Set(RequestIDHeader, requestID)
+	log := proxy.log.WithField("request_id", requestID)
+
+	// 提取上游链路上下文，开始服务端Span
+	span := proxy.tracer.StartServerSpan(func(name string) string {
+		return string(ctx.Request.Header.Peek(name))
+	}, start)
+
+	// 请求结束时记录访问日志
+	entry := &AccessLogEntry{
+		Timestamp: start,
+		RequestID: requestID,
+		Protocol:  "http",
+		ClientIP:  ctx.RemoteIP().String(),
+		Method:    string(ctx.Method()),
+		Host:      string(ctx.Host()),
+		Path:      string(ctx.Path()),
+		BytesIn:   int64(len(ctx.Request.Body())),
+		span:      span,
+	}
+	if span != nil {
+		entry.TraceID = span.TraceID.String()
+	}
+	var rule *RouteRule
+	defer func() {
+		entry.Status = ctx.Response.StatusCode()
+		entry.BytesOut = int64(len(ctx.Response.Body()))
+		entry.Latency = time.Since(start)
+		var capture *TapCapture
+		if proxy.taps.Active() {
+			capture = fasthttpTapCapture(ctx, proxy.taps.BodyBytes())
+		}
+		proxy.finishRequest(entry, rule, capture)
+	}()
+
 	// 查找路由规则
-	rule := proxy.router.FindRoute(ctx)
+	rule = proxy.router.FindRoute(ctx)
+	proxy.tracer.Sample(span, rule)
 	if rule == nil {
-		proxy.log.Warnf("未找到匹配的路由规则: %s%s", ctx.Host(), ctx.Path())
+		entry.AddFlag(FlagNoRoute)
+		log.Warnf("未找到匹配的路由规则: %s%s", ctx.Host(), ctx.Path())
 		ctx.SetStatusCode(fasthttp.StatusNotFound)
-		ctx.SetBodyString("404 Not Found")
-		proxy.metrics.IncStatusCodes(404)
+		ctx.SetBodyString(errorBody(fasthttp.StatusNotFound, requestID))
+		ctx.Response.Header.Set(RequestIDHeader, requestID)
 		return
 	}
 
@@ -316,19 +637,42 @@ func (proxy *Proxy) handleRequest(ctx *fasthttp.RequestCtx) {
 
 	// 选择上游服务
 	upstream := proxy.router.GetUpstream(rule, headers)
-	if upstream == nil || len(upstream.Addresses) == 0 {
-		proxy.log.Errorf("没有可用的上游服务: %s", rule.Domain)
+	if upstream != nil && upstream.Kind == UpstreamKindInvalid {
+		entry.AddFlag(FlagInvalidUpstream)
+		entry.Upstream = upstream.Name
+		log.Errorf("上游服务引用无效: %s", upstream.Name)
+		ctx.SetStatusCode(fasthttp.StatusInternalServerError)
+		ctx.SetBodyString(errorBody(fasthttp.StatusInternalServerError, requestID))
+		ctx.Response.Header.Set(RequestIDHeader, requestID)
+		return
+	}
+	backendAddr := proxy.pickAddress(upstream, entry.ClientIP)
+	if backendAddr == "" {
+		entry.AddFlag(FlagNoHealthyUpstream)
+		log.Errorf("没有可用的上游服务: %s", rule.Domain)
 		ctx.SetStatusCode(fasthttp.StatusServiceUnavailable)
-		ctx.SetBodyString("503 Service Unavailable")
-		proxy.metrics.IncStatusCodes(503)
+		ctx.SetBodyString(errorBody(fasthttp.StatusServiceUnavailable, requestID))
+		ctx.Response.Header.Set(RequestIDHeader, requestID)
 		return
 	}
+	defer proxy.balancer.Done(backendAddr)
 
-	// 选择后端地址（简单的轮询）
-	backendAddr := upstream.Addresses[0] // 简化处理，实际应该使用负载均衡算法
+	backendPort := upstream.PortOf(backendAddr)
+	entry.Upstream = upstream.Name
+	entry.UpstreamAddr = net.JoinHostPort(backendAddr, strconv.Itoa(backendPort))
+
+	client, scheme, err := proxy.fastClient(upstream)
+	if err != nil {
+		entry.AddFlag(FlagUpstreamFailure)
+		log.Errorf("转发请求失败: %v", err)
+		ctx.SetStatusCode(fasthttp.StatusBadGateway)
+		ctx.SetBodyString(errorBody(fasthttp.StatusBadGateway, requestID))
+		ctx.Response.Header.Set(RequestIDHeader, requestID)
+		return
+	}
 
 	// 构建目标URL
-	targetURL := fmt.Sprintf("http://%s:%d%s", backendAddr, upstream.Port, ctx.Path())
+	targetURL := fmt.Sprintf("%s://%s%s", scheme, entry.UpstreamAddr, ctx.Path())
 
 	// 创建转发请求
 	req := fasthttp.AcquireRequest()
@@ -339,26 +683,119 @@ func (proxy *Proxy) handleRequest(ctx *fasthttp.RequestCtx) {
 	// 复制请求
 	ctx.Request.CopyTo(req)
 	req.SetRequestURI(targetURL)
+	// dns类型的上游按域名提供服务，Host与SNI一致使用上游域名
+	if upstream.Kind == UpstreamKindDNS {
+		req.Header.SetHost(upstream.Host)
+		req.UseHostHeader = true
+	}
+
+	// 传播链路上下文
+	attempt := span.StartChild(upstreamSpanName(entry.Method, upstream))
+	attempt.Inject(&req.Header)
+
+	// 执行请求头操作
+	vars := &HeaderVars{
+		ClientIP:     entry.ClientIP,
+		Route:        rule.Key(),
+		Upstream:     upstream.Name,
+		UpstreamAddr: entry.UpstreamAddr,
+		RequestID:    requestID,
+		Host:         string(ctx.Host()),
+	}
+	applyRequestHeaders(&req.Header, rule, upstream, vars)
 
 	// 转发请求
-	err := proxy.client.Do(req, resp)
+	upstreamStart := time.Now()
+	err = client.Do(req, resp)
+	entry.UpstreamLatency = time.Since(upstreamStart)
+	finishUpstreamSpan(attempt, entry.Method, targetURL, backendAddr, backendPort, 0, resp.StatusCode(), err)
 	if err != nil {
-		proxy.log.Errorf("转发请求失败: %v", err)
+		entry.AddFlag(FlagUpstreamFailure)
+		log.Errorf("转发请求失败: %v", err)
 		ctx.SetStatusCode(fasthttp.StatusBadGateway)
-		ctx.SetBodyString("502 Bad Gateway")
-		proxy.metrics.IncStatusCodes(502)
+		ctx.SetBodyString(errorBody(fasthttp.StatusBadGateway, requestID))
+		ctx.Response.Header.Set(RequestIDHeader, requestID)
 		return
 	}
 
 	// 复制响应
 	resp.CopyTo(&ctx.Response)
 
-	// 记录指标
+	// 执行响应头操作，请求ID始终以网关为准
+	ctx.Response.Header.Set(RequestIDHeader, requestID)
+	applyResponseHeaders(&ctx.Response.Header, rule, upstream, vars)
+
 	duration := time.Since(start)
-	proxy.metrics.RecordLatency(duration)
-	proxy.metrics.IncStatusCodes(ctx.Response.StatusCode())
 
-	proxy.log.Debugf("请求处理完成: %s -> %s, 耗时: %v", ctx.Host(), targetURL, duration)
+	log.Debugf("请求处理完成: %s -> %s, 耗时: %v", ctx.Host(), targetURL, duration)
+}
+
+// SetAccessLogger 设置访问日志记录器，为nil时不记录访问日志
+func (proxy *Proxy) SetAccessLogger(accessLog *AccessLogger) {
+	proxy.accessLog = accessLog
+}
+
+// finishRequest 请求结束时记录指标、访问日志并分发给流量抓取，所有处理路径（包括提前返回）都经过这里
+func (proxy *Proxy) finishRequest(entry *AccessLogEntry, rule *RouteRule, capture *TapCapture) {
+	// 5xx或网关标记了异常（未匹配路由、上游失败等）的请求记为失败
+	failed := entry.Status >= 500 || len(entry.Flags) > 0
+
+	proxy.metrics.IncResponses()
+	proxy.metrics.IncStatusCodes(entry.Status)
+	proxy.metrics.RecordLatency(entry.Latency)
+
+	labels := SeriesLabels{
+		Domain:      unmatchedLabel,
+		Upstream:    entry.Upstream,
+		Address:     entry.UpstreamAddr,
+		StatusClass: statusClass(entry.Status),
+	}
+	if rule != nil {
+		labels.Domain = rule.Domain
+		labels.Route = rule.Key()
+		entry.Route = labels.Route
+	}
+	proxy.metrics.RecordRequest(labels, entry.BytesIn, entry.BytesOut, entry.Latency, entry.UpstreamLatency)
+	if rule != nil {
+		proxy.metrics.RecordTraffic(labels.Domain, labels.Route, labels.Upstream, !failed, entry.Latency, entry.BytesIn, entry.BytesOut)
+		proxy.metrics.RecordDimensionLatency(labels.Domain, labels.Route, labels.Upstream, entry.Latency)
+		proxy.metrics.RecordTimeSeries(rule.Domain, failed, entry.BytesIn, entry.BytesOut, entry.Latency)
+	} else {
+		proxy.metrics.RecordTraffic(unmatchedLabel, "", "", false, entry.Latency, entry.BytesIn, entry.BytesOut)
+		proxy.metrics.RecordTimeSeries("", failed, entry.BytesIn, entry.BytesOut, entry.Latency)
+	}
+
+	proxy.tracer.finishServerSpan(entry.span, entry, rule)
+	proxy.logAccess(entry, rule)
+
+	if capture != nil {
+		proxy.taps.Publish(entry, capture)
+	}
+}
+
+// logAccess 按路由配置提交访问日志
+func (proxy *Proxy) logAccess(entry *AccessLogEntry, rule *RouteRule) {
+	if proxy.accessLog == nil {
+		return
+	}
+
+	if rule != nil && rule.AccessLog != nil {
+		if rule.AccessLog.Disabled {
+			return
+		}
+		entry.sampleRate = rule.AccessLog.SampleRate
+	}
+	proxy.accessLog.Log(entry)
+}
+
+// SetTracer 设置链路追踪，为nil时不追踪
+func (proxy *Proxy) SetTracer(tracer *Tracer) {
+	proxy.tracer = tracer
+}
+
+// Taps 获取流量抓取管理器
+func (proxy *Proxy) Taps() *TapManager {
+	return proxy.taps
 }
 
 // GetMetrics 获取监控指标
@@ -366,6 +803,34 @@ func (proxy *Proxy) GetMetrics() *Metrics {
 	return proxy.metrics
 }
 
+// WritePrometheus 以Prometheus文本格式输出代理的全部监控指标
+func (proxy *Proxy) WritePrometheus(w io.Writer) error {
+	if err := proxy.metrics.WritePrometheus(w); err != nil {
+		return err
+	}
+	if err := proxy.tracer.writePrometheus(w); err != nil {
+		return err
+	}
+	if err := proxy.balancer.writePrometheus(w); err != nil {
+		return err
+	}
+	return writeUpstreamHealth(w, proxy.router.Rules())
+}
+
+// serverErrorLog 接收net/http服务器的内部错误日志，并统计TLS握手失败
+type serverErrorLog struct {
+	proxy *Proxy
+}
+
+func (l *serverErrorLog) Write(p []byte) (int, error) {
+	msg := strings.TrimSpace(string(p))
+	if strings.Contains(msg, "TLS handshake error") {
+		l.proxy.metrics.IncTLSHandshake(false)
+	}
+	l.proxy.log.Debug(msg)
+	return len(p), nil
+}
+
 // GetConnectionCount 获取当前连接数
 func (proxy *Proxy) GetConnectionCount() int64 {
 	return atomic.LoadInt64(&proxy.connCount)
@@ -0,0 +1,57 @@
+package dataplane
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/valyala/fasthttp"
+)
+
+func TestProxyDNSUpstreamHost(t *testing.T) {
+	hosts := make(chan string, 1)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hosts <- r.Host
+	}))
+	defer backend.Close()
+	_, portValue, _ := net.SplitHostPort(backend.Listener.Addr().String())
+	port, _ := strconv.Atoi(portValue)
+
+	log := logrus.New()
+	log.SetLevel(logrus.PanicLevel)
+	router := NewRouter(log)
+	router.UpdateRules([]*RouteRule{{
+		Domain:    "gw.example.com",
+		Path:      "/",
+		PathType:  PathMatchPrefix,
+		Upstreams: []Upstream{{Name: "external", Kind: UpstreamKindDNS, Host: "backend.example.com", Port: port, Weight: 1, Healthy: true}},
+	}})
+	proxy := NewProxy(router, log)
+	// 预置解析结果，避免依赖真实的DNS
+	entry := &dnsEntry{addresses: []string{"127.0.0.1"}, expires: time.Now().Add(time.Hour), ready: make(chan struct{})}
+	close(entry.ready)
+	proxy.resolver.entries["backend.example.com"] = entry
+
+	recorder := httptest.NewRecorder()
+	proxy.handleHTTPRequest(recorder, httptest.NewRequest(http.MethodGet, "https://gw.example.com/api", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("HTTPS请求返回 %d", recorder.Code)
+	}
+	if host := <-hosts; host != "backend.example.com" {
+		t.Errorf("HTTPS请求转发的Host为 %s，期望上游域名", host)
+	}
+
+	var ctx fasthttp.RequestCtx
+	ctx.Request.SetRequestURI("http://gw.example.com/api")
+	proxy.handleRequest(&ctx)
+	if ctx.Response.StatusCode() != http.StatusOK {
+		t.Fatalf("HTTP请求返回 %d", ctx.Response.StatusCode())
+	}
+	if host := <-hosts; host != "backend.example.com" {
+		t.Errorf("HTTP请求转发的Host为 %s，期望上游域名", host)
+	}
+}
@@ -0,0 +1,99 @@
+package dataplane
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// RequestIDHeader 请求ID的Header名称
+const RequestIDHeader = "X-Request-Id"
+
+// maxRequestIDLength 接受的外部请求ID最大长度
+const maxRequestIDLength = 128
+
+// requestIDFallback 随机数生成失败时使用的自增序号
+var requestIDFallback uint64
+
+// generateRequestID 生成32位十六进制的请求ID
+func generateRequestID() string {
+	var buf [16]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return fmt.Sprintf("%x-%x", time.Now().UnixNano(), atomic.AddUint64(&requestIDFallback, 1))
+	}
+	return hex.EncodeToString(buf[:])
+}
+
+// validRequestID 检查外部传入的请求ID是否可用：非空、长度受限且只包含可见ASCII字符
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// SetTrustedProxies 设置可信来源网段，来自这些地址的请求会沿用其携带的X-Request-Id
+func (proxy *Proxy) SetTrustedProxies(cidrs []string) error {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		cidr = strings.TrimSpace(cidr)
+		if cidr == "" {
+			continue
+		}
+		// 兼容单个IP
+		if !strings.Contains(cidr, "/") {
+			if ip := net.ParseIP(cidr); ip != nil && ip.To4() != nil {
+				cidr += "/32"
+			} else {
+				cidr += "/128"
+			}
+		}
+
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return fmt.Errorf("无效的可信网段 %s: %v", cidr, err)
+		}
+		nets = append(nets, ipNet)
+	}
+
+	proxy.trustedProxies.Store(nets)
+	proxy.log.Infof("可信来源网段已更新，共 %d 个", len(nets))
+	return nil
+}
+
+// isTrustedSource 判断客户端地址是否来自可信来源
+func (proxy *Proxy) isTrustedSource(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	nets, _ := proxy.trustedProxies.Load().([]*net.IPNet)
+	for _, ipNet := range nets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveRequestID 确定请求ID：可信来源携带的合法ID直接沿用，否则重新生成
+func (proxy *Proxy) resolveRequestID(clientIP net.IP, incoming string) string {
+	if validRequestID(incoming) && proxy.isTrustedSource(clientIP) {
+		return incoming
+	}
+	return generateRequestID()
+}
+
+// errorBody 网关生成的错误响应体，附带请求ID便于排查
+func errorBody(statusCode int, requestID string) string {
+	return fmt.Sprintf("%d %s\nrequest_id: %s\n", statusCode, http.StatusText(statusCode), requestID)
+}
@@ -0,0 +1,310 @@
+package dataplane
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	// minDNSTTL 最短的重新解析间隔，避免TTL为0的记录每个请求都解析
+	minDNSTTL = 5 * time.Second
+	// maxDNSTTL 最长的重新解析间隔
+	maxDNSTTL = time.Hour
+	// dnsFailureRetry 解析失败后重试的间隔，期间继续使用上次的结果
+	dnsFailureRetry = 5 * time.Second
+	// dnsQueryTimeout 单次DNS查询的超时
+	dnsQueryTimeout = 2 * time.Second
+	// dnsIdleTimeout 超过该时间没有请求的域名不再保留
+	dnsIdleTimeout = 10 * time.Minute
+	// dnsUDPSize 通过EDNS0声明的UDP应答大小，与接收缓冲区一致
+	dnsUDPSize = 4096
+	// resolvConfPath 读取DNS服务器地址的文件
+	resolvConfPath = "/etc/resolv.conf"
+)
+
+// DNSResolver 解析dns类型上游的域名，按DNS记录的TTL缓存结果。
+// 过期后继续使用旧结果并在后台重新解析，只有第一次解析时请求需要等待
+type DNSResolver struct {
+	servers   []string
+	entries   map[string]*dnsEntry
+	lastSweep time.Time
+	mu        sync.Mutex
+	log       *logrus.Logger
+}
+
+type dnsEntry struct {
+	addresses []string
+	expires   time.Time
+	lastUsed  time.Time
+	// refreshing 正在解析，避免同时发起多次查询
+	refreshing bool
+	// ready 第一次解析完成（无论成功与否）后关闭
+	ready chan struct{}
+}
+
+// NewDNSResolver 创建DNS解析器，使用 /etc/resolv.conf 中的DNS服务器
+func NewDNSResolver(log *logrus.Logger) *DNSResolver {
+	return &DNSResolver{
+		servers:   readNameservers(resolvConfPath),
+		entries:   make(map[string]*dnsEntry),
+		lastSweep: time.Now(),
+		log:       log,
+	}
+}
+
+// Resolve 返回域名当前的地址，解析失败且没有旧结果时返回空列表
+func (r *DNSResolver) Resolve(host string) []string {
+	if net.ParseIP(host) != nil {
+		return []string{host}
+	}
+
+	now := time.Now()
+	r.mu.Lock()
+	entry, ok := r.entries[host]
+	switch {
+	case !ok:
+		entry = &dnsEntry{refreshing: true, ready: make(chan struct{})}
+		r.entries[host] = entry
+		go r.refresh(host, entry)
+	case !entry.refreshing && !now.Before(entry.expires):
+		entry.refreshing = true
+		go r.refresh(host, entry)
+	}
+	entry.lastUsed = now
+	if now.Sub(r.lastSweep) >= dnsIdleTimeout {
+		r.sweepLocked(now)
+	}
+	r.mu.Unlock()
+
+	<-entry.ready
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return entry.addresses
+}
+
+// refresh 解析域名并更新缓存，失败时保留旧结果
+func (r *DNSResolver) refresh(host string, entry *dnsEntry) {
+	addresses, ttl, err := r.lookup(host)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry.refreshing = false
+	if err != nil {
+		r.log.Warnf("解析上游域名 %s 失败: %v", host, err)
+		entry.expires = time.Now().Add(dnsFailureRetry)
+	} else {
+		if !equalAddresses(entry.addresses, addresses) {
+			r.log.Infof("上游域名 %s 解析为 %v，TTL %v", host, addresses, ttl)
+		}
+		entry.addresses = addresses
+		entry.expires = time.Now().Add(ttl)
+	}
+	select {
+	case <-entry.ready:
+	default:
+		close(entry.ready)
+	}
+}
+
+// sweepLocked 清理长时间没有请求的域名
+func (r *DNSResolver) sweepLocked(now time.Time) {
+	for host, entry := range r.entries {
+		if !entry.refreshing && now.Sub(entry.lastUsed) >= dnsIdleTimeout {
+			delete(r.entries, host)
+		}
+	}
+	r.lastSweep = now
+}
+
+// lookup 依次查询A和AAAA记录，返回地址和TTL；查不到时（如需要search域的短域名）使用系统解析，按最短间隔重新解析
+func (r *DNSResolver) lookup(host string) ([]string, time.Duration, error) {
+	name := host
+	if !strings.HasSuffix(name, ".") {
+		name += "."
+	}
+	for _, qtype := range []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA} {
+		addresses, ttl, err := r.query(name, qtype)
+		if err == nil && len(addresses) > 0 {
+			return addresses, clampTTL(ttl), nil
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), dnsQueryTimeout)
+	defer cancel()
+	addresses, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		return nil, 0, err
+	}
+	sort.Strings(addresses)
+	return addresses, minDNSTTL, nil
+}
+
+// query 向DNS服务器查询一种记录，返回地址和所有应答记录（包括CNAME）中最小的TTL
+func (r *DNSResolver) query(name string, qtype dnsmessage.Type) ([]string, time.Duration, error) {
+	qname, err := dnsmessage.NewName(name)
+	if err != nil {
+		return nil, 0, err
+	}
+	id := uint16(rand.Intn(1 << 16))
+	// 带上EDNS0的OPT记录，地址较多的域名应答超过512字节时不会被截断
+	var opt dnsmessage.ResourceHeader
+	if err := opt.SetEDNS0(dnsUDPSize, dnsmessage.RCodeSuccess, false); err != nil {
+		return nil, 0, err
+	}
+	request := dnsmessage.Message{
+		Header:      dnsmessage.Header{ID: id, RecursionDesired: true},
+		Questions:   []dnsmessage.Question{{Name: qname, Type: qtype, Class: dnsmessage.ClassINET}},
+		Additionals: []dnsmessage.Resource{{Header: opt, Body: &dnsmessage.OPTResource{}}},
+	}
+	packet, err := request.Pack()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var lastErr error
+	for _, server := range r.servers {
+		response, err := exchangeDNS("udp", server, packet, id)
+		if err == nil && response.Truncated {
+			// UDP应答仍被截断时改用TCP查询完整的结果
+			response, err = exchangeDNS("tcp", server, packet, id)
+		}
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if response.RCode != dnsmessage.RCodeSuccess {
+			return nil, 0, fmt.Errorf("DNS服务器 %s 返回 %v", server, response.RCode)
+		}
+
+		var addresses []string
+		var ttl uint32
+		for i, answer := range response.Answers {
+			if i == 0 || answer.Header.TTL < ttl {
+				ttl = answer.Header.TTL
+			}
+			switch body := answer.Body.(type) {
+			case *dnsmessage.AResource:
+				addresses = append(addresses, net.IP(body.A[:]).String())
+			case *dnsmessage.AAAAResource:
+				addresses = append(addresses, net.IP(body.AAAA[:]).String())
+			}
+		}
+		sort.Strings(addresses)
+		return addresses, time.Duration(ttl) * time.Second, nil
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("没有可用的DNS服务器")
+	}
+	return nil, 0, lastErr
+}
+
+// exchangeDNS 发送一次DNS查询，network为udp或tcp，TCP的消息前带两字节的长度
+func exchangeDNS(network, server string, packet []byte, id uint16) (*dnsmessage.Message, error) {
+	conn, err := net.DialTimeout(network, server, dnsQueryTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(dnsQueryTimeout)); err != nil {
+		return nil, err
+	}
+	if network == "tcp" {
+		packet = append([]byte{byte(len(packet) >> 8), byte(len(packet))}, packet...)
+	}
+	if _, err := conn.Write(packet); err != nil {
+		return nil, err
+	}
+
+	if network == "tcp" {
+		var length [2]byte
+		if _, err := io.ReadFull(conn, length[:]); err != nil {
+			return nil, err
+		}
+		buf := make([]byte, int(length[0])<<8|int(length[1]))
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			return nil, err
+		}
+		var response dnsmessage.Message
+		if err := response.Unpack(buf); err != nil {
+			return nil, err
+		}
+		if response.Header.ID != id || !response.Header.Response {
+			return nil, fmt.Errorf("DNS服务器 %s 返回了不属于本次查询的应答", server)
+		}
+		return &response, nil
+	}
+
+	buf := make([]byte, dnsUDPSize)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		var response dnsmessage.Message
+		if err := response.Unpack(buf[:n]); err != nil {
+			return nil, err
+		}
+		// 忽略不属于本次查询的应答
+		if response.Header.ID == id && response.Header.Response {
+			return &response, nil
+		}
+	}
+}
+
+// clampTTL 将TTL限制在允许的范围内
+func clampTTL(ttl time.Duration) time.Duration {
+	if ttl < minDNSTTL {
+		return minDNSTTL
+	}
+	if ttl > maxDNSTTL {
+		return maxDNSTTL
+	}
+	return ttl
+}
+
+// readNameservers 读取resolv.conf中的DNS服务器，读取失败时使用本机
+func readNameservers(path string) []string {
+	var servers []string
+	if file, err := os.Open(path); err == nil {
+		defer file.Close()
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) >= 2 && fields[0] == "nameserver" && net.ParseIP(fields[1]) != nil {
+				servers = append(servers, net.JoinHostPort(fields[1], "53"))
+			}
+		}
+	}
+	if len(servers) == 0 {
+		servers = []string{"127.0.0.1:53"}
+	}
+	return servers
+}
+
+// equalAddresses 比较两个排序后的地址列表是否相同
+func equalAddresses(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
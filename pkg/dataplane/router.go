@@ -2,6 +2,11 @@ package dataplane
 
 import (
 	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
 	"sync/atomic"
 	"time"
 
@@ -11,24 +16,211 @@ import (
 
 // RouteRule 路由规则
 type RouteRule struct {
-	Domain    string            `json:"domain"`
-	Path      string            `json:"path"`
-	Headers   map[string]string `json:"headers"`
-	Upstreams []Upstream        `json:"upstreams"`
-	Weight    map[string]int    `json:"weight"` // 流量权重分配
-	CreatedAt time.Time         `json:"created_at"`
-	UpdatedAt time.Time         `json:"updated_at"`
+	// Domain 为空时匹配所有域名，*.example.com 匹配一级子域名
+	Domain string `json:"domain"`
+	Path   string `json:"path"`
+	// PathType 路径匹配方式，为空时沿用旧的匹配方式：路径精确匹配，否则匹配该域名下的任一规则
+	PathType PathMatchType     `json:"path_type,omitempty"`
+	Headers  map[string]string `json:"headers"`
+	// HeaderRoutes 按顺序匹配的Header子规则，全部未命中时回落到权重分配
+	HeaderRoutes []*HeaderRoute `json:"header_routes,omitempty"`
+	Upstreams    []Upstream     `json:"upstreams"`
+	Weight       map[string]int `json:"weight"` // 流量权重分配
+	// 请求头/响应头操作，先于上游级操作执行
+	RequestHeaders  *HeaderOperations `json:"request_headers,omitempty"`
+	ResponseHeaders *HeaderOperations `json:"response_headers,omitempty"`
+	// AccessLog 路由级访问日志配置（采样率、关闭）
+	AccessLog *RouteAccessLog `json:"access_log,omitempty"`
+	// Tracing 路由级链路追踪配置（采样率、关闭）
+	Tracing   *RouteTracing `json:"tracing,omitempty"`
+	CreatedAt time.Time     `json:"created_at"`
+	UpdatedAt time.Time     `json:"updated_at"`
+}
+
+// Key 路由规则的唯一标识：域名+路径，前缀匹配的规则以*结尾，
+// 同一路径可以同时有精确匹配和前缀匹配的规则（如Ingress的 Exact /foo 和 Prefix /foo）
+func (rule *RouteRule) Key() string {
+	if rule.PathType == PathMatchPrefix {
+		return rule.Domain + rule.Path + "*"
+	}
+	return rule.Domain + rule.Path
+}
+
+// PathMatchType 路径匹配方式
+type PathMatchType string
+
+const (
+	// PathMatchExact 路径精确匹配
+	PathMatchExact PathMatchType = "exact"
+	// PathMatchPrefix 按路径段前缀匹配，/foo 匹配 /foo 和 /foo/bar，不匹配 /foobar
+	PathMatchPrefix PathMatchType = "prefix"
+)
+
+// matchPrefix 判断请求路径是否命中规则的路径前缀，规则路径末尾的 / 不影响匹配（/foo/ 与 /foo 等价）
+func (rule *RouteRule) matchPrefix(path string) bool {
+	prefix := strings.TrimSuffix(rule.Path, "/")
+	if prefix == "" || prefix == path {
+		return true
+	}
+	return strings.HasPrefix(path, prefix) && path[len(prefix)] == '/'
+}
+
+// HeaderMatchType Header匹配方式
+type HeaderMatchType string
+
+const (
+	// HeaderMatchExact 精确匹配
+	HeaderMatchExact HeaderMatchType = "exact"
+	// HeaderMatchPrefix 前缀匹配
+	HeaderMatchPrefix HeaderMatchType = "prefix"
+	// HeaderMatchRegex 正则匹配
+	HeaderMatchRegex HeaderMatchType = "regex"
+)
+
+// HeaderRoute Header路由子规则：Header匹配时转发到指定的上游服务
+type HeaderRoute struct {
+	Header    string          `json:"header"`
+	Value     string          `json:"value"`
+	MatchType HeaderMatchType `json:"match_type"` // 默认为exact
+	Upstream  string          `json:"upstream"`   // 目标上游服务名称，对应Upstream.Name
+
+	regex *regexp.Regexp
+}
+
+// Compile 校验子规则并预编译正则表达式
+func (h *HeaderRoute) Compile() error {
+	if h.Header == "" {
+		return fmt.Errorf("Header名称不能为空")
+	}
+	if h.Upstream == "" {
+		return fmt.Errorf("Header %s 未指定目标上游服务", h.Header)
+	}
+
+	switch h.MatchType {
+	case "", HeaderMatchExact, HeaderMatchPrefix:
+	case HeaderMatchRegex:
+		regex, err := regexp.Compile(h.Value)
+		if err != nil {
+			return fmt.Errorf("Header %s 的正则表达式无效: %v", h.Header, err)
+		}
+		h.regex = regex
+	default:
+		return fmt.Errorf("不支持的Header匹配方式: %s", h.MatchType)
+	}
+	return nil
+}
+
+// Match 判断Header值是否命中子规则
+func (h *HeaderRoute) Match(value string) bool {
+	switch h.MatchType {
+	case HeaderMatchPrefix:
+		return strings.HasPrefix(value, h.Value)
+	case HeaderMatchRegex:
+		if h.regex == nil {
+			return false
+		}
+		return h.regex.MatchString(value)
+	default:
+		return value == h.Value
+	}
 }
 
 // Upstream 上游服务
 type Upstream struct {
-	Name      string   `json:"name"`
-	Addresses []string `json:"addresses"` // Pod IP列表
-	Port      int      `json:"port"`
-	Weight    int      `json:"weight"`
-	Healthy   bool     `json:"healthy"`
+	Name string `json:"name"`
+	// Kind 上游类型，为空时 Addresses 为控制面下发的Pod IP
+	Kind UpstreamKind `json:"kind,omitempty"`
+	// Host dns类型的上游域名，由数据面按DNS记录的TTL重新解析
+	Host      string   `json:"host,omitempty"`
+	Addresses []string `json:"addresses"` // 就绪的Pod IP列表，static类型为固定的IP列表
+	// DrainingAddresses 正在终止但仍能处理请求的Pod IP，新请求不会转发到这些地址，
+	// 只用于会话保持到这些地址的请求，以及没有就绪地址的情况
+	DrainingAddresses []string `json:"draining_addresses,omitempty"`
+	Port              int      `json:"port"`
+	// AddressPorts 端口与 Port 不同的地址（同一Service端口在不同Pod上的targetPort可能不同）
+	AddressPorts map[string]int `json:"address_ports,omitempty"`
+	Weight       int            `json:"weight"`
+	Healthy      bool           `json:"healthy"`
+	// SessionAffinity 为 ClientIP 时同一客户端的请求转发到同一地址，AffinityTimeout 为会话保持时长（秒）
+	SessionAffinity SessionAffinity `json:"session_affinity,omitempty"`
+	AffinityTimeout int             `json:"affinity_timeout,omitempty"`
+	// Protocol 转发到上游使用的协议，为空时使用HTTP/1.1
+	Protocol UpstreamProtocol `json:"protocol,omitempty"`
+	// TLS 不为空时使用TLS连接上游
+	TLS *UpstreamTLS `json:"tls,omitempty"`
+	// Topology 不为空时按拓扑就近转发，Locality 为就绪和终止中地址所在的位置，
+	// UnreadyLocality 为未就绪Pod所在的位置，用于计算本地Pod的就绪比例
+	Topology        *TopologyPolicy     `json:"topology,omitempty"`
+	Locality        map[string]Locality `json:"locality,omitempty"`
+	UnreadyLocality []Locality          `json:"unready_locality,omitempty"`
+	// 请求头/响应头操作，在路由级操作之后执行
+	RequestHeaders  *HeaderOperations `json:"request_headers,omitempty"`
+	ResponseHeaders *HeaderOperations `json:"response_headers,omitempty"`
+}
+
+// PortOf 返回转发到指定地址使用的端口
+func (u *Upstream) PortOf(address string) int {
+	if port, ok := u.AddressPorts[address]; ok {
+		return port
+	}
+	return u.Port
+}
+
+// UpstreamKind 上游类型
+type UpstreamKind string
+
+const (
+	// UpstreamKindStatic 固定的地址列表，如集群外的虚拟机
+	UpstreamKindStatic UpstreamKind = "static"
+	// UpstreamKindDNS 域名，数据面解析后在解析结果间轮询，如ExternalName Service、托管数据库的HTTP API
+	UpstreamKindDNS UpstreamKind = "dns"
+	// UpstreamKindInvalid 无效的后端引用（如Gateway API路由引用了不存在的Service），按权重分到的请求返回500
+	UpstreamKindInvalid UpstreamKind = "invalid"
+)
+
+// UpstreamTLS 连接上游的TLS配置
+type UpstreamTLS struct {
+	// ServerName SNI和证书校验使用的域名，为空时dns类型使用上游域名，其他类型按IP校验
+	ServerName string `json:"server_name,omitempty"`
+	// InsecureSkipVerify 不校验上游证书
+	InsecureSkipVerify bool `json:"insecure_skip_verify,omitempty"`
+	// CA 校验上游证书的CA证书（PEM），为空时使用系统CA
+	CA string `json:"ca,omitempty"`
+}
+
+// TopologyPolicy 拓扑感知路由：优先转发到数据面所在节点的Pod，其次同可用区的Pod，最后所有Pod。
+// 本地的Pod不满足以下溢出阈值时，请求转发到下一级
+type TopologyPolicy struct {
+	// MinEndpoints 本地至少需要的就绪地址数，为0时使用默认值1
+	MinEndpoints int `json:"min_endpoints,omitempty"`
+	// MinHealthyPercent 本地Pod中就绪的比例（百分比），为0时使用默认值50
+	MinHealthyPercent int `json:"min_healthy_percent,omitempty"`
+	// MaxInflight 本地每个地址平均的处理中请求数达到该值时，新请求溢出到下一级，为0时不限制
+	MaxInflight int `json:"max_inflight,omitempty"`
+}
+
+// Locality 上游地址所在的节点和可用区
+type Locality struct {
+	Node string `json:"node,omitempty"`
+	Zone string `json:"zone,omitempty"`
 }
 
+// UpstreamProtocol 转发到上游使用的协议
+type UpstreamProtocol string
+
+// SessionAffinity 会话保持方式，与Service的 spec.sessionAffinity 一致
+type SessionAffinity string
+
+const (
+	// SessionAffinityClientIP 按客户端IP保持会话
+	SessionAffinityClientIP SessionAffinity = "ClientIP"
+)
+
+const (
+	// UpstreamProtocolH2C 明文HTTP/2，用于gRPC上游，只有HTTPS监听器支持（客户端通过ALPN协商HTTP/2）
+	UpstreamProtocolH2C UpstreamProtocol = "h2c"
+)
+
 // Router 路由引擎
 type Router struct {
 	rules atomic.Value // *RouteTable
@@ -37,7 +229,16 @@ type Router struct {
 
 // RouteTable 路由表
 type RouteTable struct {
-	Rules map[string]*RouteRule // key: domain+path
+	Rules map[string]*RouteRule // key: RouteRule.Key()
+	// exactRules 精确匹配和未指定匹配方式的规则，key: 域名+路径
+	exactRules map[string]*RouteRule
+	// prefixRules 按域名分组的前缀规则，路径长的在前
+	prefixRules map[string][]*RouteRule
+	// legacyRules 按域名分组的未指定匹配方式的规则，用于域名匹配
+	legacyRules map[string]*RouteRule
+	// version 控制面下发的配置版本，updatedAt 路由表更新的时间
+	version   string
+	updatedAt time.Time
 }
 
 // NewRouter 创建路由引擎
@@ -49,62 +250,153 @@ func NewRouter(log *logrus.Logger) *Router {
 
 // UpdateRules 原子更新路由规则
 func (r *Router) UpdateRules(rules []*RouteRule) {
-	newTable := &RouteTable{Rules: make(map[string]*RouteRule)}
+	r.UpdateRulesWithVersion(rules, "")
+}
+
+// UpdateRulesWithVersion 原子更新路由规则，并记录控制面下发的配置版本。路由表保存规则的副本，不修改调用方的规则
+func (r *Router) UpdateRulesWithVersion(rules []*RouteRule, version string) {
+	newTable := &RouteTable{
+		Rules:       make(map[string]*RouteRule),
+		exactRules:  make(map[string]*RouteRule),
+		prefixRules: make(map[string][]*RouteRule),
+		legacyRules: make(map[string]*RouteRule),
+		version:     version,
+		updatedAt:   time.Now(),
+	}
 
 	for _, rule := range rules {
-		key := fmt.Sprintf("%s%s", rule.Domain, rule.Path)
-		newTable.Rules[key] = rule
+		// 复制规则后预编译Header子规则，调用方的规则可能仍在其他goroutine中使用，无效的子规则直接丢弃
+		copied := *rule
+		rule = &copied
+		headerRoutes := make([]*HeaderRoute, 0, len(rule.HeaderRoutes))
+		for _, headerRoute := range rule.HeaderRoutes {
+			compiled := *headerRoute
+			if err := compiled.Compile(); err != nil {
+				r.log.Warnf("忽略无效的Header子规则 %s%s: %v", rule.Domain, rule.Path, err)
+				continue
+			}
+			headerRoutes = append(headerRoutes, &compiled)
+		}
+		rule.HeaderRoutes = headerRoutes
+
+		if rule.PathType != "" && rule.PathType != PathMatchExact && rule.PathType != PathMatchPrefix {
+			r.log.Warnf("忽略路由 %s%s: 不支持的路径匹配方式 %s", rule.Domain, rule.Path, rule.PathType)
+			continue
+		}
+
+		newTable.Rules[rule.Key()] = rule
+		switch rule.PathType {
+		case PathMatchPrefix:
+			newTable.prefixRules[rule.Domain] = append(newTable.prefixRules[rule.Domain], rule)
+		case PathMatchExact:
+			newTable.exactRules[rule.Domain+rule.Path] = rule
+		case "":
+			newTable.exactRules[rule.Domain+rule.Path] = rule
+			if _, exists := newTable.legacyRules[rule.Domain]; !exists {
+				newTable.legacyRules[rule.Domain] = rule
+			}
+		}
+	}
+
+	for _, prefixRules := range newTable.prefixRules {
+		sort.SliceStable(prefixRules, func(i, j int) bool {
+			return len(prefixRules[i].Path) > len(prefixRules[j].Path)
+		})
 	}
 
 	r.rules.Store(newTable)
-	r.log.Infof("路由规则已更新，共 %d 条规则", len(rules))
+	if version != "" {
+		r.log.Infof("路由规则已更新，共 %d 条规则，配置版本 %s", len(rules), version)
+	} else {
+		r.log.Infof("路由规则已更新，共 %d 条规则", len(rules))
+	}
 }
 
-// FindRoute 查找匹配的路由规则
-func (r *Router) FindRoute(ctx *fasthttp.RequestCtx) *RouteRule {
+// Version 返回当前路由表的配置版本和更新时间，尚未收到配置时版本为空
+func (r *Router) Version() (string, time.Time) {
 	table := r.rules.Load().(*RouteTable)
-	host := string(ctx.Host())
-	path := string(ctx.Path())
+	return table.version, table.updatedAt
+}
 
-	// 精确匹配
-	key := host + path
-	if rule, exists := table.Rules[key]; exists {
-		return rule
-	}
+// Rules 获取当前路由表中的所有规则
+func (r *Router) Rules() []*RouteRule {
+	table := r.rules.Load().(*RouteTable)
 
-	// 域名匹配
+	rules := make([]*RouteRule, 0, len(table.Rules))
 	for _, rule := range table.Rules {
-		if rule.Domain == host {
-			return rule
-		}
+		rules = append(rules, rule)
 	}
+	return rules
+}
 
-	return nil
+// FindRoute 查找匹配的路由规则
+func (r *Router) FindRoute(ctx *fasthttp.RequestCtx) *RouteRule {
+	return r.FindRouteByDomain(string(ctx.Host()), string(ctx.Path()))
 }
 
-// FindRouteByDomain 根据域名和路径查找路由规则（用于HTTP请求）
+// FindRouteByDomain 根据域名和路径查找路由规则。依次尝试请求的域名、去掉端口的域名和通配符域名，
+// 每个域名下精确匹配优先，其次是最长的路径前缀；都未命中时使用该域名下未指定匹配方式的规则，
+// 最后使用不限域名的规则
 func (r *Router) FindRouteByDomain(domain, path string) *RouteRule {
 	table := r.rules.Load().(*RouteTable)
 
-	// 精确匹配
-	key := domain + path
-	if rule, exists := table.Rules[key]; exists {
-		return rule
+	host := domain
+	if h, _, err := net.SplitHostPort(domain); err == nil {
+		host = h
 	}
 
-	// 域名匹配
-	for _, rule := range table.Rules {
-		if rule.Domain == domain {
+	hosts := []string{domain}
+	if host != domain {
+		hosts = append(hosts, host)
+	}
+	if i := strings.IndexByte(host, '.'); i > 0 {
+		hosts = append(hosts, "*"+host[i:])
+	}
+
+	for _, h := range hosts {
+		if rule := table.match(h, path); rule != nil {
+			return rule
+		}
+	}
+
+	// 兼容旧配置：域名匹配
+	for _, h := range hosts {
+		if rule, exists := table.legacyRules[h]; exists {
 			return rule
 		}
 	}
 
+	return table.match("", path)
+}
+
+// match 在指定域名下按精确匹配、最长前缀的顺序查找规则
+func (table *RouteTable) match(host, path string) *RouteRule {
+	if rule, exists := table.exactRules[host+path]; exists {
+		return rule
+	}
+	for _, rule := range table.prefixRules[host] {
+		if rule.matchPrefix(path) {
+			return rule
+		}
+	}
 	return nil
 }
 
 // GetUpstream 根据权重选择上游服务
 func (r *Router) GetUpstream(rule *RouteRule, headers map[string]string) *Upstream {
-	// 检查Header路由
+	// 按顺序匹配Header子规则
+	for _, headerRoute := range rule.HeaderRoutes {
+		value, exists := headers[http.CanonicalHeaderKey(headerRoute.Header)]
+		if !exists || !headerRoute.Match(value) {
+			continue
+		}
+		if upstream := findUpstream(rule, headerRoute.Upstream); upstream != nil {
+			return upstream
+		}
+		r.log.Warnf("Header子规则指向的上游服务不存在: %s", headerRoute.Upstream)
+	}
+
+	// 检查Header路由（兼容旧配置：Header值等于上游服务名称）
 	if rule.Headers != nil {
 		for headerKey, headerValue := range rule.Headers {
 			if clientValue := headers[headerKey]; clientValue == headerValue {
@@ -146,3 +438,13 @@ func (r *Router) GetUpstream(rule *RouteRule, headers map[string]string) *Upstre
 
 	return &rule.Upstreams[0]
 }
+
+// findUpstream 根据名称查找上游服务
+func findUpstream(rule *RouteRule, name string) *Upstream {
+	for i := range rule.Upstreams {
+		if rule.Upstreams[i].Name == name {
+			return &rule.Upstreams[i]
+		}
+	}
+	return nil
+}
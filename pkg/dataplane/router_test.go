@@ -0,0 +1,127 @@
+package dataplane
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func newTestRouter() *Router {
+	log := logrus.New()
+	log.SetLevel(logrus.PanicLevel)
+	return NewRouter(log)
+}
+
+func TestRouterPrefixMatch(t *testing.T) {
+	router := newTestRouter()
+	router.UpdateRules([]*RouteRule{
+		{Domain: "example.com", Path: "/", PathType: PathMatchPrefix},
+		{Domain: "example.com", Path: "/api", PathType: PathMatchPrefix},
+		{Domain: "example.com", Path: "/static/", PathType: PathMatchPrefix},
+		{Domain: "example.com", Path: "/api/health", PathType: PathMatchExact},
+	})
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "/api", want: "/api"},
+		{path: "/api/", want: "/api"},
+		{path: "/api/users", want: "/api"},
+		{path: "/apis", want: "/"},
+		{path: "/api/health", want: "/api/health"},
+		{path: "/api/health/live", want: "/api"},
+		{path: "/static", want: "/static/"},
+		{path: "/static/", want: "/static/"},
+		{path: "/static/app.js", want: "/static/"},
+		{path: "/staticfiles", want: "/"},
+		{path: "/", want: "/"},
+	}
+	for _, tt := range tests {
+		rule := router.FindRouteByDomain("example.com", tt.path)
+		if rule == nil {
+			t.Errorf("%s 未命中任何规则，期望 %s", tt.path, tt.want)
+			continue
+		}
+		if rule.Path != tt.want {
+			t.Errorf("%s 命中 %s，期望 %s", tt.path, rule.Path, tt.want)
+		}
+	}
+}
+
+func TestRouterUpdateRulesCopiesRules(t *testing.T) {
+	router := newTestRouter()
+	rules := []*RouteRule{{
+		Domain:   "example.com",
+		Path:     "/",
+		PathType: PathMatchPrefix,
+		HeaderRoutes: []*HeaderRoute{
+			{Header: "X-Version", Value: "^v2", MatchType: HeaderMatchRegex, Upstream: "v2"},
+			{Header: "X-Canary", Value: "(", MatchType: HeaderMatchRegex, Upstream: "v2"},
+		},
+		Upstreams: []Upstream{{Name: "v1", Weight: 1}, {Name: "v2"}},
+	}}
+	router.UpdateRules(rules)
+	if len(rules[0].HeaderRoutes) != 2 || rules[0].HeaderRoutes[0].regex != nil {
+		t.Fatalf("更新路由表修改了调用方的规则: %+v", rules[0].HeaderRoutes)
+	}
+
+	// 同一组规则重复下发时，正在处理的请求仍读取已发布的规则（配合 -race 检查）
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			router.UpdateRules(rules)
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		rule := router.FindRouteByDomain("example.com", "/")
+		if upstream := router.GetUpstream(rule, map[string]string{"X-Version": "v2.1"}); upstream == nil || upstream.Name != "v2" {
+			t.Fatalf("Header子规则未命中: %+v", upstream)
+		}
+	}
+	wg.Wait()
+}
+
+func TestRouterGetUpstream(t *testing.T) {
+	router := newTestRouter()
+	router.UpdateRules([]*RouteRule{{
+		Domain:   "example.com",
+		Path:     "/",
+		PathType: PathMatchPrefix,
+		HeaderRoutes: []*HeaderRoute{
+			{Header: "X-Version", Value: "v2", Upstream: "v2"},
+			{Header: "X-Version", Value: "v", MatchType: HeaderMatchPrefix, Upstream: "canary"},
+			{Header: "x-user", Value: `^beta-\d+$`, MatchType: HeaderMatchRegex, Upstream: "beta"},
+			{Header: "X-Missing", Value: "yes", Upstream: "removed"},
+			{Header: "X-Missing", Value: "yes", Upstream: "canary"},
+		},
+		Headers:   map[string]string{"X-Legacy": "beta"},
+		Upstreams: []Upstream{{Name: "v1", Weight: 100}, {Name: "v2"}, {Name: "canary"}, {Name: "beta"}},
+	}})
+	rule := router.FindRouteByDomain("example.com", "/")
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    string
+	}{
+		{name: "精确匹配优先于后面的前缀匹配", headers: map[string]string{"X-Version": "v2"}, want: "v2"},
+		{name: "前缀匹配", headers: map[string]string{"X-Version": "v3"}, want: "canary"},
+		{name: "正则匹配，Header名称不区分大小写", headers: map[string]string{"X-User": "beta-42"}, want: "beta"},
+		{name: "正则未命中", headers: map[string]string{"X-User": "beta-x"}, want: "v1"},
+		{name: "按顺序先命中的子规则优先", headers: map[string]string{"X-User": "beta-1", "X-Version": "v2"}, want: "v2"},
+		{name: "目标上游不存在时继续匹配", headers: map[string]string{"X-Missing": "yes"}, want: "canary"},
+		{name: "兼容旧配置的Header路由", headers: map[string]string{"X-Legacy": "beta"}, want: "beta"},
+		{name: "子规则优先于旧配置", headers: map[string]string{"X-Legacy": "beta", "X-Version": "v2"}, want: "v2"},
+		{name: "未命中时按权重分配", headers: map[string]string{}, want: "v1"},
+	}
+	for _, tt := range tests {
+		upstream := router.GetUpstream(rule, tt.headers)
+		if upstream == nil || upstream.Name != tt.want {
+			t.Errorf("%s: 选择了 %+v，期望 %s", tt.name, upstream, tt.want)
+		}
+	}
+}
@@ -0,0 +1,353 @@
+package dataplane
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// 流量抓取的限制
+const (
+	DefaultTapDuration = time.Minute
+	MaxTapDuration     = 10 * time.Minute
+	MaxTapSessions     = 16
+	MaxTapBodyBytes    = 64 * 1024
+	tapEventBuffer     = 256
+	// tapRedacted 替换敏感请求/响应头的值
+	tapRedacted = "[REDACTED]"
+)
+
+// ErrTapRawHeadersDisabled 数据面未允许抓取未脱敏的请求/响应头
+var ErrTapRawHeadersDisabled = errors.New("数据面未开启 --tap-raw-headers，不能抓取未脱敏的请求/响应头")
+
+// tapSensitiveHeaders 默认脱敏的请求/响应头（小写）
+var tapSensitiveHeaders = map[string]bool{
+	"authorization":       true,
+	"proxy-authorization": true,
+	"cookie":              true,
+	"set-cookie":          true,
+	"x-api-key":           true,
+	"x-auth-token":        true,
+}
+
+// TapFilter 流量抓取的过滤条件
+type TapFilter struct {
+	Host       string  `json:"host,omitempty"`
+	PathPrefix string  `json:"path_prefix,omitempty"`
+	Status     string  `json:"status,omitempty"` // 具体状态码如 502，或状态码分类如 5xx
+	ClientIP   string  `json:"client_ip,omitempty"`
+	SampleRate float64 `json:"sample_rate,omitempty"` // 0~1，0表示全部
+	Headers    bool    `json:"headers,omitempty"`     // 是否附带请求/响应头，认证、Cookie等敏感头的值默认脱敏
+	RawHeaders bool    `json:"raw_headers,omitempty"` // 附带未脱敏的请求/响应头，需数据面开启 --tap-raw-headers
+	BodyBytes  int     `json:"body_bytes,omitempty"`  // 附带的请求/响应体最大字节数，0表示不附带
+}
+
+// Validate 校验过滤条件
+func (f *TapFilter) Validate() error {
+	if f.SampleRate < 0 || f.SampleRate > 1 {
+		return fmt.Errorf("采样率必须在0~1之间")
+	}
+	if f.BodyBytes < 0 || f.BodyBytes > MaxTapBodyBytes {
+		return fmt.Errorf("请求体抓取长度必须在0~%d之间", MaxTapBodyBytes)
+	}
+	if f.Status != "" {
+		if _, err := strconv.Atoi(strings.TrimSuffix(f.Status, "xx")); err != nil {
+			return fmt.Errorf("状态码过滤条件格式错误: %s", f.Status)
+		}
+	}
+	return nil
+}
+
+// match 判断请求是否满足过滤条件
+func (f *TapFilter) match(entry *AccessLogEntry) bool {
+	if f.Host != "" && !strings.EqualFold(f.Host, entry.Host) {
+		return false
+	}
+	if f.PathPrefix != "" && !strings.HasPrefix(entry.Path, f.PathPrefix) {
+		return false
+	}
+	if f.ClientIP != "" && f.ClientIP != entry.ClientIP {
+		return false
+	}
+	if f.Status != "" {
+		if strings.HasSuffix(f.Status, "xx") {
+			if statusClass(entry.Status) != f.Status {
+				return false
+			}
+		} else if strconv.Itoa(entry.Status) != f.Status {
+			return false
+		}
+	}
+	if f.SampleRate > 0 && f.SampleRate < 1 && rand.Float64() >= f.SampleRate {
+		return false
+	}
+	return true
+}
+
+// TapCapture 处理请求时抓取的请求/响应头和请求/响应体
+type TapCapture struct {
+	RequestHeaders  map[string]string
+	ResponseHeaders map[string]string
+	RequestBody     []byte
+	ResponseBody    []byte
+}
+
+// TapEvent 推送给抓取方的请求摘要
+type TapEvent struct {
+	Summary         *AccessLogEntry   `json:"summary"`
+	RequestHeaders  map[string]string `json:"request_headers,omitempty"`
+	ResponseHeaders map[string]string `json:"response_headers,omitempty"`
+	RequestBody     string            `json:"request_body,omitempty"`
+	ResponseBody    string            `json:"response_body,omitempty"`
+}
+
+// TapSession 一个抓取会话
+type TapSession struct {
+	ID        int64
+	Filter    TapFilter
+	ExpiresAt time.Time
+	Events    chan *TapEvent
+	dropped   int64
+}
+
+// Dropped 因抓取方消费过慢被丢弃的事件数
+func (s *TapSession) Dropped() int64 {
+	return atomic.LoadInt64(&s.dropped)
+}
+
+// TapManager 流量抓取管理器
+type TapManager struct {
+	sessions  map[int64]*TapSession
+	active    int32 // 当前会话数，请求路径上只读取该值
+	bodyBytes int32 // 所有会话中最大的请求体抓取长度
+	nextID    int64
+	mu        sync.RWMutex
+	// allowRawHeaders 是否允许抓取未脱敏的请求/响应头
+	allowRawHeaders bool
+}
+
+// NewTapManager 创建流量抓取管理器
+func NewTapManager() *TapManager {
+	return &TapManager{sessions: make(map[int64]*TapSession)}
+}
+
+// SetAllowRawHeaders 设置是否允许抓取未脱敏的请求/响应头，需在开始抓取前调用
+func (tm *TapManager) SetAllowRawHeaders(allow bool) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	tm.allowRawHeaders = allow
+}
+
+// Active 是否有进行中的抓取
+func (tm *TapManager) Active() bool {
+	return atomic.LoadInt32(&tm.active) > 0
+}
+
+// BodyBytes 需要抓取的请求/响应体最大字节数
+func (tm *TapManager) BodyBytes() int {
+	return int(atomic.LoadInt32(&tm.bodyBytes))
+}
+
+// Subscribe 开始抓取，duration超过上限时按上限处理
+func (tm *TapManager) Subscribe(filter TapFilter, duration time.Duration) (*TapSession, error) {
+	if err := filter.Validate(); err != nil {
+		return nil, err
+	}
+	if duration <= 0 {
+		duration = DefaultTapDuration
+	}
+	if duration > MaxTapDuration {
+		duration = MaxTapDuration
+	}
+
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	if filter.RawHeaders && !tm.allowRawHeaders {
+		return nil, ErrTapRawHeadersDisabled
+	}
+	if len(tm.sessions) >= MaxTapSessions {
+		return nil, fmt.Errorf("抓取会话数已达上限 %d", MaxTapSessions)
+	}
+
+	tm.nextID++
+	session := &TapSession{
+		ID:        tm.nextID,
+		Filter:    filter,
+		ExpiresAt: time.Now().Add(duration),
+		Events:    make(chan *TapEvent, tapEventBuffer),
+	}
+	tm.sessions[session.ID] = session
+	tm.refresh()
+
+	return session, nil
+}
+
+// Unsubscribe 结束抓取
+func (tm *TapManager) Unsubscribe(session *TapSession) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	delete(tm.sessions, session.ID)
+	tm.refresh()
+}
+
+// refresh 更新会话数和请求体抓取长度，调用方需持有写锁
+func (tm *TapManager) refresh() {
+	bodyBytes := 0
+	for _, session := range tm.sessions {
+		if session.Filter.BodyBytes > bodyBytes {
+			bodyBytes = session.Filter.BodyBytes
+		}
+	}
+	atomic.StoreInt32(&tm.bodyBytes, int32(bodyBytes))
+	atomic.StoreInt32(&tm.active, int32(len(tm.sessions)))
+}
+
+// Publish 将请求分发给匹配的抓取会话，会话消费不及时则丢弃
+func (tm *TapManager) Publish(entry *AccessLogEntry, capture *TapCapture) {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+
+	now := time.Now()
+	for _, session := range tm.sessions {
+		if now.After(session.ExpiresAt) || !session.Filter.match(entry) {
+			continue
+		}
+
+		event := &TapEvent{Summary: entry}
+		if capture != nil {
+			if session.Filter.RawHeaders {
+				event.RequestHeaders = capture.RequestHeaders
+				event.ResponseHeaders = capture.ResponseHeaders
+			} else if session.Filter.Headers {
+				event.RequestHeaders = redactHeaders(capture.RequestHeaders)
+				event.ResponseHeaders = redactHeaders(capture.ResponseHeaders)
+			}
+			if limit := session.Filter.BodyBytes; limit > 0 {
+				event.RequestBody = truncateBody(capture.RequestBody, limit)
+				event.ResponseBody = truncateBody(capture.ResponseBody, limit)
+			}
+		}
+
+		select {
+		case session.Events <- event:
+		default:
+			atomic.AddInt64(&session.dropped, 1)
+		}
+	}
+}
+
+// redactHeaders 返回敏感头的值被替换后的副本，没有敏感头时返回原map
+func redactHeaders(headers map[string]string) map[string]string {
+	sensitive := false
+	for key := range headers {
+		if tapSensitiveHeaders[strings.ToLower(key)] {
+			sensitive = true
+			break
+		}
+	}
+	if !sensitive {
+		return headers
+	}
+
+	redacted := make(map[string]string, len(headers))
+	for key, value := range headers {
+		if tapSensitiveHeaders[strings.ToLower(key)] {
+			value = tapRedacted
+		}
+		redacted[key] = value
+	}
+	return redacted
+}
+
+// truncateBody 截断请求体
+func truncateBody(body []byte, limit int) string {
+	if len(body) > limit {
+		body = body[:limit]
+	}
+	return string(body)
+}
+
+// limitedBuffer 只保留前limit个字节的缓冲
+type limitedBuffer struct {
+	buf   []byte
+	limit int
+}
+
+// Write 追加数据，超出部分丢弃
+func (b *limitedBuffer) Write(p []byte) {
+	if remain := b.limit - len(b.buf); remain > 0 {
+		if len(p) > remain {
+			p = p[:remain]
+		}
+		b.buf = append(b.buf, p...)
+	}
+}
+
+// httpTapCapture 从net/http请求和响应中抓取请求头和请求体
+func httpTapCapture(r *http.Request, respHeader http.Header, reqBody, respBody *limitedBuffer) *TapCapture {
+	capture := &TapCapture{
+		RequestHeaders:  flattenHeader(r.Header),
+		ResponseHeaders: flattenHeader(respHeader),
+	}
+	if reqBody != nil {
+		capture.RequestBody = reqBody.buf
+	}
+	if respBody != nil {
+		capture.ResponseBody = respBody.buf
+	}
+	return capture
+}
+
+// fasthttpTapCapture 从fasthttp请求上下文中抓取请求头和请求体
+func fasthttpTapCapture(ctx *fasthttp.RequestCtx, bodyBytes int) *TapCapture {
+	capture := &TapCapture{
+		RequestHeaders:  make(map[string]string),
+		ResponseHeaders: make(map[string]string),
+	}
+	ctx.Request.Header.VisitAll(func(key, value []byte) {
+		addHeaderValue(capture.RequestHeaders, string(key), string(value))
+	})
+	ctx.Response.Header.VisitAll(func(key, value []byte) {
+		addHeaderValue(capture.ResponseHeaders, string(key), string(value))
+	})
+	if bodyBytes > 0 {
+		capture.RequestBody = copyPrefix(ctx.Request.Body(), bodyBytes)
+		capture.ResponseBody = copyPrefix(ctx.Response.Body(), bodyBytes)
+	}
+	return capture
+}
+
+// flattenHeader 将多值请求头以逗号合并
+func flattenHeader(header http.Header) map[string]string {
+	result := make(map[string]string, len(header))
+	for key, values := range header {
+		result[key] = strings.Join(values, ", ")
+	}
+	return result
+}
+
+// addHeaderValue 追加请求头的值，重复的请求头以逗号合并
+func addHeaderValue(headers map[string]string, key, value string) {
+	if existing, ok := headers[key]; ok {
+		value = existing + ", " + value
+	}
+	headers[key] = value
+}
+
+// copyPrefix 复制前limit个字节，fasthttp的缓冲在请求结束后会被复用
+func copyPrefix(body []byte, limit int) []byte {
+	if len(body) > limit {
+		body = body[:limit]
+	}
+	return append([]byte(nil), body...)
+}
@@ -0,0 +1,266 @@
+package dataplane
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// 时间序列支持的指标
+const (
+	SeriesQPS       = "qps"
+	SeriesRequests  = "requests"
+	SeriesErrors    = "errors"
+	SeriesErrorRate = "error_rate"
+	SeriesBytesIn   = "bytes_in"
+	SeriesBytesOut  = "bytes_out"
+	SeriesLatency   = "latency_avg_ms"
+)
+
+// 时间序列默认保留时长
+const (
+	DefaultSecondRetention = 10 * time.Minute
+	minuteRetention        = 24 * time.Hour
+)
+
+// seriesPoint 一个时间桶内的累计值
+type seriesPoint struct {
+	ts         int64 // 桶的起始时间（秒级或分钟级Unix时间戳）
+	requests   int64
+	errors     int64
+	bytesIn    int64
+	bytesOut   int64
+	latencySum int64 // 纳秒
+}
+
+// add 累加一次请求
+func (p *seriesPoint) add(isError bool, bytesIn, bytesOut int64, latency time.Duration) {
+	p.requests++
+	if isError {
+		p.errors++
+	}
+	p.bytesIn += bytesIn
+	p.bytesOut += bytesOut
+	p.latencySum += latency.Nanoseconds()
+}
+
+// seriesRing 固定长度的环形缓冲，下标为时间戳对长度取模
+type seriesRing struct {
+	points []seriesPoint
+	step   int64 // 桶宽度（秒）
+}
+
+func newSeriesRing(retention time.Duration, step int64) seriesRing {
+	return seriesRing{points: make([]seriesPoint, seriesRingSize(retention, step)), step: step}
+}
+
+// seriesRingSize 保留时长对应的桶数
+func seriesRingSize(retention time.Duration, step int64) int64 {
+	size := int64(retention/time.Second) / step
+	if size < 1 {
+		size = 1
+	}
+	return size
+}
+
+// bucket 获取时间对应的桶，过期的桶会被清空复用
+func (r *seriesRing) bucket(unix int64) *seriesPoint {
+	ts := unix - unix%r.step
+	p := &r.points[(ts/r.step)%int64(len(r.points))]
+	if p.ts != ts {
+		*p = seriesPoint{ts: ts}
+	}
+	return p
+}
+
+// get 读取时间对应的桶，不存在时返回空桶
+func (r *seriesRing) get(ts int64) seriesPoint {
+	p := r.points[(ts/r.step)%int64(len(r.points))]
+	if p.ts != ts {
+		return seriesPoint{ts: ts}
+	}
+	return p
+}
+
+// domainSeries 单个域名的秒级和分钟级序列
+type domainSeries struct {
+	seconds seriesRing
+	minutes seriesRing
+	mu      sync.Mutex
+}
+
+// TimeSeriesStore 按域名保存最近一段时间的请求序列，秒级保留secondRetention，分钟级保留24小时
+type TimeSeriesStore struct {
+	secondRetention time.Duration
+	domains         map[string]*domainSeries // ""表示全部请求
+	mu              sync.RWMutex
+}
+
+// NewTimeSeriesStore 创建时间序列存储
+func NewTimeSeriesStore(secondRetention time.Duration) *TimeSeriesStore {
+	if secondRetention <= 0 {
+		secondRetention = DefaultSecondRetention
+	}
+	return &TimeSeriesStore{
+		secondRetention: secondRetention,
+		domains:         make(map[string]*domainSeries),
+	}
+}
+
+// Record 记录一次请求，同时计入全部请求和所属域名
+func (ts *TimeSeriesStore) Record(now time.Time, domain string, isError bool, bytesIn, bytesOut int64, latency time.Duration) {
+	unix := now.Unix()
+	ts.record(ts.series(""), unix, isError, bytesIn, bytesOut, latency)
+	if domain != "" {
+		ts.record(ts.series(domain), unix, isError, bytesIn, bytesOut, latency)
+	}
+}
+
+func (ts *TimeSeriesStore) record(s *domainSeries, unix int64, isError bool, bytesIn, bytesOut int64, latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seconds.bucket(unix).add(isError, bytesIn, bytesOut, latency)
+	s.minutes.bucket(unix).add(isError, bytesIn, bytesOut, latency)
+}
+
+// series 获取或创建域名的序列
+func (ts *TimeSeriesStore) series(domain string) *domainSeries {
+	ts.mu.RLock()
+	s, exists := ts.domains[domain]
+	ts.mu.RUnlock()
+	if exists {
+		return s
+	}
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if s, exists = ts.domains[domain]; !exists {
+		s = &domainSeries{
+			seconds: newSeriesRing(ts.secondRetention, 1),
+			minutes: newSeriesRing(minuteRetention, 60),
+		}
+		ts.domains[domain] = s
+	}
+	return s
+}
+
+// SeriesValue 时间序列中的一个点
+type SeriesValue struct {
+	Timestamp int64   `json:"timestamp"`
+	Value     float64 `json:"value"`
+}
+
+// SeriesResult 时间序列查询结果
+type SeriesResult struct {
+	Metric string        `json:"metric"`
+	Domain string        `json:"domain,omitempty"`
+	Window string        `json:"window"`
+	Step   int64         `json:"step"` // 点之间的间隔（秒）
+	Points []SeriesValue `json:"points"`
+}
+
+// Query 查询最近window时长内的指标，window不超过秒级保留时长时返回秒级数据，否则返回分钟级数据
+func (ts *TimeSeriesStore) Query(metric, domain string, window time.Duration, now time.Time) (*SeriesResult, error) {
+	if window <= 0 {
+		return nil, fmt.Errorf("时间窗口必须大于0")
+	}
+	if window > minuteRetention {
+		return nil, fmt.Errorf("时间窗口不能超过 %s", minuteRetention)
+	}
+	if err := validSeriesMetric(metric); err != nil {
+		return nil, err
+	}
+
+	result := &SeriesResult{
+		Metric: metric,
+		Domain: domain,
+		Window: window.String(),
+		Points: []SeriesValue{},
+	}
+
+	ts.mu.RLock()
+	s, exists := ts.domains[domain]
+	ts.mu.RUnlock()
+
+	step := int64(60)
+	if window <= ts.secondRetention {
+		step = 1
+	}
+	result.Step = step
+
+	// 从窗口起点到当前时间逐桶输出，不含尚未结束的当前桶。起点向下对齐到桶，
+	// 且最多输出环形缓冲长度减一个桶，最早的桶与当前桶共用下标，已被覆盖
+	end := now.Unix() - now.Unix()%step
+	start := end - int64(window/time.Second)
+	start -= start % step
+	retention := minuteRetention
+	if step == 1 {
+		retention = ts.secondRetention
+	}
+	if maxPoints := seriesRingSize(retention, step) - 1; (end-start)/step > maxPoints {
+		start = end - maxPoints*step
+	}
+	if !exists {
+		for t := start; t < end; t += step {
+			result.Points = append(result.Points, SeriesValue{Timestamp: t})
+		}
+		return result, nil
+	}
+
+	s.mu.Lock()
+	r := &s.minutes
+	if step == 1 {
+		r = &s.seconds
+	}
+	points := make([]seriesPoint, 0, (end-start)/step)
+	for t := start; t < end; t += step {
+		points = append(points, r.get(t))
+	}
+	s.mu.Unlock()
+
+	for _, p := range points {
+		result.Points = append(result.Points, SeriesValue{
+			Timestamp: p.ts,
+			Value:     seriesValue(metric, &p, step),
+		})
+	}
+	return result, nil
+}
+
+// validSeriesMetric 检查指标名称
+func validSeriesMetric(metric string) error {
+	switch metric {
+	case SeriesQPS, SeriesRequests, SeriesErrors, SeriesErrorRate, SeriesBytesIn, SeriesBytesOut, SeriesLatency:
+		return nil
+	default:
+		return fmt.Errorf("不支持的指标: %s", metric)
+	}
+}
+
+// seriesValue 根据桶内累计值计算指标
+func seriesValue(metric string, p *seriesPoint, step int64) float64 {
+	switch metric {
+	case SeriesQPS:
+		return float64(p.requests) / float64(step)
+	case SeriesRequests:
+		return float64(p.requests)
+	case SeriesErrors:
+		return float64(p.errors)
+	case SeriesErrorRate:
+		if p.requests == 0 {
+			return 0
+		}
+		return float64(p.errors) / float64(p.requests)
+	case SeriesBytesIn:
+		return float64(p.bytesIn)
+	case SeriesBytesOut:
+		return float64(p.bytesOut)
+	case SeriesLatency:
+		if p.requests == 0 {
+			return 0
+		}
+		return float64(p.latencySum) / float64(p.requests) / 1e6
+	default:
+		return 0
+	}
+}
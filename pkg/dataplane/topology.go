@@ -0,0 +1,167 @@
+package dataplane
+
+import (
+	"bufio"
+	"io"
+	"sort"
+	"sync/atomic"
+)
+
+// 拓扑感知路由选择地址的级别
+const (
+	TopologyLevelNode = "node"
+	TopologyLevelZone = "zone"
+	TopologyLevelAny  = "any"
+)
+
+const (
+	// defaultTopologyMinEndpoints 本地至少需要的就绪地址数的默认值
+	defaultTopologyMinEndpoints = 1
+	// defaultTopologyMinHealthyPercent 本地Pod就绪比例的默认值
+	defaultTopologyMinHealthyPercent = 50
+)
+
+// topologyPick 拓扑感知选择次数的key
+type topologyPick struct {
+	upstream string
+	level    string
+}
+
+// SetLocality 设置数据面所在的节点和可用区，用于拓扑感知路由
+func (proxy *Proxy) SetLocality(node, zone string) {
+	proxy.balancer.SetLocality(node, zone)
+	switch {
+	case zone != "":
+		proxy.log.Infof("拓扑感知路由: 节点 %s, 可用区 %s", node, zone)
+	case node != "":
+		proxy.log.Infof("拓扑感知路由: 节点 %s, 可用区由控制面下发或按本节点上的Pod推断", node)
+	}
+}
+
+// SetNodeZone 设置控制面按节点标签解析的可用区，启动参数指定了可用区时不使用
+func (proxy *Proxy) SetNodeZone(zone string) {
+	if zone == "" || !proxy.balancer.SetNodeZone(zone) {
+		return
+	}
+	if proxy.balancer.zone != "" && proxy.balancer.zone != zone {
+		proxy.log.Warnf("控制面下发的可用区 %s 与启动参数 %s 不一致，使用启动参数", zone, proxy.balancer.zone)
+		return
+	}
+	proxy.log.Infof("拓扑感知路由: 控制面下发的可用区 %s", zone)
+}
+
+// preferLocal 返回候选的就绪地址和所在级别：本节点的地址满足溢出阈值时只使用本节点，
+// 其次是本可用区，都不满足时使用全部地址
+func (b *Balancer) preferLocal(upstream *Upstream) ([]string, string) {
+	if b.node != "" {
+		if addresses := b.localAddresses(upstream, func(l Locality) bool { return l.Node == b.node }); addresses != nil {
+			return addresses, TopologyLevelNode
+		}
+	}
+	if zone := b.zoneOf(upstream); zone != "" {
+		if addresses := b.localAddresses(upstream, func(l Locality) bool { return l.Zone == zone }); addresses != nil {
+			return addresses, TopologyLevelZone
+		}
+	}
+	return upstream.Addresses, TopologyLevelAny
+}
+
+// zoneOf 返回数据面所在的可用区：启动参数指定的可用区优先，其次是控制面下发的节点可用区，
+// 都没有时使用本节点上Pod的可用区
+func (b *Balancer) zoneOf(upstream *Upstream) string {
+	if b.zone != "" {
+		return b.zone
+	}
+	if zone, _ := b.nodeZone.Load().(string); zone != "" {
+		return zone
+	}
+	if b.node == "" {
+		return ""
+	}
+	for _, locality := range upstream.Locality {
+		if locality.Node == b.node && locality.Zone != "" {
+			return locality.Zone
+		}
+	}
+	for _, locality := range upstream.UnreadyLocality {
+		if locality.Node == b.node && locality.Zone != "" {
+			return locality.Zone
+		}
+	}
+	return ""
+}
+
+// localAddresses 返回位置匹配的就绪地址，就绪地址数、就绪比例或处理中的请求数超过溢出阈值时返回nil
+func (b *Balancer) localAddresses(upstream *Upstream, match func(Locality) bool) []string {
+	policy := upstream.Topology
+
+	var addresses []string
+	for _, address := range upstream.Addresses {
+		if match(upstream.Locality[address]) {
+			addresses = append(addresses, address)
+		}
+	}
+	minEndpoints := policy.MinEndpoints
+	if minEndpoints <= 0 {
+		minEndpoints = defaultTopologyMinEndpoints
+	}
+	if len(addresses) < minEndpoints {
+		return nil
+	}
+
+	// 终止中和未就绪的Pod都计入总数，滚动更新或本地Pod故障时流量溢出到下一级
+	total := len(addresses)
+	for _, address := range upstream.DrainingAddresses {
+		if match(upstream.Locality[address]) {
+			total++
+		}
+	}
+	for _, locality := range upstream.UnreadyLocality {
+		if match(locality) {
+			total++
+		}
+	}
+	minHealthy := policy.MinHealthyPercent
+	if minHealthy <= 0 {
+		minHealthy = defaultTopologyMinHealthyPercent
+	}
+	if len(addresses)*100 < minHealthy*total {
+		return nil
+	}
+
+	if policy.MaxInflight > 0 {
+		var inflight int64
+		b.inflightMu.Lock()
+		for _, address := range addresses {
+			inflight += b.inflight[address]
+		}
+		b.inflightMu.Unlock()
+		if inflight >= int64(policy.MaxInflight*len(addresses)) {
+			return nil
+		}
+	}
+	return addresses
+}
+
+// writePrometheus 输出拓扑感知路由在各级选择地址的次数
+func (b *Balancer) writePrometheus(w io.Writer) error {
+	var picks []topologyPick
+	b.picks.Range(func(key, value interface{}) bool {
+		picks = append(picks, key.(topologyPick))
+		return true
+	})
+	sort.Slice(picks, func(i, j int) bool {
+		if picks[i].upstream != picks[j].upstream {
+			return picks[i].upstream < picks[j].upstream
+		}
+		return picks[i].level < picks[j].level
+	})
+
+	pw := &promWriter{w: bufio.NewWriter(w)}
+	pw.header("kun_gateway_upstream_topology_picks_total", "Requests balanced by topology-aware upstreams, by the level the address was picked from (node, zone, any).", "counter")
+	for _, pick := range picks {
+		value, _ := b.picks.Load(pick)
+		pw.sample("kun_gateway_upstream_topology_picks_total", float64(atomic.LoadInt64(value.(*int64))), "upstream", pick.upstream, "level", pick.level)
+	}
+	return pw.w.Flush()
+}
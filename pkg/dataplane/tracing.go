@@ -0,0 +1,508 @@
+package dataplane
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// 支持的上下文传播格式
+const (
+	PropagatorTraceContext = "tracecontext" // W3C traceparent/tracestate
+	PropagatorBaggage      = "baggage"      // W3C baggage
+	PropagatorB3           = "b3"           // Zipkin B3 多Header格式，提取时兼容单Header格式
+)
+
+// DefaultTracingServiceName 默认的服务名
+const DefaultTracingServiceName = "kun-gateway"
+
+// 传播使用的Header名称
+const (
+	traceparentHeader  = "traceparent"
+	tracestateHeader   = "tracestate"
+	baggageHeader      = "baggage"
+	b3SingleHeader     = "b3"
+	b3TraceIDHeader    = "X-B3-TraceId"
+	b3SpanIDHeader     = "X-B3-SpanId"
+	b3ParentSpanHeader = "X-B3-ParentSpanId"
+	b3SampledHeader    = "X-B3-Sampled"
+)
+
+// Span类型和状态，取值与OTLP一致
+const (
+	spanKindServer  = 2
+	spanKindClient  = 3
+	spanStatusUnset = 0
+	spanStatusError = 2
+)
+
+// TraceID 16字节的链路ID
+type TraceID [16]byte
+
+// SpanID 8字节的Span ID
+type SpanID [8]byte
+
+// String 十六进制形式
+func (id TraceID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// IsValid 全零为无效ID
+func (id TraceID) IsValid() bool {
+	return id != TraceID{}
+}
+
+// String 十六进制形式
+func (id SpanID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// IsValid 全零为无效ID
+func (id SpanID) IsValid() bool {
+	return id != SpanID{}
+}
+
+// newTraceID 生成随机链路ID
+func newTraceID() TraceID {
+	var id TraceID
+	for !id.IsValid() {
+		if _, err := rand.Read(id[:]); err != nil {
+			binary.BigEndian.PutUint64(id[:8], uint64(time.Now().UnixNano()))
+			binary.BigEndian.PutUint64(id[8:], uint64(time.Now().UnixNano()))
+		}
+	}
+	return id
+}
+
+// newSpanID 生成随机Span ID
+func newSpanID() SpanID {
+	var id SpanID
+	for !id.IsValid() {
+		if _, err := rand.Read(id[:]); err != nil {
+			binary.BigEndian.PutUint64(id[:], uint64(time.Now().UnixNano()))
+		}
+	}
+	return id
+}
+
+// RouteTracing 路由级链路追踪配置
+type RouteTracing struct {
+	Disabled   bool    `json:"disabled,omitempty"`
+	SampleRate float64 `json:"sample_rate,omitempty"` // 0~1，0表示使用全局采样率，只对没有上游采样决定的请求生效
+}
+
+// TracingConfig 链路追踪配置
+type TracingConfig struct {
+	// Endpoint OTLP/HTTP接收地址，如 http://otel-collector:4318，未指定路径时使用 /v1/traces
+	Endpoint string
+	// ServiceName 上报的service.name
+	ServiceName string
+	// SampleRate 全局采样率，0~1
+	SampleRate float64
+	// Propagators 传播格式：tracecontext、baggage、b3
+	Propagators []string
+	// Headers 上报时附加的请求头，如认证信息
+	Headers map[string]string
+	// BatchSize 每批上报的Span数
+	BatchSize int
+	// QueueSize 异步队列长度，队列满时丢弃Span
+	QueueSize int
+	// FlushInterval 最长上报间隔
+	FlushInterval time.Duration
+}
+
+// Tracer 链路追踪，Tracer为nil时所有操作都是空操作
+type Tracer struct {
+	config      TracingConfig
+	traceparent bool
+	baggage     bool
+	b3          bool
+	exporter    *otlpExporter
+}
+
+// NewTracer 创建链路追踪
+func NewTracer(config TracingConfig, log *logrus.Logger) (*Tracer, error) {
+	if config.ServiceName == "" {
+		config.ServiceName = DefaultTracingServiceName
+	}
+	if config.SampleRate < 0 || config.SampleRate > 1 {
+		return nil, fmt.Errorf("采样率必须在0~1之间")
+	}
+	if len(config.Propagators) == 0 {
+		config.Propagators = []string{PropagatorTraceContext, PropagatorBaggage}
+	}
+
+	tracer := &Tracer{config: config}
+	for _, propagator := range config.Propagators {
+		switch strings.ToLower(strings.TrimSpace(propagator)) {
+		case PropagatorTraceContext:
+			tracer.traceparent = true
+		case PropagatorBaggage:
+			tracer.baggage = true
+		case PropagatorB3:
+			tracer.b3 = true
+		case "":
+		default:
+			return nil, fmt.Errorf("不支持的传播格式: %s", propagator)
+		}
+	}
+
+	exporter, err := newOTLPExporter(config, log)
+	if err != nil {
+		return nil, err
+	}
+	tracer.exporter = exporter
+
+	return tracer, nil
+}
+
+// Close 上报队列中剩余的Span
+func (t *Tracer) Close() {
+	if t == nil {
+		return
+	}
+	t.exporter.Close()
+}
+
+// Span 一次操作的追踪记录
+type Span struct {
+	tracer *Tracer
+
+	TraceID      TraceID
+	SpanID       SpanID
+	ParentSpanID SpanID
+	Name         string
+	Kind         int
+	Start        time.Time
+	End          time.Time
+	Attributes   []SpanAttribute
+	Status       int
+	StatusMsg    string
+
+	sampled       bool
+	hasParent     bool // 请求携带了上游的链路上下文
+	parentSampled bool
+	traceState    string
+	baggage       string
+}
+
+// SpanAttribute Span属性，Value为string、int64、float64或bool
+type SpanAttribute struct {
+	Key   string
+	Value interface{}
+}
+
+// SetAttribute 设置属性
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.Attributes = append(s.Attributes, SpanAttribute{Key: key, Value: value})
+}
+
+// SetError 将Span标记为失败
+func (s *Span) SetError(msg string) {
+	if s == nil {
+		return
+	}
+	s.Status = spanStatusError
+	s.StatusMsg = msg
+}
+
+// Sampled 是否被采样
+func (s *Span) Sampled() bool {
+	return s != nil && s.sampled
+}
+
+// StartServerSpan 从请求头中提取上游的链路上下文并开始服务端Span，get按名称读取请求头
+func (t *Tracer) StartServerSpan(get func(string) string, start time.Time) *Span {
+	if t == nil {
+		return nil
+	}
+
+	span := &Span{
+		tracer: t,
+		SpanID: newSpanID(),
+		Kind:   spanKindServer,
+		Start:  start,
+	}
+
+	if t.traceparent {
+		span.extractTraceContext(get)
+	}
+	if !span.hasParent && t.b3 {
+		span.extractB3(get)
+	}
+	if !span.hasParent {
+		span.TraceID = newTraceID()
+	}
+	if t.baggage {
+		span.baggage = get(baggageHeader)
+	}
+
+	return span
+}
+
+// extractTraceContext 解析W3C traceparent，格式: 00-<trace-id>-<parent-id>-<flags>
+func (s *Span) extractTraceContext(get func(string) string) {
+	parts := strings.Split(strings.TrimSpace(get(traceparentHeader)), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return
+	}
+	// 版本00必须正好4段，更高版本允许追加字段
+	if parts[0] == "00" && len(parts) != 4 {
+		return
+	}
+
+	traceID, ok := parseTraceID(parts[1])
+	if !ok {
+		return
+	}
+	parentID, ok := parseSpanID(parts[2])
+	if !ok {
+		return
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil || len(flags) != 1 {
+		return
+	}
+
+	s.TraceID = traceID
+	s.ParentSpanID = parentID
+	s.parentSampled = flags[0]&0x01 == 1
+	s.hasParent = true
+	s.traceState = get(tracestateHeader)
+}
+
+// extractB3 解析B3多Header格式或单Header格式
+func (s *Span) extractB3(get func(string) string) {
+	traceIDHex, spanIDHex, sampled := get(b3TraceIDHeader), get(b3SpanIDHeader), get(b3SampledHeader)
+	if single := strings.TrimSpace(get(b3SingleHeader)); single != "" {
+		// 格式: {TraceId}-{SpanId}-{SamplingState}-{ParentSpanId}，后两段可选
+		parts := strings.Split(single, "-")
+		if len(parts) < 2 {
+			return
+		}
+		traceIDHex, spanIDHex = parts[0], parts[1]
+		if len(parts) > 2 {
+			sampled = parts[2]
+		}
+	}
+
+	// 64位的B3链路ID左侧补零
+	if len(traceIDHex) == 16 {
+		traceIDHex = strings.Repeat("0", 16) + traceIDHex
+	}
+	traceID, ok := parseTraceID(traceIDHex)
+	if !ok {
+		return
+	}
+	parentID, ok := parseSpanID(spanIDHex)
+	if !ok {
+		return
+	}
+
+	s.TraceID = traceID
+	s.ParentSpanID = parentID
+	s.parentSampled = sampled == "1" || sampled == "d" || sampled == "true"
+	s.hasParent = true
+}
+
+// parseTraceID 解析32位十六进制的链路ID
+func parseTraceID(value string) (TraceID, bool) {
+	var id TraceID
+	if len(value) != 32 || strings.ToLower(value) != value {
+		return id, false
+	}
+	if _, err := hex.Decode(id[:], []byte(value)); err != nil {
+		return id, false
+	}
+	return id, id.IsValid()
+}
+
+// parseSpanID 解析16位十六进制的Span ID
+func parseSpanID(value string) (SpanID, bool) {
+	var id SpanID
+	if len(value) != 16 || strings.ToLower(value) != value {
+		return id, false
+	}
+	if _, err := hex.Decode(id[:], []byte(value)); err != nil {
+		return id, false
+	}
+	return id, id.IsValid()
+}
+
+// Sample 根据路由决定是否采样：路由关闭追踪时不采样；携带上游链路上下文时沿用上游的决定；
+// 否则按路由采样率（未设置时为全局采样率）对链路ID取样，同一链路在各节点上的决定一致
+func (t *Tracer) Sample(span *Span, rule *RouteRule) {
+	if t == nil || span == nil {
+		return
+	}
+
+	var routeTracing *RouteTracing
+	if rule != nil {
+		routeTracing = rule.Tracing
+	}
+
+	switch {
+	case routeTracing != nil && routeTracing.Disabled:
+		span.sampled = false
+	case span.hasParent:
+		span.sampled = span.parentSampled
+	default:
+		rate := t.config.SampleRate
+		if routeTracing != nil && routeTracing.SampleRate > 0 {
+			rate = routeTracing.SampleRate
+		}
+		span.sampled = sampleTraceID(span.TraceID, rate)
+	}
+}
+
+// sampleTraceID 按链路ID的低64位取样
+func sampleTraceID(id TraceID, rate float64) bool {
+	if rate >= 1 {
+		return true
+	}
+	if rate <= 0 {
+		return false
+	}
+	bound := uint64(rate * (1 << 63))
+	return binary.BigEndian.Uint64(id[8:])>>1 < bound
+}
+
+// StartChild 开始一次上游请求的客户端Span，每次尝试（包括重试）对应一个Span
+func (s *Span) StartChild(name string) *Span {
+	if s == nil {
+		return nil
+	}
+	return &Span{
+		tracer:       s.tracer,
+		TraceID:      s.TraceID,
+		SpanID:       newSpanID(),
+		ParentSpanID: s.SpanID,
+		Name:         name,
+		Kind:         spanKindClient,
+		Start:        time.Now(),
+		sampled:      s.sampled,
+		traceState:   s.traceState,
+		baggage:      s.baggage,
+	}
+}
+
+// Inject 将当前Span的链路上下文写入转发给上游的请求头
+func (s *Span) Inject(header headerWriter) {
+	if s == nil {
+		return
+	}
+	t := s.tracer
+
+	if t.traceparent {
+		flags := "00"
+		if s.sampled {
+			flags = "01"
+		}
+		header.Set(traceparentHeader, "00-"+s.TraceID.String()+"-"+s.SpanID.String()+"-"+flags)
+		if s.traceState != "" {
+			header.Set(tracestateHeader, s.traceState)
+		} else {
+			header.Del(tracestateHeader)
+		}
+	}
+	if t.baggage && s.baggage != "" {
+		header.Set(baggageHeader, s.baggage)
+	}
+	if t.b3 {
+		sampled := "0"
+		if s.sampled {
+			sampled = "1"
+		}
+		header.Del(b3SingleHeader)
+		header.Set(b3TraceIDHeader, s.TraceID.String())
+		header.Set(b3SpanIDHeader, s.SpanID.String())
+		header.Set(b3ParentSpanHeader, s.ParentSpanID.String())
+		header.Set(b3SampledHeader, sampled)
+	}
+}
+
+// Finish 结束Span，被采样时提交上报
+func (s *Span) Finish() {
+	if s == nil {
+		return
+	}
+	s.End = time.Now()
+	if s.sampled {
+		s.tracer.exporter.Export(s)
+	}
+}
+
+// finishServerSpan 根据访问日志记录补全服务端Span的属性并结束
+func (t *Tracer) finishServerSpan(span *Span, entry *AccessLogEntry, rule *RouteRule) {
+	if t == nil || span == nil || !span.sampled {
+		return
+	}
+
+	span.Name = entry.Method
+	if rule != nil {
+		span.Name += " " + rule.Path
+		span.SetAttribute("http.route", rule.Path)
+		span.SetAttribute("kun.route", rule.Key())
+	}
+	span.SetAttribute("http.request.method", entry.Method)
+	span.SetAttribute("url.scheme", entry.Protocol)
+	span.SetAttribute("url.path", entry.Path)
+	span.SetAttribute("server.address", entry.Host)
+	span.SetAttribute("client.address", entry.ClientIP)
+	span.SetAttribute("http.response.status_code", int64(entry.Status))
+	span.SetAttribute("http.request.body.size", entry.BytesIn)
+	span.SetAttribute("http.response.body.size", entry.BytesOut)
+	span.SetAttribute("kun.request_id", entry.RequestID)
+	if entry.Upstream != "" {
+		span.SetAttribute("kun.upstream", entry.Upstream)
+	}
+	if len(entry.Flags) > 0 {
+		span.SetAttribute("kun.response_flags", entry.flagString())
+	}
+
+	// 服务端Span只有5xx记为失败，4xx属于客户端错误
+	if entry.Status >= 500 {
+		span.SetError(strings.Join(entry.Flags, ","))
+	}
+
+	span.End = entry.Timestamp.Add(entry.Latency)
+	t.exporter.Export(span)
+}
+
+// upstreamSpanName 上游请求Span的名称
+func upstreamSpanName(method string, upstream *Upstream) string {
+	return method + " " + upstream.Name
+}
+
+// finishUpstreamSpan 记录上游请求的结果并结束Span，attempt从0开始，大于0表示重试
+func finishUpstreamSpan(span *Span, method, url, addr string, port, attempt, statusCode int, err error) {
+	if span == nil {
+		return
+	}
+
+	span.SetAttribute("http.request.method", method)
+	span.SetAttribute("url.full", url)
+	span.SetAttribute("server.address", addr)
+	span.SetAttribute("server.port", int64(port))
+	if attempt > 0 {
+		span.SetAttribute("http.request.resend_count", int64(attempt))
+	}
+
+	if err != nil {
+		span.SetError(err.Error())
+	} else {
+		span.SetAttribute("http.response.status_code", int64(statusCode))
+		if statusCode >= 400 {
+			span.SetError("")
+		}
+	}
+	span.Finish()
+}
@@ -0,0 +1,139 @@
+package dataplane
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/valyala/fasthttp"
+	"golang.org/x/net/http2"
+)
+
+// upstreamClients 按TLS配置缓存连接上游的客户端，TLS配置相同的上游共用连接池
+type upstreamClients struct {
+	clients map[upstreamTLSKey]*tlsClients
+	mu      sync.Mutex
+}
+
+// upstreamTLSKey TLS客户端的缓存key
+type upstreamTLSKey struct {
+	serverName         string
+	insecureSkipVerify bool
+	ca                 string
+}
+
+// tlsClients 同一TLS配置的HTTP/1.1（HTTP和HTTPS监听器各一个）和HTTP/2客户端
+type tlsClients struct {
+	fast  *fasthttp.Client
+	http  *http.Client
+	http2 *http.Client
+}
+
+func newUpstreamClients() *upstreamClients {
+	return &upstreamClients{clients: make(map[upstreamTLSKey]*tlsClients)}
+}
+
+// get 获取上游TLS配置对应的客户端，CA无效时返回错误
+func (c *upstreamClients) get(upstream *Upstream) (*tlsClients, error) {
+	key := upstreamTLSKey{
+		serverName:         upstream.TLS.ServerName,
+		insecureSkipVerify: upstream.TLS.InsecureSkipVerify,
+		ca:                 upstream.TLS.CA,
+	}
+	// dns类型的上游连接解析出的IP，默认按域名校验证书
+	if key.serverName == "" && upstream.Kind == UpstreamKindDNS {
+		key.serverName = upstream.Host
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if clients, ok := c.clients[key]; ok {
+		return clients, nil
+	}
+
+	config := &tls.Config{
+		ServerName:         key.serverName,
+		InsecureSkipVerify: key.insecureSkipVerify,
+	}
+	if key.ca != "" {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(key.ca)) {
+			return nil, fmt.Errorf("上游 %s 的CA证书无效", upstream.Name)
+		}
+		config.RootCAs = pool
+	}
+
+	clients := &tlsClients{
+		fast: &fasthttp.Client{
+			MaxConnsPerHost:     1000,
+			ReadTimeout:         30 * time.Second,
+			WriteTimeout:        30 * time.Second,
+			MaxIdleConnDuration: 10 * time.Second,
+			TLSConfig:           config,
+		},
+		http: &http.Client{
+			CheckRedirect: noRedirect,
+			Transport: &http.Transport{
+				TLSClientConfig:     config,
+				MaxIdleConnsPerHost: 100,
+				IdleConnTimeout:     90 * time.Second,
+			},
+		},
+		http2: &http.Client{
+			CheckRedirect: noRedirect,
+			Transport:     &http2.Transport{TLSClientConfig: config},
+		},
+	}
+	c.clients[key] = clients
+	return clients, nil
+}
+
+// httpClient 选择HTTPS监听器转发到上游使用的客户端和URL scheme
+func (proxy *Proxy) httpClient(upstream *Upstream) (*http.Client, string, error) {
+	if upstream.TLS == nil {
+		if upstream.Protocol == UpstreamProtocolH2C {
+			return proxy.h2cClient, "http", nil
+		}
+		return proxy.plainClient, "http", nil
+	}
+
+	clients, err := proxy.upstreamClients.get(upstream)
+	if err != nil {
+		return nil, "", err
+	}
+	if upstream.Protocol == UpstreamProtocolH2C {
+		return clients.http2, "https", nil
+	}
+	return clients.http, "https", nil
+}
+
+// fastClient 选择HTTP监听器转发到上游使用的客户端和URL scheme
+func (proxy *Proxy) fastClient(upstream *Upstream) (*fasthttp.Client, string, error) {
+	if upstream.TLS == nil {
+		return proxy.client, "http", nil
+	}
+
+	clients, err := proxy.upstreamClients.get(upstream)
+	if err != nil {
+		return nil, "", err
+	}
+	return clients.fast, "https", nil
+}
+
+// pickAddress 选择转发的上游地址，dns类型的上游先解析域名，没有可用地址时返回空字符串
+func (proxy *Proxy) pickAddress(upstream *Upstream, clientIP string) string {
+	if upstream == nil {
+		return ""
+	}
+	if upstream.Kind == UpstreamKindDNS {
+		resolved := *upstream
+		resolved.Addresses = proxy.resolver.Resolve(upstream.Host)
+		upstream = &resolved
+	}
+	address, _ := proxy.balancer.Pick(upstream, clientIP)
+	return address
+}
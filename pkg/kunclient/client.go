@@ -0,0 +1,158 @@
+// Package kunclient kun-gateway.io/v1alpha1 资源的类型化客户端，基于动态客户端实现，
+// 测试时可使用 k8s.io/client-go/dynamic/fake
+package kunclient
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"kun-gateway/pkg/apis/kungateway/v1alpha1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Client kun-gateway.io/v1alpha1 客户端
+type Client struct {
+	dynamic dynamic.Interface
+}
+
+// New 基于动态客户端创建
+func New(dynamicClient dynamic.Interface) *Client {
+	return &Client{dynamic: dynamicClient}
+}
+
+// KunRoutes 指定命名空间的KunRoute客户端
+func (c *Client) KunRoutes(namespace string) *KunRouteClient {
+	return &KunRouteClient{resource: c.resource(v1alpha1.KunRouteResource, "KunRoute", namespace)}
+}
+
+// KunCertificates 指定命名空间的KunCertificate客户端
+func (c *Client) KunCertificates(namespace string) *KunCertificateClient {
+	return &KunCertificateClient{resource: c.resource(v1alpha1.KunCertificateResource, "KunCertificate", namespace)}
+}
+
+// KunPolicies 指定命名空间的KunPolicy客户端
+func (c *Client) KunPolicies(namespace string) *KunPolicyClient {
+	return &KunPolicyClient{resource: c.resource(v1alpha1.KunPolicyResource, "KunPolicy", namespace)}
+}
+
+// Informer 指定命名空间中一种资源的informer，缓存中的对象为 *unstructured.Unstructured
+func (c *Client) Informer(gvr schema.GroupVersionResource, namespace string, resync time.Duration) cache.SharedIndexInformer {
+	return dynamicinformer.NewFilteredDynamicInformer(c.dynamic, gvr, namespace, resync, cache.Indexers{}, nil).Informer()
+}
+
+func (c *Client) resource(gvr schema.GroupVersionResource, kind, namespace string) resource {
+	return resource{
+		client: c.dynamic.Resource(gvr).Namespace(namespace),
+		kind:   kind,
+	}
+}
+
+// resource 在类型化对象和Unstructured之间转换，供各资源的客户端复用
+type resource struct {
+	client dynamic.ResourceInterface
+	kind   string
+}
+
+func (r resource) get(ctx context.Context, name string, into runtime.Object) error {
+	object, err := r.client.Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	return fromUnstructured(object, into)
+}
+
+func (r resource) list(ctx context.Context, options metav1.ListOptions, into runtime.Object) error {
+	list, err := r.client.List(ctx, options)
+	if err != nil {
+		return err
+	}
+	return runtime.DefaultUnstructuredConverter.FromUnstructured(list.UnstructuredContent(), into)
+}
+
+func (r resource) create(ctx context.Context, object, into runtime.Object) error {
+	in, err := r.toUnstructured(object)
+	if err != nil {
+		return err
+	}
+	created, err := r.client.Create(ctx, in, metav1.CreateOptions{})
+	if err != nil {
+		return err
+	}
+	return fromUnstructured(created, into)
+}
+
+func (r resource) update(ctx context.Context, object, into runtime.Object, subresources ...string) error {
+	in, err := r.toUnstructured(object)
+	if err != nil {
+		return err
+	}
+	var updated *unstructured.Unstructured
+	if len(subresources) > 0 {
+		updated, err = r.client.UpdateStatus(ctx, in, metav1.UpdateOptions{})
+	} else {
+		updated, err = r.client.Update(ctx, in, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		return err
+	}
+	return fromUnstructured(updated, into)
+}
+
+func (r resource) patch(ctx context.Context, name string, patchType types.PatchType, data []byte, into runtime.Object) error {
+	patched, err := r.client.Patch(ctx, name, patchType, data, metav1.PatchOptions{})
+	if err != nil {
+		return err
+	}
+	return fromUnstructured(patched, into)
+}
+
+// watch 将事件中的Unstructured转换为类型化对象，转换失败的事件以Error事件返回
+func (r resource) watch(ctx context.Context, options metav1.ListOptions, newObject func() runtime.Object) (watch.Interface, error) {
+	watcher, err := r.client.Watch(ctx, options)
+	if err != nil {
+		return nil, err
+	}
+	return watch.Filter(watcher, func(event watch.Event) (watch.Event, bool) {
+		object, ok := event.Object.(*unstructured.Unstructured)
+		if !ok {
+			return event, true
+		}
+		typed := newObject()
+		if err := fromUnstructured(object, typed); err != nil {
+			return watch.Event{Type: watch.Error, Object: &metav1.Status{
+				Status:  metav1.StatusFailure,
+				Message: err.Error(),
+			}}, true
+		}
+		event.Object = typed
+		return event, true
+	}), nil
+}
+
+func (r resource) toUnstructured(object runtime.Object) (*unstructured.Unstructured, error) {
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(object)
+	if err != nil {
+		return nil, fmt.Errorf("转换%s失败: %v", r.kind, err)
+	}
+	out := &unstructured.Unstructured{Object: content}
+	out.SetAPIVersion(v1alpha1.SchemeGroupVersion.String())
+	out.SetKind(r.kind)
+	return out, nil
+}
+
+func fromUnstructured(object *unstructured.Unstructured, into runtime.Object) error {
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(object.UnstructuredContent(), into); err != nil {
+		return fmt.Errorf("解析%s %s/%s 失败: %v", object.GetKind(), object.GetNamespace(), object.GetName(), err)
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package kunclient
+
+import (
+	"context"
+
+	"kun-gateway/pkg/apis/kungateway/v1alpha1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// KunRouteClient KunRoute客户端
+type KunRouteClient struct {
+	resource resource
+}
+
+// Get 获取KunRoute
+func (c *KunRouteClient) Get(ctx context.Context, name string) (*v1alpha1.KunRoute, error) {
+	out := &v1alpha1.KunRoute{}
+	return out, c.resource.get(ctx, name, out)
+}
+
+// List 列出KunRoute
+func (c *KunRouteClient) List(ctx context.Context, options metav1.ListOptions) (*v1alpha1.KunRouteList, error) {
+	out := &v1alpha1.KunRouteList{}
+	return out, c.resource.list(ctx, options, out)
+}
+
+// Create 创建KunRoute
+func (c *KunRouteClient) Create(ctx context.Context, route *v1alpha1.KunRoute) (*v1alpha1.KunRoute, error) {
+	out := &v1alpha1.KunRoute{}
+	return out, c.resource.create(ctx, route, out)
+}
+
+// Update 更新KunRoute，ResourceVersion不一致时返回冲突错误
+func (c *KunRouteClient) Update(ctx context.Context, route *v1alpha1.KunRoute) (*v1alpha1.KunRoute, error) {
+	out := &v1alpha1.KunRoute{}
+	return out, c.resource.update(ctx, route, out)
+}
+
+// UpdateStatus 更新KunRoute的状态
+func (c *KunRouteClient) UpdateStatus(ctx context.Context, route *v1alpha1.KunRoute) (*v1alpha1.KunRoute, error) {
+	out := &v1alpha1.KunRoute{}
+	return out, c.resource.update(ctx, route, out, "status")
+}
+
+// Patch 修改KunRoute
+func (c *KunRouteClient) Patch(ctx context.Context, name string, patchType types.PatchType, data []byte) (*v1alpha1.KunRoute, error) {
+	out := &v1alpha1.KunRoute{}
+	return out, c.resource.patch(ctx, name, patchType, data, out)
+}
+
+// Delete 删除KunRoute
+func (c *KunRouteClient) Delete(ctx context.Context, name string) error {
+	return c.resource.client.Delete(ctx, name, metav1.DeleteOptions{})
+}
+
+// Watch 监听KunRoute变化，事件对象为 *v1alpha1.KunRoute
+func (c *KunRouteClient) Watch(ctx context.Context, options metav1.ListOptions) (watch.Interface, error) {
+	return c.resource.watch(ctx, options, func() runtime.Object { return &v1alpha1.KunRoute{} })
+}
+
+// KunCertificateClient KunCertificate客户端
+type KunCertificateClient struct {
+	resource resource
+}
+
+// Get 获取KunCertificate
+func (c *KunCertificateClient) Get(ctx context.Context, name string) (*v1alpha1.KunCertificate, error) {
+	out := &v1alpha1.KunCertificate{}
+	return out, c.resource.get(ctx, name, out)
+}
+
+// List 列出KunCertificate
+func (c *KunCertificateClient) List(ctx context.Context, options metav1.ListOptions) (*v1alpha1.KunCertificateList, error) {
+	out := &v1alpha1.KunCertificateList{}
+	return out, c.resource.list(ctx, options, out)
+}
+
+// Create 创建KunCertificate
+func (c *KunCertificateClient) Create(ctx context.Context, certificate *v1alpha1.KunCertificate) (*v1alpha1.KunCertificate, error) {
+	out := &v1alpha1.KunCertificate{}
+	return out, c.resource.create(ctx, certificate, out)
+}
+
+// Update 更新KunCertificate，ResourceVersion不一致时返回冲突错误
+func (c *KunCertificateClient) Update(ctx context.Context, certificate *v1alpha1.KunCertificate) (*v1alpha1.KunCertificate, error) {
+	out := &v1alpha1.KunCertificate{}
+	return out, c.resource.update(ctx, certificate, out)
+}
+
+// UpdateStatus 更新KunCertificate的状态
+func (c *KunCertificateClient) UpdateStatus(ctx context.Context, certificate *v1alpha1.KunCertificate) (*v1alpha1.KunCertificate, error) {
+	out := &v1alpha1.KunCertificate{}
+	return out, c.resource.update(ctx, certificate, out, "status")
+}
+
+// Delete 删除KunCertificate
+func (c *KunCertificateClient) Delete(ctx context.Context, name string) error {
+	return c.resource.client.Delete(ctx, name, metav1.DeleteOptions{})
+}
+
+// Watch 监听KunCertificate变化，事件对象为 *v1alpha1.KunCertificate
+func (c *KunCertificateClient) Watch(ctx context.Context, options metav1.ListOptions) (watch.Interface, error) {
+	return c.resource.watch(ctx, options, func() runtime.Object { return &v1alpha1.KunCertificate{} })
+}
+
+// KunPolicyClient KunPolicy客户端
+type KunPolicyClient struct {
+	resource resource
+}
+
+// Get 获取KunPolicy
+func (c *KunPolicyClient) Get(ctx context.Context, name string) (*v1alpha1.KunPolicy, error) {
+	out := &v1alpha1.KunPolicy{}
+	return out, c.resource.get(ctx, name, out)
+}
+
+// List 列出KunPolicy
+func (c *KunPolicyClient) List(ctx context.Context, options metav1.ListOptions) (*v1alpha1.KunPolicyList, error) {
+	out := &v1alpha1.KunPolicyList{}
+	return out, c.resource.list(ctx, options, out)
+}
+
+// Create 创建KunPolicy
+func (c *KunPolicyClient) Create(ctx context.Context, policy *v1alpha1.KunPolicy) (*v1alpha1.KunPolicy, error) {
+	out := &v1alpha1.KunPolicy{}
+	return out, c.resource.create(ctx, policy, out)
+}
+
+// Update 更新KunPolicy，ResourceVersion不一致时返回冲突错误
+func (c *KunPolicyClient) Update(ctx context.Context, policy *v1alpha1.KunPolicy) (*v1alpha1.KunPolicy, error) {
+	out := &v1alpha1.KunPolicy{}
+	return out, c.resource.update(ctx, policy, out)
+}
+
+// UpdateStatus 更新KunPolicy的状态
+func (c *KunPolicyClient) UpdateStatus(ctx context.Context, policy *v1alpha1.KunPolicy) (*v1alpha1.KunPolicy, error) {
+	out := &v1alpha1.KunPolicy{}
+	return out, c.resource.update(ctx, policy, out, "status")
+}
+
+// Delete 删除KunPolicy
+func (c *KunPolicyClient) Delete(ctx context.Context, name string) error {
+	return c.resource.client.Delete(ctx, name, metav1.DeleteOptions{})
+}
+
+// Watch 监听KunPolicy变化，事件对象为 *v1alpha1.KunPolicy
+func (c *KunPolicyClient) Watch(ctx context.Context, options metav1.ListOptions) (watch.Interface, error) {
+	return c.resource.watch(ctx, options, func() runtime.Object { return &v1alpha1.KunPolicy{} })
+}
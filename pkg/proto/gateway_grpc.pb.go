@@ -0,0 +1,226 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             v4.24.4
+// source: gateway.proto
+
+package proto
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	DataPlaneService_UpdateRoutes_FullMethodName = "/proto.DataPlaneService/UpdateRoutes"
+	DataPlaneService_GetMetrics_FullMethodName   = "/proto.DataPlaneService/GetMetrics"
+	DataPlaneService_StreamConfig_FullMethodName = "/proto.DataPlaneService/StreamConfig"
+)
+
+// DataPlaneServiceClient is the client API for DataPlaneService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type DataPlaneServiceClient interface {
+	// 更新路由规则
+	UpdateRoutes(ctx context.Context, in *UpdateRoutesRequest, opts ...grpc.CallOption) (*UpdateRoutesResponse, error)
+	// 获取监控指标
+	GetMetrics(ctx context.Context, in *GetMetricsRequest, opts ...grpc.CallOption) (*GetMetricsResponse, error)
+	// 订阅配置，由控制面提供：数据面建立长连接并在第一条消息中携带节点信息，
+	// 控制面立即下发当前的全量配置，之后配置变化时推送全量或增量快照，
+	// 数据面对每个快照回复ACK（error_detail为空）或NACK
+	StreamConfig(ctx context.Context, opts ...grpc.CallOption) (DataPlaneService_StreamConfigClient, error)
+}
+
+type dataPlaneServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewDataPlaneServiceClient(cc grpc.ClientConnInterface) DataPlaneServiceClient {
+	return &dataPlaneServiceClient{cc}
+}
+
+func (c *dataPlaneServiceClient) UpdateRoutes(ctx context.Context, in *UpdateRoutesRequest, opts ...grpc.CallOption) (*UpdateRoutesResponse, error) {
+	out := new(UpdateRoutesResponse)
+	err := c.cc.Invoke(ctx, DataPlaneService_UpdateRoutes_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *dataPlaneServiceClient) GetMetrics(ctx context.Context, in *GetMetricsRequest, opts ...grpc.CallOption) (*GetMetricsResponse, error) {
+	out := new(GetMetricsResponse)
+	err := c.cc.Invoke(ctx, DataPlaneService_GetMetrics_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *dataPlaneServiceClient) StreamConfig(ctx context.Context, opts ...grpc.CallOption) (DataPlaneService_StreamConfigClient, error) {
+	stream, err := c.cc.NewStream(ctx, &DataPlaneService_ServiceDesc.Streams[0], DataPlaneService_StreamConfig_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &dataPlaneServiceStreamConfigClient{stream}
+	return x, nil
+}
+
+type DataPlaneService_StreamConfigClient interface {
+	Send(*ConfigRequest) error
+	Recv() (*ConfigSnapshot, error)
+	grpc.ClientStream
+}
+
+type dataPlaneServiceStreamConfigClient struct {
+	grpc.ClientStream
+}
+
+func (x *dataPlaneServiceStreamConfigClient) Send(m *ConfigRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *dataPlaneServiceStreamConfigClient) Recv() (*ConfigSnapshot, error) {
+	m := new(ConfigSnapshot)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// DataPlaneServiceServer is the server API for DataPlaneService service.
+// All implementations must embed UnimplementedDataPlaneServiceServer
+// for forward compatibility
+type DataPlaneServiceServer interface {
+	// 更新路由规则
+	UpdateRoutes(context.Context, *UpdateRoutesRequest) (*UpdateRoutesResponse, error)
+	// 获取监控指标
+	GetMetrics(context.Context, *GetMetricsRequest) (*GetMetricsResponse, error)
+	// 订阅配置，由控制面提供：数据面建立长连接并在第一条消息中携带节点信息，
+	// 控制面立即下发当前的全量配置，之后配置变化时推送全量或增量快照，
+	// 数据面对每个快照回复ACK（error_detail为空）或NACK
+	StreamConfig(DataPlaneService_StreamConfigServer) error
+	mustEmbedUnimplementedDataPlaneServiceServer()
+}
+
+// UnimplementedDataPlaneServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedDataPlaneServiceServer struct {
+}
+
+func (UnimplementedDataPlaneServiceServer) UpdateRoutes(context.Context, *UpdateRoutesRequest) (*UpdateRoutesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateRoutes not implemented")
+}
+func (UnimplementedDataPlaneServiceServer) GetMetrics(context.Context, *GetMetricsRequest) (*GetMetricsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetMetrics not implemented")
+}
+func (UnimplementedDataPlaneServiceServer) StreamConfig(DataPlaneService_StreamConfigServer) error {
+	return status.Errorf(codes.Unimplemented, "method StreamConfig not implemented")
+}
+func (UnimplementedDataPlaneServiceServer) mustEmbedUnimplementedDataPlaneServiceServer() {}
+
+// UnsafeDataPlaneServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to DataPlaneServiceServer will
+// result in compilation errors.
+type UnsafeDataPlaneServiceServer interface {
+	mustEmbedUnimplementedDataPlaneServiceServer()
+}
+
+func RegisterDataPlaneServiceServer(s grpc.ServiceRegistrar, srv DataPlaneServiceServer) {
+	s.RegisterService(&DataPlaneService_ServiceDesc, srv)
+}
+
+func _DataPlaneService_UpdateRoutes_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateRoutesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DataPlaneServiceServer).UpdateRoutes(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DataPlaneService_UpdateRoutes_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DataPlaneServiceServer).UpdateRoutes(ctx, req.(*UpdateRoutesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DataPlaneService_GetMetrics_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetMetricsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DataPlaneServiceServer).GetMetrics(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DataPlaneService_GetMetrics_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DataPlaneServiceServer).GetMetrics(ctx, req.(*GetMetricsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DataPlaneService_StreamConfig_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(DataPlaneServiceServer).StreamConfig(&dataPlaneServiceStreamConfigServer{stream})
+}
+
+type DataPlaneService_StreamConfigServer interface {
+	Send(*ConfigSnapshot) error
+	Recv() (*ConfigRequest, error)
+	grpc.ServerStream
+}
+
+type dataPlaneServiceStreamConfigServer struct {
+	grpc.ServerStream
+}
+
+func (x *dataPlaneServiceStreamConfigServer) Send(m *ConfigSnapshot) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *dataPlaneServiceStreamConfigServer) Recv() (*ConfigRequest, error) {
+	m := new(ConfigRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// DataPlaneService_ServiceDesc is the grpc.ServiceDesc for DataPlaneService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var DataPlaneService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "proto.DataPlaneService",
+	HandlerType: (*DataPlaneServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "UpdateRoutes",
+			Handler:    _DataPlaneService_UpdateRoutes_Handler,
+		},
+		{
+			MethodName: "GetMetrics",
+			Handler:    _DataPlaneService_GetMetrics_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamConfig",
+			Handler:       _DataPlaneService_StreamConfig_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "gateway.proto",
+}
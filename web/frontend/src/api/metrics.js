@@ -104,3 +104,60 @@ export const healthCheck = async () => {
     return false;
   }
 };
+
+// 获取数据面实例的同步状态
+export const getDataPlanes = async () => {
+  try {
+    const response = await api.get("/api/v1/dataplanes");
+    return response.fleet || {};
+  } catch (error) {
+    console.error("获取数据面同步状态失败:", error);
+    return {};
+  }
+};
+
+// 获取历史配置版本
+export const getConfigVersions = async () => {
+  try {
+    const response = await api.get("/api/v1/config/versions");
+    return response.versions || [];
+  } catch (error) {
+    console.error("获取配置版本失败:", error);
+    return [];
+  }
+};
+
+// 比较配置版本，不指定from时与上一个版本比较
+export const getConfigDiff = async (generation, from) => {
+  try {
+    const response = await api.get(`/api/v1/config/versions/${generation}/diff`, {
+      params: from ? { from } : {},
+    });
+    return response.diff;
+  } catch (error) {
+    console.error("获取配置差异失败:", error);
+    throw error;
+  }
+};
+
+// 将所有数据面回滚到历史配置版本
+export const rollbackConfig = async (generation) => {
+  try {
+    const response = await api.post(`/api/v1/config/versions/${generation}/rollback`);
+    return response;
+  } catch (error) {
+    console.error("回滚配置失败:", error);
+    throw error;
+  }
+};
+
+// 解除回滚，下发最新的路由配置
+export const resumeConfig = async () => {
+  try {
+    const response = await api.post("/api/v1/config/resume");
+    return response;
+  } catch (error) {
+    console.error("解除回滚失败:", error);
+    throw error;
+  }
+};